@@ -0,0 +1,376 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/megamsys/libgo/errors"
+	"github.com/megamsys/vertice/carton"
+	"github.com/megamsys/vertice/provision"
+)
+
+const (
+	ActionQueued      = "queued"
+	ActionDone        = "done"
+	ActionFailed      = "failed"
+	ActionInterrupted = "interrupted"
+
+	// DefaultActionRetention is how long a finished action can be polled.
+	DefaultActionRetention = time.Hour
+)
+
+// Dispatcher runs a request through the same path as the requests received
+// from nsq, done is called with the result once it is processed.
+type Dispatcher interface {
+	Dispatch(r *carton.Requests, done func(error)) error
+}
+
+// Deployer runs the actions asked over http, nil when deployd isn't enabled.
+var Deployer Dispatcher
+
+// Actions are the actions asked over http, polled by their id.
+var Actions = NewActions(0)
+
+//assembliesOf, assemblyOf and assemblyOfRecord are replaced in tests.
+var (
+	assembliesOf     = carton.Get
+	assemblyOf       = carton.NewAssembly
+	assemblyOfRecord = recordAssembly
+)
+
+//recordAssembly is the assembly of the snapshot, disk or backup id of the category.
+func recordAssembly(category, id, email string) (string, error) {
+	switch category {
+	case carton.SNAPSHOT:
+		s, err := carton.GetSnap(id, email)
+		if err != nil {
+			return "", err
+		}
+		return s.AssemblyId, nil
+	case carton.DISKS:
+		d, err := carton.GetDisks(id, email)
+		if err != nil {
+			return "", err
+		}
+		return d.AssemblyId, nil
+	case carton.BACKUPS:
+		b, err := carton.GetBackup(id, email)
+		if err != nil {
+			return "", err
+		}
+		return b.AssemblyId, nil
+	}
+	return "", fmt.Errorf("%s has no records", category)
+}
+
+// ActionStatus is the progress of an action on the assemblies.
+type ActionStatus struct {
+	Id           string     `json:"id"`
+	AssembliesId string     `json:"assemblies_id"`
+	AccountId    string     `json:"account_id"`
+	CatId        string     `json:"cat_id"`
+	Category     string     `json:"category"`
+	Action       string     `json:"action"`
+	Status       string     `json:"status"`
+	Error        string     `json:"error,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	FinishedAt   *time.Time `json:"finished_at,omitempty"`
+}
+
+type actions struct {
+	mu        sync.Mutex
+	all       map[string]*ActionStatus
+	Retention time.Duration
+	file      string
+}
+
+// NewActions makes the actions, the default retention is used for zero.
+func NewActions(retention time.Duration) *actions {
+	if retention <= 0 {
+		retention = DefaultActionRetention
+	}
+	return &actions{all: make(map[string]*ActionStatus), Retention: retention}
+}
+
+// OpenActions makes the actions kept in the file, so they are polled after a
+// restart. The ones still queued when vertice stopped are interrupted, what
+// became of them isn't known.
+func OpenActions(retention time.Duration, file string) (*actions, error) {
+	a := NewActions(retention)
+	a.file = file
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return a, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	sts := make([]*ActionStatus, 0)
+	if err = json.Unmarshal(b, &sts); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for _, st := range sts {
+		if st.Status == ActionQueued {
+			st.Status, st.Error, st.FinishedAt = ActionInterrupted, "vertice stopped before the action finished", &now
+		}
+		a.all[st.Id] = st
+	}
+	return a, a.save()
+}
+
+//save writes the actions to the file when they are kept in one.
+func (a *actions) save() error {
+	if a.file == "" {
+		return nil
+	}
+	sts := make([]*ActionStatus, 0, len(a.all))
+	for _, st := range a.all {
+		sts = append(sts, st)
+	}
+	b, err := json.Marshal(sts)
+	if err != nil {
+		return err
+	}
+	tmp := a.file + ".tmp"
+	if err = ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, a.file)
+}
+
+// add tracks a queued action, the ones finished past the retention are dropped.
+func (a *actions) add(st *ActionStatus) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for id, o := range a.all {
+		if o.FinishedAt != nil && st.CreatedAt.Sub(*o.FinishedAt) > a.Retention {
+			delete(a.all, id)
+		}
+	}
+	a.all[st.Id] = st
+	if err := a.save(); err != nil {
+		log.Errorf("  actions not saved in %s : %s", a.file, err)
+	}
+}
+
+func (a *actions) finish(id string, err error, now time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	st, ok := a.all[id]
+	if !ok {
+		return
+	}
+	st.Status, st.FinishedAt = ActionDone, &now
+	if err != nil {
+		st.Status, st.Error = ActionFailed, err.Error()
+	}
+	if err := a.save(); err != nil {
+		log.Errorf("  actions not saved in %s : %s", a.file, err)
+	}
+}
+
+// Get is a copy of the action.
+func (a *actions) Get(id string) (ActionStatus, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	st, ok := a.all[id]
+	if !ok {
+		return ActionStatus{}, false
+	}
+	return *st, true
+}
+
+// Of are the actions on the assemblies, oldest first.
+func (a *actions) Of(asmsId string) []ActionStatus {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	sts := make([]ActionStatus, 0)
+	for _, st := range a.all {
+		if st.AssembliesId == asmsId {
+			sts = append(sts, *st)
+		}
+	}
+	sort.Slice(sts, func(i, j int) bool { return sts[i].CreatedAt.Before(sts[j].CreatedAt) })
+	return sts
+}
+
+// actionRequest is the body of POST /assemblies/{id}/actions. The cat_id is
+// the snapshot, disk or backup the action is on, the assemblies when empty.
+type actionRequest struct {
+	Category string `json:"category"`
+	Action   string `json:"action"`
+	CatId    string `json:"cat_id"`
+}
+
+// actionOn checks the action is on the assemblies: the cat_id is the
+// assemblies, a snapshot, disk or backup of one of its assemblies for the
+// actions on those. The other categories operate the assemblies as a whole,
+// deployd reads their cat_id as an assemblies id.
+func actionOn(asms *carton.Assemblies, ar actionRequest, email string) *errors.HTTP {
+	switch ar.Category {
+	case carton.SNAPSHOT, carton.DISKS, carton.BACKUPS:
+		id, err := assemblyOfRecord(ar.Category, ar.CatId, email)
+		if err != nil {
+			return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+		}
+		for _, a := range asms.AssemblysId {
+			if a == id {
+				return nil
+			}
+		}
+	default:
+		if ar.CatId == asms.Id {
+			return nil
+		}
+	}
+	return &errors.HTTP{Code: http.StatusNotFound, Message: fmt.Sprintf("%s isn't on the assemblies %s", ar.CatId, asms.Id)}
+}
+
+// assembliesAccount is the account of the token, an admin acts for the
+// account_id of the query.
+func assembliesAccount(r *http.Request) (string, *errors.HTTP) {
+	token, herr := requestToken(r)
+	if herr != nil {
+		return "", herr
+	}
+	email := token.GetUserName()
+	if a := r.URL.Query().Get("account_id"); a != "" {
+		email = a
+	}
+	if herr = tokenOwns(token, email); herr != nil {
+		return "", herr
+	}
+	return email, nil
+}
+
+// assemblyAction runs a category/action pair of carton.ReqParser on the
+// assemblies, as a request from nsq would. The id returned polls its progress.
+func assemblyAction(w http.ResponseWriter, r *http.Request) error {
+	asmsId := r.URL.Query().Get(":id")
+	email, herr := assembliesAccount(r)
+	if herr != nil {
+		return herr
+	}
+	var ar actionRequest
+	if err := json.NewDecoder(r.Body).Decode(&ar); err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: "invalid action : " + err.Error()}
+	}
+	if ar.Category == carton.BATCH {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: "a batch isn't run on an assemblies"}
+	}
+	if ar.CatId == "" {
+		ar.CatId = asmsId
+	}
+	if _, err := carton.NewReqParser(ar.CatId).ParseRequest(ar.Category, ar.Action); err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	if Deployer == nil {
+		return &errors.HTTP{Code: http.StatusServiceUnavailable, Message: "deployd isn't enabled"}
+	}
+	asms, err := assembliesOf(asmsId, email)
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	if herr = actionOn(asms, ar, email); herr != nil {
+		return herr
+	}
+	now := time.Now()
+	req := &carton.Requests{
+		Id:        Uid("RQS"),
+		AccountId: email,
+		CatId:     ar.CatId,
+		Category:  ar.Category,
+		Action:    ar.Action,
+		CreatedAt: now,
+	}
+	st := &ActionStatus{
+		Id:           req.Id,
+		AssembliesId: asmsId,
+		AccountId:    email,
+		CatId:        req.CatId,
+		Category:     req.Category,
+		Action:       req.Action,
+		Status:       ActionQueued,
+		CreatedAt:    now,
+	}
+	Actions.add(st)
+	err = Deployer.Dispatch(req, func(err error) {
+		if err != nil {
+			log.Errorf("  action %s %s.%s on %s : %s", req.Id, req.Category, req.Action, asmsId, err)
+		}
+		Actions.finish(req.Id, err, time.Now())
+	})
+	if err != nil {
+		Actions.finish(req.Id, err, time.Now())
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", fmt.Sprintf("/assemblies/%s/actions/%s", asmsId, req.Id))
+	w.WriteHeader(http.StatusAccepted)
+	return json.NewEncoder(w).Encode(st)
+}
+
+// assemblyActionStatus is the progress of an action asked over http.
+func assemblyActionStatus(w http.ResponseWriter, r *http.Request) error {
+	asmsId := r.URL.Query().Get(":id")
+	email, herr := assembliesAccount(r)
+	if herr != nil {
+		return herr
+	}
+	st, ok := Actions.Get(r.URL.Query().Get(":rid"))
+	if !ok || st.AssembliesId != asmsId || st.AccountId != email {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: fmt.Sprintf("no action %s on %s", r.URL.Query().Get(":rid"), asmsId)}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(st)
+}
+
+type assemblyState struct {
+	Id     string `json:"id"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	State  string `json:"state"`
+}
+
+// assemblyStatus is the status and state of every assembly of the
+// assemblies, with the actions asked on it over http and the operations
+// run on its boxes.
+func assemblyStatus(w http.ResponseWriter, r *http.Request) error {
+	asmsId := r.URL.Query().Get(":id")
+	email, herr := assembliesAccount(r)
+	if herr != nil {
+		return herr
+	}
+	asms, err := assembliesOf(asmsId, email)
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	states := make([]assemblyState, 0, len(asms.AssemblysId))
+	for _, id := range asms.AssemblysId {
+		a, err := assemblyOf(id, email, asms.OrgId)
+		if err != nil {
+			return err
+		}
+		states = append(states, assemblyState{Id: a.Id, Name: a.Name, Status: a.Status, State: a.State})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":         asms.Id,
+		"name":       asms.Name,
+		"assemblies": states,
+		"actions":    Actions.Of(asmsId),
+		"operations": provision.Operations.Of(asmsId),
+	})
+}
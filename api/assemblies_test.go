@@ -0,0 +1,189 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/megamsys/libgo/errors"
+	"github.com/megamsys/vertice/api/context"
+	"github.com/megamsys/vertice/carton"
+	"gopkg.in/check.v1"
+)
+
+type fakeDeployer struct {
+	reqs []*carton.Requests
+	done []func(error)
+}
+
+func (f *fakeDeployer) Dispatch(r *carton.Requests, done func(error)) error {
+	f.reqs = append(f.reqs, r)
+	f.done = append(f.done, done)
+	return nil
+}
+
+func (s *S) installAssemblies() (*fakeDeployer, func()) {
+	f := &fakeDeployer{}
+	dp, acts, asms, asm, rec := Deployer, Actions, assembliesOf, assemblyOf, assemblyOfRecord
+	Deployer, Actions = f, NewActions(0)
+	assembliesOf = func(id, email string) (*carton.Assemblies, error) {
+		if id != "AMS001" || email != "info@megam.io" {
+			return nil, fmt.Errorf("assemblies %s not found", id)
+		}
+		return &carton.Assemblies{Id: id, Name: "web", AssemblysId: []string{"ASM001"}}, nil
+	}
+	assemblyOf = func(id, email, org string) (*carton.Assembly, error) {
+		return &carton.Assembly{Id: id, Name: "web1", Status: "running", State: "running"}, nil
+	}
+	assemblyOfRecord = func(category, id, email string) (string, error) {
+		switch id {
+		case "SNP001":
+			return "ASM001", nil
+		case "SNP002":
+			return "ASM002", nil
+		}
+		return "", fmt.Errorf("%s %s not found", category, id)
+	}
+	return f, func() {
+		Deployer, Actions, assembliesOf, assemblyOf, assemblyOfRecord = dp, acts, asms, asm, rec
+	}
+}
+
+func actionRequestOf(path, body string) *http.Request {
+	return requestOf("POST", path, strings.NewReader(body))
+}
+
+//requestOf is a request as the handlers get it: the token of the path is the
+//one the middleware validated from the Authorization header.
+func requestOf(method, path string, body io.Reader) *http.Request {
+	r, _ := http.NewRequest(method, path, body)
+	q := r.URL.Query()
+	if t := q.Get("token"); t != "" {
+		if token, err := Auth(t); err == nil {
+			context.SetAuthToken(r, token)
+		}
+		q.Del("token")
+		r.URL.RawQuery = q.Encode()
+	}
+	return r
+}
+
+func (s *S) TestAssemblyAction(c *check.C) {
+	f, restore := s.installAssemblies()
+	defer restore()
+	r := actionRequestOf("/assemblies/AMS001/actions?:id=AMS001&token=info@megam.io:aaaa", `{"category":"control","action":"stop"}`)
+	w := httptest.NewRecorder()
+	c.Assert(assemblyAction(w, r), check.IsNil)
+	c.Assert(w.Code, check.Equals, http.StatusAccepted)
+	var st ActionStatus
+	c.Assert(json.NewDecoder(w.Body).Decode(&st), check.IsNil)
+	c.Assert(st.Status, check.Equals, ActionQueued)
+	c.Assert(w.Header().Get("Location"), check.Equals, "/assemblies/AMS001/actions/"+st.Id)
+	c.Assert(f.reqs, check.HasLen, 1)
+	c.Assert(f.reqs[0].Id, check.Equals, st.Id)
+	c.Assert(f.reqs[0].CatId, check.Equals, "AMS001")
+	c.Assert(f.reqs[0].Category, check.Equals, carton.CONTROL)
+	c.Assert(f.reqs[0].AccountId, check.Equals, "info@megam.io")
+
+	f.done[0](fmt.Errorf("vm is gone"))
+	r = requestOf("GET", "/assemblies/AMS001/actions/"+st.Id+"?:id=AMS001&:rid="+st.Id+"&token=info@megam.io:aaaa", nil)
+	w = httptest.NewRecorder()
+	c.Assert(assemblyActionStatus(w, r), check.IsNil)
+	c.Assert(json.NewDecoder(w.Body).Decode(&st), check.IsNil)
+	c.Assert(st.Status, check.Equals, ActionFailed)
+	c.Assert(st.Error, check.Equals, "vm is gone")
+	c.Assert(st.FinishedAt, check.NotNil)
+	r = requestOf("GET", "/assemblies/AMS002/actions/"+st.Id+"?:id=AMS002&:rid="+st.Id+"&token=info@megam.io:aaaa", nil)
+	c.Assert(assemblyActionStatus(httptest.NewRecorder(), r).(*errors.HTTP).Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *S) TestAssemblyActionRejected(c *check.C) {
+	f, restore := s.installAssemblies()
+	defer restore()
+	tests := []struct {
+		path, body string
+		code       int
+	}{
+		{"/assemblies/AMS001/actions?:id=AMS001", `{"category":"control","action":"stop"}`, http.StatusUnauthorized},
+		{"/assemblies/AMS001/actions?:id=AMS001&token=info@megam.io:aaaa&account_id=other@megam.io", `{"category":"control","action":"stop"}`, http.StatusForbidden},
+		{"/assemblies/AMS001/actions?:id=AMS001&token=info@megam.io:aaaa", `{"category":"control","action":"fly"}`, http.StatusBadRequest},
+		{"/assemblies/AMS001/actions?:id=AMS001&token=info@megam.io:aaaa", `{"category":"batch","action":"run"}`, http.StatusBadRequest},
+		{"/assemblies/AMS001/actions?:id=AMS001&token=info@megam.io:aaaa", `control.stop`, http.StatusBadRequest},
+		{"/assemblies/AMS002/actions?:id=AMS002&token=info@megam.io:aaaa", `{"category":"control","action":"stop"}`, http.StatusNotFound},
+		{"/assemblies/AMS001/actions?:id=AMS001&token=info@megam.io:aaaa", `{"category":"control","action":"stop","cat_id":"AMS002"}`, http.StatusNotFound},
+		{"/assemblies/AMS001/actions?:id=AMS001&token=info@megam.io:aaaa", `{"category":"control","action":"stop","cat_id":"ASM001"}`, http.StatusNotFound},
+		{"/assemblies/AMS001/actions?:id=AMS001&token=info@megam.io:aaaa", `{"category":"operations","action":"upgrade","cat_id":"ASM001"}`, http.StatusNotFound},
+		{"/assemblies/AMS001/actions?:id=AMS001&token=info@megam.io:aaaa", `{"category":"snapshot","action":"snapremove","cat_id":"SNP002"}`, http.StatusNotFound},
+		{"/assemblies/AMS001/actions?:id=AMS001&token=info@megam.io:aaaa", `{"category":"snapshot","action":"snapremove"}`, http.StatusNotFound},
+	}
+	for _, t := range tests {
+		err := assemblyAction(httptest.NewRecorder(), actionRequestOf(t.path, t.body))
+		c.Assert(err, check.NotNil, check.Commentf(t.path+" "+t.body))
+		c.Assert(err.(*errors.HTTP).Code, check.Equals, t.code, check.Commentf(t.path+" "+t.body))
+	}
+	c.Assert(f.reqs, check.HasLen, 0)
+	Deployer = nil
+	err := assemblyAction(httptest.NewRecorder(), actionRequestOf("/assemblies/AMS001/actions?:id=AMS001&token=info@megam.io:aaaa", `{"category":"control","action":"stop"}`))
+	c.Assert(err.(*errors.HTTP).Code, check.Equals, http.StatusServiceUnavailable)
+}
+
+func (s *S) TestAssemblyStatus(c *check.C) {
+	f, restore := s.installAssemblies()
+	defer restore()
+	r := actionRequestOf("/assemblies/AMS001/actions?:id=AMS001&token=info@megam.io:aaaa", `{"category":"snapshot","action":"snapcreate","cat_id":"SNP001"}`)
+	c.Assert(assemblyAction(httptest.NewRecorder(), r), check.IsNil)
+	f.done[0](nil)
+	r = requestOf("GET", "/assemblies/AMS001/status?:id=AMS001&token=info@megam.io:aaaa", nil)
+	w := httptest.NewRecorder()
+	c.Assert(assemblyStatus(w, r), check.IsNil)
+	var res struct {
+		Name       string          `json:"name"`
+		Assemblies []assemblyState `json:"assemblies"`
+		Actions    []ActionStatus  `json:"actions"`
+	}
+	c.Assert(json.NewDecoder(w.Body).Decode(&res), check.IsNil)
+	c.Assert(res.Name, check.Equals, "web")
+	c.Assert(res.Assemblies, check.DeepEquals, []assemblyState{{Id: "ASM001", Name: "web1", Status: "running", State: "running"}})
+	c.Assert(res.Actions, check.HasLen, 1)
+	c.Assert(res.Actions[0].CatId, check.Equals, "SNP001")
+	c.Assert(res.Actions[0].Status, check.Equals, ActionDone)
+}
+
+func (s *S) TestActionsRetention(c *check.C) {
+	a := NewActions(time.Minute)
+	now := time.Now()
+	a.add(&ActionStatus{Id: "RQS001", AssembliesId: "AMS001", CreatedAt: now})
+	a.finish("RQS001", nil, now)
+	a.add(&ActionStatus{Id: "RQS002", AssembliesId: "AMS001", CreatedAt: now.Add(time.Second)})
+	c.Assert(a.Of("AMS001"), check.HasLen, 2)
+	a.add(&ActionStatus{Id: "RQS003", AssembliesId: "AMS001", CreatedAt: now.Add(2 * time.Minute)})
+	_, ok := a.Get("RQS001")
+	c.Assert(ok, check.Equals, false)
+	_, ok = a.Get("RQS002")
+	c.Assert(ok, check.Equals, true)
+}
+
+func (s *S) TestActionsKeptInFile(c *check.C) {
+	file := filepath.Join(c.MkDir(), "actions", "actions.json")
+	a, err := OpenActions(time.Hour, file)
+	c.Assert(err, check.IsNil)
+	now := time.Now()
+	a.add(&ActionStatus{Id: "RQS001", AssembliesId: "AMS001", Status: ActionQueued, CreatedAt: now})
+	a.add(&ActionStatus{Id: "RQS002", AssembliesId: "AMS001", Status: ActionQueued, CreatedAt: now})
+	a.finish("RQS001", fmt.Errorf("vm is gone"), now)
+	a, err = OpenActions(time.Hour, file)
+	c.Assert(err, check.IsNil)
+	st, ok := a.Get("RQS001")
+	c.Assert(ok, check.Equals, true)
+	c.Assert(st.Status, check.Equals, ActionFailed)
+	c.Assert(st.Error, check.Equals, "vm is gone")
+	st, ok = a.Get("RQS002")
+	c.Assert(ok, check.Equals, true)
+	c.Assert(st.Status, check.Equals, ActionInterrupted)
+	c.Assert(st.FinishedAt, check.NotNil)
+}
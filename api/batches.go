@@ -0,0 +1,95 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/megamsys/libgo/errors"
+	"github.com/megamsys/vertice/carton"
+)
+
+// batchAdmin checks the token is of an admin, a batch selects the
+// assemblies of every account.
+func batchAdmin(r *http.Request) (string, *errors.HTTP) {
+	token, herr := requestToken(r)
+	if herr != nil {
+		return "", herr
+	}
+	if t, ok := token.(*Token); !ok || !t.Admin {
+		return "", &errors.HTTP{Code: http.StatusForbidden, Message: "batches are run by an admin, not by " + token.GetUserName()}
+	}
+	if carton.Batches == nil || Deployer == nil {
+		return "", &errors.HTTP{Code: http.StatusServiceUnavailable, Message: carton.ErrBatchDisabled.Error()}
+	}
+	return token.GetUserName(), nil
+}
+
+// batchCreate adds a batch and runs it with a (batch, run) request on its
+// id, the report is polled at /batches/{id}.
+func batchCreate(w http.ResponseWriter, r *http.Request) error {
+	email, herr := batchAdmin(r)
+	if herr != nil {
+		return herr
+	}
+	var b carton.Batch
+	if err := json.NewDecoder(r.Body).Decode(&b); err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: "invalid batch : " + err.Error()}
+	}
+	if b.Id == "" {
+		b.Id = Uid("BAT")
+	}
+	if err := b.Validate(); err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	old, err := carton.Batches.Get(b.Id)
+	switch {
+	case err == carton.ErrBatchNotFound:
+	case err != nil:
+		return err
+	case old.Status != carton.BatchPending:
+		return &errors.HTTP{Code: http.StatusConflict, Message: fmt.Sprintf("batch %s is %s", b.Id, old.Status)}
+	}
+	if err = carton.Batches.Put(&b); err != nil {
+		return err
+	}
+	req := &carton.Requests{
+		Id:        Uid("RQS"),
+		AccountId: email,
+		CatId:     b.Id,
+		Category:  carton.BATCH,
+		Action:    carton.RUN,
+		CreatedAt: time.Now(),
+	}
+	err = Deployer.Dispatch(req, func(err error) {
+		if err != nil {
+			log.Errorf("  batch %s : %s", b.Id, err)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/batches/"+b.Id)
+	w.WriteHeader(http.StatusAccepted)
+	return json.NewEncoder(w).Encode(b)
+}
+
+// batch is a batch with the result on every assembly it matched.
+func batch(w http.ResponseWriter, r *http.Request) error {
+	id := r.URL.Query().Get(":id")
+	if _, herr := batchAdmin(r); herr != nil {
+		return herr
+	}
+	b, err := carton.Batches.Get(id)
+	if err == carton.ErrBatchNotFound {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: fmt.Sprintf("no batch %s", id)}
+	}
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(b)
+}
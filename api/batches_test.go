@@ -0,0 +1,77 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/megamsys/libgo/errors"
+	"github.com/megamsys/vertice/api/context"
+	"github.com/megamsys/vertice/carton"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) installBatches(c *check.C) (*fakeDeployer, func()) {
+	f, restore := s.installAssemblies()
+	old := carton.Batches
+	st, err := carton.NewBatchStore(c.MkDir())
+	c.Assert(err, check.IsNil)
+	carton.Batches = st
+	return f, func() {
+		restore()
+		carton.Batches = old
+	}
+}
+
+func adminRequest(method, path, body string) *http.Request {
+	r, _ := http.NewRequest(method, path, strings.NewReader(body))
+	context.SetAuthToken(r, &Token{Token: "admin@megam.io:cccc", UserEmail: "admin@megam.io", Admin: true})
+	return r
+}
+
+func (s *S) TestBatchCreate(c *check.C) {
+	f, restore := s.installBatches(c)
+	defer restore()
+	r := adminRequest("POST", "/batches", `{"id":"BAT001","selector":{"tag":"web"},"category":"control","action":"stop"}`)
+	defer context.Clear(r)
+	w := httptest.NewRecorder()
+	c.Assert(batchCreate(w, r), check.IsNil)
+	c.Assert(w.Code, check.Equals, http.StatusAccepted)
+	c.Assert(w.Header().Get("Location"), check.Equals, "/batches/BAT001")
+	c.Assert(f.reqs, check.HasLen, 1)
+	c.Assert(f.reqs[0].CatId, check.Equals, "BAT001")
+	c.Assert(f.reqs[0].Category, check.Equals, carton.BATCH)
+	c.Assert(f.reqs[0].Action, check.Equals, carton.RUN)
+
+	g := adminRequest("GET", "/batches/BAT001?:id=BAT001", "")
+	defer context.Clear(g)
+	w = httptest.NewRecorder()
+	c.Assert(batch(w, g), check.IsNil)
+	var b carton.Batch
+	c.Assert(json.NewDecoder(w.Body).Decode(&b), check.IsNil)
+	c.Assert(b.Status, check.Equals, carton.BatchPending)
+	c.Assert(b.Selector.Tag, check.Equals, "web")
+	g404 := adminRequest("GET", "/batches/BAT002?:id=BAT002", "")
+	defer context.Clear(g404)
+	c.Assert(batch(httptest.NewRecorder(), g404).(*errors.HTTP).Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *S) TestBatchCreateRejected(c *check.C) {
+	f, restore := s.installBatches(c)
+	defer restore()
+	err := batchCreate(httptest.NewRecorder(), actionRequestOf("/batches?token=info@megam.io:aaaa", `{"category":"control","action":"stop"}`))
+	c.Assert(err.(*errors.HTTP).Code, check.Equals, http.StatusForbidden)
+	for _, body := range []string{`stop`, `{"category":"state","action":"bootstrapped"}`, `{"category":"control","action":"stop","mode":"sometimes"}`} {
+		r := adminRequest("POST", "/batches", body)
+		err = batchCreate(httptest.NewRecorder(), r)
+		context.Clear(r)
+		c.Assert(err.(*errors.HTTP).Code, check.Equals, http.StatusBadRequest, check.Commentf(body))
+	}
+	c.Assert(f.reqs, check.HasLen, 0)
+	carton.Batches = nil
+	r := adminRequest("POST", "/batches", `{"category":"control","action":"stop"}`)
+	defer context.Clear(r)
+	err = batchCreate(httptest.NewRecorder(), r)
+	c.Assert(err.(*errors.HTTP).Code, check.Equals, http.StatusServiceUnavailable)
+}
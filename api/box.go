@@ -1,27 +1,88 @@
 package api
 
 import (
-	//	"encoding/json"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
 	log "github.com/Sirupsen/logrus"
 	"github.com/googollee/go-socket.io"
 	"github.com/megamsys/libgo/cmd"
+	"github.com/megamsys/libgo/errors"
 	"github.com/megamsys/vertice/provision"
 )
 
+// logInit is what a client follows the logs of a box with. The name alone
+// follows the new logs, a cursor replays the stored ones after it first.
+type logInit struct {
+	Name   string  `json:"name"`
+	Cursor *uint64 `json:"cursor"`
+	Source string  `json:"source"`
+	Unit   string  `json:"unit"`
+}
+
+func parseLogInit(msg string) logInit {
+	li := logInit{Name: msg}
+	if strings.HasPrefix(strings.TrimSpace(msg), "{") {
+		if err := json.Unmarshal([]byte(msg), &li); err != nil {
+			log.Debugf("  logInit %s : %s", msg, err)
+		}
+	}
+	return li
+}
+
+// tail follows the logs from the cursor of the client, or from the last
+// stored log when it has none.
+func (li logInit) tail() *provision.LogTail {
+	q := provision.LogQuery{Source: li.Source, Unit: li.Unit}
+	if li.Cursor != nil {
+		q.After = *li.Cursor
+	} else if provision.Logs != nil {
+		q.After, _ = provision.Logs.Cursor(li.Name)
+	}
+	return provision.Logs.Tail(li.Name, q)
+}
+
 func logHandler(so socketio.Socket) {
 	so.On("logInit", func(msg string) {
+		li := parseLogInit(msg)
 		var entry provision.Box
-		entry.Name = msg
+		entry.Name = li.Name
 		l, _ := provision.NewLogListener(&entry)
+		tail := li.tail()
 		go func() {
 			so.On("logDisconnect", func(data string) {
 				l.Close()
 				log.Debugf(cmd.Colorfy("  > [nsqd] unsub   ", "blue", "", "bold") + fmt.Sprintf("Unsubscribing from the Queue"))
 			})
+			//the listener is on before the history is read, what is logged
+			//meanwhile arrives live and the tail drops what it handed out.
+			if li.Cursor != nil {
+				for {
+					logs, err := tail.History()
+					if err != nil {
+						log.Errorf("  logs of %s : %s", entry.Name, err)
+						break
+					}
+					if len(logs) == 0 {
+						break
+					}
+					for _, logbox := range logs {
+						so.Emit(entry.Name, logbox)
+					}
+				}
+			}
 			for logbox := range l.B {
-				//	logData, _ := json.Marshal(logbox)
-				so.Emit(entry.Name, logbox)
+				logs, err := tail.Live(logbox)
+				if err != nil {
+					log.Errorf("  logs of %s : %s", entry.Name, err)
+				}
+				for _, bl := range logs {
+					so.Emit(entry.Name, bl)
+				}
 			}
 		}()
 
@@ -33,6 +94,67 @@ func logHandler(so socketio.Socket) {
 
 }
 
+// logHistory returns the stored logs of a box to its owner, filtered by
+// the query: after (a cursor), since and until (RFC3339), source, unit and limit.
+// The cursor of the last log is where the next page starts.
+func logHistory(w http.ResponseWriter, r *http.Request) error {
+	name := r.URL.Query().Get(":name")
+	if provision.Logs == nil {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: "the logs of the boxes aren't kept"}
+	}
+	owner, err := provision.Logs.Owner(name)
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	if owner == "" {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: fmt.Sprintf("no logs of %s", name)}
+	}
+	if herr := tokenAuthorized(r, owner); herr != nil {
+		return herr
+	}
+	q, err := logQuery(r)
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	logs, err := provision.Logs.Query(name, q)
+	if err != nil {
+		return err
+	}
+	cursor := q.After
+	if len(logs) > 0 {
+		cursor = logs[len(logs)-1].Cursor
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(map[string]interface{}{"logs": logs, "cursor": cursor})
+}
+
+func logQuery(r *http.Request) (provision.LogQuery, error) {
+	v := r.URL.Query()
+	q := provision.LogQuery{Source: v.Get("source"), Unit: v.Get("unit")}
+	var err error
+	if a := v.Get("after"); a != "" {
+		if q.After, err = strconv.ParseUint(a, 10, 64); err != nil {
+			return q, fmt.Errorf("invalid after %q", a)
+		}
+	}
+	if l := v.Get("limit"); l != "" {
+		if q.Limit, err = strconv.Atoi(l); err != nil {
+			return q, fmt.Errorf("invalid limit %q", l)
+		}
+	}
+	if t := v.Get("since"); t != "" {
+		if q.Since, err = time.Parse(time.RFC3339, t); err != nil {
+			return q, fmt.Errorf("invalid since %q", t)
+		}
+	}
+	if t := v.Get("until"); t != "" {
+		if q.Until, err = time.Parse(time.RFC3339, t); err != nil {
+			return q, fmt.Errorf("invalid until %q", t)
+		}
+	}
+	return q, nil
+}
+
 /*import (
 	"encoding/json"
 	"fmt"
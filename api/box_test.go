@@ -1,10 +1,59 @@
 package api
 
 import (
-//"github.com/megamsys/vertice/config"
-//"gopkg.in/check.v1"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/megamsys/libgo/errors"
+	"github.com/megamsys/vertice/provision"
+	"gopkg.in/check.v1"
 )
 
+func (s *S) TestLogHistory(c *check.C) {
+	st, err := provision.NewLogStore(c.MkDir(), 0, 0)
+	c.Assert(err, check.IsNil)
+	old := provision.Logs
+	provision.Logs = st
+	defer func() { provision.Logs = old }()
+	logs := []provision.Boxlog{
+		{Message: "a", Source: "deploy", Unit: "u1"},
+		{Message: "b", Source: "shell", Unit: "u1"},
+		{Message: "c", Source: "deploy", Unit: "u1"},
+	}
+	c.Assert(st.Append("box1.megam.io", "info@megam.io", time.Now(), logs), check.IsNil)
+
+	r := requestOf("GET", "/logs/box1.megam.io/history?:name=box1.megam.io&token=info@megam.io:aaaa&after=1&source=deploy", nil)
+	w := httptest.NewRecorder()
+	c.Assert(logHistory(w, r), check.IsNil)
+	var res struct {
+		Logs   []provision.Boxlog `json:"logs"`
+		Cursor uint64             `json:"cursor"`
+	}
+	c.Assert(json.NewDecoder(w.Body).Decode(&res), check.IsNil)
+	c.Assert(res.Logs, check.HasLen, 1)
+	c.Assert(res.Logs[0].Message, check.Equals, "c")
+	c.Assert(res.Cursor, check.Equals, uint64(3))
+
+	r = requestOf("GET", "/logs/box1.megam.io/history?:name=box1.megam.io&token=info@megam.io:aaaa&since=yesterday", nil)
+	c.Assert(logHistory(httptest.NewRecorder(), r).(*errors.HTTP).Code, check.Equals, http.StatusBadRequest)
+	r = requestOf("GET", "/logs/box1.megam.io/history?:name=box1.megam.io&token=other@megam.io:aaaa", nil)
+	c.Assert(logHistory(httptest.NewRecorder(), r).(*errors.HTTP).Code, check.Equals, http.StatusForbidden)
+	r = requestOf("GET", "/logs/box2.megam.io/history?:name=box2.megam.io&token=info@megam.io:aaaa", nil)
+	c.Assert(logHistory(httptest.NewRecorder(), r).(*errors.HTTP).Code, check.Equals, http.StatusNotFound)
+}
+
+func (s *S) TestParseLogInit(c *check.C) {
+	li := parseLogInit("box1.megam.io")
+	c.Assert(li.Name, check.Equals, "box1.megam.io")
+	c.Assert(li.Cursor, check.IsNil)
+	li = parseLogInit(`{"name":"box1.megam.io","cursor":0,"unit":"u1"}`)
+	c.Assert(li.Name, check.Equals, "box1.megam.io")
+	c.Assert(*li.Cursor, check.Equals, uint64(0))
+	c.Assert(li.Unit, check.Equals, "u1")
+}
+
 /*
 func (s *S) TestAppLogShouldReturnNotFoundWhenAppDoesNotExist(c *check.C) {
 	request, err := http.NewRequest("GET", "/apps/unknown/log/?:app=unknown&lines=10", nil)
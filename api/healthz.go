@@ -0,0 +1,31 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/megamsys/vertice/hc"
+)
+
+// healthz is the status, latency and last error of every backend as of
+// their last checks, with the readiness of vertice.
+func healthz(w http.ResponseWriter, r *http.Request) error {
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(hc.Health.Report())
+}
+
+// healthzReady fails with 503 while a required backend is down.
+func healthzReady(w http.ResponseWriter, r *http.Request) error {
+	report := hc.Health.Report()
+	down := make([]string, 0)
+	for _, c := range report.Components {
+		if c.Required && c.Status != hc.ComponentUp {
+			down = append(down, c.Name)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if !report.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	return json.NewEncoder(w).Encode(map[string]interface{}{"ready": report.Ready, "down": down})
+}
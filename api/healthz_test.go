@@ -0,0 +1,40 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/megamsys/vertice/hc"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestHealthzReady(c *check.C) {
+	health := hc.Health
+	defer func() { hc.Health = health }()
+	hc.Health = hc.NewComponents(0)
+	hc.Health.Register("gateway", "gateway", func() error { return nil })
+	hc.Health.Register("nsq:localhost:4150", "nsq", func() error { return fmt.Errorf("connection refused") })
+	hc.Health.Check()
+	r, _ := http.NewRequest("GET", "/healthz/ready", nil)
+	w := httptest.NewRecorder()
+	c.Assert(healthzReady(w, r), check.IsNil)
+	c.Assert(w.Code, check.Equals, http.StatusServiceUnavailable)
+	var res struct {
+		Ready bool     `json:"ready"`
+		Down  []string `json:"down"`
+	}
+	c.Assert(json.NewDecoder(w.Body).Decode(&res), check.IsNil)
+	c.Assert(res.Ready, check.Equals, false)
+	c.Assert(res.Down, check.DeepEquals, []string{"nsq:localhost:4150"})
+
+	w = httptest.NewRecorder()
+	c.Assert(healthz(w, r), check.IsNil)
+	c.Assert(w.Code, check.Equals, http.StatusOK)
+	var report hc.Report
+	c.Assert(json.NewDecoder(w.Body).Decode(&report), check.IsNil)
+	c.Assert(report.Status, check.Equals, hc.HealthDown)
+	c.Assert(report.Components, check.HasLen, 2)
+	c.Assert(report.Components[1].LastError, check.Equals, "connection refused")
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/codegangsta/negroni"
 	"github.com/googollee/go-socket.io"
 	"github.com/megamsys/libgo/cmd"
+	"github.com/megamsys/vertice/instrument"
 	"github.com/rs/cors"
 	"golang.org/x/net/websocket"
 	"net/http"
@@ -49,8 +50,26 @@ func NewNegHandler() *negroni.Negroni {
 	//m.Add("Get", "/logs", Handler(logs))
 	m.Add("Post", "/logs/", socketServer)
 	m.Add("Get", "/logs/", socketServer)
+	m.Add("Get", "/logs/{name}/history", Handler(logHistory))
 	m.Add("Get", "/ping", Handler(ping))
-	m.Add("Get", "/vnc/", Handler(vnc))
+	m.Add("Get", "/metrics", instrument.Default)
+	m.Add("Get", "/healthz", Handler(healthz))
+	m.Add("Get", "/healthz/ready", Handler(healthzReady))
+	m.Add("Post", "/console/{email}/{asmsid}/{id}", Handler(vnc))
+	m.Add("Get", "/vnc/{token}", websocket.Server{Handler: vncProxyHandler, Handshake: vncHandshake})
+	m.Add("Post", "/assemblies/{id}/actions", Handler(assemblyAction))
+	m.Add("Get", "/assemblies/{id}/actions/{rid}", Handler(assemblyActionStatus))
+	m.Add("Get", "/assemblies/{id}/status", Handler(assemblyStatus))
+	m.Add("Get", "/schedules", Handler(schedules))
+	m.Add("Post", "/schedules", Handler(scheduleCreate))
+	m.Add("Delete", "/schedules/{id}", Handler(scheduleDelete))
+	m.Add("Get", "/workflows", Handler(workflows))
+	m.Add("Post", "/workflows", Handler(workflowCreate))
+	m.Add("Get", "/workflows/{id}", Handler(workflow))
+	m.Add("Post", "/batches", Handler(batchCreate))
+	m.Add("Get", "/batches/{id}", Handler(batch))
+	m.Add("Get", "/operations/{id}", Handler(operation))
+	m.Add("Get", "/operations/{id}/watch", websocket.Handler(operationWatchHandler))
 
 	socketHandler(socketServer)
 
@@ -0,0 +1,58 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/megamsys/libgo/errors"
+	"github.com/megamsys/vertice/provision"
+	"golang.org/x/net/websocket"
+)
+
+// operation is the progress of the steps of an operation on a box.
+func operation(w http.ResponseWriter, r *http.Request) error {
+	id := r.URL.Query().Get(":id")
+	op, ok := provision.Operations.Get(id)
+	if !ok {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: fmt.Sprintf("no operation %s", id)}
+	}
+	if herr := tokenAuthorized(r, op.AccountId); herr != nil {
+		return herr
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(op)
+}
+
+// operationWatchHandler pushes the operation every time a step changes, the
+// websocket is closed once it finished.
+func operationWatchHandler(ws *websocket.Conn) {
+	defer ws.Close()
+	r := ws.Request()
+	id := r.URL.Query().Get(":id")
+	fail := func(msg string) {
+		websocket.JSON.Send(ws, map[string]string{"error": msg})
+	}
+	op, ok := provision.Operations.Get(id)
+	if !ok {
+		fail(fmt.Sprintf("no operation %s", id))
+		return
+	}
+	if herr := shellAuthorized(r, op.AccountId); herr != nil {
+		fail(herr.Message)
+		return
+	}
+	ch, stop, ok := provision.Operations.Watch(id)
+	if !ok {
+		fail(fmt.Sprintf("no operation %s", id))
+		return
+	}
+	defer stop()
+	for op := range ch {
+		if err := websocket.JSON.Send(ws, op); err != nil {
+			log.Debugf("  operation %s watch : %s", id, err)
+			return
+		}
+	}
+}
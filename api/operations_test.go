@@ -0,0 +1,41 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/megamsys/libgo/action"
+	"github.com/megamsys/libgo/errors"
+	"github.com/megamsys/vertice/provision"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestOperation(c *check.C) {
+	old := provision.Operations
+	provision.Operations = provision.NewOperationStore(0)
+	defer func() { provision.Operations = old }()
+	box := &provision.Box{CartonsId: "AMS001", AccountId: "info@megam.io"}
+	id, actions := provision.Operations.Track(box, "deploy", []*action.Action{{
+		Name: "create-machine",
+		Forward: func(ctx action.FWContext) (action.Result, error) {
+			return nil, nil
+		},
+	}})
+	c.Assert(action.NewPipeline(actions...).Execute("args"), check.IsNil)
+
+	r := requestOf("GET", "/operations/"+id+"?:id="+id+"&token=info@megam.io:aaaa", nil)
+	w := httptest.NewRecorder()
+	c.Assert(operation(w, r), check.IsNil)
+	var op provision.Operation
+	c.Assert(json.NewDecoder(w.Body).Decode(&op), check.IsNil)
+	c.Assert(op.Status, check.Equals, provision.OperationRunning)
+	c.Assert(op.Progress, check.Equals, 100)
+	c.Assert(op.Steps[0].Name, check.Equals, "create-machine")
+	c.Assert(op.Steps[0].Status, check.Equals, provision.StepDone)
+
+	r = requestOf("GET", "/operations/"+id+"?:id="+id+"&token=other@megam.io:aaaa", nil)
+	c.Assert(operation(httptest.NewRecorder(), r).(*errors.HTTP).Code, check.Equals, http.StatusForbidden)
+	r = requestOf("GET", "/operations/OPN000?:id=OPN000&token=info@megam.io:aaaa", nil)
+	c.Assert(operation(httptest.NewRecorder(), r).(*errors.HTTP).Code, check.Equals, http.StatusNotFound)
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/megamsys/libgo/errors"
+	"github.com/megamsys/vertice/carton"
+	"github.com/megamsys/vertice/subd/schedulerd"
+)
+
+// Schedules are the schedules run by schedulerd, nil when it isn't enabled.
+var Schedules *schedulerd.Store
+
+func schedulesEnabled() *errors.HTTP {
+	if Schedules == nil {
+		return &errors.HTTP{Code: http.StatusServiceUnavailable, Message: "schedulerd isn't enabled"}
+	}
+	return nil
+}
+
+// scheduleOwned checks the account owns what the schedule operates, the
+// assembly of a snapcreate or the assemblies of the others.
+func scheduleOwned(sc *schedulerd.Schedule, email string) *errors.HTTP {
+	var err error
+	if sc.Category == carton.SNAPSHOT {
+		_, err = assemblyOf(sc.CatId, email, "")
+	} else {
+		_, err = assembliesOf(sc.CatId, email)
+	}
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	return nil
+}
+
+// schedules are the schedules of the account.
+func schedules(w http.ResponseWriter, r *http.Request) error {
+	email, herr := assembliesAccount(r)
+	if herr != nil {
+		return herr
+	}
+	if herr = schedulesEnabled(); herr != nil {
+		return herr
+	}
+	all, err := Schedules.List()
+	if err != nil {
+		return err
+	}
+	scs := make([]*schedulerd.Schedule, 0)
+	for _, sc := range all {
+		if sc.AccountId == email {
+			scs = append(scs, sc)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(scs)
+}
+
+// scheduleCreate adds or replaces a schedule of the account, its next run is
+// worked out from the cron spec by schedulerd.
+func scheduleCreate(w http.ResponseWriter, r *http.Request) error {
+	email, herr := assembliesAccount(r)
+	if herr != nil {
+		return herr
+	}
+	var sc schedulerd.Schedule
+	if err := json.NewDecoder(r.Body).Decode(&sc); err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: "invalid schedule : " + err.Error()}
+	}
+	if sc.Category == carton.BATCH {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: "a batch isn't scheduled on an assembly"}
+	}
+	if sc.Id == "" {
+		sc.Id = Uid("SCH")
+	}
+	sc.AccountId = email
+	sc.NextRun, sc.LastRun, sc.LastResult, sc.LastError = time.Time{}, time.Time{}, "", ""
+	if err := sc.Validate(); err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	if herr = schedulesEnabled(); herr != nil {
+		return herr
+	}
+	if herr = scheduleOwned(&sc, email); herr != nil {
+		return herr
+	}
+	switch err := Schedules.Put(&sc); err {
+	case nil:
+	case schedulerd.ErrScheduleTaken:
+		return &errors.HTTP{Code: http.StatusConflict, Message: fmt.Sprintf("schedule %s is taken", sc.Id)}
+	default:
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/schedules/"+sc.Id)
+	w.WriteHeader(http.StatusCreated)
+	return json.NewEncoder(w).Encode(sc)
+}
+
+// scheduleDelete removes a schedule of the account.
+func scheduleDelete(w http.ResponseWriter, r *http.Request) error {
+	id := r.URL.Query().Get(":id")
+	email, herr := assembliesAccount(r)
+	if herr != nil {
+		return herr
+	}
+	if herr = schedulesEnabled(); herr != nil {
+		return herr
+	}
+	all, err := Schedules.List()
+	if err != nil {
+		return err
+	}
+	for _, sc := range all {
+		if sc.Id == id && sc.AccountId == email {
+			if err = Schedules.Delete(id); err != nil {
+				return err
+			}
+			w.WriteHeader(http.StatusNoContent)
+			return nil
+		}
+	}
+	return &errors.HTTP{Code: http.StatusNotFound, Message: fmt.Sprintf("no schedule %s", id)}
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+
+	"github.com/megamsys/libgo/errors"
+	"github.com/megamsys/vertice/subd/schedulerd"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) installSchedules(c *check.C) func() {
+	_, restore := s.installAssemblies()
+	old := Schedules
+	Schedules = schedulerd.NewStore(filepath.Join(c.MkDir(), "schedules.json"))
+	return func() {
+		restore()
+		Schedules = old
+	}
+}
+
+func (s *S) TestScheduleCreate(c *check.C) {
+	defer s.installSchedules(c)()
+	r := actionRequestOf("/schedules?token=info@megam.io:aaaa",
+		`{"id":"nightly-stop","cat_id":"AMS001","category":"control","action":"stop","cron":"0 2 * * *","enabled":true,"last_result":"success"}`)
+	w := httptest.NewRecorder()
+	c.Assert(scheduleCreate(w, r), check.IsNil)
+	c.Assert(w.Code, check.Equals, http.StatusCreated)
+	c.Assert(w.Header().Get("Location"), check.Equals, "/schedules/nightly-stop")
+
+	r = requestOf("GET", "/schedules?token=info@megam.io:aaaa", nil)
+	w = httptest.NewRecorder()
+	c.Assert(schedules(w, r), check.IsNil)
+	var scs []*schedulerd.Schedule
+	c.Assert(json.NewDecoder(w.Body).Decode(&scs), check.IsNil)
+	c.Assert(scs, check.HasLen, 1)
+	c.Assert(scs[0].AccountId, check.Equals, "info@megam.io")
+	c.Assert(scs[0].LastResult, check.Equals, "")
+
+	r = requestOf("GET", "/schedules?token=other@megam.io:aaaa", nil)
+	w = httptest.NewRecorder()
+	c.Assert(schedules(w, r), check.IsNil)
+	c.Assert(json.NewDecoder(w.Body).Decode(&scs), check.IsNil)
+	c.Assert(scs, check.HasLen, 0)
+
+	r = requestOf("DELETE", "/schedules/nightly-stop?:id=nightly-stop&token=other@megam.io:aaaa", nil)
+	c.Assert(scheduleDelete(httptest.NewRecorder(), r).(*errors.HTTP).Code, check.Equals, http.StatusNotFound)
+	r = requestOf("DELETE", "/schedules/nightly-stop?:id=nightly-stop&token=info@megam.io:aaaa", nil)
+	w = httptest.NewRecorder()
+	c.Assert(scheduleDelete(w, r), check.IsNil)
+	c.Assert(w.Code, check.Equals, http.StatusNoContent)
+	all, err := Schedules.List()
+	c.Assert(err, check.IsNil)
+	c.Assert(all, check.HasLen, 0)
+}
+
+func (s *S) TestScheduleCreateRejected(c *check.C) {
+	defer s.installSchedules(c)()
+	tests := []struct {
+		path, body string
+		code       int
+	}{
+		{"/schedules", `{"cat_id":"AMS001","category":"control","action":"stop","cron":"0 2 * * *"}`, http.StatusUnauthorized},
+		{"/schedules?token=info@megam.io:aaaa", `{"cat_id":"AMS001","category":"control","action":"stop","cron":"0 2 * *"}`, http.StatusBadRequest},
+		{"/schedules?token=info@megam.io:aaaa", `{"cat_id":"SNP001","category":"snapshot","action":"snapremove","cron":"0 2 * * *"}`, http.StatusBadRequest},
+		{"/schedules?token=info@megam.io:aaaa", `{"cat_id":"BAT001","category":"batch","action":"run","cron":"0 2 * * *"}`, http.StatusBadRequest},
+		{"/schedules?token=info@megam.io:aaaa", `{"cat_id":"AMS002","category":"control","action":"stop","cron":"0 2 * * *"}`, http.StatusNotFound},
+		{"/schedules?token=info@megam.io:aaaa", `{"id":"../../etc/nightly","cat_id":"AMS001","category":"control","action":"stop","cron":"0 2 * * *"}`, http.StatusBadRequest},
+	}
+	for _, t := range tests {
+		err := scheduleCreate(httptest.NewRecorder(), actionRequestOf(t.path, t.body))
+		c.Assert(err, check.NotNil, check.Commentf(t.path+" "+t.body))
+		c.Assert(err.(*errors.HTTP).Code, check.Equals, t.code, check.Commentf(t.path+" "+t.body))
+	}
+	Schedules = nil
+	err := scheduleCreate(httptest.NewRecorder(), actionRequestOf("/schedules?token=info@megam.io:aaaa", `{"cat_id":"AMS001","category":"control","action":"stop","cron":"0 2 * * *"}`))
+	c.Assert(err.(*errors.HTTP).Code, check.Equals, http.StatusServiceUnavailable)
+}
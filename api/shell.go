@@ -2,16 +2,23 @@ package api
 
 import (
 	"net/http"
-	//"strconv"
+	"strconv"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/megamsys/libgo/errors"
-	//"github.com/megamsys/vertice/api/context"
+	"github.com/megamsys/vertice/api/context"
+	"github.com/megamsys/vertice/auth"
 	"github.com/megamsys/vertice/carton"
 	"github.com/megamsys/vertice/provision"
 	"golang.org/x/net/websocket"
 )
 
+const (
+	defaultShellWidth  = 140
+	defaultShellHeight = 38
+	defaultShellTerm   = "xterm"
+)
+
 func remoteShellHandler(ws *websocket.Conn) {
 	var httpErr *errors.HTTP
 	defer func() {
@@ -28,25 +35,12 @@ func remoteShellHandler(ws *websocket.Conn) {
 		}
 	}()
 	r := ws.Request()
-	/*token := context.GetAuthToken(r)
-	if token == nil {
-		httpErr = &errors.HTTP{
-			Code:    http.StatusUnauthorized,
-			Message: "no token provided",
-		}
-		return
-	}*/
-	/*user, err := token.User()
-	if err != nil {
-		httpErr = &errors.HTTP{
-			Code:    http.StatusInternalServerError,
-			Message: err.Error(),
-		}
-		return
-	}*/
 	assembly_id := r.URL.Query().Get(":id") //send the assembly_id
 	asmsid := r.URL.Query().Get(":asmsid")
 	account_id := r.URL.Query().Get(":email")
+	if httpErr = shellAuthorized(r, account_id); httpErr != nil {
+		return
+	}
 	car, err := getBox(asmsid, assembly_id, account_id)
 	if err != nil {
 		if herr, ok := err.(*errors.HTTP); ok {
@@ -60,22 +54,27 @@ func remoteShellHandler(ws *websocket.Conn) {
 		return
 	}
 	boxId := r.URL.Query().Get(":id")
-	//width, _ := strconv.Atoi(r.URL.Query().Get("width"))
-	//height, _ := strconv.Atoi(r.URL.Query().Get("height"))
-	//term := r.URL.Query().Get("term")
-	width := 140
-	height := 38
-	term := "xterm"
-	log.Debugf("%s %s %s %s", boxId, width, height, term)
+	size, term := shellSize(r)
+	log.Debugf("%s %d %d %s", boxId, size.Width, size.Height, term)
+
+	var rec *castRecorder
+	if ShellRecordings != nil {
+		if rec, err = ShellRecordings.create(account_id, boxId, size, term); err != nil {
+			log.Errorf("  shell recording of %s : %s", boxId, err)
+		}
+	}
+	conn := newShellConn(ws, rec)
+	defer conn.done()
 
 	for _, box := range *car.Boxes {
 		opts := provision.ShellOptions{
 			Box:    &box,
-			Conn:   ws,
-			Width:  width,
-			Height: height,
+			Conn:   conn,
+			Width:  size.Width,
+			Height: size.Height,
 			Unit:   boxId,
 			Term:   term,
+			Resize: conn.resize,
 		}
 		err = carton.ProvisionerMap[box.Provider].Shell(opts) //BUG: we need get the provisioner of the correct provider
 		if err != nil {
@@ -87,6 +86,67 @@ func remoteShellHandler(ws *websocket.Conn) {
 	}
 }
 
+// shellAuthorized checks the token of a websocket (the shell, the watch of an
+// operation) owns the account. A browser can't set the headers of a
+// websocket, so only there the token may be in the query.
+func shellAuthorized(r *http.Request, email string) *errors.HTTP {
+	token := context.GetAuthToken(r)
+	if token == nil {
+		if t := r.URL.Query().Get("token"); t != "" {
+			token, _ = validate(t, r)
+		}
+	}
+	if token == nil {
+		return &errors.HTTP{Code: http.StatusUnauthorized, Message: "no token provided"}
+	}
+	return tokenOwns(token, email)
+}
+
+// tokenAuthorized checks the token of the request owns the account.
+func tokenAuthorized(r *http.Request, email string) *errors.HTTP {
+	token, herr := requestToken(r)
+	if herr != nil {
+		return herr
+	}
+	return tokenOwns(token, email)
+}
+
+// requestToken is the token the middleware validated from the Authorization header.
+func requestToken(r *http.Request) (auth.Token, *errors.HTTP) {
+	token := context.GetAuthToken(r)
+	if token == nil {
+		return nil, &errors.HTTP{Code: http.StatusUnauthorized, Message: "no token provided"}
+	}
+	return token, nil
+}
+
+func tokenOwns(token auth.Token, email string) *errors.HTTP {
+	owns := token.GetUserName() == email
+	if t, ok := token.(*Token); ok {
+		owns = t.Owns(email)
+	}
+	if !owns {
+		return &errors.HTTP{Code: http.StatusForbidden, Message: "the assembly isn't owned by " + token.GetUserName()}
+	}
+	return nil
+}
+
+// shellSize is the size and term the client asks for, the defaults fill in what is missing.
+func shellSize(r *http.Request) (provision.ShellSize, string) {
+	size := provision.ShellSize{Width: defaultShellWidth, Height: defaultShellHeight}
+	if w, err := strconv.Atoi(r.URL.Query().Get("width")); err == nil && w > 0 {
+		size.Width = w
+	}
+	if h, err := strconv.Atoi(r.URL.Query().Get("height")); err == nil && h > 0 {
+		size.Height = h
+	}
+	term := r.URL.Query().Get("term")
+	if term == "" {
+		term = defaultShellTerm
+	}
+	return size, term
+}
+
 //Return the Box object ?  Get the carton, and make a Box
 func getBox(asmsid string, id string, account_id string) (*carton.Carton, error) {
 	c, err := carton.NewCarton(asmsid, id, account_id)
@@ -0,0 +1,233 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/megamsys/vertice/provision"
+)
+
+const castExt = ".cast"
+
+// ShellRecordings is where the shell sessions are recorded, nil when they aren't.
+var ShellRecordings *Recordings
+
+// Recordings keeps the shell sessions as asciicast (v2) files in Dir, the
+// ones older than Retention are removed by Reap. A zero Retention keeps them.
+type Recordings struct {
+	Dir       string
+	Retention time.Duration
+}
+
+// create opens the recording of a session of the box.
+func (r *Recordings) create(email, boxId string, size provision.ShellSize, term string) (*castRecorder, error) {
+	dir := filepath.Join(r.Dir, email)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	f, err := os.OpenFile(filepath.Join(dir, boxId+"-"+strconv.FormatInt(now.UnixNano(), 10)+castExt), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return newCastRecorder(f, size, term, email+" "+boxId, now)
+}
+
+// Reap removes the recordings older than the retention, it returns how many were removed.
+func (r *Recordings) Reap(now time.Time) (int, error) {
+	if r.Retention <= 0 {
+		return 0, nil
+	}
+	removed := 0
+	err := filepath.Walk(r.Dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() || !strings.HasSuffix(path, castExt) || now.Sub(fi.ModTime()) < r.Retention {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		removed++
+		return nil
+	})
+	if os.IsNotExist(err) {
+		err = nil
+	}
+	return removed, err
+}
+
+// castRecorder writes an asciicast v2 stream: a header line and an event
+// line [seconds, code, data] for the output (o), the input (i) and the resizes (r).
+type castRecorder struct {
+	mu    sync.Mutex
+	w     io.WriteCloser
+	start time.Time
+}
+
+type castHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+func newCastRecorder(w io.WriteCloser, size provision.ShellSize, term, title string, start time.Time) (*castRecorder, error) {
+	h, err := json.Marshal(castHeader{
+		Version:   2,
+		Width:     size.Width,
+		Height:    size.Height,
+		Timestamp: start.Unix(),
+		Title:     title,
+		Env:       map[string]string{"TERM": term},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(append(h, '\n')); err != nil {
+		w.Close()
+		return nil, err
+	}
+	return &castRecorder{w: w, start: start}, nil
+}
+
+func (r *castRecorder) event(code, data string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.w == nil {
+		return
+	}
+	e, _ := json.Marshal([]interface{}{time.Since(r.start).Seconds(), code, data})
+	if _, err := r.w.Write(append(e, '\n')); err != nil {
+		log.Errorf("  shell recording : %s", err)
+	}
+}
+
+func (r *castRecorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	w := r.w
+	if w == nil {
+		return nil
+	}
+	r.w = nil
+	return w.Close()
+}
+
+// resizePrefix starts the xterm sequence a client resizes the terminal
+// with, ESC [ 8 ; rows ; cols t.
+var resizePrefix = []byte("\x1b[8;")
+
+// splitResizes takes the resize sequences out of the input of a shell.
+// A resize is sent by the client in a message of its own, so it is never
+// split across reads.
+func splitResizes(b []byte) ([]byte, []provision.ShellSize) {
+	var (
+		data  []byte
+		sizes []provision.ShellSize
+	)
+	for {
+		i := bytes.Index(b, resizePrefix)
+		if i < 0 {
+			return append(data, b...), sizes
+		}
+		data = append(data, b[:i]...)
+		rest := b[i+len(resizePrefix):]
+		j := bytes.IndexByte(rest, 't')
+		rows, cols := 0, 0
+		if j > 0 {
+			if rc := strings.Split(string(rest[:j]), ";"); len(rc) == 2 {
+				rows, _ = strconv.Atoi(rc[0])
+				cols, _ = strconv.Atoi(rc[1])
+			}
+		}
+		if rows <= 0 || cols <= 0 {
+			//not a resize, it goes to the shell as it is.
+			data = append(data, resizePrefix...)
+			b = rest
+			continue
+		}
+		sizes = append(sizes, provision.ShellSize{Width: cols, Height: rows})
+		b = rest[j+1:]
+	}
+}
+
+// shellConn is the websocket of a shell, it hands the resizes of the client
+// to the provisioner and records the session when a recorder is set.
+type shellConn struct {
+	io.ReadWriteCloser
+	resize chan provision.ShellSize
+	rec    *castRecorder
+	buf    []byte
+	data   []byte
+}
+
+func newShellConn(c io.ReadWriteCloser, rec *castRecorder) *shellConn {
+	return &shellConn{
+		ReadWriteCloser: c,
+		resize:          make(chan provision.ShellSize, 8),
+		rec:             rec,
+		buf:             make([]byte, 32*1024),
+	}
+}
+
+func (c *shellConn) Read(p []byte) (int, error) {
+	for len(c.data) == 0 {
+		n, err := c.ReadWriteCloser.Read(c.buf)
+		if n > 0 {
+			var sizes []provision.ShellSize
+			c.data, sizes = splitResizes(c.buf[:n])
+			for _, s := range sizes {
+				if c.rec != nil {
+					c.rec.event("r", fmt.Sprintf("%dx%d", s.Width, s.Height))
+				}
+				select {
+				case c.resize <- s:
+				default:
+					log.Debugf("  shell resize %dx%d dropped", s.Width, s.Height)
+				}
+			}
+			if c.rec != nil && len(c.data) > 0 {
+				c.rec.event("i", string(c.data))
+			}
+		}
+		if err != nil {
+			if len(c.data) > 0 {
+				break
+			}
+			return 0, err
+		}
+	}
+	n := copy(p, c.data)
+	c.data = c.data[n:]
+	return n, nil
+}
+
+func (c *shellConn) Write(p []byte) (int, error) {
+	if c.rec != nil {
+		c.rec.event("o", string(p))
+	}
+	return c.ReadWriteCloser.Write(p)
+}
+
+// done closes the recording once the shell ended. The resizes aren't
+// closed, the input may still be read by the provisioner.
+func (c *shellConn) done() {
+	if c.rec != nil {
+		if err := c.rec.Close(); err != nil {
+			log.Errorf("  shell recording : %s", err)
+		}
+	}
+}
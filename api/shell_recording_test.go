@@ -0,0 +1,89 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/megamsys/vertice/provision"
+	"gopkg.in/check.v1"
+)
+
+type bufConn struct {
+	in  *strings.Reader
+	out bytes.Buffer
+}
+
+func (b *bufConn) Read(p []byte) (int, error)  { return b.in.Read(p) }
+func (b *bufConn) Write(p []byte) (int, error) { return b.out.Write(p) }
+func (b *bufConn) Close() error                { return nil }
+
+type nopCloser struct{ *bytes.Buffer }
+
+func (nopCloser) Close() error { return nil }
+
+func (s *S) TestSplitResizes(c *check.C) {
+	data, sizes := splitResizes([]byte("ls\x1b[8;40;120tpwd\x1b[8;50;200t"))
+	c.Assert(string(data), check.Equals, "lspwd")
+	c.Assert(sizes, check.DeepEquals, []provision.ShellSize{{Width: 120, Height: 40}, {Width: 200, Height: 50}})
+	data, sizes = splitResizes([]byte("\x1b[8;4x;1t\x1b"))
+	c.Assert(string(data), check.Equals, "\x1b[8;4x;1t\x1b")
+	c.Assert(sizes, check.HasLen, 0)
+	data, _ = splitResizes([]byte("\x1b[A"))
+	c.Assert(string(data), check.Equals, "\x1b[A")
+}
+
+func (s *S) TestShellConnRecords(c *check.C) {
+	var cast bytes.Buffer
+	rec, err := newCastRecorder(nopCloser{&cast}, provision.ShellSize{Width: 80, Height: 24}, "xterm", "info@megam.io web1", time.Now())
+	c.Assert(err, check.IsNil)
+	ws := &bufConn{in: strings.NewReader("\x1b[8;30;100tls\n")}
+	conn := newShellConn(ws, rec)
+	in, err := ioutil.ReadAll(conn)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(in), check.Equals, "ls\n")
+	c.Assert(<-conn.resize, check.Equals, provision.ShellSize{Width: 100, Height: 30})
+	conn.Write([]byte("file1\n"))
+	c.Assert(ws.out.String(), check.Equals, "file1\n")
+	conn.done()
+	conn.Write([]byte("late"))
+
+	lines := strings.Split(strings.TrimSpace(cast.String()), "\n")
+	c.Assert(lines, check.HasLen, 4)
+	var h castHeader
+	c.Assert(json.Unmarshal([]byte(lines[0]), &h), check.IsNil)
+	c.Assert(h.Version, check.Equals, 2)
+	c.Assert(h.Width, check.Equals, 80)
+	c.Assert(h.Env["TERM"], check.Equals, "xterm")
+	codes := []string{}
+	for _, l := range lines[1:] {
+		var e []interface{}
+		c.Assert(json.Unmarshal([]byte(l), &e), check.IsNil)
+		codes = append(codes, e[1].(string)+":"+e[2].(string))
+	}
+	c.Assert(codes, check.DeepEquals, []string{"r:100x30", "i:ls\n", "o:file1\n"})
+}
+
+func (s *S) TestRecordingsReap(c *check.C) {
+	dir := c.MkDir()
+	r := &Recordings{Dir: dir, Retention: 24 * time.Hour}
+	rec, err := r.create("info@megam.io", "ASM001", provision.ShellSize{Width: 80, Height: 24}, "xterm")
+	c.Assert(err, check.IsNil)
+	c.Assert(rec.Close(), check.IsNil)
+	old := filepath.Join(dir, "info@megam.io", "ASM001-1"+castExt)
+	c.Assert(ioutil.WriteFile(old, []byte("{}\n"), 0600), check.IsNil)
+	past := time.Now().Add(-48 * time.Hour)
+	c.Assert(os.Chtimes(old, past, past), check.IsNil)
+	n, err := r.Reap(time.Now())
+	c.Assert(err, check.IsNil)
+	c.Assert(n, check.Equals, 1)
+	files, _ := filepath.Glob(filepath.Join(dir, "info@megam.io", "*"+castExt))
+	c.Assert(files, check.HasLen, 1)
+	n, err = (&Recordings{Dir: filepath.Join(dir, "none"), Retention: time.Hour}).Reap(time.Now())
+	c.Assert(err, check.IsNil)
+	c.Assert(n, check.Equals, 0)
+}
@@ -3,6 +3,7 @@ package api
 import (
 	"testing"
 
+	"github.com/megamsys/vertice/carton"
 	"gopkg.in/check.v1"
 )
 
@@ -20,12 +21,15 @@ func resetHandlers() {
 
 func (s *S) SetUpSuite(c *check.C) {
 	s.token = getTok()
+	accountOf = func(email string) (*carton.Account, error) {
+		return &carton.Account{Email: email, ApiKey: "aaaa"}, nil
+	}
 	c.Assert(s.token.GetUserName(), check.Equals, "info@megam.io")
 }
 
 func getTok() Token {
 	t := Token{}
-	t.Token = "aaaa"
+	t.Token = "info@megam.io:aaaa"
 	t.UserEmail = "info@megam.io"
 	return t
 }
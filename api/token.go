@@ -1,10 +1,18 @@
 package api
 
-import "github.com/megamsys/vertice/auth"
+import (
+	"crypto/subtle"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/megamsys/vertice/auth"
+	"github.com/megamsys/vertice/carton"
+)
 
 type Token struct {
 	Token     string
 	UserEmail string
+	Admin     bool
 }
 
 func (t *Token) GetValue() string {
@@ -19,10 +27,34 @@ func (t *Token) GetUserName() string {
 	return t.UserEmail
 }
 
+// Owns is true when the account email is the one of the token, an admin owns every account.
+func (t *Token) Owns(email string) bool {
+	return t.Admin || t.UserEmail == email
+}
+
+//accountOf reads the account a token is checked with, replaced in tests.
+var accountOf = carton.NewAccounts
+
+// Auth checks a token made of the email and the api key of an account
+// 'email:api_key', a type before it is dropped ('bearer email:api_key').
+// An account that can't be read is an invalid token, not a failure of the request.
 func Auth(t string) (auth.Token, error) {
-	tt := Token{
-		Token:     "aaaa",
-		UserEmail: "info@megam.io",
+	value, err := auth.ParseToken(t)
+	if err != nil {
+		return nil, err
+	}
+	i := strings.LastIndex(value, ":")
+	if i <= 0 || i == len(value)-1 {
+		return nil, auth.ErrInvalidToken
+	}
+	email, key := value[:i], value[i+1:]
+	act, err := accountOf(email)
+	if err != nil {
+		log.Debugf("  token of %s : %s", email, err)
+		return nil, auth.ErrInvalidToken
+	}
+	if act == nil || subtle.ConstantTimeCompare([]byte(act.ApiKey), []byte(key)) != 1 {
+		return nil, auth.ErrInvalidToken
 	}
-	return &tt, nil
+	return &Token{Token: value, UserEmail: email, Admin: act.IsAdmin()}, nil
 }
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/megamsys/vertice/api/context"
+	"github.com/megamsys/vertice/auth"
+	"github.com/megamsys/vertice/carton"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestAuth(c *check.C) {
+	t, err := Auth("bearer info@megam.io:aaaa")
+	c.Assert(err, check.IsNil)
+	c.Assert(t.GetUserName(), check.Equals, "info@megam.io")
+	c.Assert(t.(*Token).Owns("info@megam.io"), check.Equals, true)
+	c.Assert(t.(*Token).Owns("other@megam.io"), check.Equals, false)
+	_, err = Auth("bearer info@megam.io:bbbb")
+	c.Assert(err, check.Equals, auth.ErrInvalidToken)
+	_, err = Auth("aaaa")
+	c.Assert(err, check.Equals, auth.ErrInvalidToken)
+	_, err = Auth("info@megam.io:")
+	c.Assert(err, check.Equals, auth.ErrInvalidToken)
+}
+
+func (s *S) TestAuthAccountNotRead(c *check.C) {
+	defer func(a func(string) (*carton.Account, error)) { accountOf = a }(accountOf)
+	accountOf = func(email string) (*carton.Account, error) {
+		return nil, errors.New("gateway is down")
+	}
+	_, err := Auth("bearer info@megam.io:aaaa")
+	c.Assert(err, check.Equals, auth.ErrInvalidToken)
+	r, _ := http.NewRequest("GET", "/ping", nil)
+	r.Header.Set("Authorization", "bearer info@megam.io:aaaa")
+	called := false
+	authTokenMiddleware(httptest.NewRecorder(), r, func(http.ResponseWriter, *http.Request) { called = true })
+	defer context.Clear(r)
+	c.Assert(called, check.Equals, true)
+	c.Assert(context.GetRequestError(r), check.IsNil)
+	c.Assert(context.GetAuthToken(r), check.IsNil)
+}
+
+func (s *S) TestTokenAuthorizedNotFromQuery(c *check.C) {
+	r, _ := http.NewRequest("GET", "/operations/OPN001?token=info@megam.io:aaaa", nil)
+	c.Assert(tokenAuthorized(r, "info@megam.io").Code, check.Equals, http.StatusUnauthorized)
+	r.Header.Set("Authorization", "bearer info@megam.io:aaaa")
+	authTokenMiddleware(httptest.NewRecorder(), r, func(http.ResponseWriter, *http.Request) {})
+	defer context.Clear(r)
+	c.Assert(tokenAuthorized(r, "info@megam.io"), check.IsNil)
+}
+
+func (s *S) TestShellAuthorized(c *check.C) {
+	r, _ := http.NewRequest("GET", "/shell/info@megam.io/AMS001/ASM001", nil)
+	c.Assert(shellAuthorized(r, "info@megam.io").Code, check.Equals, http.StatusUnauthorized)
+	r, _ = http.NewRequest("GET", "/shell/info@megam.io/AMS001/ASM001?token=info@megam.io:aaaa", nil)
+	c.Assert(shellAuthorized(r, "info@megam.io"), check.IsNil)
+	c.Assert(shellAuthorized(r, "other@megam.io").Code, check.Equals, http.StatusForbidden)
+	r, _ = http.NewRequest("GET", "/shell/other@megam.io/AMS001/ASM001", nil)
+	context.SetAuthToken(r, &Token{Token: "admin@megam.io:cccc", UserEmail: "admin@megam.io", Admin: true})
+	defer context.Clear(r)
+	c.Assert(shellAuthorized(r, "other@megam.io"), check.IsNil)
+}
+
+func (s *S) TestShellSize(c *check.C) {
+	r, _ := http.NewRequest("GET", "/shell/a/b/c", nil)
+	size, term := shellSize(r)
+	c.Assert(size.Width, check.Equals, defaultShellWidth)
+	c.Assert(size.Height, check.Equals, defaultShellHeight)
+	c.Assert(term, check.Equals, defaultShellTerm)
+	r, _ = http.NewRequest("GET", "/shell/a/b/c?width=200&height=50&term=xterm-256color", nil)
+	size, term = shellSize(r)
+	c.Assert(size.Width, check.Equals, 200)
+	c.Assert(size.Height, check.Equals, 50)
+	c.Assert(term, check.Equals, "xterm-256color")
+}
@@ -1,12 +1,192 @@
 package api
 
 import (
-	//"encoding/json"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/megamsys/libgo/errors"
+	"github.com/megamsys/vertice/carton"
+	"github.com/megamsys/vertice/govnc"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	DefaultConsoleTokenTTL   = time.Minute
+	DefaultConsoleIdle       = 15 * time.Minute
+	DefaultConsoleMaxViewers = 2
 )
 
+// Consoles are the consoles of the vms: the tokens a console is opened with,
+// and the viewers connected to each vm.
+var Consoles = NewConsoles(0, 0, 0)
+
+// ConsoleTicket is a console token, it opens one console of the assembly
+// before it expires.
+type ConsoleTicket struct {
+	Token        string    `json:"token"`
+	AccountId    string    `json:"-"`
+	AssembliesId string    `json:"-"`
+	AssemblyId   string    `json:"-"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	Url          string    `json:"url"`
+}
+
+type consoles struct {
+	mu         sync.Mutex
+	tickets    map[string]*ConsoleTicket
+	viewers    map[string]int
+	TokenTTL   time.Duration
+	Idle       time.Duration
+	MaxViewers int
+}
+
+// NewConsoles makes the consoles, the defaults are used for the zero values.
+func NewConsoles(ttl, idle time.Duration, maxViewers int) *consoles {
+	if ttl <= 0 {
+		ttl = DefaultConsoleTokenTTL
+	}
+	if idle <= 0 {
+		idle = DefaultConsoleIdle
+	}
+	if maxViewers <= 0 {
+		maxViewers = DefaultConsoleMaxViewers
+	}
+	return &consoles{
+		tickets:    make(map[string]*ConsoleTicket),
+		viewers:    make(map[string]int),
+		TokenTTL:   ttl,
+		Idle:       idle,
+		MaxViewers: maxViewers,
+	}
+}
+
+// Issue makes a token for a console of the assembly.
+func (c *consoles) Issue(email, asmsId, asmId string, now time.Time) (*ConsoleTicket, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	t := &ConsoleTicket{
+		Token:        hex.EncodeToString(b),
+		AccountId:    email,
+		AssembliesId: asmsId,
+		AssemblyId:   asmId,
+		ExpiresAt:    now.Add(c.TokenTTL),
+	}
+	t.Url = "/vnc/" + t.Token
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, o := range c.tickets {
+		if !now.Before(o.ExpiresAt) {
+			delete(c.tickets, k)
+		}
+	}
+	c.tickets[t.Token] = t
+	return t, nil
+}
+
+// Redeem uses the token up, it can't open another console.
+func (c *consoles) Redeem(token string, now time.Time) (*ConsoleTicket, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, ok := c.tickets[token]
+	if !ok {
+		return nil, fmt.Errorf("console token unknown or already used")
+	}
+	delete(c.tickets, token)
+	if !now.Before(t.ExpiresAt) {
+		return nil, fmt.Errorf("console token expired at %s", t.ExpiresAt.Format(time.RFC3339))
+	}
+	return t, nil
+}
+
+// acquire takes a viewer of the vm, false when it has as many as allowed.
+func (c *consoles) acquire(asmId string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.viewers[asmId] >= c.MaxViewers {
+		return false
+	}
+	c.viewers[asmId]++
+	return true
+}
+
+func (c *consoles) release(asmId string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.viewers[asmId]--; c.viewers[asmId] <= 0 {
+		delete(c.viewers, asmId)
+	}
+}
+
+// vnc issues a console token of the vm for its owner, the console is opened
+// by the websocket at the url of the token before it expires.
 func vnc(w http.ResponseWriter, r *http.Request) error {
+	email := r.URL.Query().Get(":email")
+	asmsId := r.URL.Query().Get(":asmsid")
+	asmId := r.URL.Query().Get(":id")
+	if herr := tokenAuthorized(r, email); herr != nil {
+		return herr
+	}
+	a, err := carton.NewAssembly(asmId, email, "")
+	if err != nil {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	if a.VncHost() == "" || a.VncPort() == "" {
+		return &errors.HTTP{Code: http.StatusConflict, Message: fmt.Sprintf("assembly %s has no console", asmId)}
+	}
+	t, err := Consoles.Issue(email, asmsId, asmId, time.Now())
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(t)
+}
 
+// vncHandshake accepts the binary subprotocol noVNC asks for.
+func vncHandshake(cfg *websocket.Config, r *http.Request) error {
+	for _, p := range cfg.Protocol {
+		if strings.TrimSpace(p) == "binary" {
+			cfg.Protocol = []string{"binary"}
+			return nil
+		}
+	}
+	cfg.Protocol = nil
 	return nil
+}
 
+// vncProxyHandler bridges the websocket of a browser to the vnc port of the vm.
+func vncProxyHandler(ws *websocket.Conn) {
+	ws.PayloadType = websocket.BinaryFrame
+	fail := func(msg string) {
+		log.Debugf("  console : %s", msg)
+		ws.Write([]byte("Error: " + msg + "\n"))
+		ws.Close()
+	}
+	t, err := Consoles.Redeem(ws.Request().URL.Query().Get(":token"), time.Now())
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	if !Consoles.acquire(t.AssemblyId) {
+		fail(fmt.Sprintf("assembly %s has %d viewers already", t.AssemblyId, Consoles.MaxViewers))
+		return
+	}
+	defer Consoles.release(t.AssemblyId)
+	a, err := carton.NewAssembly(t.AssemblyId, t.AccountId, "")
+	if err != nil {
+		fail(err.Error())
+		return
+	}
+	err = govnc.Connect(&govnc.VncHost{IpAddress: a.VncHost(), Port: a.VncPort()}, ws, Consoles.Idle)
+	if err != nil {
+		log.Debugf("  console of %s closed : %s", t.AssemblyId, err)
+	}
 }
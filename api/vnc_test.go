@@ -0,0 +1,52 @@
+package api
+
+import (
+	"time"
+
+	"golang.org/x/net/websocket"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestConsoleTokens(c *check.C) {
+	cs := NewConsoles(time.Minute, 0, 0)
+	c.Assert(cs.Idle, check.Equals, DefaultConsoleIdle)
+	now := time.Now()
+	t, err := cs.Issue("info@megam.io", "AMS001", "ASM001", now)
+	c.Assert(err, check.IsNil)
+	c.Assert(t.Url, check.Equals, "/vnc/"+t.Token)
+	c.Assert(t.ExpiresAt, check.Equals, now.Add(time.Minute))
+	r, err := cs.Redeem(t.Token, now.Add(time.Second))
+	c.Assert(err, check.IsNil)
+	c.Assert(r.AssemblyId, check.Equals, "ASM001")
+	c.Assert(r.AccountId, check.Equals, "info@megam.io")
+	_, err = cs.Redeem(t.Token, now.Add(time.Second))
+	c.Assert(err, check.ErrorMatches, ".*already used")
+	t, _ = cs.Issue("info@megam.io", "AMS001", "ASM001", now)
+	_, err = cs.Redeem(t.Token, now.Add(time.Minute))
+	c.Assert(err, check.ErrorMatches, "console token expired .*")
+	//the expired tokens are dropped when a token is issued.
+	cs.Issue("info@megam.io", "AMS001", "ASM001", now)
+	cs.Issue("info@megam.io", "AMS001", "ASM001", now.Add(2*time.Minute))
+	c.Assert(cs.tickets, check.HasLen, 1)
+}
+
+func (s *S) TestConsoleViewers(c *check.C) {
+	cs := NewConsoles(0, 0, 2)
+	c.Assert(cs.acquire("ASM001"), check.Equals, true)
+	c.Assert(cs.acquire("ASM001"), check.Equals, true)
+	c.Assert(cs.acquire("ASM001"), check.Equals, false)
+	c.Assert(cs.acquire("ASM002"), check.Equals, true)
+	cs.release("ASM001")
+	c.Assert(cs.acquire("ASM001"), check.Equals, true)
+	cs.release("ASM002")
+	c.Assert(cs.viewers, check.DeepEquals, map[string]int{"ASM001": 2})
+}
+
+func (s *S) TestVncHandshake(c *check.C) {
+	cfg := &websocket.Config{Protocol: []string{"base64", " binary"}}
+	c.Assert(vncHandshake(cfg, nil), check.IsNil)
+	c.Assert(cfg.Protocol, check.DeepEquals, []string{"binary"})
+	cfg = &websocket.Config{Protocol: []string{"base64"}}
+	c.Assert(vncHandshake(cfg, nil), check.IsNil)
+	c.Assert(cfg.Protocol, check.IsNil)
+}
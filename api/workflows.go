@@ -0,0 +1,121 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/megamsys/libgo/errors"
+	"github.com/megamsys/vertice/carton"
+)
+
+func workflowsEnabled() *errors.HTTP {
+	if carton.Workflows == nil || Deployer == nil {
+		return &errors.HTTP{Code: http.StatusServiceUnavailable, Message: carton.ErrWorkflowDisabled.Error()}
+	}
+	return nil
+}
+
+// workflowCreate adds a workflow on assemblies of the account and runs it
+// with a (workflow, run) request, its steps are polled at /workflows/{id}.
+func workflowCreate(w http.ResponseWriter, r *http.Request) error {
+	email, herr := assembliesAccount(r)
+	if herr != nil {
+		return herr
+	}
+	var wf carton.Workflow
+	if err := json.NewDecoder(r.Body).Decode(&wf); err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: "invalid workflow : " + err.Error()}
+	}
+	if wf.Id == "" {
+		wf.Id = Uid("WFL")
+	}
+	wf.AccountId = email
+	if err := wf.Validate(); err != nil {
+		return &errors.HTTP{Code: http.StatusBadRequest, Message: err.Error()}
+	}
+	if herr = workflowsEnabled(); herr != nil {
+		return herr
+	}
+	if _, err := assembliesOf(wf.CatId, email); err != nil {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: err.Error()}
+	}
+	old, err := carton.Workflows.Get(wf.Id)
+	switch {
+	case err == carton.ErrWorkflowNotFound:
+	case err != nil:
+		return err
+	case old.AccountId != email || old.Status != carton.WorkflowPending:
+		return &errors.HTTP{Code: http.StatusConflict, Message: fmt.Sprintf("workflow %s is taken", wf.Id)}
+	}
+	if err = carton.Workflows.Put(&wf); err != nil {
+		return err
+	}
+	req := &carton.Requests{
+		Id:        Uid("RQS"),
+		AccountId: email,
+		CatId:     wf.CatId,
+		Category:  carton.WORKFLOW,
+		Action:    carton.RUN,
+		CreatedAt: time.Now(),
+	}
+	err = Deployer.Dispatch(req, func(err error) {
+		if err != nil {
+			log.Errorf("  workflow %s on %s : %s", wf.Id, wf.CatId, err)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/workflows/"+wf.Id)
+	w.WriteHeader(http.StatusAccepted)
+	return json.NewEncoder(w).Encode(wf)
+}
+
+// workflow is a workflow of the account, with the state of every step.
+func workflow(w http.ResponseWriter, r *http.Request) error {
+	id := r.URL.Query().Get(":id")
+	email, herr := assembliesAccount(r)
+	if herr != nil {
+		return herr
+	}
+	if herr = workflowsEnabled(); herr != nil {
+		return herr
+	}
+	wf, err := carton.Workflows.Get(id)
+	if err == carton.ErrWorkflowNotFound || err == nil && wf.AccountId != email {
+		return &errors.HTTP{Code: http.StatusNotFound, Message: fmt.Sprintf("no workflow %s", id)}
+	}
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(wf)
+}
+
+// workflows are the workflows of the account oldest first, the ones of the
+// assemblies cat_id when it is in the query.
+func workflows(w http.ResponseWriter, r *http.Request) error {
+	email, herr := assembliesAccount(r)
+	if herr != nil {
+		return herr
+	}
+	if herr = workflowsEnabled(); herr != nil {
+		return herr
+	}
+	all, err := carton.Workflows.List(r.URL.Query().Get("cat_id"))
+	if err != nil {
+		return err
+	}
+	wfs := make([]*carton.Workflow, 0)
+	for _, wf := range all {
+		if wf.AccountId == email {
+			wfs = append(wfs, wf)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(wfs)
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/megamsys/libgo/errors"
+	"github.com/megamsys/vertice/carton"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) installWorkflows(c *check.C) (*fakeDeployer, func()) {
+	f, restore := s.installAssemblies()
+	old := carton.Workflows
+	st, err := carton.NewWorkflowStore(c.MkDir())
+	c.Assert(err, check.IsNil)
+	carton.Workflows = st
+	return f, func() {
+		restore()
+		carton.Workflows = old
+	}
+}
+
+func (s *S) TestWorkflowCreate(c *check.C) {
+	f, restore := s.installWorkflows(c)
+	defer restore()
+	r := actionRequestOf("/workflows?token=info@megam.io:aaaa",
+		`{"id":"WFL001","name":"safe-upgrade","cat_id":"AMS001","steps":[{"op":"snapcreate"},{"op":"upgrade"},{"op":"healthcheck"}]}`)
+	w := httptest.NewRecorder()
+	c.Assert(workflowCreate(w, r), check.IsNil)
+	c.Assert(w.Code, check.Equals, http.StatusAccepted)
+	c.Assert(w.Header().Get("Location"), check.Equals, "/workflows/WFL001")
+	c.Assert(f.reqs, check.HasLen, 1)
+	c.Assert(f.reqs[0].CatId, check.Equals, "AMS001")
+	c.Assert(f.reqs[0].Category, check.Equals, carton.WORKFLOW)
+	c.Assert(f.reqs[0].Action, check.Equals, carton.RUN)
+
+	r = requestOf("GET", "/workflows/WFL001?:id=WFL001&token=info@megam.io:aaaa", nil)
+	w = httptest.NewRecorder()
+	c.Assert(workflow(w, r), check.IsNil)
+	var wf carton.Workflow
+	c.Assert(json.NewDecoder(w.Body).Decode(&wf), check.IsNil)
+	c.Assert(wf.AccountId, check.Equals, "info@megam.io")
+	c.Assert(wf.Status, check.Equals, carton.WorkflowPending)
+	c.Assert(wf.Steps, check.HasLen, 3)
+	r = requestOf("GET", "/workflows/WFL001?:id=WFL001&token=other@megam.io:aaaa", nil)
+	c.Assert(workflow(httptest.NewRecorder(), r).(*errors.HTTP).Code, check.Equals, http.StatusNotFound)
+
+	r = requestOf("GET", "/workflows?cat_id=AMS001&token=info@megam.io:aaaa", nil)
+	w = httptest.NewRecorder()
+	c.Assert(workflows(w, r), check.IsNil)
+	var wfs []*carton.Workflow
+	c.Assert(json.NewDecoder(w.Body).Decode(&wfs), check.IsNil)
+	c.Assert(wfs, check.HasLen, 1)
+}
+
+func (s *S) TestWorkflowCreateRejected(c *check.C) {
+	f, restore := s.installWorkflows(c)
+	defer restore()
+	tests := []struct {
+		path, body string
+		code       int
+	}{
+		{"/workflows", `{"cat_id":"AMS001","steps":[{"op":"upgrade"}]}`, http.StatusUnauthorized},
+		{"/workflows?token=info@megam.io:aaaa", `upgrade`, http.StatusBadRequest},
+		{"/workflows?token=info@megam.io:aaaa", `{"cat_id":"AMS001","steps":[]}`, http.StatusBadRequest},
+		{"/workflows?token=info@megam.io:aaaa", `{"cat_id":"AMS001","steps":[{"op":"snaprestore"}]}`, http.StatusBadRequest},
+		{"/workflows?token=info@megam.io:aaaa", `{"cat_id":"AMS002","steps":[{"op":"upgrade"}]}`, http.StatusNotFound},
+	}
+	for _, t := range tests {
+		err := workflowCreate(httptest.NewRecorder(), actionRequestOf(t.path, t.body))
+		c.Assert(err, check.NotNil, check.Commentf(t.path+" "+t.body))
+		c.Assert(err.(*errors.HTTP).Code, check.Equals, t.code, check.Commentf(t.path+" "+t.body))
+	}
+	c.Assert(f.reqs, check.HasLen, 0)
+	carton.Workflows = nil
+	err := workflowCreate(httptest.NewRecorder(), actionRequestOf("/workflows?token=info@megam.io:aaaa", `{"cat_id":"AMS001","steps":[{"op":"upgrade"}]}`))
+	c.Assert(err.(*errors.HTTP).Code, check.Equals, http.StatusServiceUnavailable)
+}
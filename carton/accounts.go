@@ -2,8 +2,11 @@ package carton
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/megamsys/libgo/api"
+	"github.com/megamsys/libgo/events/bills"
 	"github.com/megamsys/vertice/meta"
+	"strconv"
 	"strings"
 )
 
@@ -119,3 +122,15 @@ func (a *Account) IsAdmin() bool {
 	}
 	return false
 }
+
+// Balance is the credit left to the account.
+func Balance(email string) (float64, error) {
+	bal, err := bills.NewBalances(email, meta.MC.ToMap())
+	if err != nil {
+		return 0, err
+	}
+	if bal == nil {
+		return 0, fmt.Errorf("no balance for %s", email)
+	}
+	return strconv.ParseFloat(bal.Credit, 64)
+}
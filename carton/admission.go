@@ -0,0 +1,156 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+package carton
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/megamsys/libgo/events/alerts"
+	lb "github.com/megamsys/vertice/logbox"
+	"github.com/megamsys/vertice/provision"
+)
+
+// Usage is what an account holds or a request asks for, cpu in cores,
+// ram and storage in MB.
+type Usage struct {
+	Cpu       uint64
+	Ram       uint64
+	Storage   uint64
+	Instances uint64
+	Snapshots uint64
+}
+
+func (u Usage) String() string {
+	return fmt.Sprintf("(cpu:%d, ram:%dMB, storage:%dMB, instances:%d, snapshots:%d)",
+		u.Cpu, u.Ram, u.Storage, u.Instances, u.Snapshots)
+}
+
+func (u *Usage) add(c provision.BoxCompute) {
+	b := &provision.Box{Compute: c}
+	u.Cpu += b.GetCpushare()
+	u.Ram += b.GetMemory()
+	u.Storage += b.GetHDD()
+	u.Instances++
+}
+
+//admissionQuota and admissionUsage are replaced in tests.
+var (
+	admissionQuota = AccountQuota
+	admissionUsage = accountUsage
+)
+
+// accountUsage adds up the machines and containers the account runs, with the
+// disks attached to them and their snapshots. What the request req replaces or
+// adds is left out: the box's own machine for a deploy or a resize, and the
+// disk or snapshot record made for the request.
+func accountUsage(b *provision.Box, req Usage) (Usage, error) {
+	u := Usage{}
+	asms, err := AccountAssembly(b.AccountId)
+	if err != nil {
+		return u, err
+	}
+	flavors := make(map[string]*Flavor)
+	for i := range asms {
+		a := &asms[i]
+		if a.AccountId != b.AccountId || a.isDestroyed() {
+			continue
+		}
+		if countsMachine(a, b, req) {
+			flv, ok := flavors[a.FlavorId()]
+			if !ok {
+				if flv, err = GetFlavor(b.AccountId, a.FlavorId()); err != nil {
+					return u, err
+				}
+				flavors[a.FlavorId()] = flv
+			}
+			u.add(flv.compute())
+		}
+		//an assembly without disks or snapshots has nothing to list.
+		if dsks, err := GetAsmDisks(a.Id, b.AccountId); err == nil {
+			for _, d := range dsks {
+				if d.Id != b.CartonsId {
+					n, _ := strconv.ParseUint(d.NumMemory(), 10, 64)
+					u.Storage += n
+				}
+			}
+		} else {
+			log.Debugf("  no disks of %s : %s", a.Id, err)
+		}
+		if snps, err := GetAsmSnaps(a.Id, b.AccountId); err == nil {
+			for _, s := range snps {
+				if s.Id != b.CartonsId && s.IsAlive() {
+					u.Snapshots++
+				}
+			}
+		} else {
+			log.Debugf("  no snapshots of %s : %s", a.Id, err)
+		}
+	}
+	return u, nil
+}
+
+//countsMachine tells if the machine of the assembly is in the usage. The box's
+//own machine is in the request of a deploy, and replaced by the new flavor of
+//a resize.
+func countsMachine(a *Assembly, b *provision.Box, req Usage) bool {
+	return a.Id != b.CartonId || (req.Instances == 0 && b.Resize == nil)
+}
+
+// Admit rejects the request of the box when it takes the account over its
+// quota, an event with the reason is sent to the account.
+func Admit(b *provision.Box, req Usage, w io.Writer) error {
+	q, err := admissionQuota(b.AccountId)
+	if err != nil {
+		return err
+	}
+	if q == nil {
+		return nil
+	}
+	used, err := admissionUsage(b, req)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf("  admission of %s %s, account uses %s", b.GetFullName(), req, used)))
+	if err = q.Exceeded(used, req); err != nil {
+		fmt.Fprintf(w, lb.W(lb.DEPLOY, lb.ERROR, fmt.Sprintf("  admission of %s --> %s", b.GetFullName(), err)))
+		_ = DoneNotify(b, w, alerts.FAILURE, err.Error())
+		return err
+	}
+	return nil
+}
+
+//deployUsage is a new machine or container of the box.
+func deployUsage(b *provision.Box) Usage {
+	return Usage{Cpu: b.GetCpushare(), Ram: b.GetMemory(), Storage: b.GetHDD(), Instances: 1}
+}
+
+//resizeUsage is the new flavor, the box's own machine isn't in the usage.
+func resizeUsage(b *provision.Box) Usage {
+	return Usage{Cpu: b.Resize.GetCpushare(), Ram: b.Resize.GetMemory(), Storage: b.Resize.GetHDD()}
+}
+
+//diskUsage is the disk of the request being attached.
+func diskUsage(b *provision.Box) (Usage, error) {
+	dsk, err := GetDisks(b.CartonsId, b.AccountId)
+	if err != nil {
+		return Usage{}, err
+	}
+	n, _ := strconv.ParseUint(dsk.NumMemory(), 10, 64)
+	return Usage{Storage: n}, nil
+}
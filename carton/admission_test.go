@@ -0,0 +1,86 @@
+package carton
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/megamsys/vertice/provision"
+	"gopkg.in/check.v1"
+)
+
+func accountQuota(kv ...string) *Quota {
+	in := make([]map[string]string, 0)
+	for i := 0; i < len(kv); i += 2 {
+		in = append(in, map[string]string{"key": kv[i], "value": kv[i+1]})
+	}
+	b, _ := json.Marshal(map[string]interface{}{"id": "QUO001", "account_id": "info@megam.io", "quota_type": ACCOUNT_QUOTA, "allowed": in})
+	q := &Quota{}
+	json.Unmarshal(b, q)
+	return q
+}
+
+func (s *S) TestQuotaExceeded(c *check.C) {
+	q := accountQuota(QUOTA_CPU, "8", QUOTA_RAM, "16384", QUOTA_INSTANCES, "3")
+	used := Usage{Cpu: 6, Ram: 8192, Storage: 102400, Instances: 2, Snapshots: 10}
+	c.Assert(q.Exceeded(used, Usage{Cpu: 2, Ram: 8192, Storage: 40960, Instances: 1}), check.IsNil)
+	c.Assert(q.Exceeded(used, Usage{Cpu: 4, Ram: 1024, Instances: 1}), check.ErrorMatches, "over the cpu quota .*")
+	c.Assert(q.Exceeded(used, Usage{Ram: 9216}), check.ErrorMatches, "over the ram quota .*")
+	c.Assert(q.Exceeded(Usage{Instances: 3}, Usage{Instances: 1}), check.ErrorMatches, "over the instances quota .*")
+	//no limit on storage and snapshots.
+	c.Assert(q.Exceeded(used, Usage{Storage: 1 << 30, Snapshots: 100}), check.IsNil)
+	//an account over a limit can still ask for what isn't limited by it.
+	c.Assert(q.Exceeded(Usage{Cpu: 10}, Usage{Snapshots: 1}), check.IsNil)
+	c.Assert(accountQuota(QUOTA_CPU, "eight").Exceeded(used, Usage{Cpu: 1}), check.NotNil)
+}
+
+func (s *S) TestAdmit(c *check.C) {
+	defer func(q func(string) (*Quota, error), u func(*provision.Box, Usage) (Usage, error)) {
+		admissionQuota, admissionUsage = q, u
+	}(admissionQuota, admissionUsage)
+	box := &provision.Box{CartonName: "web1", AccountId: "info@megam.io",
+		Compute: provision.BoxCompute{Cpushare: "2", Memory: "2048 MB", HDD: "20 GB"}}
+	used := false
+	admissionUsage = func(*provision.Box, Usage) (Usage, error) {
+		used = true
+		return Usage{Cpu: 2, Ram: 2048, Storage: 20480, Instances: 1}, nil
+	}
+	admissionQuota = func(string) (*Quota, error) { return nil, nil }
+	c.Assert(Admit(box, deployUsage(box), ioutil.Discard), check.IsNil)
+	c.Assert(used, check.Equals, false)
+	admissionQuota = func(string) (*Quota, error) { return accountQuota(QUOTA_CPU, "4", QUOTA_INSTANCES, "2"), nil }
+	c.Assert(deployUsage(box), check.DeepEquals, Usage{Cpu: 2, Ram: 2048, Storage: 20480, Instances: 1})
+	c.Assert(Admit(box, deployUsage(box), ioutil.Discard), check.IsNil)
+	c.Assert(used, check.Equals, true)
+}
+
+func (s *S) TestCountsMachine(c *check.C) {
+	own, other := &Assembly{Id: "ASM001"}, &Assembly{Id: "ASM002"}
+	box := &provision.Box{CartonId: "ASM001", CartonsId: "DSK001"}
+	//an attach or a snapshot is on the running machine.
+	c.Assert(countsMachine(own, box, Usage{Storage: 10240}), check.Equals, true)
+	c.Assert(countsMachine(own, box, Usage{Snapshots: 1}), check.Equals, true)
+	//a deploy brings the machine in.
+	c.Assert(countsMachine(own, box, deployUsage(box)), check.Equals, false)
+	c.Assert(countsMachine(other, box, deployUsage(box)), check.Equals, true)
+	box.Resize = &provision.BoxResize{FlavorId: "FLV002"}
+	c.Assert(countsMachine(own, box, resizeUsage(box)), check.Equals, false)
+	c.Assert(countsMachine(other, box, resizeUsage(box)), check.Equals, true)
+}
+
+func (s *S) TestAdmitFirstMachine(c *check.C) {
+	defer func(q func(string) (*Quota, error), u func(*provision.Box, Usage) (Usage, error)) {
+		admissionQuota, admissionUsage = q, u
+	}(admissionQuota, admissionUsage)
+	box := &provision.Box{CartonId: "ASM001", CartonName: "web1", AccountId: "info@megam.io",
+		Compute: provision.BoxCompute{Cpushare: "2", Memory: "2048 MB", HDD: "20 GB"}}
+	//the gateway lists the assembly of the box before its first deploy.
+	admissionUsage = func(b *provision.Box, req Usage) (Usage, error) {
+		u := Usage{}
+		if countsMachine(&Assembly{Id: "ASM001"}, b, req) {
+			u.add(b.Compute)
+		}
+		return u, nil
+	}
+	admissionQuota = func(string) (*Quota, error) { return accountQuota(QUOTA_INSTANCES, "1"), nil }
+	c.Assert(Admit(box, deployUsage(box), ioutil.Discard), check.IsNil)
+}
@@ -211,6 +211,7 @@ func mkCarton(aies, ay, email string) (*Carton, error) {
 		Vnets:        a.vnets(),
 		InstanceId:   a.instanceId(),
 		PolicyOps:    a.policyOps(),
+		Migration:    a.migration(),
 		Backup:       a.isBackup(),
 		ImageName:    a.imageName(),
 		StorageType:  a.storageType(),
@@ -270,6 +271,7 @@ func (a *Assembly) mkBoxes(aies string, args api.ApiArgs) ([]provision.Box, erro
 					b.Compute = a.compute()
 				}
 				b.PolicyOps = a.policyOps()
+				b.Migration = a.migration()
 				b.SSH = a.newSSH()
 				b.Region = a.region()
 				b.Status = utils.Status(a.Status)
@@ -296,6 +298,11 @@ func AssemblyBox() ([]Assembly, error) {
 	return new(Assembly).gets(newArgs(meta.MC.MasterUser, ""))
 }
 
+// AccountAssembly lists the assemblies of the account email.
+func AccountAssembly(email string) ([]Assembly, error) {
+	return new(Assembly).gets(newArgs(email, ""))
+}
+
 func NewCarton(aies, ay, email string) (*Carton, error) {
 	return mkCarton(aies, ay, email)
 }
@@ -325,7 +332,13 @@ func (a *Assembly) SetStatus(status utils.Status) error {
 
 func (a *Assembly) SetState(state utils.State) error {
 	a.State = state.String()
-	return a.update()
+	if err := a.update(); err != nil {
+		return err
+	}
+	if a.isDestroyed() {
+		notifyRemoved(a.Id)
+	}
+	return nil
 }
 
 func (a *Assembly) Trigger_event(status utils.Status) error {
@@ -398,6 +411,9 @@ func (a *Assembly) NukeAndSetOutputs(m map[string][]string) error {
 		if err != nil {
 			return err
 		}
+		if hasNetworkKeys(m) {
+			notifyChanged(a)
+		}
 	} else {
 		return provision.ErrNoOutputsFound
 	}
@@ -411,6 +427,7 @@ func (a *Assembly) Delete(asmid string) error {
 	if err != nil {
 		return err
 	}
+	notifyRemoved(asmid)
 	return nil
 }
 
@@ -458,10 +475,10 @@ func (a *Assembly) ipv6Pub() string {
 func (a *Assembly) publicIp() string {
 	return a.Outputs.Match(utils.PUBLICIPV4)
 }
-func (a *Assembly) vncHost() string {
+func (a *Assembly) VncHost() string {
 	return a.Outputs.Match(VNCHOST)
 }
-func (a *Assembly) vncPort() string {
+func (a *Assembly) VncPort() string {
 	return a.Outputs.Match(VNCPORT)
 }
 func (a *Assembly) instanceId() string {
@@ -687,17 +704,23 @@ func (a *Assembly) IsTopedo() bool {
 	return strings.Split(a.Tosca, ".")[1] == constants.TORPEDO
 }
 func (a *Assembly) Resources(flv *Flavor) map[string]string {
+	return a.billaleResource(a.AllocatedResources(flv))
+}
+
+// AllocatedResources are the resources of the flavor and their costs, whatever
+// the state of the assembly.
+func (a *Assembly) AllocatedResources(flv *Flavor) map[string]string {
 	box := &provision.Box{}
 	if flv != nil {
 		box.Compute = flv.compute()
-		return a.billaleResource(map[string]string{
+		return map[string]string{
 			constants.CPU:         strconv.FormatInt(int64(box.GetCpushare()), 10),
 			constants.RAM:         strconv.FormatInt(int64(box.GetMemory()), 10),
 			constants.STORAGE:     strconv.FormatInt(int64(box.GetHDD()), 10),
 			constants.CPU_COST:    flv.GetCpuCost(),
 			constants.MEMORY_COST: flv.GetMemoryCost(),
 			constants.DISK_COST:   flv.GetHDDCost(),
-		})
+		}
 	}
 	return a.resources()
 }
@@ -717,7 +740,7 @@ func (a *Assembly) resources() map[string]string {
 		r[constants.MEMORY_COST] = a.GetVMMemoryCost()
 		r[constants.DISK_COST] = a.GetVMHDDCost()
 	}
-	return a.billaleResource(r)
+	return r
 }
 
 func (a *Assembly) billaleResource(r map[string]string) map[string]string {
@@ -65,7 +65,9 @@ func CreateImage(opts *DiskOpts) error {
 	logWriter.Async()
 	defer logWriter.Close()
 	writer := io.MultiWriter(&outBuffer, &logWriter)
+	done := provisionerCall(opts.B, "save_image")
 	err := ProvisionerMap[opts.B.Provider].SaveImage(opts.B, writer)
+	done(err)
 	elapsed := time.Since(start)
 
 	if err != nil {
@@ -87,7 +89,9 @@ func DeleteImage(opts *DiskOpts) error {
 	logWriter.Async()
 	defer logWriter.Close()
 	writer := io.MultiWriter(&outBuffer, &logWriter)
+	done := provisionerCall(opts.B, "delete_image")
 	err := ProvisionerMap[opts.B.Provider].DeleteImage(opts.B, writer)
+	done(err)
 	elapsed := time.Since(start)
 
 	if err != nil {
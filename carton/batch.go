@@ -0,0 +1,370 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+package carton
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	//comma separated tags of an assembly, eg: tags = "web,production"
+	TAGS = "tags"
+
+	BatchStopOnError = "stop_on_error"
+	BatchContinue    = "continue"
+
+	BatchPending = "pending"
+	BatchRunning = "running"
+	BatchDone    = "done"
+	BatchFailed  = "failed"
+
+	ResultDone    = "done"
+	ResultFailed  = "failed"
+	ResultSkipped = "skipped"
+
+	DefaultBatchConcurrency = 5
+)
+
+var (
+	ErrBatchNotFound = errors.New("batch not found")
+	ErrBatchDisabled = errors.New("batches are not enabled")
+)
+
+//Global batch store set by the subd daemons, nil means batches are not run.
+var Batches *BatchStore
+
+// Selector matches the assemblies of a batch, an empty field matches every assembly.
+type Selector struct {
+	OrgId  string `json:"org_id"`
+	Region string `json:"region"`
+	Flavor string `json:"flavor"`
+	Tag    string `json:"tag"`
+}
+
+func (s Selector) String() string {
+	return fmt.Sprintf("org=%s region=%s flavor=%s tag=%s", s.OrgId, s.Region, s.Flavor, s.Tag)
+}
+
+func (s Selector) Match(a *Assembly) bool {
+	if s.OrgId != "" && s.OrgId != a.OrgId {
+		return false
+	}
+	if s.Region != "" && s.Region != a.region() {
+		return false
+	}
+	if s.Flavor != "" && s.Flavor != a.flavorId() {
+		return false
+	}
+	if s.Tag != "" && !a.HasTag(s.Tag) {
+		return false
+	}
+	return true
+}
+
+func (a *Assembly) HasTag(tag string) bool {
+	for _, t := range strings.Split(a.Inputs.Match(TAGS), ",") {
+		if strings.TrimSpace(t) == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// BatchResult is the outcome of the batch operation on one assembly.
+type BatchResult struct {
+	AssemblyId string        `json:"assembly_id"`
+	Name       string        `json:"name"`
+	AccountId  string        `json:"account_id"`
+	Status     string        `json:"status"`
+	Error      string        `json:"error"`
+	Duration   time.Duration `json:"duration"`
+}
+
+// Batch runs one carton operation (category, action) on every assembly
+// matching the selector, at most concurrency assemblies at a time.
+// In the stop_on_error mode the assemblies not started after a failure are skipped.
+type Batch struct {
+	Id          string         `json:"id"`
+	Selector    Selector       `json:"selector"`
+	Category    string         `json:"category"`
+	Action      string         `json:"action"`
+	Concurrency int            `json:"concurrency"`
+	Mode        string         `json:"mode"`
+	Status      string         `json:"status"`
+	Results     []*BatchResult `json:"results"`
+	CreatedAt   time.Time      `json:"created_at"`
+	StartedAt   time.Time      `json:"started_at"`
+	FinishedAt  time.Time      `json:"finished_at"`
+}
+
+// Validate checks that the operation is one that the ReqParser knows about.
+// Only the control, operations and snapcreate operations can be batched, an
+// assembly is never created or destroyed by a selector.
+func (b *Batch) Validate() error {
+	if b.Id == "" {
+		return fmt.Errorf("batch needs an id")
+	}
+	if !ValidId(b.Id) {
+		return fmt.Errorf("batch %q : the id is made of letters, digits, '_' and '-' only", b.Id)
+	}
+	if b.Mode != "" && b.Mode != BatchStopOnError && b.Mode != BatchContinue {
+		return fmt.Errorf("batch %s : unknown mode %s, expected %s or %s", b.Id, b.Mode, BatchStopOnError, BatchContinue)
+	}
+	switch {
+	case b.Category == CONTROL, b.Category == OPERATIONS:
+	case b.Category == SNAPSHOT && b.Action == SNAPCREATE:
+	default:
+		return newParseError([]string{b.Category, b.Action}, []string{CONTROL, OPERATIONS, SNAPSHOT + "." + SNAPCREATE})
+	}
+	_, err := NewReqParser(b.Id).ParseRequest(b.Category, b.Action)
+	return err
+}
+
+// Count returns the number of results with the status.
+func (b *Batch) Count(status string) int {
+	n := 0
+	for _, r := range b.Results {
+		if r.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+// String is the aggregated report of the batch.
+func (b *Batch) String() string {
+	w := new(tabwriter.Writer)
+	var buf bytes.Buffer
+	w.Init(&buf, 0, 8, 1, '\t', 0)
+	fmt.Fprintf(w, "batch %s\t%s.%s\t%s\n", b.Id, b.Category, b.Action, b.Selector)
+	fmt.Fprintf(w, "matched %d\tdone %d\tfailed %d\tskipped %d\n", len(b.Results),
+		b.Count(ResultDone), b.Count(ResultFailed), b.Count(ResultSkipped))
+	for _, r := range b.Results {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.AssemblyId, r.Name, r.Status, r.Duration, r.Error)
+	}
+	w.Flush()
+	return strings.TrimSpace(buf.String())
+}
+
+//batchAssemblies lists every assembly, replaced in tests.
+var batchAssemblies = AssemblyBox
+
+//batchRun operates one assembly, replaced in tests.
+var batchRun = func(b *Batch, a *Assembly) error {
+	ca, err := b.cartons(a)
+	if err != nil {
+		return err
+	}
+	md, err := NewReqParser(a.Id).ParseRequest(b.Category, b.Action)
+	if err != nil {
+		return err
+	}
+	return md.Process(ca)
+}
+
+//cartons makes the carton of the assembly. A snapshot needs a snapshot
+//record to fill in, so one is added for every assembly snapshotted.
+func (b *Batch) cartons(a *Assembly) (Cartons, error) {
+	id := ""
+	if b.Category == SNAPSHOT {
+		s, err := NewSnapOf(a, b.Id)
+		if err != nil {
+			return nil, err
+		}
+		id = s.Id
+	}
+	c, err := NewCarton(id, a.Id, a.AccountId)
+	if err != nil {
+		return nil, err
+	}
+	c.toBox()
+	return Cartons{c}, nil
+}
+
+// Run operates every matching assembly and records the per assembly results.
+func (b *Batch) Run(store *BatchStore) error {
+	if err := b.Validate(); err != nil {
+		return err
+	}
+	asms, err := batchAssemblies()
+	if err != nil {
+		return err
+	}
+	matched := make([]*Assembly, 0)
+	for i := range asms {
+		if asms[i].IsAlive() && b.Selector.Match(&asms[i]) {
+			matched = append(matched, &asms[i])
+		}
+	}
+	b.Results = make([]*BatchResult, len(matched))
+	for i, a := range matched {
+		b.Results[i] = &BatchResult{AssemblyId: a.Id, Name: a.Name, AccountId: a.AccountId, Status: ResultSkipped}
+	}
+	b.Status, b.StartedAt = BatchRunning, time.Now()
+	store.save(b)
+	log.Infof("  batch %s %s.%s on %d assemblies (%s)", b.Id, b.Category, b.Action, len(matched), b.Selector)
+
+	concurrency := b.Concurrency
+	if concurrency < 1 {
+		concurrency = DefaultBatchConcurrency
+	}
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		stopped bool
+		sem     = make(chan struct{}, concurrency)
+	)
+	for i, a := range matched {
+		sem <- struct{}{}
+		mu.Lock()
+		stop := stopped
+		mu.Unlock()
+		if stop {
+			<-sem
+			break
+		}
+		wg.Add(1)
+		go func(r *BatchResult, a *Assembly) {
+			defer func() { <-sem; wg.Done() }()
+			start := time.Now()
+			err := batchRun(b, a)
+			mu.Lock()
+			defer mu.Unlock()
+			r.Duration = time.Since(start)
+			if err != nil {
+				r.Status, r.Error = ResultFailed, err.Error()
+				log.Errorf("  batch %s %s : %s", b.Id, a.Id, err)
+				stopped = b.Mode == BatchStopOnError
+			} else {
+				r.Status = ResultDone
+			}
+			store.save(b)
+		}(b.Results[i], a)
+	}
+	wg.Wait()
+
+	b.FinishedAt = time.Now()
+	b.Status = BatchDone
+	if b.Count(ResultFailed) > 0 {
+		b.Status = BatchFailed
+	}
+	store.save(b)
+	log.Infof("  batch %s\n%s", b.Id, b)
+	if b.Status == BatchFailed {
+		return fmt.Errorf("batch %s : %d of %d assemblies failed", b.Id, b.Count(ResultFailed), len(b.Results))
+	}
+	return nil
+}
+
+// BatchStore keeps every batch with its report as a json file in a directory.
+type BatchStore struct {
+	sync.Mutex
+	dir string
+}
+
+func NewBatchStore(dir string) (*BatchStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &BatchStore{dir: dir}, nil
+}
+
+// Put adds a pending batch, it is run by a (batch, run) request on its id.
+func (s *BatchStore) Put(b *Batch) error {
+	if err := b.Validate(); err != nil {
+		return err
+	}
+	b.Status, b.Results = BatchPending, nil
+	if b.CreatedAt.IsZero() {
+		b.CreatedAt = time.Now()
+	}
+	s.Lock()
+	defer s.Unlock()
+	return s.write(b)
+}
+
+func (s *BatchStore) Get(id string) (*Batch, error) {
+	if !ValidId(id) {
+		return nil, ErrBatchNotFound
+	}
+	s.Lock()
+	defer s.Unlock()
+	b, err := ioutil.ReadFile(s.path(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrBatchNotFound
+		}
+		return nil, err
+	}
+	bt := &Batch{}
+	if err = json.Unmarshal(b, bt); err != nil {
+		return nil, err
+	}
+	return bt, nil
+}
+
+//save is used while a batch runs, a failing write is logged and the batch goes on.
+func (s *BatchStore) save(b *Batch) {
+	s.Lock()
+	defer s.Unlock()
+	if err := s.write(b); err != nil {
+		log.Errorf("unable to save batch %s : %s", b.Id, err)
+	}
+}
+
+func (s *BatchStore) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+func (s *BatchStore) write(b *Batch) error {
+	d, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path(b.Id) + ".tmp"
+	if err = ioutil.WriteFile(tmp, d, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path(b.Id))
+}
+
+// RunBatch runs the pending batch id.
+func RunBatch(id string) error {
+	if Batches == nil {
+		return ErrBatchDisabled
+	}
+	b, err := Batches.Get(id)
+	if err != nil {
+		return err
+	}
+	if b.Status != BatchPending {
+		log.Warnf("  batch %s is %s, not run again", b.Id, b.Status)
+		return nil
+	}
+	return b.Run(Batches)
+}
@@ -0,0 +1,116 @@
+package carton
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+const batchAssembliesJson = `[
+  {"id": "ASM001", "org_id": "ORG1", "name": "web1", "state": "running",
+   "inputs": [{"key": "region", "value": "chennai"}, {"key": "tags", "value": "web, production"}]},
+  {"id": "ASM002", "org_id": "ORG1", "name": "web2", "state": "running",
+   "inputs": [{"key": "region", "value": "chennai"}, {"key": "tags", "value": "web"}]},
+  {"id": "ASM003", "org_id": "ORG1", "name": "db1", "state": "running",
+   "inputs": [{"key": "region", "value": "sydney"}, {"key": "tags", "value": "db"}]},
+  {"id": "ASM004", "org_id": "ORG2", "name": "web3", "state": "running",
+   "inputs": [{"key": "region", "value": "chennai"}, {"key": "tags", "value": "web"}]}
+]`
+
+func (s *S) installBatch(c *check.C, run func(a *Assembly) error) func() {
+	asms, brun := batchAssemblies, batchRun
+	var all []Assembly
+	c.Assert(json.Unmarshal([]byte(batchAssembliesJson), &all), check.IsNil)
+	batchAssemblies = func() ([]Assembly, error) { return all, nil }
+	batchRun = func(b *Batch, a *Assembly) error { return run(a) }
+	return func() {
+		batchAssemblies, batchRun = asms, brun
+	}
+}
+
+func (s *S) TestSelectorMatch(c *check.C) {
+	var all []Assembly
+	c.Assert(json.Unmarshal([]byte(batchAssembliesJson), &all), check.IsNil)
+	sl := Selector{OrgId: "ORG1", Region: "chennai", Tag: "web"}
+	c.Assert(sl.Match(&all[0]), check.Equals, true)
+	c.Assert(sl.Match(&all[1]), check.Equals, true)
+	c.Assert(sl.Match(&all[2]), check.Equals, false)
+	c.Assert(sl.Match(&all[3]), check.Equals, false)
+	c.Assert(Selector{Tag: "production"}.Match(&all[0]), check.Equals, true)
+	c.Assert(Selector{}.Match(&all[3]), check.Equals, true)
+}
+
+func (s *S) TestBatchContinueReportsEveryAssembly(c *check.C) {
+	defer s.installBatch(c, func(a *Assembly) error {
+		if a.Id == "ASM002" {
+			return errors.New("stop failed")
+		}
+		return nil
+	})()
+	st, err := NewBatchStore(c.MkDir())
+	c.Assert(err, check.IsNil)
+	b := &Batch{Id: "BAT001", Selector: Selector{Tag: "web"}, Category: CONTROL, Action: STOP, Mode: BatchContinue}
+	c.Assert(st.Put(b), check.IsNil)
+	c.Assert(b.Run(st), check.NotNil)
+	saved, err := st.Get("BAT001")
+	c.Assert(err, check.IsNil)
+	c.Assert(saved.Status, check.Equals, BatchFailed)
+	c.Assert(saved.Results, check.HasLen, 3)
+	c.Assert(saved.Count(ResultDone), check.Equals, 2)
+	c.Assert(saved.Results[1].AssemblyId, check.Equals, "ASM002")
+	c.Assert(saved.Results[1].Status, check.Equals, ResultFailed)
+	c.Assert(saved.Results[1].Error, check.Equals, "stop failed")
+}
+
+func (s *S) TestBatchStopOnErrorSkipsTheRest(c *check.C) {
+	defer s.installBatch(c, func(a *Assembly) error {
+		if a.Id == "ASM001" {
+			return errors.New("restart failed")
+		}
+		return nil
+	})()
+	st, err := NewBatchStore(c.MkDir())
+	c.Assert(err, check.IsNil)
+	b := &Batch{Id: "BAT002", Category: CONTROL, Action: RESTART, Concurrency: 1, Mode: BatchStopOnError}
+	c.Assert(st.Put(b), check.IsNil)
+	c.Assert(b.Run(st), check.NotNil)
+	c.Assert(b.Count(ResultFailed), check.Equals, 1)
+	c.Assert(b.Count(ResultSkipped), check.Equals, 3)
+}
+
+func (s *S) TestBatchConcurrencyLimit(c *check.C) {
+	var mu sync.Mutex
+	active, peak := 0, 0
+	defer s.installBatch(c, func(a *Assembly) error {
+		mu.Lock()
+		active++
+		if active > peak {
+			peak = active
+		}
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		active--
+		mu.Unlock()
+		return nil
+	})()
+	st, err := NewBatchStore(c.MkDir())
+	c.Assert(err, check.IsNil)
+	b := &Batch{Id: "BAT003", Category: SNAPSHOT, Action: SNAPCREATE, Concurrency: 2}
+	c.Assert(st.Put(b), check.IsNil)
+	c.Assert(b.Run(st), check.IsNil)
+	c.Assert(b.Status, check.Equals, BatchDone)
+	c.Assert(b.Count(ResultDone), check.Equals, 4)
+	c.Assert(peak <= 2, check.Equals, true)
+}
+
+func (s *S) TestBatchValidate(c *check.C) {
+	c.Assert((&Batch{Id: "BAT004", Category: STATE, Action: DESTROY}).Validate(), check.NotNil)
+	c.Assert((&Batch{Id: "BAT004", Category: SNAPSHOT, Action: SNAPDELETE}).Validate(), check.NotNil)
+	c.Assert((&Batch{Id: "BAT004", Category: CONTROL, Action: STOP, Mode: "maybe"}).Validate(), check.NotNil)
+	c.Assert((&Batch{Id: "../workflows/WFL001", Category: OPERATIONS, Action: UPGRADE}).Validate(), check.ErrorMatches, "batch .* : the id is made of .*")
+	c.Assert((&Batch{Id: "BAT004", Category: OPERATIONS, Action: UPGRADE}).Validate(), check.IsNil)
+}
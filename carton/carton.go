@@ -4,8 +4,10 @@ import (
 	log "github.com/Sirupsen/logrus"
 	"github.com/megamsys/libgo/api"
 	"github.com/megamsys/libgo/utils"
+	"github.com/megamsys/vertice/instrument"
 	"github.com/megamsys/vertice/provision"
 	"gopkg.in/yaml.v2"
+	"time"
 )
 
 const (
@@ -41,6 +43,7 @@ type Carton struct {
 	Vnets        map[string]string
 	Boxes        *[]provision.Box
 	PolicyOps    *provision.PolicyOps
+	Migration    *provision.BoxMigration
 	Status       utils.Status
 	State        utils.State
 }
@@ -48,6 +51,15 @@ type Carton struct {
 //Global provisioners set by the subd daemons.
 var ProvisionerMap map[string]provision.Provisioner = make(map[string]provision.Provisioner)
 
+//provisionerCall times a call to the provisioner of the box, the func
+//returned ends it with the result of the call.
+func provisionerCall(b *provision.Box, call string) func(error) {
+	start := time.Now()
+	return func(err error) {
+		instrument.ProvisionerSeconds.Since(start, b.Provider, b.Region, call, instrument.Result(err))
+	}
+}
+
 func (a *Carton) String() string {
 	if d, err := yaml.Marshal(a); err != nil {
 		return err.Error()
@@ -92,6 +104,7 @@ func (c *Carton) toBox() error { //assemblies id.
 			InstanceId:   c.InstanceId,
 			SSH:          c.SSH,
 			PolicyOps:    c.PolicyOps,
+			Migration:    c.Migration,
 			QuotaId:      c.QuotaId,
 			Region:       c.Region,
 			Vnets:        c.Vnets,
@@ -181,6 +194,30 @@ func (c *Carton) NetworkUpdate() error {
 	return nil
 }
 
+// migrates the boxes to the cluster or region set in the inputs.
+func (c *Carton) Migrate() error {
+	for _, box := range *c.Boxes {
+		err := Migrate(&box)
+		if err != nil {
+			log.Errorf("Unable to migrate the box %s", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// resizes the boxes to the flavor set in the inputs.
+func (c *Carton) Resize() error {
+	for _, box := range *c.Boxes {
+		err := Resize(&box)
+		if err != nil {
+			log.Errorf("Unable to resize the box %s", err)
+			return err
+		}
+	}
+	return nil
+}
+
 // starts box
 func (c *Carton) Start() error {
 	for _, box := range *c.Boxes {
@@ -58,7 +58,13 @@ func Deploy(opts *DeployOpts) error {
 	logWriter.Async()
 	defer logWriter.Close()
 	writer := io.MultiWriter(&outBuffer, &logWriter)
-	imageId, err := deployToProvisioner(opts, writer)
+	var imageId string
+	err := Admit(opts.B, deployUsage(opts.B), writer)
+	if err == nil {
+		done := provisionerCall(opts.B, "deploy")
+		imageId, err = deployToProvisioner(opts, writer)
+		done(err)
+	}
 	elapsed := time.Since(start)
 	saveErr := saveDeployData(opts, imageId, outBuffer.String(), elapsed, err)
 	if saveErr != nil {
@@ -22,10 +22,13 @@ func Destroy(opts *DestroyOpts) error {
 	logWriter.Async()
 	defer logWriter.Close()
 	writer := io.MultiWriter(&outBuffer, &logWriter)
+	done := provisionerCall(opts.B, "destroy")
 	err := ProvisionerMap[opts.B.Provider].Destroy(opts.B, writer)
+	done(err)
 	if err != nil {
 		return err
 	}
+	notifyRemoved(opts.B.CartonId)
 	elapsed := time.Since(start)
 	log.Debugf("%s in (%s)\n%s",
 		cmd.Colorfy(opts.B.GetFullName(), "cyan", "", "bold"),
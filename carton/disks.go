@@ -53,7 +53,16 @@ func AttachDisk(opts *DiskOpts) error {
 	logWriter.Async()
 	defer logWriter.Close()
 	writer := io.MultiWriter(&outBuffer, &logWriter)
-	err := ProvisionerMap[opts.B.Provider].AttachDisk(opts.B, writer)
+	req, err := diskUsage(opts.B)
+	if err != nil {
+		return err
+	}
+	if err = Admit(opts.B, req, writer); err != nil {
+		return err
+	}
+	done := provisionerCall(opts.B, "attach_disk")
+	err = ProvisionerMap[opts.B.Provider].AttachDisk(opts.B, writer)
+	done(err)
 	elapsed := time.Since(start)
 
 	if err != nil {
@@ -75,7 +84,9 @@ func DetachDisk(opts *DiskOpts) error {
 	logWriter.Async()
 	defer logWriter.Close()
 	writer := io.MultiWriter(&outBuffer, &logWriter)
+	done := provisionerCall(opts.B, "detach_disk")
 	err := ProvisionerMap[opts.B.Provider].DetachDisk(opts.B, writer)
+	done(err)
 	elapsed := time.Since(start)
 	if err != nil {
 		return err
@@ -120,6 +131,23 @@ func GetDisks(id, email string) (*Disks, error) {
 	return d, nil
 }
 
+/** A public function which pulls all disks attached to the VM.
+and any others we do. **/
+func GetAsmDisks(asm_id, email string) ([]Disks, error) {
+	cl := api.NewClient(newArgs(email, ""), "/disks/"+asm_id)
+	response, err := cl.Get()
+	if err != nil {
+		return nil, err
+	}
+
+	res := &ApiDisks{}
+	err = json.Unmarshal(response, res)
+	if err != nil {
+		return nil, err
+	}
+	return res.Results, nil
+}
+
 func (a *Disks) RemoveDisk() error {
 	cl := api.NewClient(newArgs(a.AccountId, a.OrgId), "/disks/"+a.AssemblyId+"/"+a.Id)
 	if _, err := cl.Delete(); err != nil {
@@ -0,0 +1,136 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+package carton
+
+import (
+	"encoding/json"
+	"errors"
+	log "github.com/Sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+var ErrDuplicatePayload = errors.New("duplicate payload, already accepted")
+
+//Global idempotency store set by the subd daemons, nil means duplicates are not dropped.
+var Idempotency *IdempotencyStore
+
+// IdempotencyStore remembers the payloads accepted within a window, so that
+// a payload redelivered by nsq is processed only once.
+// When a file is given the accepted keys survive a restart.
+type IdempotencyStore struct {
+	sync.Mutex
+	window time.Duration
+	file   string
+	seen   map[string]time.Time
+}
+
+// NewIdempotencyStore returns a store that drops duplicates seen within window.
+func NewIdempotencyStore(window time.Duration, file string) (*IdempotencyStore, error) {
+	s := &IdempotencyStore{window: window, file: file, seen: make(map[string]time.Time)}
+	if file == "" {
+		return s, nil
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, err
+	}
+	if err = json.Unmarshal(b, &s.seen); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Accept marks the key as seen. It returns false when the key was already
+// accepted within the window.
+func (s *IdempotencyStore) Accept(key string) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+	now := time.Now()
+	s.expire(now)
+	if _, ok := s.seen[key]; ok {
+		return false, nil
+	}
+	s.seen[key] = now
+	return true, s.save()
+}
+
+// Forget removes the key, a request that has to be retried is accepted again.
+func (s *IdempotencyStore) Forget(key string) error {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.seen, key)
+	return s.save()
+}
+
+func (s *IdempotencyStore) expire(now time.Time) {
+	for k, at := range s.seen {
+		if now.Sub(at) > s.window {
+			delete(s.seen, k)
+		}
+	}
+}
+
+func (s *IdempotencyStore) save() error {
+	if s.file == "" {
+		return nil
+	}
+	b, err := json.Marshal(s.seen)
+	if err != nil {
+		return err
+	}
+	tmp := s.file + ".tmp"
+	if err = ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.file)
+}
+
+// IdempotencyKey identifies a request by its payload id and category/action.
+func (r *Requests) IdempotencyKey() string {
+	return r.Id + ":" + r.Category + "." + r.Action
+}
+
+//accept drops the request when it was already accepted within the window.
+//A failing store is logged and lets the request through.
+func (r *Requests) accept() error {
+	if Idempotency == nil || r.Id == "" {
+		return nil
+	}
+	ok, err := Idempotency.Accept(r.IdempotencyKey())
+	if err != nil {
+		log.Errorf("idempotency store %s : %s", r.IdempotencyKey(), err)
+		return nil
+	}
+	if !ok {
+		log.Warnf("dropped duplicate payload %s (%s.%s) for %s", r.Id, r.Category, r.Action, r.CatId)
+		return ErrDuplicatePayload
+	}
+	return nil
+}
+
+// ForgetRequest lets the request be accepted again, used when it is requeued for a retry.
+func ForgetRequest(r *Requests) error {
+	if Idempotency == nil || r.Id == "" {
+		return nil
+	}
+	return Idempotency.Forget(r.IdempotencyKey())
+}
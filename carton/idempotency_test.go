@@ -0,0 +1,59 @@
+package carton
+
+import (
+	"path/filepath"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestIdempotencyStoreDropsDuplicates(c *check.C) {
+	st, err := NewIdempotencyStore(time.Hour, "")
+	c.Assert(err, check.IsNil)
+	ok, err := st.Accept("RER001:state.create")
+	c.Assert(err, check.IsNil)
+	c.Assert(ok, check.Equals, true)
+	ok, err = st.Accept("RER001:state.create")
+	c.Assert(err, check.IsNil)
+	c.Assert(ok, check.Equals, false)
+	ok, err = st.Accept("RER001:control.stop")
+	c.Assert(err, check.IsNil)
+	c.Assert(ok, check.Equals, true)
+}
+
+func (s *S) TestIdempotencyStoreWindowExpires(c *check.C) {
+	st, err := NewIdempotencyStore(time.Millisecond, "")
+	c.Assert(err, check.IsNil)
+	ok, _ := st.Accept("RER002:backup.backupcreate")
+	c.Assert(ok, check.Equals, true)
+	time.Sleep(5 * time.Millisecond)
+	ok, _ = st.Accept("RER002:backup.backupcreate")
+	c.Assert(ok, check.Equals, true)
+}
+
+func (s *S) TestIdempotencyStoreSurvivesRestart(c *check.C) {
+	file := filepath.Join(c.MkDir(), "idempotency.json")
+	st, err := NewIdempotencyStore(time.Hour, file)
+	c.Assert(err, check.IsNil)
+	ok, _ := st.Accept("RER003:state.create")
+	c.Assert(ok, check.Equals, true)
+	restarted, err := NewIdempotencyStore(time.Hour, file)
+	c.Assert(err, check.IsNil)
+	ok, _ = restarted.Accept("RER003:state.create")
+	c.Assert(ok, check.Equals, false)
+	c.Assert(restarted.Forget("RER003:state.create"), check.IsNil)
+	ok, _ = restarted.Accept("RER003:state.create")
+	c.Assert(ok, check.Equals, true)
+}
+
+func (s *S) TestRequestsAcceptDuplicate(c *check.C) {
+	st, err := NewIdempotencyStore(time.Hour, "")
+	c.Assert(err, check.IsNil)
+	Idempotency = st
+	defer func() { Idempotency = nil }()
+	r := &Requests{Id: "RER004", Category: SNAPSHOT, Action: SNAPCREATE}
+	c.Assert(r.accept(), check.IsNil)
+	c.Assert(r.accept(), check.Equals, ErrDuplicatePayload)
+	c.Assert(ForgetRequest(r), check.IsNil)
+	c.Assert(r.accept(), check.IsNil)
+}
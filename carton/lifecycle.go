@@ -65,7 +65,10 @@ func Start(cy *LifecycleOpts) error {
 	cy.setLogger()
 	defer cy.logWriter.Close()
 	if cy.canCycleStart() {
-		if err := ProvisionerMap[cy.B.Provider].Start(cy.B, cy.process(constants.START), cy.writer); err != nil {
+		done := provisionerCall(cy.B, "start")
+		err := ProvisionerMap[cy.B.Provider].Start(cy.B, cy.process(constants.START), cy.writer)
+		done(err)
+		if err != nil {
 			return err
 		}
 	} else {
@@ -82,7 +85,10 @@ func Stop(cy *LifecycleOpts) error {
 	defer cy.logWriter.Close()
 	if cy.canCycleStop() {
 
-		if err := ProvisionerMap[cy.B.Provider].Stop(cy.B, cy.process(constants.STOP), cy.writer); err != nil {
+		done := provisionerCall(cy.B, "stop")
+		err := ProvisionerMap[cy.B.Provider].Stop(cy.B, cy.process(constants.STOP), cy.writer)
+		done(err)
+		if err != nil {
 			return err
 		}
 	} else {
@@ -98,7 +104,10 @@ func Restart(cy *LifecycleOpts) error {
 	cy.setLogger()
 	defer cy.logWriter.Close()
 	if cy.canCycleStop() {
-		if err := ProvisionerMap[cy.B.Provider].Restart(cy.B, cy.process(constants.RESTART), cy.writer); err != nil {
+		done := provisionerCall(cy.B, "restart")
+		err := ProvisionerMap[cy.B.Provider].Restart(cy.B, cy.process(constants.RESTART), cy.writer)
+		done(err)
+		if err != nil {
 			return err
 		}
 	} else {
@@ -115,7 +124,10 @@ func SuspendBox(cy *LifecycleOpts) error {
 	defer cy.logWriter.Close()
 	if cy.canCycleStop() {
 
-		if err := ProvisionerMap[cy.B.Provider].Suspend(cy.B, cy.process(constants.SUSPEND), cy.writer); err != nil {
+		done := provisionerCall(cy.B, "suspend")
+		err := ProvisionerMap[cy.B.Provider].Suspend(cy.B, cy.process(constants.SUSPEND), cy.writer)
+		done(err)
+		if err != nil {
 			return err
 		}
 	} else {
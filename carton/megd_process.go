@@ -169,6 +169,48 @@ func (s UpgradeProcess) Process(ca Cartons) error {
 	return nil
 }
 
+// MigrateProcess represents a command for migrating cartons.
+type MigrateProcess struct {
+	Name string
+}
+
+func (s MigrateProcess) String() string {
+	var buf bytes.Buffer
+	_, _ = buf.WriteString("MIGRATE CARTON ")
+	_, _ = buf.WriteString(s.Name)
+	return buf.String()
+}
+
+func (s MigrateProcess) Process(ca Cartons) error {
+	for _, c := range ca {
+		if err := c.Migrate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ResizeProcess represents a command for resizing cartons to another flavor.
+type ResizeProcess struct {
+	Name string
+}
+
+func (s ResizeProcess) String() string {
+	var buf bytes.Buffer
+	_, _ = buf.WriteString("RESIZE CARTON ")
+	_, _ = buf.WriteString(s.Name)
+	return buf.String()
+}
+
+func (s ResizeProcess) Process(ca Cartons) error {
+	for _, c := range ca {
+		if err := c.Resize(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // StateupProcess represents a command for restarting  cartons.
 type StateupProcess struct {
 	Name string
@@ -416,3 +458,35 @@ func (s FailureProcess) String() string {
 func (s FailureProcess) Process(ca Cartons) error {
 	return nil
 }
+
+// WorkflowProcess runs the pending workflows of an assembly.
+type WorkflowProcess struct {
+	Name string
+}
+
+func (s WorkflowProcess) String() string {
+	var buf bytes.Buffer
+	_, _ = buf.WriteString("WORKFLOW CARTON ")
+	_, _ = buf.WriteString(s.Name)
+	return buf.String()
+}
+
+func (s WorkflowProcess) Process(ca Cartons) error {
+	return RunWorkflows(s.Name)
+}
+
+// BatchProcess runs a batch operation over the assemblies matching its selector.
+type BatchProcess struct {
+	Name string
+}
+
+func (s BatchProcess) String() string {
+	var buf bytes.Buffer
+	_, _ = buf.WriteString("BATCH CARTON ")
+	_, _ = buf.WriteString(s.Name)
+	return buf.String()
+}
+
+func (s BatchProcess) Process(ca Cartons) error {
+	return RunBatch(s.Name)
+}
@@ -0,0 +1,131 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+package carton
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/megamsys/libgo/cmd"
+	"github.com/megamsys/libgo/utils"
+	lw "github.com/megamsys/libgo/writer"
+	"github.com/megamsys/vertice/provision"
+)
+
+const (
+	//the target of a migrate request is set in the inputs of the assembly.
+	MIGRATE_REGION  = "migrate_region"
+	MIGRATE_CLUSTER = "migrate_cluster"
+	MIGRATE_TYPE    = "migrate_type"
+
+	MIGRATE_LIVE = "live"
+	MIGRATE_COLD = "cold"
+
+	StatusMigrating = utils.Status("migrating")
+	StatusMigrated  = utils.Status("migrated")
+)
+
+//migration is the target of the migrate request, nil when none is set.
+func (a *Assembly) migration() *provision.BoxMigration {
+	region := strings.TrimSpace(a.Inputs.Match(MIGRATE_REGION))
+	cluster := strings.TrimSpace(a.Inputs.Match(MIGRATE_CLUSTER))
+	if region == "" && cluster == "" {
+		return nil
+	}
+	return &provision.BoxMigration{
+		Region:  region,
+		Cluster: cluster,
+		Live:    strings.ToLower(strings.TrimSpace(a.Inputs.Match(MIGRATE_TYPE))) == MIGRATE_LIVE,
+	}
+}
+
+//clearMigration drops the target of the migrate request once it is done, so
+//the next migrate request needs a target of its own.
+func (a *Assembly) clearMigration() error {
+	a.Inputs.NukeKeys(MIGRATE_REGION)
+	a.Inputs.NukeKeys(MIGRATE_CLUSTER)
+	a.Inputs.NukeKeys(MIGRATE_TYPE)
+	return a.update()
+}
+
+//update inputs in scylla, nuke the matching keys available
+func (a *Assembly) NukeAndSetInputs(m map[string][]string) error {
+	if len(m) > 0 {
+		log.Debugf("nuke and set inputs in scylla [%s]", m)
+		a.Inputs.NukeAndSet(m)
+		return a.update()
+	}
+	return provision.ErrNoOutputsFound
+}
+
+// ValidateMigration checks the migrate request of the box before it is handed to the provisioner.
+func ValidateMigration(box *provision.Box) error {
+	m := box.Migration
+	if m == nil {
+		return fmt.Errorf("box %s : no %s or %s in the inputs", box.GetFullName(), MIGRATE_REGION, MIGRATE_CLUSTER)
+	}
+	if !m.CrossRegion(box.Region) && m.Cluster == "" {
+		return fmt.Errorf("box %s : %s is needed to migrate within the region %s", box.GetFullName(), MIGRATE_CLUSTER, box.Region)
+	}
+	if m.Live && m.CrossRegion(box.Region) {
+		return fmt.Errorf("box %s : live migration to the region %s is not possible, use %s", box.GetFullName(), m.Region, MIGRATE_COLD)
+	}
+	if m.Live && box.State != utils.StateRunning {
+		return fmt.Errorf("box %s : live migration needs a running box, it is %s", box.GetFullName(), box.State)
+	}
+	return nil
+}
+
+func Migrate(box *provision.Box) error {
+	var outBuffer bytes.Buffer
+	start := time.Now()
+	logWriter := lw.LogWriter{Box: box}
+	logWriter.Async()
+	defer logWriter.Close()
+	writer := io.MultiWriter(&outBuffer, &logWriter)
+
+	if err := ValidateMigration(box); err != nil {
+		return err
+	}
+	migrator, ok := ProvisionerMap[box.Provider].(provision.Migrator)
+	if !ok {
+		return fmt.Errorf("provisioner %s of box %s cannot migrate", box.Provider, box.GetFullName())
+	}
+	done := provisionerCall(box, "migrate")
+	err := migrator.Migrate(box, writer)
+	done(err)
+	if err != nil {
+		return err
+	}
+	//the provisioner updated the status, so the assembly is read again.
+	a, err := NewAssembly(box.CartonId, box.AccountId, "")
+	if err != nil {
+		return err
+	}
+	if err = a.clearMigration(); err != nil {
+		return err
+	}
+	elapsed := time.Since(start)
+	log.Debugf("%s in (%s)\n%s",
+		cmd.Colorfy(box.GetFullName(), "cyan", "", "bold"),
+		cmd.Colorfy(elapsed.String(), "green", "", "bold"),
+		cmd.Colorfy(outBuffer.String(), "yellow", "", ""))
+	return nil
+}
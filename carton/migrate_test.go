@@ -0,0 +1,53 @@
+package carton
+
+import (
+	"encoding/json"
+
+	"github.com/megamsys/libgo/utils"
+	"github.com/megamsys/vertice/provision"
+	"gopkg.in/check.v1"
+)
+
+func migrateAssembly(kv ...string) *Assembly {
+	in := make([]map[string]string, 0)
+	for i := 0; i < len(kv); i += 2 {
+		in = append(in, map[string]string{"key": kv[i], "value": kv[i+1]})
+	}
+	b, _ := json.Marshal(map[string]interface{}{"name": "web1", "inputs": in})
+	a := &Assembly{}
+	json.Unmarshal(b, a)
+	return a
+}
+
+func (s *S) TestAssemblyMigration(c *check.C) {
+	c.Assert(migrateAssembly(REGION, "chennai").migration(), check.IsNil)
+	m := migrateAssembly(REGION, "chennai", MIGRATE_CLUSTER, "101", MIGRATE_TYPE, "Live").migration()
+	c.Assert(m, check.DeepEquals, &provision.BoxMigration{Cluster: "101", Live: true})
+	c.Assert(m.CrossRegion("chennai"), check.Equals, false)
+	m = migrateAssembly(REGION, "chennai", MIGRATE_REGION, "sydney").migration()
+	c.Assert(m.Live, check.Equals, false)
+	c.Assert(m.CrossRegion("chennai"), check.Equals, true)
+	c.Assert(m.CrossRegion("sydney"), check.Equals, false)
+}
+
+func (s *S) TestValidateMigration(c *check.C) {
+	box := &provision.Box{CartonName: "web1", Region: "chennai", State: utils.StateRunning}
+	c.Assert(ValidateMigration(box), check.NotNil)
+	box.Migration = &provision.BoxMigration{Cluster: "101", Live: true}
+	c.Assert(ValidateMigration(box), check.IsNil)
+	box.Migration = &provision.BoxMigration{Region: "chennai"}
+	c.Assert(ValidateMigration(box), check.NotNil)
+	box.Migration = &provision.BoxMigration{Region: "sydney", Live: true}
+	c.Assert(ValidateMigration(box), check.NotNil)
+	box.Migration = &provision.BoxMigration{Region: "sydney"}
+	c.Assert(ValidateMigration(box), check.IsNil)
+	box.State = utils.StateStopped
+	box.Migration = &provision.BoxMigration{Cluster: "101", Live: true}
+	c.Assert(ValidateMigration(box), check.NotNil)
+}
+
+func (s *S) TestParseMigrate(c *check.C) {
+	md, err := NewReqParser("ASM001").ParseRequest(OPERATIONS, MIGRATE)
+	c.Assert(err, check.IsNil)
+	c.Assert(md, check.FitsTypeOf, MigrateProcess{})
+}
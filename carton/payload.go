@@ -48,12 +48,25 @@ func NewPayload(b []byte) (*Payload, error) {
 
 /**
 **fetch the request json from riak and parse the json to struct
+**duplicates of an accepted payload are dropped with ErrDuplicatePayload
 **/
 func (p *Payload) Convert() (*Requests, error) {
+	r, err := p.convert()
+	if err != nil {
+		return nil, err
+	}
+	if err = r.accept(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (p *Payload) convert() (*Requests, error) {
 	if len(strings.TrimSpace(p.CatId)) < 10 {
 		return listReqsById(p.Id, p.AccountId)
 	} else {
 		return &Requests{
+			Id:        p.Id,
 			Action:    p.Action,
 			Category:  p.Category,
 			AccountId: p.AccountId,
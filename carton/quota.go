@@ -2,8 +2,11 @@ package carton
 
 import (
 	"encoding/json"
+	"fmt"
 	"github.com/megamsys/libgo/api"
 	"github.com/megamsys/libgo/pairs"
+	"strconv"
+	"strings"
 )
 
 type Quota struct {
@@ -70,3 +73,79 @@ func (q *Quota) ContainerQuota() (bool, error) {
 func (q *Quota) AllowedSnaps() string {
 	return q.Allowed.Match("no_of_units")
 }
+
+//the quota of an account is the one of quota_type account, its allowed
+//limits are checked before anything is deployed or grown.
+const (
+	ACCOUNT_QUOTA = "account"
+
+	QUOTA_CPU       = "cpu"       //cores
+	QUOTA_RAM       = "ram"       //MB
+	QUOTA_STORAGE   = "storage"   //MB, the disks of the machines and the attached ones
+	QUOTA_INSTANCES = "instances" //machines and containers
+	QUOTA_SNAPSHOTS = "snapshots"
+
+	//the inputs of the account quota.
+	BALANCE_WARNINGS = "balance_warnings" //how long before the balance runs out it is warned, "7d,3d,24h"
+)
+
+// AccountQuota is the quota holding the limits of the account, nil when the
+// account has none.
+func AccountQuota(email string) (*Quota, error) {
+	cl := api.NewClient(newArgs(email, ""), "/quotas")
+	response, err := cl.Get()
+	if err != nil {
+		return nil, err
+	}
+	ac := &ApiQuota{}
+	if err = json.Unmarshal(response, ac); err != nil {
+		return nil, err
+	}
+	for i := range ac.Results {
+		if ac.Results[i].QuotaType == ACCOUNT_QUOTA {
+			return &ac.Results[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// BalanceWarnings are the warnings the account chose before its balance runs
+// out, empty when it didn't.
+func BalanceWarnings(email string) (string, error) {
+	q, err := AccountQuota(email)
+	if err != nil || q == nil {
+		return "", err
+	}
+	return strings.TrimSpace(q.Inputs.Match(BALANCE_WARNINGS)), nil
+}
+
+// Exceeded errors when the request added to the usage goes over an allowed limit.
+// Only the resources the request asks for are checked, a limit missing
+// from the quota is not enforced.
+func (q *Quota) Exceeded(used, req Usage) error {
+	for _, r := range []struct {
+		key       string
+		used, req uint64
+		unit      string
+	}{
+		{QUOTA_CPU, used.Cpu, req.Cpu, " cores"},
+		{QUOTA_RAM, used.Ram, req.Ram, "MB"},
+		{QUOTA_STORAGE, used.Storage, req.Storage, "MB"},
+		{QUOTA_INSTANCES, used.Instances, req.Instances, ""},
+		{QUOTA_SNAPSHOTS, used.Snapshots, req.Snapshots, ""},
+	} {
+		allowed := strings.TrimSpace(q.Allowed.Match(r.key))
+		if r.req == 0 || allowed == "" {
+			continue
+		}
+		limit, err := strconv.ParseUint(allowed, 10, 64)
+		if err != nil {
+			return fmt.Errorf("quota %s : %s is not a number (%s)", q.Id, r.key, allowed)
+		}
+		if r.used+r.req > limit {
+			return fmt.Errorf("over the %s quota of the account %s : %d%s used, %d%s requested, %d%s allowed",
+				r.key, q.AccountId, r.used, r.unit, r.req, r.unit, limit, r.unit)
+		}
+	}
+	return nil
+}
@@ -18,6 +18,9 @@ package carton
 import (
 	log "github.com/Sirupsen/logrus"
 	"github.com/megamsys/libgo/cmd"
+	constants "github.com/megamsys/libgo/utils"
+	"github.com/megamsys/vertice/instrument"
+	"time"
 )
 
 type ReqOperator struct {
@@ -41,7 +44,29 @@ func (p *ReqOperator) Accept(r *MegdProcessor) error {
 	}
 	md := *r
 	log.Debugf(cmd.Colorfy(md.String(), "cyan", "", "bold"))
-	return md.Process(c)
+	start := time.Now()
+	err = md.Process(c)
+	instrument.ProcessorSeconds.Since(start, p.Category, p.Action, instrument.Result(err))
+	return err
+}
+
+// Fail marks the assemblies operated by the request as errored, this is used
+// when a request is given up on.
+func (p *ReqOperator) Fail(cause error) error {
+	c, err := p.Get()
+	if err != nil {
+		return err
+	}
+	for _, ca := range c {
+		a, err := NewAssembly(ca.Id, ca.AccountId, ca.OrgId)
+		if err != nil {
+			return err
+		}
+		if err = a.SetStatusErr(constants.StatusError, cause); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 func (p *ReqOperator) Get() (Cartons, error) {
@@ -78,6 +103,9 @@ func (p *ReqOperator) Get() (Cartons, error) {
 			return nil, err
 		}
 		return c, nil
+	case BATCH:
+		//the batch finds its own cartons.
+		return Cartons{}, nil
 	default:
 		a, err := Get(p.CartonsId, p.AccountId)
 		if err != nil {
@@ -91,6 +119,40 @@ func (p *ReqOperator) Get() (Cartons, error) {
 	}
 }
 
+// AssemblyIds are the ids of the assemblies the request operates: the one of
+// its snapshot, disk or backup, or the ones of its assemblies. A batch or a
+// workflow finds its own assemblies, it has none.
+func (p *ReqOperator) AssemblyIds() ([]string, error) {
+	switch p.Category {
+	case BACKUPS:
+		b, err := GetBackup(p.CartonsId, p.AccountId)
+		if err != nil {
+			return nil, err
+		}
+		return []string{b.AssemblyId}, nil
+	case DISKS:
+		d, err := GetDisks(p.CartonsId, p.AccountId)
+		if err != nil {
+			return nil, err
+		}
+		return []string{d.AssemblyId}, nil
+	case SNAPSHOT:
+		s, err := GetSnap(p.CartonsId, p.AccountId)
+		if err != nil {
+			return nil, err
+		}
+		return []string{s.AssemblyId}, nil
+	case BATCH, WORKFLOW:
+		return nil, nil
+	default:
+		a, err := Get(p.CartonsId, p.AccountId)
+		if err != nil {
+			return nil, err
+		}
+		return a.AssemblysId, nil
+	}
+}
+
 // MegdProcessor represents a single operation in vertice.
 type MegdProcessor interface {
 	Process(c Cartons) error
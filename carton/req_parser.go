@@ -18,6 +18,7 @@ package carton
 import (
 	"fmt"
 	"gopkg.in/yaml.v2"
+	"regexp"
 	"strings"
 	"time"
 )
@@ -45,9 +46,11 @@ var (
 	HARD_STOP    = "hard-stop"
 	SUSPEND      = "suspend"
 
-	//the operation actions is just one called upgrade
+	//the operation actions are upgrade, migrate and resize
 	OPERATIONS = "operations"
 	UPGRADE    = "upgrade"
+	MIGRATE    = "migrate"
+	RESIZE     = "resize"
 
 	//snapshot actions
 	SNAPSHOT    = "snapshot"
@@ -67,6 +70,13 @@ var (
 	DISKS      = "disks"
 	ATTACHDISK = "attachdisk"
 	DETACHDISK = "detachdisk"
+
+	// workflow actions
+	WORKFLOW = "workflow"
+	RUN      = "run"
+
+	// batch actions, the batch is the cat_id
+	BATCH = "batch"
 )
 
 type ReqParser struct {
@@ -101,8 +111,12 @@ func (p *ReqParser) ParseRequest(category string, action string) (MegdProcessor,
 		return p.parseDisks(action)
 	case DONE:
 		return p.parseDone(action)
+	case WORKFLOW:
+		return p.parseWorkflow(action)
+	case BATCH:
+		return p.parseBatch(action)
 	default:
-		return nil, newParseError([]string{category, action}, []string{STATE, CONTROL, OPERATIONS, SNAPSHOT, DISKS, BACKUPS})
+		return nil, newParseError([]string{category, action}, []string{STATE, CONTROL, OPERATIONS, SNAPSHOT, DISKS, BACKUPS, WORKFLOW, BATCH})
 	}
 }
 
@@ -174,8 +188,16 @@ func (p *ReqParser) parseOperations(action string) (MegdProcessor, error) {
 		return UpdateNetworkProcess{
 			Name: p.name,
 		}, nil
+	case MIGRATE:
+		return MigrateProcess{
+			Name: p.name,
+		}, nil
+	case RESIZE:
+		return ResizeProcess{
+			Name: p.name,
+		}, nil
 	default:
-		return nil, newParseError([]string{OPERATIONS, action}, []string{UPGRADE})
+		return nil, newParseError([]string{OPERATIONS, action}, []string{UPGRADE, MIGRATE, RESIZE})
 	}
 }
 
@@ -247,6 +269,28 @@ func (p *ReqParser) parseDisks(action string) (MegdProcessor, error) {
 	}
 }
 
+func (p *ReqParser) parseWorkflow(action string) (MegdProcessor, error) {
+	switch action {
+	case RUN:
+		return WorkflowProcess{
+			Name: p.name,
+		}, nil
+	default:
+		return nil, newParseError([]string{WORKFLOW, action}, []string{RUN})
+	}
+}
+
+func (p *ReqParser) parseBatch(action string) (MegdProcessor, error) {
+	switch action {
+	case RUN:
+		return BatchProcess{
+			Name: p.name,
+		}, nil
+	default:
+		return nil, newParseError([]string{BATCH, action}, []string{RUN})
+	}
+}
+
 // ParseError represents an error that occurred during parsing.
 type ParseError struct {
 	Found    string
@@ -273,6 +317,16 @@ type Requests struct {
 	CreatedAt time.Time `json:"created_at" cql:"created_at"`
 }
 
+//idRegexp is what an id given by a user is made of, the ids of requests end
+//up in file names of the journal and the stores.
+var idRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// ValidId checks an id given by a user (of a schedule, a workflow or a batch)
+// can be used in a file name: letters, digits, '_' and '-' only.
+func ValidId(id string) bool {
+	return idRegexp.MatchString(id)
+}
+
 type ApiRequests struct {
 	JsonClaz string     `json:"json_claz" cql:"json_claz"`
 	Results  []Requests `json:"results" cql:"results"`
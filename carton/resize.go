@@ -0,0 +1,131 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+package carton
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/megamsys/libgo/cmd"
+	"github.com/megamsys/libgo/utils"
+	lw "github.com/megamsys/libgo/writer"
+	"github.com/megamsys/vertice/provision"
+)
+
+const (
+	//the flavor of a resize request is set in the inputs of the assembly.
+	RESIZE_FLAVOR_ID = "resize_flavor_id"
+
+	StatusResizing = utils.Status("resizing")
+	StatusResized  = utils.Status("resized")
+)
+
+func (a *Assembly) resizeFlavorId() string {
+	return strings.TrimSpace(a.Inputs.Match(RESIZE_FLAVOR_ID))
+}
+
+// switchFlavor makes the flavor the one of the assembly, the bills are
+// made with its costs from now on.
+func (a *Assembly) switchFlavor(f *Flavor) error {
+	m := map[string][]string{
+		FLAVOR_ID:     []string{f.Id},
+		provision.CPU: []string{f.getCpushare()},
+		provision.RAM: []string{f.getMemory()},
+		provision.HDD: []string{f.getHDD()},
+	}
+	if a.IsContainer() {
+		m[CONTAINER_CPU_COST] = []string{f.GetCpuCost()}
+		m[CONTAINER_MEMORY_COST] = []string{f.GetMemoryCost()}
+	} else {
+		m[VM_CPU_COST] = []string{f.GetCpuCost()}
+		m[VM_MEMORY_COST] = []string{f.GetMemoryCost()}
+		m[VM_DISK_COST] = []string{f.GetHDDCost()}
+	}
+	a.Inputs.NukeAndSet(m)
+	a.Inputs.NukeKeys(RESIZE_FLAVOR_ID)
+	return a.update()
+}
+
+// ValidateResize checks the resize of the box before it is handed to the provisioner.
+// A disk can only grow.
+func ValidateResize(box *provision.Box) error {
+	r := box.Resize
+	if r == nil {
+		return fmt.Errorf("box %s : no %s in the inputs", box.GetFullName(), RESIZE_FLAVOR_ID)
+	}
+	if r.GetCpushare() == 0 || r.GetMemory() == 0 {
+		return fmt.Errorf("box %s : flavor %s has no cpu or memory", box.GetFullName(), r.FlavorId)
+	}
+	if r.GetHDD() < box.GetHDD() {
+		return fmt.Errorf("box %s : disk of flavor %s is smaller than %dMB, it can't shrink", box.GetFullName(), r.FlavorId, box.GetHDD())
+	}
+	return nil
+}
+
+func Resize(box *provision.Box) error {
+	var outBuffer bytes.Buffer
+	start := time.Now()
+	logWriter := lw.LogWriter{Box: box}
+	logWriter.Async()
+	defer logWriter.Close()
+	writer := io.MultiWriter(&outBuffer, &logWriter)
+
+	a, err := NewAssembly(box.CartonId, box.AccountId, "")
+	if err != nil {
+		return err
+	}
+	if a.resizeFlavorId() == "" {
+		return fmt.Errorf("box %s : no %s in the inputs", box.GetFullName(), RESIZE_FLAVOR_ID)
+	}
+	flv, err := GetFlavor(box.AccountId, a.resizeFlavorId())
+	if err != nil {
+		return err
+	}
+	box.Resize = &provision.BoxResize{FlavorId: flv.Id, Compute: flv.compute()}
+	if err = ValidateResize(box); err != nil {
+		return err
+	}
+	if err = Admit(box, resizeUsage(box), writer); err != nil {
+		return err
+	}
+	resizer, ok := ProvisionerMap[box.Provider].(provision.Resizer)
+	if !ok {
+		return fmt.Errorf("provisioner %s of box %s cannot resize", box.Provider, box.GetFullName())
+	}
+	done := provisionerCall(box, "resize")
+	err = resizer.Resize(box, writer)
+	done(err)
+	if err != nil {
+		return err
+	}
+	//the provisioner updated the status, so the assembly is read again.
+	if a, err = NewAssembly(box.CartonId, box.AccountId, ""); err != nil {
+		return err
+	}
+	if err = a.switchFlavor(flv); err != nil {
+		return err
+	}
+	elapsed := time.Since(start)
+	log.Debugf("%s in (%s)\n%s",
+		cmd.Colorfy(box.GetFullName(), "cyan", "", "bold"),
+		cmd.Colorfy(elapsed.String(), "green", "", "bold"),
+		cmd.Colorfy(outBuffer.String(), "yellow", "", ""))
+	return nil
+}
@@ -0,0 +1,25 @@
+package carton
+
+import (
+	"github.com/megamsys/vertice/provision"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestValidateResize(c *check.C) {
+	box := &provision.Box{CartonName: "web1", Compute: provision.BoxCompute{Cpushare: "1", Memory: "1024 MB", HDD: "20 GB"}}
+	c.Assert(ValidateResize(box), check.NotNil)
+	box.Resize = &provision.BoxResize{FlavorId: "FLV001", Compute: provision.BoxCompute{Cpushare: "2", Memory: "2048 MB", HDD: "40 GB"}}
+	c.Assert(ValidateResize(box), check.IsNil)
+	box.Resize.Compute.HDD = "20 GB"
+	c.Assert(ValidateResize(box), check.IsNil)
+	box.Resize.Compute.HDD = "10 GB"
+	c.Assert(ValidateResize(box), check.NotNil)
+	box.Resize = &provision.BoxResize{FlavorId: "FLV002", Compute: provision.BoxCompute{HDD: "40 GB"}}
+	c.Assert(ValidateResize(box), check.NotNil)
+}
+
+func (s *S) TestParseResize(c *check.C) {
+	md, err := NewReqParser("ASM001").ParseRequest(OPERATIONS, RESIZE)
+	c.Assert(err, check.IsNil)
+	c.Assert(md, check.FitsTypeOf, ResizeProcess{})
+}
@@ -3,6 +3,7 @@ package carton
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	log "github.com/Sirupsen/logrus"
 	"github.com/megamsys/libgo/api"
 	"github.com/megamsys/libgo/cmd"
@@ -12,6 +13,7 @@ import (
 	"github.com/megamsys/vertice/meta"
 	"gopkg.in/yaml.v2"
 	"io"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -60,7 +62,12 @@ func CreateSnapshot(opts *DiskOpts) error {
 	logWriter.Async()
 	defer logWriter.Close()
 	writer := io.MultiWriter(&outBuffer, &logWriter)
+	if err := Admit(opts.B, Usage{Snapshots: 1}, writer); err != nil {
+		return err
+	}
+	done := provisionerCall(opts.B, "create_snapshot")
 	err := ProvisionerMap[opts.B.Provider].CreateSnapshot(opts.B, writer)
+	done(err)
 	elapsed := time.Since(start)
 
 	if err != nil {
@@ -82,7 +89,9 @@ func RestoreSnapshot(opts *DiskOpts) error {
 	logWriter.Async()
 	defer logWriter.Close()
 	writer := io.MultiWriter(&outBuffer, &logWriter)
+	done := provisionerCall(opts.B, "restore_snapshot")
 	err := ProvisionerMap[opts.B.Provider].RestoreSnapshot(opts.B, writer)
+	done(err)
 	elapsed := time.Since(start)
 
 	if err != nil {
@@ -104,7 +113,9 @@ func SnapshotSaveAs(opts *DiskOpts) error {
 	logWriter.Async()
 	defer logWriter.Close()
 	writer := io.MultiWriter(&outBuffer, &logWriter)
+	done := provisionerCall(opts.B, "create_snapshot")
 	err := ProvisionerMap[opts.B.Provider].CreateSnapshot(opts.B, writer)
+	done(err)
 	elapsed := time.Since(start)
 
 	if err != nil {
@@ -126,7 +137,9 @@ func DeleteSnapshot(opts *DiskOpts) error {
 	logWriter.Async()
 	defer logWriter.Close()
 	writer := io.MultiWriter(&outBuffer, &logWriter)
+	done := provisionerCall(opts.B, "delete_snapshot")
 	err := ProvisionerMap[opts.B.Provider].DeleteSnapshot(opts.B, writer)
+	done(err)
 	elapsed := time.Since(start)
 
 	if err != nil {
@@ -155,6 +168,9 @@ func GetSnap(id, email string) (*Snaps, error) {
 	if err != nil {
 		return nil, err
 	}
+	if len(res.Results) == 0 {
+		return nil, fmt.Errorf("snapshot %s not found", id)
+	}
 	a := &res.Results[0]
 	log.Debugf("Snaps %v", a)
 	return a, nil
@@ -207,6 +223,25 @@ func (s *Snaps) UpdateSnap() error {
 
 }
 
+// NewSnapOf adds the snapshot record a snapcreate of the assembly fills in,
+// named after the assembly and the suffix.
+func NewSnapOf(a *Assembly, suffix string) (*Snaps, error) {
+	s := &Snaps{
+		Id:         "SNP" + strconv.FormatInt(time.Now().UnixNano(), 10),
+		AccountId:  a.AccountId,
+		OrgId:      a.OrgId,
+		AssemblyId: a.Id,
+		Name:       a.Name + "-" + suffix,
+		Status:     constants.DEACTIVESNAP,
+		CreatedAt:  time.Now().Format(time.RFC3339),
+		Inputs:     a.Inputs,
+	}
+	if err := s.UpdateSnap(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
 func (s *Snaps) RemoveSnap() error {
 	cl := api.NewClient(newArgs(s.AccountId, s.OrgId), SNAPSHOTS+s.AssemblyId+"/"+s.Id)
 	if _, err := cl.Delete(); err != nil {
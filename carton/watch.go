@@ -0,0 +1,77 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+package carton
+
+import (
+	"sync"
+)
+
+// AssemblyWatcher is told when the addresses of an assembly change and when
+// it is destroyed, eg: the built-in dns server.
+type AssemblyWatcher interface {
+	AssemblyChanged(a *Assembly)
+	AssemblyRemoved(id string)
+}
+
+var watchers struct {
+	sync.RWMutex
+	all []AssemblyWatcher
+}
+
+// Watch adds a watcher of the assemblies.
+func Watch(w AssemblyWatcher) {
+	watchers.Lock()
+	defer watchers.Unlock()
+	watchers.all = append(watchers.all, w)
+}
+
+// Unwatch removes a watcher added by Watch.
+func Unwatch(w AssemblyWatcher) {
+	watchers.Lock()
+	defer watchers.Unlock()
+	for i, o := range watchers.all {
+		if o == w {
+			watchers.all = append(watchers.all[:i], watchers.all[i+1:]...)
+			return
+		}
+	}
+}
+
+func notifyChanged(a *Assembly) {
+	watchers.RLock()
+	defer watchers.RUnlock()
+	for _, w := range watchers.all {
+		w.AssemblyChanged(a)
+	}
+}
+
+func notifyRemoved(id string) {
+	watchers.RLock()
+	defer watchers.RUnlock()
+	for _, w := range watchers.all {
+		w.AssemblyRemoved(id)
+	}
+}
+
+//hasNetworkKeys is true when the outputs set have an address of the assembly.
+func hasNetworkKeys(m map[string][]string) bool {
+	for _, k := range NETWORK_KEYS {
+		if _, ok := m[k]; ok {
+			return true
+		}
+	}
+	return false
+}
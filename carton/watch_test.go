@@ -0,0 +1,30 @@
+package carton
+
+import (
+	"github.com/megamsys/libgo/utils"
+	"gopkg.in/check.v1"
+)
+
+type fakeWatcher struct {
+	changed []string
+	removed []string
+}
+
+func (w *fakeWatcher) AssemblyChanged(a *Assembly) { w.changed = append(w.changed, a.Id) }
+func (w *fakeWatcher) AssemblyRemoved(id string)   { w.removed = append(w.removed, id) }
+
+func (s *S) TestWatch(c *check.C) {
+	w := &fakeWatcher{}
+	Watch(w)
+	notifyChanged(&Assembly{Id: "ASM001"})
+	notifyRemoved("ASM002")
+	Unwatch(w)
+	notifyRemoved("ASM003")
+	c.Assert(w.changed, check.DeepEquals, []string{"ASM001"})
+	c.Assert(w.removed, check.DeepEquals, []string{"ASM002"})
+}
+
+func (s *S) TestHasNetworkKeys(c *check.C) {
+	c.Assert(hasNetworkKeys(map[string][]string{utils.PRIVATEIPV6: {"fd00::5"}}), check.Equals, true)
+	c.Assert(hasNetworkKeys(map[string][]string{VNCHOST: {"node1"}}), check.Equals, false)
+}
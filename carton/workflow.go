@@ -0,0 +1,564 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+package carton
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/megamsys/libgo/action"
+	constants "github.com/megamsys/libgo/utils"
+)
+
+const (
+	//a health check gate, it is not an operation on the cartons.
+	HEALTHCHECK = "healthcheck"
+
+	WorkflowPending     = "pending"
+	WorkflowRunning     = "running"
+	WorkflowDone        = "done"
+	WorkflowRolledBack  = "rolledback"
+	WorkflowFailed      = "failed"
+	WorkflowInterrupted = "interrupted"
+
+	StepPending    = "pending"
+	StepRunning    = "running"
+	StepDone       = "done"
+	StepFailed     = "failed"
+	StepUndone     = "undone"
+	StepUndoFailed = "undo_failed"
+
+	DefaultGateTimeout  = 5 * time.Minute
+	DefaultGateInterval = 10 * time.Second
+)
+
+var (
+	ErrWorkflowNotFound = errors.New("workflow not found")
+	ErrWorkflowDisabled = errors.New("workflows are not enabled")
+)
+
+//Global workflow store set by the subd daemons, nil means workflows are not run.
+var Workflows *WorkflowStore
+
+// WorkflowOp is an operation a workflow step runs on every carton of the step.
+// The category decides which cartons are operated, a snapshot op works on
+// the cartons of a snapshot.
+type WorkflowOp struct {
+	Category string
+	Run      func(c *Carton) error
+	// Undo is the default compensation of a done step, empty when there is nothing to undo.
+	Undo string
+}
+
+// WorkflowOps are the operations a step can name.
+var WorkflowOps = map[string]WorkflowOp{
+	SNAPCREATE:  {Category: SNAPSHOT, Run: (*Carton).CreateSnapshot, Undo: SNAPRESTORE},
+	SNAPRESTORE: {Category: SNAPSHOT, Run: (*Carton).RestoreSnapshot},
+	UPGRADE:     {Category: OPERATIONS, Run: (*Carton).Upgrade},
+	START:       {Category: CONTROL, Run: (*Carton).Start, Undo: STOP},
+	STOP:        {Category: CONTROL, Run: func(c *Carton) error { return c.Stop(false) }, Undo: START},
+	RESTART:     {Category: CONTROL, Run: func(c *Carton) error { return c.Restart(false) }},
+}
+
+// WorkflowStep is one operation of a workflow, or a health check gate when
+// the op is healthcheck. Target is the ids operated, comma separated, it
+// defaults to the assemblies of the workflow. The snapshot ops need the
+// snapshot ids, but for a snapcreate without a target, which adds a snapshot
+// record of every assembly and keeps their ids as its target.
+type WorkflowStep struct {
+	Op         string    `json:"op"`
+	Target     string    `json:"target"`
+	Undo       string    `json:"undo"`
+	Timeout    string    `json:"timeout"`
+	Interval   string    `json:"interval"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// Workflow chains carton operations on the assemblies CatId, eg: snapcreate, upgrade,
+// healthcheck. When a step fails, the done steps are compensated in the
+// reverse order, the snapcreate above is undone by restoring the snapshot.
+type Workflow struct {
+	Id        string          `json:"id"`
+	Name      string          `json:"name"`
+	CatId     string          `json:"cat_id"`
+	AccountId string          `json:"account_id"`
+	Steps     []*WorkflowStep `json:"steps"`
+	Status    string          `json:"status"`
+	Error     string          `json:"error"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+func (w *Workflow) String() string {
+	ops := make([]string, 0, len(w.Steps))
+	for _, s := range w.Steps {
+		ops = append(ops, s.Op)
+	}
+	return fmt.Sprintf("%s %s (%s) [%s] %s", w.Id, w.Name, w.CatId, strings.Join(ops, " > "), w.Status)
+}
+
+// Validate checks the ops, the compensations and the gate durations of the steps.
+func (w *Workflow) Validate() error {
+	if w.Id == "" || w.CatId == "" {
+		return fmt.Errorf("workflow needs an id and an assembly")
+	}
+	if !ValidId(w.Id) {
+		return fmt.Errorf("workflow %q : the id is made of letters, digits, '_' and '-' only", w.Id)
+	}
+	if len(w.Steps) == 0 {
+		return fmt.Errorf("workflow %s has no steps", w.Id)
+	}
+	for i, s := range w.Steps {
+		if s.Op == HEALTHCHECK {
+			if _, _, err := s.gate(); err != nil {
+				return fmt.Errorf("workflow %s step %d : %s", w.Id, i, err)
+			}
+			continue
+		}
+		op, ok := WorkflowOps[s.Op]
+		if !ok {
+			return fmt.Errorf("workflow %s step %d : unknown op %s", w.Id, i, s.Op)
+		}
+		if op.Category == SNAPSHOT && s.Op != SNAPCREATE && s.Target == "" {
+			return fmt.Errorf("workflow %s step %d : %s needs the snapshot as target", w.Id, i, s.Op)
+		}
+		undo, ok := WorkflowOps[s.undo()]
+		if s.undo() != "" && !ok {
+			return fmt.Errorf("workflow %s step %d : unknown undo %s", w.Id, i, s.undo())
+		}
+		if undo.Category == SNAPSHOT && op.Category != SNAPSHOT {
+			return fmt.Errorf("workflow %s step %d : undo %s needs a snapshot step", w.Id, i, s.undo())
+		}
+	}
+	return nil
+}
+
+func (s *WorkflowStep) undo() string {
+	if s.Undo != "" || s.Op == HEALTHCHECK {
+		return s.Undo
+	}
+	return WorkflowOps[s.Op].Undo
+}
+
+func (s *WorkflowStep) gate() (time.Duration, time.Duration, error) {
+	timeout, interval := DefaultGateTimeout, DefaultGateInterval
+	var err error
+	if s.Timeout != "" {
+		if timeout, err = time.ParseDuration(s.Timeout); err != nil {
+			return 0, 0, err
+		}
+	}
+	if s.Interval != "" {
+		if interval, err = time.ParseDuration(s.Interval); err != nil {
+			return 0, 0, err
+		}
+	}
+	return timeout, interval, nil
+}
+
+func (s *WorkflowStep) target(w *Workflow) string {
+	if s.Target != "" {
+		return s.Target
+	}
+	return w.CatId
+}
+
+//workflowCartons gets the cartons a step operates, replaced in tests.
+var workflowCartons = func(category, id, email string) (Cartons, error) {
+	return (&ReqOperator{CartonsId: id, Category: category, AccountId: email}).Get()
+}
+
+//workflowSnaps adds a snapshot record of every assembly of the workflow, replaced in tests.
+var workflowSnaps = func(w *Workflow) ([]string, error) {
+	asms, err := Get(w.CatId, w.AccountId)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(asms.AssemblysId))
+	for _, id := range asms.AssemblysId {
+		a, err := NewAssembly(id, w.AccountId, asms.OrgId)
+		if err != nil {
+			return nil, err
+		}
+		snp, err := NewSnapOf(a, w.Id)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, snp.Id)
+	}
+	return ids, nil
+}
+
+//assemblyRunning tells if the assembly passes the health check gate, replaced in tests.
+var assemblyRunning = func(id, email string) (bool, error) {
+	a, err := NewAssembly(id, email, "")
+	if err != nil {
+		return false, err
+	}
+	return a.State == constants.StateRunning.String(), nil
+}
+
+type workflowArgs struct {
+	store *WorkflowStore
+}
+
+// Run executes the steps of the workflow in an action pipeline, the state
+// of every step is saved in the store as it changes.
+func (w *Workflow) Run(store *WorkflowStore) error {
+	if err := w.Validate(); err != nil {
+		return err
+	}
+	actions := make([]*action.Action, 0, len(w.Steps))
+	for i := range w.Steps {
+		actions = append(actions, w.action(i))
+	}
+	w.Status, w.Error = WorkflowRunning, ""
+	store.save(w)
+	log.Infof("  workflow %s", w)
+
+	err := action.NewPipeline(actions...).Execute(workflowArgs{store: store})
+	if err != nil {
+		w.rolledBack(err)
+	} else {
+		w.Status = WorkflowDone
+	}
+	store.save(w)
+	log.Infof("  workflow %s", w)
+	return err
+}
+
+// Compensate undoes the done steps of a workflow interrupted by a stop of
+// vertice in the reverse order, as a failing step of Run does.
+func (w *Workflow) Compensate(store *WorkflowStore) {
+	cause := errors.New("interrupted by a stop of vertice")
+	for i := len(w.Steps) - 1; i >= 0; i-- {
+		if w.Steps[i].Status == StepDone {
+			w.undo(w.Steps[i], cause)
+			store.save(w)
+		}
+	}
+	w.rolledBack(cause)
+	store.save(w)
+	log.Infof("  workflow %s", w)
+}
+
+//rolledBack is the status after the done steps were undone, failed when an undo failed.
+func (w *Workflow) rolledBack(cause error) {
+	w.Status, w.Error = WorkflowRolledBack, cause.Error()
+	for _, s := range w.Steps {
+		if s.Status == StepUndoFailed {
+			w.Status = WorkflowFailed
+		}
+	}
+}
+
+//undo runs the compensation of the done step s, if it has one.
+func (w *Workflow) undo(s *WorkflowStep, cause error) {
+	if s.undo() == "" {
+		return
+	}
+	log.Warnf("  workflow %s undo %s by %s, %s", w.Id, s.Op, s.undo(), cause)
+	if err := w.run(WorkflowOps[s.undo()], s.target(w)); err != nil {
+		s.Status, s.Error = StepUndoFailed, err.Error()
+	} else {
+		s.Status = StepUndone
+	}
+}
+
+//action wraps the step i, a failing step rolls back the steps before it.
+func (w *Workflow) action(i int) *action.Action {
+	s := w.Steps[i]
+	return &action.Action{
+		Name: "workflow-" + s.Op,
+		Forward: func(ctx action.FWContext) (action.Result, error) {
+			args := ctx.Params[0].(workflowArgs)
+			s.Status, s.Error, s.StartedAt = StepRunning, "", time.Now()
+			args.store.save(w)
+			err := w.forward(s)
+			s.FinishedAt = time.Now()
+			if err != nil {
+				s.Status, s.Error = StepFailed, err.Error()
+				args.store.save(w)
+				return nil, fmt.Errorf("%s : %s", s.Op, err)
+			}
+			s.Status = StepDone
+			args.store.save(w)
+			return s, nil
+		},
+		Backward: func(ctx action.BWContext) {
+			args := ctx.Params[0].(workflowArgs)
+			if s.undo() == "" {
+				return
+			}
+			w.undo(s, ctx.CauseOf)
+			args.store.save(w)
+		},
+		MinParams: 1,
+	}
+}
+
+func (w *Workflow) forward(s *WorkflowStep) error {
+	if s.Op == HEALTHCHECK {
+		return w.healthcheck(s)
+	}
+	if s.Op == SNAPCREATE && s.Target == "" {
+		ids, err := workflowSnaps(w)
+		if err != nil {
+			return err
+		}
+		s.Target = strings.Join(ids, ",")
+	}
+	return w.run(WorkflowOps[s.Op], s.target(w))
+}
+
+func (w *Workflow) run(op WorkflowOp, target string) error {
+	for _, id := range strings.Split(target, ",") {
+		ca, err := workflowCartons(op.Category, id, w.AccountId)
+		if err != nil {
+			return err
+		}
+		for _, c := range ca {
+			if err = op.Run(c); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//healthcheck waits till the assemblies are running again.
+func (w *Workflow) healthcheck(s *WorkflowStep) error {
+	timeout, interval, err := s.gate()
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		ok, err := w.running()
+		if err != nil {
+			log.Debugf("  workflow %s healthcheck %s : %s", w.Id, w.CatId, err)
+		} else if ok {
+			return nil
+		}
+		if time.Now().Add(interval).After(deadline) {
+			return fmt.Errorf("%s is not running after %s", w.CatId, timeout)
+		}
+		time.Sleep(interval)
+	}
+}
+
+func (w *Workflow) running() (bool, error) {
+	ca, err := workflowCartons(OPERATIONS, w.CatId, w.AccountId)
+	if err != nil {
+		return false, err
+	}
+	for _, c := range ca {
+		if ok, err := assemblyRunning(c.Id, w.AccountId); err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// WorkflowStore keeps every workflow as a json file in a directory, so the
+// state of a workflow can be inspected while and after it runs.
+type WorkflowStore struct {
+	sync.Mutex
+	dir string
+}
+
+// NewWorkflowStore opens the workflows in dir. A workflow left running by a
+// stop of vertice is interrupted, its done steps are undone by the next run of
+// the workflows of its assemblies.
+func NewWorkflowStore(dir string) (*WorkflowStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &WorkflowStore{dir: dir}
+	wfs, err := s.List("")
+	if err != nil {
+		return nil, err
+	}
+	for _, w := range wfs {
+		if w.Status != WorkflowRunning {
+			continue
+		}
+		w.Status, w.Error = WorkflowInterrupted, "interrupted by a stop of vertice, the done steps are to be undone"
+		for _, st := range w.Steps {
+			if st.Status == StepRunning {
+				st.Status, st.Error = StepFailed, "interrupted"
+			}
+		}
+		log.Warnf("workflow %s was interrupted", w.Id)
+		if err = s.write(w); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Put adds a pending workflow, it is run by the next (workflow, run) request of its assemblies.
+func (s *WorkflowStore) Put(w *Workflow) error {
+	if err := w.Validate(); err != nil {
+		return err
+	}
+	w.Status, w.Error = WorkflowPending, ""
+	for _, st := range w.Steps {
+		st.Status, st.Error = StepPending, ""
+	}
+	if w.CreatedAt.IsZero() {
+		w.CreatedAt = time.Now()
+	}
+	s.Lock()
+	defer s.Unlock()
+	return s.write(w)
+}
+
+func (s *WorkflowStore) Get(id string) (*Workflow, error) {
+	if !ValidId(id) {
+		return nil, ErrWorkflowNotFound
+	}
+	s.Lock()
+	defer s.Unlock()
+	return s.read(s.path(id))
+}
+
+// List returns the workflows of the assemblies catId oldest first, all of them when catId is empty.
+func (s *WorkflowStore) List(catId string) ([]*Workflow, error) {
+	s.Lock()
+	defer s.Unlock()
+	files, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	wfs := make([]*Workflow, 0, len(files))
+	for _, f := range files {
+		w, err := s.read(f)
+		if err != nil {
+			log.Errorf("skipped workflow %s : %s", f, err)
+			continue
+		}
+		if catId == "" || w.CatId == catId {
+			wfs = append(wfs, w)
+		}
+	}
+	sort.Slice(wfs, func(i, j int) bool { return wfs[i].CreatedAt.Before(wfs[j].CreatedAt) })
+	return wfs, nil
+}
+
+// Pending returns the workflows of the assemblies catId that have not run yet.
+func (s *WorkflowStore) Pending(catId string) ([]*Workflow, error) {
+	return s.withStatus(catId, WorkflowPending)
+}
+
+// Interrupted returns the workflows of the assemblies catId whose done steps
+// are to be undone.
+func (s *WorkflowStore) Interrupted(catId string) ([]*Workflow, error) {
+	return s.withStatus(catId, WorkflowInterrupted)
+}
+
+func (s *WorkflowStore) withStatus(catId, status string) ([]*Workflow, error) {
+	all, err := s.List(catId)
+	if err != nil {
+		return nil, err
+	}
+	wfs := make([]*Workflow, 0)
+	for _, w := range all {
+		if w.Status == status {
+			wfs = append(wfs, w)
+		}
+	}
+	return wfs, nil
+}
+
+//save is used while a workflow runs, a failing write is logged and the workflow goes on.
+func (s *WorkflowStore) save(w *Workflow) {
+	s.Lock()
+	defer s.Unlock()
+	if err := s.write(w); err != nil {
+		log.Errorf("unable to save workflow %s : %s", w.Id, err)
+	}
+}
+
+func (s *WorkflowStore) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+func (s *WorkflowStore) read(file string) (*Workflow, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrWorkflowNotFound
+		}
+		return nil, err
+	}
+	w := &Workflow{}
+	if err = json.Unmarshal(b, w); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (s *WorkflowStore) write(w *Workflow) error {
+	w.UpdatedAt = time.Now()
+	b, err := json.MarshalIndent(w, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path(w.Id) + ".tmp"
+	if err = ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path(w.Id))
+}
+
+// RunWorkflows runs the pending workflows of the assemblies catId one after
+// another, once the interrupted ones are compensated.
+func RunWorkflows(catId string) error {
+	if Workflows == nil {
+		return ErrWorkflowDisabled
+	}
+	interrupted, err := Workflows.Interrupted(catId)
+	if err != nil {
+		return err
+	}
+	for _, w := range interrupted {
+		w.Compensate(Workflows)
+	}
+	wfs, err := Workflows.Pending(catId)
+	if err != nil {
+		return err
+	}
+	var failed error
+	for _, w := range wfs {
+		if err := w.Run(Workflows); err != nil {
+			failed = err
+		}
+	}
+	return failed
+}
@@ -0,0 +1,196 @@
+package carton
+
+import (
+	"errors"
+
+	"gopkg.in/check.v1"
+)
+
+type fakeOps struct {
+	ran     []string
+	failOn  string
+	running bool
+}
+
+func (f *fakeOps) install() func() {
+	ops, cartons, snaps, running := WorkflowOps, workflowCartons, workflowSnaps, assemblyRunning
+	op := func(name string) func(*Carton) error {
+		return func(ca *Carton) error {
+			f.ran = append(f.ran, name+":"+ca.CartonsId)
+			if name == f.failOn {
+				return errors.New(name + " failed")
+			}
+			return nil
+		}
+	}
+	WorkflowOps = map[string]WorkflowOp{
+		SNAPCREATE:  {Category: SNAPSHOT, Run: op(SNAPCREATE), Undo: SNAPRESTORE},
+		SNAPRESTORE: {Category: SNAPSHOT, Run: op(SNAPRESTORE)},
+		UPGRADE:     {Category: OPERATIONS, Run: op(UPGRADE)},
+	}
+	workflowCartons = func(category, id, email string) (Cartons, error) {
+		return Cartons{&Carton{Id: "ASM001", CartonsId: id, AccountId: email}}, nil
+	}
+	workflowSnaps = func(w *Workflow) ([]string, error) {
+		return []string{"SNP101", "SNP102"}, nil
+	}
+	assemblyRunning = func(id, email string) (bool, error) {
+		return f.running, nil
+	}
+	return func() {
+		WorkflowOps, workflowCartons, workflowSnaps, assemblyRunning = ops, cartons, snaps, running
+	}
+}
+
+func safeUpgrade() *Workflow {
+	return &Workflow{
+		Id:        "WFL001",
+		Name:      "safe-upgrade",
+		CatId:     "ASM001",
+		AccountId: "info@megam.io",
+		Steps: []*WorkflowStep{
+			{Op: SNAPCREATE, Target: "SNP001"},
+			{Op: UPGRADE},
+			{Op: HEALTHCHECK, Timeout: "10ms", Interval: "1ms"},
+		},
+	}
+}
+
+func (s *S) TestWorkflowRunsSteps(c *check.C) {
+	f := &fakeOps{running: true}
+	defer f.install()()
+	st, err := NewWorkflowStore(c.MkDir())
+	c.Assert(err, check.IsNil)
+	w := safeUpgrade()
+	c.Assert(st.Put(w), check.IsNil)
+	c.Assert(w.Run(st), check.IsNil)
+	c.Assert(f.ran, check.DeepEquals, []string{"snapcreate:SNP001", "upgrade:ASM001"})
+	saved, err := st.Get("WFL001")
+	c.Assert(err, check.IsNil)
+	c.Assert(saved.Status, check.Equals, WorkflowDone)
+	for _, step := range saved.Steps {
+		c.Assert(step.Status, check.Equals, StepDone)
+	}
+}
+
+func (s *S) TestWorkflowRestoresSnapshotWhenGateFails(c *check.C) {
+	f := &fakeOps{running: false}
+	defer f.install()()
+	st, err := NewWorkflowStore(c.MkDir())
+	c.Assert(err, check.IsNil)
+	w := safeUpgrade()
+	c.Assert(st.Put(w), check.IsNil)
+	c.Assert(w.Run(st), check.NotNil)
+	c.Assert(f.ran, check.DeepEquals, []string{"snapcreate:SNP001", "upgrade:ASM001", "snaprestore:SNP001"})
+	saved, err := st.Get("WFL001")
+	c.Assert(err, check.IsNil)
+	c.Assert(saved.Status, check.Equals, WorkflowRolledBack)
+	c.Assert(saved.Steps[0].Status, check.Equals, StepUndone)
+	c.Assert(saved.Steps[1].Status, check.Equals, StepDone)
+	c.Assert(saved.Steps[2].Status, check.Equals, StepFailed)
+}
+
+func (s *S) TestWorkflowFailedWhenUndoFails(c *check.C) {
+	f := &fakeOps{running: true, failOn: UPGRADE}
+	defer f.install()()
+	st, err := NewWorkflowStore(c.MkDir())
+	c.Assert(err, check.IsNil)
+	w := safeUpgrade()
+	w.Steps[0].Undo = UPGRADE
+	c.Assert(st.Put(w), check.IsNil)
+	c.Assert(w.Run(st), check.NotNil)
+	saved, err := st.Get("WFL001")
+	c.Assert(err, check.IsNil)
+	c.Assert(saved.Status, check.Equals, WorkflowFailed)
+	c.Assert(saved.Steps[0].Status, check.Equals, StepUndoFailed)
+	c.Assert(saved.Steps[2].Status, check.Equals, StepPending)
+}
+
+func (s *S) TestWorkflowValidate(c *check.C) {
+	w := safeUpgrade()
+	c.Assert(w.Validate(), check.IsNil)
+	w.Steps = append(w.Steps, &WorkflowStep{Op: "reboot"})
+	c.Assert(w.Validate(), check.NotNil)
+	w = safeUpgrade()
+	w.Steps[2].Timeout = "soon"
+	c.Assert(w.Validate(), check.NotNil)
+	w = safeUpgrade()
+	w.Steps[0] = &WorkflowStep{Op: SNAPRESTORE}
+	c.Assert(w.Validate(), check.ErrorMatches, ".* snaprestore needs the snapshot as target")
+	w = safeUpgrade()
+	w.Steps[1].Undo = SNAPRESTORE
+	c.Assert(w.Validate(), check.ErrorMatches, ".* undo snaprestore needs a snapshot step")
+}
+
+func (s *S) TestWorkflowSnapshotsTheAssemblies(c *check.C) {
+	f := &fakeOps{running: false}
+	defer f.install()()
+	st, err := NewWorkflowStore(c.MkDir())
+	c.Assert(err, check.IsNil)
+	w := safeUpgrade()
+	w.Steps[0].Target = ""
+	c.Assert(st.Put(w), check.IsNil)
+	c.Assert(w.Run(st), check.NotNil)
+	c.Assert(f.ran, check.DeepEquals, []string{"snapcreate:SNP101", "snapcreate:SNP102", "upgrade:ASM001",
+		"snaprestore:SNP101", "snaprestore:SNP102"})
+	saved, err := st.Get("WFL001")
+	c.Assert(err, check.IsNil)
+	c.Assert(saved.Steps[0].Target, check.Equals, "SNP101,SNP102")
+}
+
+func (s *S) TestWorkflowStoreCompensatesTheInterrupted(c *check.C) {
+	f := &fakeOps{running: true}
+	defer f.install()()
+	defer func(wf *WorkflowStore) { Workflows = wf }(Workflows)
+	dir := c.MkDir()
+	st, err := NewWorkflowStore(dir)
+	c.Assert(err, check.IsNil)
+	w := safeUpgrade()
+	c.Assert(st.Put(w), check.IsNil)
+	w.Status, w.Steps[0].Status, w.Steps[1].Status = WorkflowRunning, StepDone, StepRunning
+	st.save(w)
+	st, err = NewWorkflowStore(dir)
+	c.Assert(err, check.IsNil)
+	saved, err := st.Get("WFL001")
+	c.Assert(err, check.IsNil)
+	c.Assert(saved.Status, check.Equals, WorkflowInterrupted)
+	c.Assert(saved.Steps[0].Status, check.Equals, StepDone)
+	c.Assert(saved.Steps[1].Status, check.Equals, StepFailed)
+	c.Assert(saved.Steps[2].Status, check.Equals, StepPending)
+	Workflows = st
+	c.Assert(RunWorkflows("ASM001"), check.IsNil)
+	c.Assert(f.ran, check.DeepEquals, []string{"snaprestore:SNP001"})
+	saved, err = st.Get("WFL001")
+	c.Assert(err, check.IsNil)
+	c.Assert(saved.Status, check.Equals, WorkflowRolledBack)
+	c.Assert(saved.Steps[0].Status, check.Equals, StepUndone)
+}
+
+func (s *S) TestWorkflowRejectsIdsOutOfFileNames(c *check.C) {
+	w := safeUpgrade()
+	w.Id = "../batches/BAT001"
+	c.Assert(w.Validate(), check.ErrorMatches, "workflow .* : the id is made of .*")
+	st, err := NewWorkflowStore(c.MkDir())
+	c.Assert(err, check.IsNil)
+	_, err = st.Get("../WFL001")
+	c.Assert(err, check.Equals, ErrWorkflowNotFound)
+}
+
+func (s *S) TestWorkflowStorePending(c *check.C) {
+	f := &fakeOps{running: true}
+	defer f.install()()
+	st, err := NewWorkflowStore(c.MkDir())
+	c.Assert(err, check.IsNil)
+	done := safeUpgrade()
+	c.Assert(st.Put(done), check.IsNil)
+	c.Assert(done.Run(st), check.IsNil)
+	next := safeUpgrade()
+	next.Id = "WFL002"
+	c.Assert(st.Put(next), check.IsNil)
+	wfs, err := st.Pending("ASM001")
+	c.Assert(err, check.IsNil)
+	c.Assert(wfs, check.HasLen, 1)
+	c.Assert(wfs[0].Id, check.Equals, "WFL002")
+	_, err = st.Get("WFL003")
+	c.Assert(err, check.Equals, ErrWorkflowNotFound)
+}
@@ -42,6 +42,8 @@ func cmdRegistry(name string) *cmd.Manager {
 		}
 	})
 	m.Register(&run.Start{})
+	m.Register(&run.Reconcile{})
+	m.Register(&run.Statement{})
 	return m
 }
 
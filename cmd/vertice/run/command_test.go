@@ -16,6 +16,8 @@
 package run
 
 import (
+	"time"
+
 	"github.com/megamsys/libgo/cmd"
 	"gopkg.in/check.v1"
 )
@@ -34,3 +36,50 @@ func (s *S) TestMegamStartInfo(c *check.C) {
 	command := Start{}
 	c.Assert(command.Info(), check.DeepEquals, expected)
 }
+
+func (s *S) TestReconcileInfo(c *check.C) {
+	desc := `lists the gaps, overlaps and failed posts of the bills of an account.
+
+The periods billed that end between --from and --to are checked, given as
+2006-01-02 or 2006-01-02T15:04:05Z07:00, the last 30 days by default.
+`
+	expected := &cmd.Info{
+		Name:    "reconcile",
+		Usage:   `reconcile [--config] --account <email> [--from <time>] [--to <time>] [--json]`,
+		Desc:    desc,
+		MinArgs: 0,
+	}
+	command := Reconcile{}
+	c.Assert(command.Info(), check.DeepEquals, expected)
+}
+
+func (s *S) TestStatementInfo(c *check.C) {
+	desc := `writes the statement of an account as json, csv or html.
+
+The periods billed that end between --from and --to are in it, given as
+2006-01-02 or 2006-01-02T15:04:05Z07:00, the last month by default.
+`
+	expected := &cmd.Info{
+		Name:    "statement",
+		Usage:   `statement [--config] --account <email> [--from <time>] [--to <time>] [--format json|csv|html] [--output <file>]`,
+		Desc:    desc,
+		MinArgs: 0,
+	}
+	command := Statement{}
+	c.Assert(command.Info(), check.DeepEquals, expected)
+}
+
+func (s *S) TestParseTime(c *check.C) {
+	now := time.Now()
+	t, err := parseTime("", now)
+	c.Assert(err, check.IsNil)
+	c.Assert(t, check.Equals, now)
+	t, err = parseTime("2017-06-01", now)
+	c.Assert(err, check.IsNil)
+	c.Assert(t.Equal(time.Date(2017, 6, 1, 0, 0, 0, 0, time.Local)), check.Equals, true)
+	t, err = parseTime("2017-06-01T10:00:00Z", now)
+	c.Assert(err, check.IsNil)
+	c.Assert(t.Equal(time.Date(2017, 6, 1, 10, 0, 0, 0, time.UTC)), check.Equals, true)
+	_, err = parseTime("yesterday", now)
+	c.Assert(err, check.NotNil)
+}
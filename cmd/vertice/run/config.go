@@ -7,12 +7,16 @@ import (
 	"github.com/megamsys/vertice/storage"
 	"github.com/megamsys/vertice/subd/deployd"
 	"github.com/megamsys/vertice/subd/dns"
+	"github.com/megamsys/vertice/subd/dnsd"
 	"github.com/megamsys/vertice/subd/docker"
 	"github.com/megamsys/vertice/subd/eventsd"
 	"github.com/megamsys/vertice/subd/httpd"
 	"github.com/megamsys/vertice/subd/marketplacesd"
 	"github.com/megamsys/vertice/subd/metricsd"
+	"github.com/megamsys/vertice/subd/proxyd"
 	"github.com/megamsys/vertice/subd/rancher"
+	"github.com/megamsys/vertice/subd/retentiond"
+	"github.com/megamsys/vertice/subd/schedulerd"
 )
 
 type Config struct {
@@ -22,10 +26,14 @@ type Config struct {
 	Docker       *docker.Config        `toml:"docker"`
 	Metrics      *metricsd.Config      `toml:"metrics"`
 	DNS          *dns.Config           `toml:"dns"`
+	Dnsd         *dnsd.Config          `toml:"dnsd"`
+	Proxyd       *proxyd.Config        `toml:"proxyd"`
 	Events       *eventsd.Config       `toml:"events"`
 	Storage      *storage.Config       `toml:"storage"`
 	Rancher      *rancher.Config       `toml:"rancher"`
 	MarketPlaces *marketplacesd.Config `toml:"marketplaces"`
+	Scheduler    *schedulerd.Config    `toml:"scheduler"`
+	Retention    *retentiond.Config    `toml:"retention"`
 }
 
 func (c Config) String() string {
@@ -36,10 +44,14 @@ func (c Config) String() string {
 		c.Docker.String() + "\n" +
 		c.Metrics.String() + "\n" +
 		c.DNS.String() + "\n" +
+		c.Dnsd.String() + "\n" +
+		c.Proxyd.String() + "\n" +
 		c.Events.String() + "\n" +
 		c.Storage.String() + "\n" +
 		c.MarketPlaces.String() + "\n" +
-		c.Rancher.String())
+		c.Rancher.String() + "\n" +
+		c.Scheduler.String() + "\n" +
+		c.Retention.String())
 
 }
 
@@ -53,9 +65,13 @@ func NewConfig() *Config {
 	c.Metrics = metricsd.NewConfig()
 	c.Events = eventsd.NewConfig()
 	c.DNS = dns.NewConfig()
+	c.Dnsd = dnsd.NewConfig()
+	c.Proxyd = proxyd.NewConfig()
 	c.Storage = storage.NewConfig()
 	c.Rancher = rancher.NewConfig()
 	c.MarketPlaces = marketplacesd.NewConfig()
+	c.Scheduler = schedulerd.NewConfig()
+	c.Retention = retentiond.NewConfig()
 	return c
 }
 
@@ -0,0 +1,62 @@
+package run
+
+import (
+	"time"
+
+	"github.com/megamsys/vertice/hc"
+	"github.com/megamsys/vertice/router/powerdns"
+	"github.com/megamsys/vertice/router/rfc2136"
+	"github.com/megamsys/vertice/router/route53"
+	"github.com/megamsys/vertice/router/zonefile"
+)
+
+// registerHealth adds a health check for every backend enabled in the config,
+// they are served at /healthz. A check gives up at the health_timeout of httpd.
+func registerHealth(c *Config) {
+	timeout := time.Duration(c.HTTPD.HealthTimeout)
+	if c.Meta.Api != "" {
+		hc.Health.Register("gateway", "gateway", hc.HTTPCheck(c.Meta.Api, timeout))
+	}
+	for _, addr := range c.Meta.NSQd {
+		hc.Health.Register("nsq:"+addr, "nsq", hc.TCPCheck(addr, timeout))
+	}
+	if check := hc.NilavuCheck(c.Meta.Home, timeout); check != nil {
+		hc.Health.Register("nilavu", "nilavu", check)
+	}
+	if c.Deployd.One.Enabled {
+		for _, r := range c.Deployd.One.Regions {
+			hc.Health.Register("one:"+r.OneZone, "one", hc.OneCheck(r.OneEndPoint, r.OneUserid, r.OnePassword, timeout))
+		}
+	}
+	if c.Docker.Docker.Enabled {
+		for _, r := range c.Docker.Docker.Regions {
+			hc.Health.Register("docker:"+r.DockerZone, "docker", hc.DockerCheck(r.SwarmEndPoint, timeout))
+		}
+	}
+	if c.Rancher.Rancher.Enabled {
+		for _, r := range c.Rancher.Rancher.Regions {
+			hc.Health.Register("rancher:"+r.RancherZone, "rancher", hc.RancherCheck(r.RancherEndPoint, r.AdminAccess, r.AdminSecret, timeout))
+		}
+	}
+	if c.Storage.Enabled && c.Storage.RgwStorage.Enabled {
+		for _, r := range c.Storage.RgwStorage.Regions {
+			if r.Enabled {
+				hc.Health.Register("radosgw:"+r.Zone, "radosgw", hc.HTTPCheck(r.EndPoint, timeout))
+			}
+		}
+	}
+	if c.DNS.Enabled {
+		hc.Health.Register("route53", "route53", route53.HealthCheck(c.DNS.AccessKey, c.DNS.SecretKey))
+	}
+	//the routers of the regions, route53 is checked once with the keys above.
+	for _, r := range c.DNS.Regions {
+		switch r.Router {
+		case "rfc2136":
+			hc.Health.Register("rfc2136:"+r.Region, "rfc2136", rfc2136.HealthCheck(r, timeout))
+		case "powerdns":
+			hc.Health.Register("powerdns:"+r.Region, "powerdns", powerdns.HealthCheck(r, timeout))
+		case "zonefile":
+			hc.Health.Register("zonefile:"+r.Region, "zonefile", zonefile.HealthCheck(r))
+		}
+	}
+}
@@ -0,0 +1,137 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+package run
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/megamsys/libgo/cmd"
+	"github.com/megamsys/vertice/metrix"
+	"launchpad.net/gnuflag"
+)
+
+const dateLayout = "2006-01-02"
+
+// Reconcile lists the periods billed twice (overlaps), never billed (gaps) and
+// whose bill couldn't be posted, from the ledger of metricsd.
+type Reconcile struct {
+	fs      *gnuflag.FlagSet
+	file    configFile
+	account string
+	from    string
+	to      string
+	json    bool
+}
+
+func (g *Reconcile) Info() *cmd.Info {
+	desc := `lists the gaps, overlaps and failed posts of the bills of an account.
+
+The periods billed that end between --from and --to are checked, given as
+2006-01-02 or 2006-01-02T15:04:05Z07:00, the last 30 days by default.
+`
+	return &cmd.Info{
+		Name:    "reconcile",
+		Usage:   `reconcile [--config] --account <email> [--from <time>] [--to <time>] [--json]`,
+		Desc:    desc,
+		MinArgs: 0,
+	}
+}
+
+func (c *Reconcile) Run(context *cmd.Context) error {
+	if c.account == "" {
+		return fmt.Errorf("reconcile: --account is required")
+	}
+	to, err := parseTime(c.to, time.Now())
+	if err != nil {
+		return err
+	}
+	from, err := parseTime(c.from, to.AddDate(0, 0, -30))
+	if err != nil {
+		return err
+	}
+	l, err := openLedger(c.file.String())
+	if err != nil {
+		return err
+	}
+	found, err := l.Reconcile(c.account, from, to)
+	if err != nil {
+		return err
+	}
+	if c.json {
+		return json.NewEncoder(context.Stdout).Encode(found)
+	}
+	writeDiscrepancies(context.Stdout, found)
+	return nil
+}
+
+func (c *Reconcile) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = gnuflag.NewFlagSet("reconcile", gnuflag.ExitOnError)
+		c.fs.Var(&c.file, "config", "Path to configuration file (default to /vertice/vertice.conf)")
+		c.fs.Var(&c.file, "c", "Path to configuration file (default to /vertice/vertice.conf)")
+		c.fs.StringVar(&c.account, "account", "", "Email of the account")
+		c.fs.StringVar(&c.account, "a", "", "Email of the account")
+		c.fs.StringVar(&c.from, "from", "", "Start of the range")
+		c.fs.StringVar(&c.to, "to", "", "End of the range (default to now)")
+		c.fs.BoolVar(&c.json, "json", false, "Print the discrepancies as json")
+	}
+	return c.fs
+}
+
+//openLedger opens the ledger of metricsd in the config at path.
+func openLedger(path string) (*metrix.Ledger, error) {
+	config, err := (&Start{}).ParseConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	if config.Metrics.Ledger == nil || !config.Metrics.Ledger.Enabled {
+		return nil, fmt.Errorf("the ledger of metricsd isn't enabled")
+	}
+	return metrix.OpenLedger(config.Metrics.Ledger.Dir)
+}
+
+//parseTime parses a date or a time, def when it is empty.
+func parseTime(s string, def time.Time) (time.Time, error) {
+	if s == "" {
+		return def, nil
+	}
+	if t, err := time.ParseInLocation(dateLayout, s, time.Local); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return t, fmt.Errorf("%s is neither a date nor a time", s)
+	}
+	return t, nil
+}
+
+func writeDiscrepancies(out io.Writer, found []metrix.Discrepancy) {
+	if len(found) == 0 {
+		fmt.Fprintln(out, "no discrepancies.")
+		return
+	}
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tSENSOR\tASSEMBLY\tFROM\tTO\tDURATION\tERROR")
+	for _, d := range found {
+		fmt.Fprintf(w, "%s\t%s\t%s (%s)\t%s\t%s\t%s\t%s\n", d.Kind, d.SensorType, d.AssemblyName, d.AssemblyId,
+			d.Start.Format(time.RFC3339), d.End.Format(time.RFC3339), d.End.Sub(d.Start), d.Error)
+	}
+	w.Flush()
+}
@@ -8,15 +8,20 @@ import (
 
 	log "github.com/Sirupsen/logrus"
 	pp "github.com/megamsys/libgo/cmd"
+	"github.com/megamsys/vertice/api"
 	"github.com/megamsys/vertice/meta"
 	"github.com/megamsys/vertice/subd/deployd"
 	"github.com/megamsys/vertice/subd/dns"
+	"github.com/megamsys/vertice/subd/dnsd"
 	"github.com/megamsys/vertice/subd/docker"
 	"github.com/megamsys/vertice/subd/eventsd"
 	"github.com/megamsys/vertice/subd/httpd"
 	"github.com/megamsys/vertice/subd/marketplacesd"
 	"github.com/megamsys/vertice/subd/metricsd"
+	"github.com/megamsys/vertice/subd/proxyd"
 	"github.com/megamsys/vertice/subd/rancher"
+	"github.com/megamsys/vertice/subd/retentiond"
+	"github.com/megamsys/vertice/subd/schedulerd"
 )
 
 // Server represents a container for the metadata and storage data and services.
@@ -42,35 +47,80 @@ func NewServer(c *Config, version string) (*Server, error) {
 		closing: make(chan struct{}),
 	}
 
-	s.appendDeploydService(c.Meta, c.Deployd)
-	s.appendHTTPDService(c.HTTPD)
+	registerHealth(c)
+	dp := s.appendDeploydService(c.Meta, c.Deployd)
+	s.appendSchedulerdService(c.Scheduler, dp)
+	s.appendRetentiondService(c.Retention, dp)
+	s.appendHTTPDService(c.HTTPD, dp)
 	s.appendDockerService(c.Meta, c.Docker)
 	s.appendMetricsdService(c)
 	s.appendEventsdService(c.Meta, c.Events, c.Deployd)
 	s.appendRancherService(c.Meta, c.Rancher)
 	s.appendMarketplacesService(c.Meta, c.MarketPlaces, c.Deployd)
 	s.selfieDNS(c.DNS)
+	s.appendDnsdService(c.Dnsd)
+	s.appendProxydService(c.Proxyd, c.Docker)
 	c.Meta.MkGlobal() //a setter for global meta config
 	return s, nil
 }
 
-func (s *Server) appendDeploydService(c *meta.Config, d *deployd.Config) {
+func (s *Server) appendDeploydService(c *meta.Config, d *deployd.Config) *deployd.Service {
 	e := *d
 	if !e.One.Enabled {
 		log.Warn("skip oned service.")
-		return
+		return nil
 	}
 	srv := deployd.NewService(c, d)
 	s.Services = append(s.Services, srv)
+	return srv
+}
+
+//the scheduled requests are processed by the deployd workers, the schedules
+//are added over http.
+func (s *Server) appendSchedulerdService(c *schedulerd.Config, d *deployd.Service) {
+	if !c.Enabled {
+		log.Warn("skip schedulerd service.")
+		return
+	}
+	if d == nil {
+		log.Warn("skip schedulerd service, deployd is not enabled.")
+		return
+	}
+	srv := schedulerd.NewService(c, d)
+	api.Schedules = srv.Store
+	s.Services = append(s.Services, srv)
+}
+
+//the expired snapshots and backups are deleted by the deployd workers, a dry run only reports them.
+func (s *Server) appendRetentiondService(c *retentiond.Config, d *deployd.Service) {
+	if !c.Enabled {
+		log.Warn("skip retentiond service.")
+		return
+	}
+	if d == nil && !c.DryRun {
+		log.Warn("skip retentiond service, deployd is not enabled.")
+		return
+	}
+	var dp retentiond.Dispatcher
+	if d != nil {
+		dp = d
+	}
+	srv := retentiond.NewService(c, dp)
+	s.Services = append(s.Services, srv)
 }
 
-func (s *Server) appendHTTPDService(c *httpd.Config) {
+//the actions asked over http are processed by the deployd workers.
+func (s *Server) appendHTTPDService(c *httpd.Config, d *deployd.Service) {
 	e := *c
 	if !e.Enabled {
 		log.Warn("skip httpd service.")
 		return
 	}
-	srv := httpd.NewService(c)
+	var dp api.Dispatcher
+	if d != nil {
+		dp = d
+	}
+	srv := httpd.NewService(c, dp)
 	s.Services = append(s.Services, srv)
 }
 
@@ -127,6 +177,30 @@ func (s *Server) selfieDNS(c *dns.Config) {
 	c.MkGlobal()
 }
 
+func (s *Server) appendDnsdService(c *dnsd.Config) {
+	if !c.Enabled {
+		log.Warn("skip dnsd service.")
+		return
+	}
+	srv := dnsd.NewService(c)
+	s.Services = append(s.Services, srv)
+}
+
+func (s *Server) appendProxydService(c *proxyd.Config, d *docker.Config) {
+	if !c.Enabled {
+		log.Warn("skip proxyd service.")
+		return
+	}
+	var swarms []string
+	if d.Docker.Enabled {
+		for _, r := range d.Docker.Regions {
+			swarms = append(swarms, r.SwarmEndPoint)
+		}
+	}
+	srv := proxyd.NewService(c, swarms)
+	s.Services = append(s.Services, srv)
+}
+
 // Err returns an error channel that multiplexes all out of band errors received from all services.
 func (s *Server) Err() <-chan error { return s.err }
 
@@ -0,0 +1,103 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+package run
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/megamsys/libgo/cmd"
+	"github.com/megamsys/vertice/metrix"
+	"launchpad.net/gnuflag"
+)
+
+// Statement writes the statement of an account for a billing period from the
+// ledger of metricsd: what its assemblies, snapshots, backups and object
+// storage cost by resource, paid by a quota or deducted on demand.
+type Statement struct {
+	fs      *gnuflag.FlagSet
+	file    configFile
+	account string
+	from    string
+	to      string
+	format  string
+	output  string
+}
+
+func (g *Statement) Info() *cmd.Info {
+	desc := `writes the statement of an account as json, csv or html.
+
+The periods billed that end between --from and --to are in it, given as
+2006-01-02 or 2006-01-02T15:04:05Z07:00, the last month by default.
+`
+	return &cmd.Info{
+		Name:    "statement",
+		Usage:   `statement [--config] --account <email> [--from <time>] [--to <time>] [--format json|csv|html] [--output <file>]`,
+		Desc:    desc,
+		MinArgs: 0,
+	}
+}
+
+func (c *Statement) Run(context *cmd.Context) error {
+	if c.account == "" {
+		return fmt.Errorf("statement: --account is required")
+	}
+	now := time.Now()
+	to, err := parseTime(c.to, time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local))
+	if err != nil {
+		return err
+	}
+	from, err := parseTime(c.from, to.AddDate(0, -1, 0))
+	if err != nil {
+		return err
+	}
+	l, err := openLedger(c.file.String())
+	if err != nil {
+		return err
+	}
+	st, err := l.Statement(c.account, from, to)
+	if err != nil {
+		return err
+	}
+	var out io.Writer = context.Stdout
+	if c.output != "" {
+		f, err := os.Create(c.output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	return st.Write(out, c.format)
+}
+
+func (c *Statement) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = gnuflag.NewFlagSet("statement", gnuflag.ExitOnError)
+		c.fs.Var(&c.file, "config", "Path to configuration file (default to /vertice/vertice.conf)")
+		c.fs.Var(&c.file, "c", "Path to configuration file (default to /vertice/vertice.conf)")
+		c.fs.StringVar(&c.account, "account", "", "Email of the account")
+		c.fs.StringVar(&c.account, "a", "", "Email of the account")
+		c.fs.StringVar(&c.from, "from", "", "Start of the billing period (default to the start of the last month)")
+		c.fs.StringVar(&c.to, "to", "", "End of the billing period (default to the start of this month)")
+		c.fs.StringVar(&c.format, "format", metrix.JSON, "json, csv or html")
+		c.fs.StringVar(&c.output, "output", "", "File to write the statement to (default to the standard output)")
+		c.fs.StringVar(&c.output, "o", "", "File to write the statement to (default to the standard output)")
+	}
+	return c.fs
+}
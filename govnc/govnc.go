@@ -1,14 +1,20 @@
 package govnc
 
 import (
-	//"net"
-	//"time"
-	//"log"
+	"errors"
+	"io"
+	"net"
+	"time"
+
 	log "github.com/Sirupsen/logrus"
 	vnc "github.com/kward/go-vnc"
-	//"golang.org/x/net/context"
 )
 
+const dialTimeout = 10 * time.Second
+
+// ErrIdle ends a console nothing was typed or moved in for the idle timeout.
+var ErrIdle = errors.New("console idle, closed")
+
 type VncListener struct {
 	B <-chan vnc.ServerMessage
 }
@@ -19,6 +25,93 @@ type VncHost struct {
 	Password  string
 }
 
-func Connect(vh *VncHost) {
-	log.Debugf("%v", vh)
+// Connect bridges the client (a browser websocket) to the vnc server of the
+// host, until one of them closes or the client is idle. Both are closed on return.
+func Connect(vh *VncHost, client io.ReadWriteCloser, idle time.Duration) error {
+	log.Debugf("  console to %s:%s", vh.IpAddress, vh.Port)
+	server, err := net.DialTimeout("tcp", net.JoinHostPort(vh.IpAddress, vh.Port), dialTimeout)
+	if err != nil {
+		client.Close()
+		return err
+	}
+	defer server.Close()
+	defer client.Close()
+
+	active := make(chan struct{}, 1)
+	errs := make(chan error, 2)
+	go func() {
+		_, err := io.Copy(client, server)
+		errs <- err
+	}()
+	go func() {
+		errs <- copyActive(server, client, active)
+	}()
+
+	var timeout <-chan time.Time
+	var timer *time.Timer
+	if idle > 0 {
+		timer = time.NewTimer(idle)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	for {
+		select {
+		case err = <-errs:
+			return err
+		case <-active:
+			if timer != nil {
+				if !timer.Stop() {
+					<-timer.C
+				}
+				timer.Reset(idle)
+			}
+		case <-timeout:
+			return ErrIdle
+		}
+	}
+}
+
+//copyActive copies the messages of the client to the server, the ones
+//a user sends (keys, pointer, clipboard) mark the client active.
+func copyActive(dst io.Writer, src io.Reader, active chan<- struct{}) error {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				return werr
+			}
+			if !isUpdateRequest(buf[:n]) {
+				select {
+				case active <- struct{}{}:
+				default:
+				}
+			}
+		}
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+const (
+	updateRequestType = 3
+	updateRequestLen  = 10
+)
+
+// isUpdateRequest is true when the message only asks for framebuffer updates,
+// a client sends them all the time, even with nobody in front of it.
+func isUpdateRequest(b []byte) bool {
+	if len(b) == 0 || len(b)%updateRequestLen != 0 {
+		return false
+	}
+	for i := 0; i < len(b); i += updateRequestLen {
+		if b[i] != updateRequestType {
+			return false
+		}
+	}
+	return true
 }
@@ -0,0 +1,90 @@
+package govnc
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+type S struct{}
+
+var _ = check.Suite(&S{})
+
+//echoServer is a vnc server echoing what it gets.
+func echoServer(c *check.C) (*VncHost, func()) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, check.IsNil)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(conn, conn)
+		}
+	}()
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+	return &VncHost{IpAddress: host, Port: port}, func() { l.Close() }
+}
+
+func (s *S) TestIsUpdateRequest(c *check.C) {
+	req := []byte{3, 1, 0, 0, 0, 0, 4, 0, 3, 0}
+	c.Assert(isUpdateRequest(req), check.Equals, true)
+	c.Assert(isUpdateRequest(append(req, req...)), check.Equals, true)
+	c.Assert(isUpdateRequest([]byte{4, 1, 0, 0, 0, 0, 0, 97}), check.Equals, false)
+	c.Assert(isUpdateRequest(append(req, 5, 0, 0, 10, 0, 20)), check.Equals, false)
+	c.Assert(isUpdateRequest(nil), check.Equals, false)
+}
+
+func (s *S) TestConnect(c *check.C) {
+	vh, stop := echoServer(c)
+	defer stop()
+	client, browser := net.Pipe()
+	done := make(chan error, 1)
+	go func() { done <- Connect(vh, client, time.Minute) }()
+	_, err := browser.Write([]byte("RFB 003.008\n"))
+	c.Assert(err, check.IsNil)
+	buf := make([]byte, 12)
+	_, err = io.ReadFull(browser, buf)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(buf), check.Equals, "RFB 003.008\n")
+	browser.Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		c.Fatal("console not closed with the browser")
+	}
+}
+
+func (s *S) TestConnectIdle(c *check.C) {
+	vh, stop := echoServer(c)
+	defer stop()
+	client, browser := net.Pipe()
+	go io.Copy(ioutil.Discard, browser)
+	done := make(chan error, 1)
+	go func() { done <- Connect(vh, client, 200*time.Millisecond) }()
+	//update requests don't keep the console open.
+	for i := 0; i < 5; i++ {
+		browser.Write([]byte{3, 1, 0, 0, 0, 0, 4, 0, 3, 0})
+		time.Sleep(50 * time.Millisecond)
+	}
+	select {
+	case err := <-done:
+		c.Assert(err, check.Equals, ErrIdle)
+	case <-time.After(5 * time.Second):
+		c.Fatal("idle console not closed")
+	}
+}
+
+func (s *S) TestConnectRefused(c *check.C) {
+	vh, stop := echoServer(c)
+	stop()
+	client, _ := net.Pipe()
+	c.Assert(Connect(vh, client, 0), check.NotNil)
+}
@@ -0,0 +1,142 @@
+package hc
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+//clientOf gives up on a request at the timeout of the check, zero is the default.
+func clientOf(timeout time.Duration) *http.Client {
+	if timeout <= 0 {
+		timeout = DefaultHealthTimeout
+	}
+	return &http.Client{Timeout: timeout}
+}
+
+// HTTPCheck is up when the url answers, an error of the server is down.
+func HTTPCheck(url string, timeout time.Duration) func() error {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		url = "http://" + url
+	}
+	client := clientOf(timeout)
+	return func() error {
+		res, err := client.Get(url)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		if res.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("%s answered %s", url, res.Status)
+		}
+		return nil
+	}
+}
+
+// TCPCheck is up when the address takes a connection.
+func TCPCheck(addr string, timeout time.Duration) func() error {
+	if timeout <= 0 {
+		timeout = DefaultHealthTimeout
+	}
+	return func() error {
+		conn, err := net.DialTimeout("tcp", addr, timeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+}
+
+// DockerCheck pings the docker api of a swarm, given as tcp://host:port.
+func DockerCheck(swarm string, timeout time.Duration) func() error {
+	client := clientOf(timeout)
+	return func() error {
+		url := strings.TrimRight(strings.Replace(swarm, "tcp://", "http://", 1), "/") + "/_ping"
+		res, err := client.Get(url)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			return fmt.Errorf("%s answered %s", url, res.Status)
+		}
+		return nil
+	}
+}
+
+// RancherCheck reads the api of a rancher server with the keys of its region.
+func RancherCheck(endpoint, access, secret string, timeout time.Duration) func() error {
+	client := clientOf(timeout)
+	return func() error {
+		url := strings.TrimRight(endpoint, "/") + "/v2-beta"
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			return err
+		}
+		req.SetBasicAuth(access, secret)
+		res, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		switch {
+		case res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden:
+			return fmt.Errorf("%s refused the keys of %s", url, access)
+		case res.StatusCode >= http.StatusBadRequest:
+			return fmt.Errorf("%s answered %s", url, res.Status)
+		}
+		return nil
+	}
+}
+
+const oneVersion = `<?xml version="1.0"?><methodCall><methodName>one.system.version</methodName>` +
+	`<params><param><value><string>%s</string></value></param></params></methodCall>`
+
+//oneResponse is the xml-rpc answer of opennebula: [ok, version or error, ..].
+type oneResponse struct {
+	Values []struct {
+		Boolean string `xml:"boolean"`
+		String  string `xml:"string"`
+	} `xml:"params>param>value>array>data>value"`
+	Fault string `xml:"fault>value>struct>member>value>string"`
+}
+
+// OneCheck asks the version of opennebula at the xml-rpc endpoint, with the
+// user of the region so wrong credentials are down too.
+func OneCheck(endpoint, user, password string, timeout time.Duration) func() error {
+	client := clientOf(timeout)
+	return func() error {
+		var body bytes.Buffer
+		xml.EscapeText(&body, []byte(user+":"+password))
+		res, err := client.Post(endpoint, "text/xml", strings.NewReader(fmt.Sprintf(oneVersion, body.String())))
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			return fmt.Errorf("%s answered %s", endpoint, res.Status)
+		}
+		data, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			return err
+		}
+		var r oneResponse
+		if err = xml.Unmarshal(data, &r); err != nil {
+			return fmt.Errorf("%s : %s", endpoint, err)
+		}
+		switch {
+		case r.Fault != "":
+			return fmt.Errorf("%s : %s", endpoint, r.Fault)
+		case len(r.Values) < 2:
+			return fmt.Errorf("%s : no version in the answer", endpoint)
+		case r.Values[0].Boolean != "1":
+			return fmt.Errorf("%s : %s", endpoint, r.Values[1].String)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,181 @@
+package hc
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	ComponentUnknown = "unknown"
+	ComponentUp      = "up"
+	ComponentDown    = "down"
+
+	HealthOk       = "ok"
+	HealthDegraded = "degraded"
+	HealthDown     = "down"
+
+	// DefaultHealthTimeout is how long a check runs before its component is down.
+	DefaultHealthTimeout = 10 * time.Second
+)
+
+// DefaultRequires are the components vertice isn't ready without.
+var DefaultRequires = []string{"gateway", "nsq"}
+
+// Health are the backends configured in vertice.conf, checked in the background.
+var Health = NewComponents(0)
+
+// ComponentStatus is the last check of a component.
+type ComponentStatus struct {
+	Name        string     `json:"name"`
+	Kind        string     `json:"kind"`
+	Required    bool       `json:"required"`
+	Status      string     `json:"status"`
+	LatencyMs   float64    `json:"latency_ms"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+	CheckedAt   *time.Time `json:"checked_at,omitempty"`
+}
+
+// Report is the health of every component. vertice is ready when all the
+// required ones are up.
+type Report struct {
+	Status     string            `json:"status"`
+	Ready      bool              `json:"ready"`
+	Components []ComponentStatus `json:"components"`
+}
+
+type component struct {
+	ComponentStatus
+	check   func() error
+	running bool
+}
+
+type Components struct {
+	mu      sync.Mutex
+	all     map[string]*component
+	Timeout time.Duration
+	//Requires are the names or kinds of the required components.
+	Requires []string
+}
+
+// NewComponents makes the components, the default timeout is used for zero.
+func NewComponents(timeout time.Duration) *Components {
+	if timeout <= 0 {
+		timeout = DefaultHealthTimeout
+	}
+	return &Components{
+		all:      make(map[string]*component),
+		Timeout:  timeout,
+		Requires: DefaultRequires,
+	}
+}
+
+// Register adds a component checked by check, a component of the same name is replaced.
+func (c *Components) Register(name, kind string, check func() error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.all[name] = &component{
+		ComponentStatus: ComponentStatus{Name: name, Kind: kind, Status: ComponentUnknown},
+		check:           check,
+	}
+}
+
+func (c *Components) required(cp *component) bool {
+	for _, r := range c.Requires {
+		if r == cp.Name || r == cp.Kind {
+			return true
+		}
+	}
+	return false
+}
+
+// Check runs the checks of all the components at once. A check still running
+// from a previous time is left alone, its component stays as it is.
+func (c *Components) Check() {
+	c.mu.Lock()
+	all := make([]*component, 0, len(c.all))
+	for _, cp := range c.all {
+		if !cp.running {
+			cp.running = true
+			all = append(all, cp)
+		}
+	}
+	timeout := c.Timeout
+	c.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, cp := range all {
+		wg.Add(1)
+		go func(cp *component) {
+			defer wg.Done()
+			c.checkOne(cp, timeout)
+		}(cp)
+	}
+	wg.Wait()
+}
+
+func (c *Components) checkOne(cp *component, timeout time.Duration) {
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() {
+		err := cp.check()
+		c.mu.Lock()
+		cp.running = false
+		c.mu.Unlock()
+		done <- err
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-time.After(timeout):
+		err = fmt.Errorf("no answer in %s", timeout)
+	}
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cp.CheckedAt = &now
+	cp.LatencyMs = float64(now.Sub(start)) / float64(time.Millisecond)
+	cp.Status = ComponentUp
+	if err != nil {
+		cp.Status, cp.LastError, cp.LastErrorAt = ComponentDown, err.Error(), &now
+	}
+}
+
+// Run checks the components every interval until stop is closed.
+func (c *Components) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		c.Check()
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Report is the health as of the last checks, sorted by name.
+func (c *Components) Report() Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	r := Report{Status: HealthOk, Ready: true, Components: make([]ComponentStatus, 0, len(c.all))}
+	for _, cp := range c.all {
+		st := cp.ComponentStatus
+		st.Required = c.required(cp)
+		if st.Status != ComponentUp {
+			r.Status = HealthDegraded
+			if st.Required {
+				r.Ready = false
+			}
+		}
+		r.Components = append(r.Components, st)
+	}
+	if !r.Ready {
+		r.Status = HealthDown
+	}
+	sort.Slice(r.Components, func(i, j int) bool { return r.Components[i].Name < r.Components[j].Name })
+	return r
+}
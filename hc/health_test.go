@@ -0,0 +1,145 @@
+package hc
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type S struct{}
+
+var _ = check.Suite(&S{})
+
+func (s *S) TestReport(c *check.C) {
+	h := NewComponents(0)
+	nsqDown := errors.New("connection refused")
+	h.Register("nsq:localhost:4150", "nsq", func() error { return nsqDown })
+	h.Register("gateway", "gateway", func() error { return nil })
+	h.Register("one:chennai", "one", func() error { return nil })
+	r := h.Report()
+	c.Assert(r.Ready, check.Equals, false)
+	c.Assert(r.Components[0].Status, check.Equals, ComponentUnknown)
+
+	h.Check()
+	r = h.Report()
+	c.Assert(r.Status, check.Equals, HealthDown)
+	c.Assert(r.Ready, check.Equals, false)
+	c.Assert(r.Components, check.HasLen, 3)
+	c.Assert(r.Components[0].Name, check.Equals, "gateway")
+	c.Assert(r.Components[0].Required, check.Equals, true)
+	c.Assert(r.Components[1].Required, check.Equals, true)
+	c.Assert(r.Components[1].Status, check.Equals, ComponentDown)
+	c.Assert(r.Components[1].LastError, check.Equals, "connection refused")
+	c.Assert(r.Components[2].Required, check.Equals, false)
+	c.Assert(r.Components[2].CheckedAt, check.NotNil)
+
+	//back up, the last error is kept.
+	nsqDown = nil
+	h.Check()
+	r = h.Report()
+	c.Assert(r.Status, check.Equals, HealthOk)
+	c.Assert(r.Ready, check.Equals, true)
+	c.Assert(r.Components[1].Status, check.Equals, ComponentUp)
+	c.Assert(r.Components[1].LastError, check.Equals, "connection refused")
+
+	h.Register("one:sydney", "one", func() error { return errors.New("no answer") })
+	h.Check()
+	r = h.Report()
+	c.Assert(r.Status, check.Equals, HealthDegraded)
+	c.Assert(r.Ready, check.Equals, true)
+	h.Requires = []string{"one:sydney"}
+	c.Assert(h.Report().Ready, check.Equals, false)
+}
+
+func (s *S) TestCheckTimeout(c *check.C) {
+	h := NewComponents(50 * time.Millisecond)
+	release := make(chan struct{})
+	calls := make(chan struct{}, 2)
+	h.Register("gateway", "gateway", func() error {
+		calls <- struct{}{}
+		<-release
+		return nil
+	})
+	h.Check()
+	r := h.Report()
+	c.Assert(r.Components[0].Status, check.Equals, ComponentDown)
+	c.Assert(r.Components[0].LastError, check.Equals, "no answer in 50ms")
+	//the check is still running, it isn't run twice.
+	h.Check()
+	c.Assert(len(calls), check.Equals, 1)
+	close(release)
+}
+
+func (s *S) TestOneCheck(c *check.C) {
+	answer := `<?xml version="1.0"?><methodResponse><params><param><value><array><data>` +
+		`<value><boolean>%s</boolean></value><value><string>%s</string></value>` +
+		`<value><i4>0</i4></value></data></array></value></param></params></methodResponse>`
+	var body string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, body)
+	}))
+	defer srv.Close()
+	body = fmt.Sprintf(answer, "1", "5.2.0")
+	c.Assert(OneCheck(srv.URL, "oneadmin", "onepass", 0)(), check.IsNil)
+	body = fmt.Sprintf(answer, "0", "[one.system.version] User couldn't be authenticated, aborting call.")
+	c.Assert(OneCheck(srv.URL, "oneadmin", "bad", 0)(), check.ErrorMatches, ".*User couldn't be authenticated.*")
+}
+
+func (s *S) TestRancherAndDockerCheck(c *check.C) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/_ping":
+			w.Write([]byte("OK"))
+		case "/v2-beta":
+			if u, p, _ := r.BasicAuth(); u != "access" || p != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	c.Assert(DockerCheck("tcp://"+srv.Listener.Addr().String(), 0)(), check.IsNil)
+	c.Assert(RancherCheck(srv.URL, "access", "secret", 0)(), check.IsNil)
+	c.Assert(RancherCheck(srv.URL, "access", "wrong", 0)(), check.ErrorMatches, ".*refused the keys of access")
+	c.Assert(HTTPCheck(srv.Listener.Addr().String(), 0)(), check.IsNil)
+}
+
+func (s *S) TestHTTPCheckTimeout(c *check.C) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+	start := time.Now()
+	c.Assert(HTTPCheck(srv.URL, 50*time.Millisecond)(), check.NotNil)
+	c.Assert(time.Since(start) < DefaultHealthTimeout, check.Equals, true)
+}
+
+func (s *S) TestNilavuCheck(c *check.C) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+	home := c.MkDir()
+	c.Assert(NilavuCheck(home, 0), check.IsNil)
+	conf := filepath.Join(home, "nilavu.conf")
+	c.Assert(ioutil.WriteFile(conf, []byte("defaults:\n  logs: ws://localhost:7777\n"), 0644), check.IsNil)
+	nc := NilavuCheck(home, 0)
+	c.Assert(nc(), check.ErrorMatches, "no api in .*nilavu.conf")
+	c.Assert(ioutil.WriteFile(conf, []byte("defaults:\n  api: "+srv.URL+"\n"), 0644), check.IsNil)
+	c.Assert(nc(), check.IsNil)
+	c.Assert(os.Remove(conf), check.IsNil)
+	c.Assert(nc(), check.NotNil)
+}
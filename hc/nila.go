@@ -1,9 +1,11 @@
 package hc
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/megamsys/libgo/hc"
 	"github.com/megamsys/vertice/meta"
@@ -15,23 +17,51 @@ func init() {
 }
 
 func healthCheck() (interface{}, error) {
-	filename := filepath.Join(meta.MC.Home, "nilavu.conf")
+	m, err := readNilavu(meta.MC.Home)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+//readNilavu parses the nilavu.conf in home, nilavu is disabled without one.
+func readNilavu(home string) (MiniNilavu, error) {
+	filename := filepath.Join(home, "nilavu.conf")
 	if _, err := os.Stat(filename); err != nil {
-		return nil, hc.ErrDisabledComponent
+		return MiniNilavu{}, hc.ErrDisabledComponent
 	}
 	var m MiniNilavu
 	if dat, err := ioutil.ReadFile(filename); err == nil {
 		n := nilavu{}
 		if err = n.mkNilavu(dat); err != nil {
-			return nil, err
+			return m, err
 		}
 		m = mkMiniNilavu(&n)
 	} else {
-		return nil, err
+		return m, err
 	}
 	return m, nil
 }
 
+// NilavuCheck reads the nilavu.conf in home and checks the api nilavu is set
+// up with answers. It is nil when there is no nilavu.conf, nilavu isn't
+// installed alongside.
+func NilavuCheck(home string, timeout time.Duration) func() error {
+	if _, err := readNilavu(home); err == hc.ErrDisabledComponent {
+		return nil
+	}
+	return func() error {
+		m, err := readNilavu(home)
+		if err != nil {
+			return err
+		}
+		if m.Api == "" {
+			return fmt.Errorf("no api in %s", filepath.Join(home, "nilavu.conf"))
+		}
+		return HTTPCheck(m.Api, timeout)()
+	}
+}
+
 func (n *nilavu) mkNilavu(data []byte) error {
 	if err := yaml.Unmarshal(data, n); err != nil {
 		return err
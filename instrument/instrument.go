@@ -0,0 +1,254 @@
+// Package instrument keeps the counters and histograms of vertice, they are
+// exposed to prometheus in its text format (0.0.4).
+package instrument
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var (
+	// DefBuckets are the buckets of short calls, in seconds.
+	DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+	// LongBuckets are the buckets of calls to the clouds, in seconds.
+	LongBuckets = []float64{1, 5, 15, 30, 60, 120, 300, 600, 1200, 1800}
+)
+
+// Default is the registry served at /metrics.
+var Default = NewRegistry()
+
+type metric interface {
+	name() string
+	write(w *bufio.Writer)
+}
+
+// Registry is a set of metrics, served by name.
+type Registry struct {
+	mu  sync.Mutex
+	all map[string]metric
+}
+
+func NewRegistry() *Registry {
+	return &Registry{all: make(map[string]metric)}
+}
+
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.all[m.name()]; ok {
+		panic("instrument: metric " + m.name() + " registered twice")
+	}
+	r.all[m.name()] = m
+}
+
+// Counter makes a counter with the labels and registers it.
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	c := &Counter{vec: newVec(name, help, labels)}
+	r.register(c)
+	return c
+}
+
+// Histogram makes a histogram of the buckets (upper bounds, ascending) with
+// the labels and registers it.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{vec: newVec(name, help, labels), buckets: buckets}
+	r.register(h)
+	return h
+}
+
+// ServeHTTP writes every metric, sorted by name.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	ms := make([]metric, 0, len(r.all))
+	for _, m := range r.all {
+		ms = append(ms, m)
+	}
+	r.mu.Unlock()
+	sort.Slice(ms, func(i, j int) bool { return ms[i].name() < ms[j].name() })
+	w.Header().Set("Content-Type", ContentType)
+	bw := bufio.NewWriter(w)
+	for _, m := range ms {
+		m.write(bw)
+	}
+	bw.Flush()
+}
+
+//vec keeps a series by the values of its labels.
+type vec struct {
+	mu     sync.Mutex
+	metric string
+	help   string
+	labels []string
+	series map[string]interface{}
+}
+
+func newVec(name, help string, labels []string) vec {
+	return vec{metric: name, help: help, labels: labels, series: make(map[string]interface{})}
+}
+
+func (v *vec) name() string { return v.metric }
+
+//key is the label values, a missing one is empty and the extra ones are dropped.
+func (v *vec) key(values []string) string {
+	vs := make([]string, len(v.labels))
+	copy(vs, values)
+	return strings.Join(vs, "\xff")
+}
+
+//keys are the series sorted, so the output is the same between scrapes.
+func (v *vec) keys() []string {
+	ks := make([]string, 0, len(v.series))
+	for k := range v.series {
+		ks = append(ks, k)
+	}
+	sort.Strings(ks)
+	return ks
+}
+
+//pairs renders the labels of the key, with the extra name/value given.
+func (v *vec) pairs(key string, extra ...string) string {
+	if len(v.labels) == 0 && len(extra) == 0 {
+		return ""
+	}
+	ps := make([]string, 0, len(v.labels)+1)
+	if len(v.labels) > 0 {
+		for i, val := range strings.Split(key, "\xff") {
+			ps = append(ps, v.labels[i]+`="`+escape(val)+`"`)
+		}
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		ps = append(ps, extra[i]+`="`+escape(extra[i+1])+`"`)
+	}
+	return "{" + strings.Join(ps, ",") + "}"
+}
+
+func (v *vec) header(w *bufio.Writer, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", v.metric, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(v.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.metric, typ)
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+func format(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// Counter is a total that only goes up, per label values.
+type Counter struct {
+	vec
+}
+
+// Inc adds one to the series of the label values.
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds n to the series of the label values, a negative n is ignored.
+func (c *Counter) Add(n float64, values ...string) {
+	if n < 0 {
+		return
+	}
+	k := c.key(values)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, _ := c.series[k].(float64)
+	c.series[k] = t + n
+}
+
+// Value is the total of the label values.
+func (c *Counter) Value(values ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t, _ := c.series[c.key(values)].(float64)
+	return t
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.header(w, "counter")
+	for _, k := range c.keys() {
+		fmt.Fprintf(w, "%s%s %s\n", c.metric, c.pairs(k), format(c.series[k].(float64)))
+	}
+}
+
+// Histogram counts the observations in buckets, per label values.
+type Histogram struct {
+	vec
+	buckets []float64
+}
+
+type histogramSeries struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// Observe counts v in the series of the label values.
+func (h *Histogram) Observe(v float64, values ...string) {
+	k := h.key(values)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[k].(*histogramSeries)
+	if !ok {
+		s = &histogramSeries{counts: make([]uint64, len(h.buckets))}
+		h.series[k] = s
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.sum += v
+	s.count++
+}
+
+// Since observes the seconds since start, eg: defer h.Since(time.Now(), "vms").
+func (h *Histogram) Since(start time.Time, values ...string) {
+	h.Observe(time.Since(start).Seconds(), values...)
+}
+
+// Count is the number of observations of the label values.
+func (h *Histogram) Count(values ...string) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s, ok := h.series[h.key(values)].(*histogramSeries); ok {
+		return s.count
+	}
+	return 0
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.header(w, "histogram")
+	for _, k := range h.keys() {
+		s := h.series[k].(*histogramSeries)
+		var cum uint64
+		for i, b := range h.buckets {
+			cum += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.metric, h.pairs(k, "le", format(b)), cum)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.metric, h.pairs(k, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.metric, h.pairs(k), format(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.metric, h.pairs(k), s.count)
+	}
+}
@@ -0,0 +1,73 @@
+package instrument
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type S struct{}
+
+var _ = check.Suite(&S{})
+
+func (s *S) scrape(c *check.C, r *Registry) string {
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	r.ServeHTTP(w, req)
+	c.Assert(w.Header().Get("Content-Type"), check.Equals, ContentType)
+	return w.Body.String()
+}
+
+func (s *S) TestCounter(c *check.C) {
+	r := NewRegistry()
+	ct := r.Counter("vertice_test_total", "Test \"counter\".", "topic")
+	ct.Inc("vms")
+	ct.Add(2, "vms")
+	ct.Add(-1, "vms")
+	ct.Inc(`a"b\c`)
+	c.Assert(ct.Value("vms"), check.Equals, float64(3))
+	c.Assert(s.scrape(c, r), check.Equals, `# HELP vertice_test_total Test "counter".
+# TYPE vertice_test_total counter
+vertice_test_total{topic="a\"b\\c"} 1
+vertice_test_total{topic="vms"} 3
+`)
+}
+
+func (s *S) TestHistogram(c *check.C) {
+	r := NewRegistry()
+	h := r.Histogram("vertice_test_seconds", "Test histogram.", []float64{1, 5}, "call", "result")
+	h.Observe(0.5, "start", "ok")
+	h.Observe(1, "start", "ok")
+	h.Observe(3, "start", "ok")
+	h.Observe(9, "start", "ok")
+	c.Assert(h.Count("start", "ok"), check.Equals, uint64(4))
+	c.Assert(h.Count("stop", "ok"), check.Equals, uint64(0))
+	c.Assert(s.scrape(c, r), check.Equals, `# HELP vertice_test_seconds Test histogram.
+# TYPE vertice_test_seconds histogram
+vertice_test_seconds_bucket{call="start",result="ok",le="1"} 2
+vertice_test_seconds_bucket{call="start",result="ok",le="5"} 3
+vertice_test_seconds_bucket{call="start",result="ok",le="+Inf"} 4
+vertice_test_seconds_sum{call="start",result="ok"} 13.5
+vertice_test_seconds_count{call="start",result="ok"} 4
+`)
+}
+
+func (s *S) TestRegistrySortsAndRejectsTwice(c *check.C) {
+	r := NewRegistry()
+	r.Counter("vertice_b_total", "B.").Inc()
+	r.Counter("vertice_a_total", "A.").Inc()
+	c.Assert(s.scrape(c, r), check.Equals, `# HELP vertice_a_total A.
+# TYPE vertice_a_total counter
+vertice_a_total 1
+# HELP vertice_b_total B.
+# TYPE vertice_b_total counter
+vertice_b_total 1
+`)
+	c.Assert(func() { r.Counter("vertice_a_total", "A.") }, check.PanicMatches, ".*registered twice")
+}
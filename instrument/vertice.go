@@ -0,0 +1,33 @@
+package instrument
+
+// The metrics of vertice.
+var (
+	NSQConsumed = Default.Counter("vertice_nsq_messages_consumed_total",
+		"Messages consumed from nsq.", "topic")
+
+	ProcessorSeconds = Default.Histogram("vertice_processor_duration_seconds",
+		"Time a request spent in its processor.", LongBuckets, "category", "action", "result")
+
+	StepFailures = Default.Counter("vertice_pipeline_step_failures_total",
+		"Steps of the box pipelines that failed.", "kind", "step")
+
+	ProvisionerSeconds = Default.Histogram("vertice_provisioner_call_duration_seconds",
+		"Time of the calls to the provisioners.", LongBuckets, "provider", "region", "call", "result")
+
+	CollectorSeconds = Default.Histogram("vertice_collector_run_duration_seconds",
+		"Time of a run of a metrics collector.", []float64{.1, .5, 1, 2.5, 5, 10, 30, 60, 120}, "collector", "result")
+
+	DNSQueries = Default.Counter("vertice_dns_queries_total",
+		"Queries answered by the built-in dns server.", "view", "rcode")
+
+	SinkBatches = Default.Counter("vertice_metrics_sink_batches_total",
+		"Batches of sensors written to the metrics sinks, failed or dropped.", "sink", "result")
+)
+
+// Result is the result label of an error.
+func Result(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "ok"
+}
@@ -14,6 +14,7 @@ const (
 type Backups struct {
 	DefaultUnits map[string]string
 	RawStatus    []byte
+	Ledger       *Ledger
 }
 
 func (r *Backups) Prefix() string {
@@ -22,8 +23,10 @@ func (r *Backups) Prefix() string {
 
 func (r *Backups) DeductBill(c *MetricsCollection) (e error) {
 	for _, mc := range c.Sensors {
-		mkBalance(mc, r.DefaultUnits)
+		err := mkBalance(mc, r.DefaultUnits)
+		recordBill(r.Ledger, mc, r.DefaultUnits, err)
 	}
+	flushBills(r.Ledger)
 	return
 }
 
@@ -34,6 +37,8 @@ func (s *Backups) Collect(c *MetricsCollection) (e error) {
 		return
 	}
 
+	//the periods begun and not recorded are billed again next time.
+	defer abortBills(s.Ledger, c)
 	s.CollectMetricsFromStats(c, bks)
 	e = s.DeductBill(c)
 	return
@@ -50,7 +55,16 @@ func (c *Backups) ReadUsers() ([]*carton.Account, error) {
 
 //actually the NewSensor can create trypes based on the event type.
 func (c *Backups) CollectMetricsFromStats(mc *MetricsCollection, bks []carton.Backups) {
+	end := time.Now()
 	for _, a := range bks {
+		if a.Status != constants.IMAGE_READY {
+			continue
+		}
+		//a backup is billed since its last charge in the ledger.
+		start, ok := beginBill(c.Ledger, BillKey(BACKUPS_SENSOR, a.AssemblyId, a.Id), end)
+		if !ok {
+			continue
+		}
 		sc := NewSensor(BACKUPS_SENSOR)
 		sc.AccountId = a.AccountId
 		sc.AssemblyId = a.AssemblyId
@@ -61,14 +75,13 @@ func (c *Backups) CollectMetricsFromStats(mc *MetricsCollection, bks []carton.Ba
 		sc.Source = c.Prefix()
 		sc.Message = "backups billing"
 		sc.Status = "health-ok"
-		sc.AuditPeriodBeginning = time.Now().Add(-MetricsInterval).Format(time.RFC3339)
-		sc.AuditPeriodEnding = time.Now().Format(time.RFC3339)
+		sc.AuditPeriodBeginning = start.Format(time.RFC3339)
+		sc.AuditPeriodEnding = end.Format(time.RFC3339)
 		sc.AuditPeriodDelta = ""
+		sc.Interval = end.Sub(start)
 		sc.addMetric(STORAGE_COST, c.DefaultUnits[STORAGE_COST_PER_HOUR], a.Sizeof(), "delta")
-		sc.CreatedAt = time.Now()
-		if a.Status == constants.IMAGE_READY {
-			mc.Add(sc)
-		}
+		sc.CreatedAt = end
+		mc.Add(sc)
 	}
 
 	return
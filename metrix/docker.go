@@ -1,7 +1,14 @@
 package metrix
 
 import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/megamsys/vertice/carton"
 )
 
 type Stats struct {
@@ -16,6 +23,8 @@ type Stats struct {
 	PreCPUStats     CPUStats
 	NetworkIn       uint64
 	NetworkOut      uint64
+	DiskRead        uint64
+	DiskWrite       uint64
 	AccountId       string
 	AssemblyId      string
 	QuotaId         string
@@ -32,3 +41,190 @@ type CPUStats struct {
 	UsageInKernelmode uint64
 	SystemCPUUsage    uint64
 }
+
+var dockerClient = &http.Client{Timeout: time.Minute}
+
+// DockerUsage reads the usage of the containers from the stats of the swarm
+// of their region, given as tcp://host:port. The counters of the stats are
+// since the container started, the stats read last are kept to count from.
+type DockerUsage struct {
+	Swarms map[string]string
+
+	mu   sync.Mutex
+	last map[string]*Stats
+}
+
+type dockerState struct {
+	State struct {
+		Running    bool
+		StartedAt  time.Time
+		FinishedAt time.Time
+	}
+}
+
+type dockerStats struct {
+	Read     time.Time `json:"read"`
+	CPUStats struct {
+		CPUUsage struct {
+			TotalUsage        uint64   `json:"total_usage"`
+			PercpuUsage       []uint64 `json:"percpu_usage"`
+			UsageInKernelmode uint64   `json:"usage_in_kernelmode"`
+			UsageInUsermode   uint64   `json:"usage_in_usermode"`
+		} `json:"cpu_usage"`
+		SystemCPUUsage uint64 `json:"system_cpu_usage"`
+	} `json:"cpu_stats"`
+	MemoryStats struct {
+		Usage uint64 `json:"usage"`
+	} `json:"memory_stats"`
+	Networks map[string]struct {
+		RxBytes uint64 `json:"rx_bytes"`
+		TxBytes uint64 `json:"tx_bytes"`
+	} `json:"networks"`
+	BlkioStats struct {
+		IoServiceBytesRecursive []struct {
+			Op    string `json:"op"`
+			Value uint64 `json:"value"`
+		} `json:"io_service_bytes_recursive"`
+	} `json:"blkio_stats"`
+}
+
+// Usage is the usage of the containers of the regions with a swarm.
+func (d *DockerUsage) Usage(asms []*carton.Assembly, start, end time.Time) (map[string]*Usage, error) {
+	used := make(map[string]*Usage)
+	for _, a := range asms {
+		swarm, ok := d.Swarms[a.Inputs.Match(carton.REGION)]
+		id := a.Outputs.Match(carton.INSTANCE_ID)
+		if !ok || id == "" {
+			continue
+		}
+		u, err := d.usage(swarm, a, id, start, end)
+		if err != nil {
+			return nil, err
+		}
+		used[a.Id] = u
+	}
+	return used, nil
+}
+
+func (d *DockerUsage) usage(swarm string, a *carton.Assembly, id string, start, end time.Time) (*Usage, error) {
+	var st dockerState
+	if err := dockerGet(swarm, "/containers/"+id+"/json", &st); err != nil {
+		return nil, err
+	}
+	var periods []period
+	if !st.State.StartedAt.IsZero() {
+		p := period{start: st.State.StartedAt, end: end}
+		if !st.State.Running && st.State.FinishedAt.After(st.State.StartedAt) {
+			p.end = st.State.FinishedAt
+		}
+		periods = append(periods, p)
+	}
+	if !st.State.Running {
+		//the stats of a stopped container are gone, it is billed for the time it ran.
+		return &Usage{Uptime: overlap(periods, start, end)}, nil
+	}
+	cur, err := containerStats(swarm, id)
+	if err != nil {
+		return nil, err
+	}
+	if cur.AuditPeriod.After(end) {
+		cur.AuditPeriod = end
+	}
+	cur.ContainerId = id
+	cur.AssemblyId = a.Id
+	cur.AccountId = a.AccountId
+	d.mu.Lock()
+	if d.last == nil {
+		d.last = make(map[string]*Stats)
+	}
+	prev, ok := d.last[id]
+	d.last[id] = cur
+	d.mu.Unlock()
+	if !ok || prev.AuditPeriod.Before(st.State.StartedAt) {
+		prev = baseline(cur, st.State.StartedAt, start)
+	}
+	return usageOf([]sample{statsSample(prev, prev), statsSample(prev, cur)}, periods, start, end), nil
+}
+
+//baseline is where the counters were at the start of the period, read
+//linearly from the counters since the container started at started.
+func baseline(cur *Stats, started, start time.Time) *Stats {
+	if !start.After(started) {
+		return &Stats{AuditPeriod: started}
+	}
+	f := float64(start.Sub(started)) / float64(cur.AuditPeriod.Sub(started))
+	if f >= 1 {
+		return cur
+	}
+	scale := func(v uint64) uint64 { return uint64(float64(v) * f) }
+	return &Stats{
+		AuditPeriod: start,
+		CPUStats:    CPUStats{TotalUsage: scale(cur.CPUStats.TotalUsage)},
+		NetworkIn:   scale(cur.NetworkIn),
+		NetworkOut:  scale(cur.NetworkOut),
+		DiskRead:    scale(cur.DiskRead),
+		DiskWrite:   scale(cur.DiskWrite),
+	}
+}
+
+//statsSample is the sample of the stats read after prev: the cpus busy on
+//average since prev.
+func statsSample(prev, cur *Stats) sample {
+	s := sample{
+		at:        cur.AuditPeriod,
+		memoryMB:  float64(cur.MemoryUsage) / (1024 * 1024),
+		diskBytes: cur.DiskRead + cur.DiskWrite,
+		netBytes:  cur.NetworkIn + cur.NetworkOut,
+	}
+	if d := cur.AuditPeriod.Sub(prev.AuditPeriod); d > 0 {
+		s.cpu = float64(counterDelta(prev.CPUStats.TotalUsage, cur.CPUStats.TotalUsage)) / float64(d)
+	}
+	return s
+}
+
+func containerStats(swarm, id string) (*Stats, error) {
+	var ds dockerStats
+	if err := dockerGet(swarm, "/containers/"+id+"/stats?stream=false", &ds); err != nil {
+		return nil, err
+	}
+	s := &Stats{
+		MemoryUsage: ds.MemoryStats.Usage,
+		CPUStats: CPUStats{
+			PercpuUsage:       ds.CPUStats.CPUUsage.PercpuUsage,
+			TotalUsage:        ds.CPUStats.CPUUsage.TotalUsage,
+			UsageInKernelmode: ds.CPUStats.CPUUsage.UsageInKernelmode,
+			UsageInUsermode:   ds.CPUStats.CPUUsage.UsageInUsermode,
+			SystemCPUUsage:    ds.CPUStats.SystemCPUUsage,
+		},
+		AuditPeriod: ds.Read,
+	}
+	for _, n := range ds.Networks {
+		s.NetworkIn += n.RxBytes
+		s.NetworkOut += n.TxBytes
+	}
+	for _, b := range ds.BlkioStats.IoServiceBytesRecursive {
+		switch strings.ToLower(b.Op) {
+		case "read":
+			s.DiskRead += b.Value
+		case "write":
+			s.DiskWrite += b.Value
+		}
+	}
+	if s.AuditPeriod.IsZero() {
+		s.AuditPeriod = time.Now()
+	}
+	return s, nil
+}
+
+func dockerGet(swarm, path string, v interface{}) error {
+	url := strings.TrimRight(strings.Replace(swarm, "tcp://", "http://", 1), "/") + path
+	res, err := dockerClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered %s", url, res.Status)
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
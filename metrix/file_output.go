@@ -0,0 +1,121 @@
+package metrix
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	DefaultSinkMaxSize  = 100 << 20
+	DefaultSinkMaxFiles = 5
+)
+
+// FileSink writes the sensors as json lines to a file, rotated when it grows
+// over MaxSize: the file becomes <path>.1, the older ones move up and the
+// ones over MaxFiles are removed.
+type FileSink struct {
+	Path     string
+	MaxSize  int64
+	MaxFiles int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+func NewFileSink(path string, maxSize int64, maxFiles int) *FileSink {
+	if maxSize <= 0 {
+		maxSize = DefaultSinkMaxSize
+	}
+	if maxFiles <= 0 {
+		maxFiles = DefaultSinkMaxFiles
+	}
+	return &FileSink{Path: path, MaxSize: maxSize, MaxFiles: maxFiles}
+}
+
+func (s *FileSink) Name() string {
+	return FILE
+}
+
+func (s *FileSink) Write(all Sensors, hostname string) error {
+	if len(all) == 0 {
+		return nil
+	}
+	var lines []byte
+	for _, m := range all {
+		b, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		lines = append(append(lines, b...), '\n')
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.open(); err != nil {
+		return err
+	}
+	if s.size > 0 && s.size+int64(len(lines)) > s.MaxSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := s.f.Write(lines)
+	s.size += int64(n)
+	return err
+}
+
+func (s *FileSink) open() error {
+	if s.f != nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	s.f, s.size = f, fi.Size()
+	return nil
+}
+
+func (s *FileSink) rotate() error {
+	if err := s.f.Close(); err != nil {
+		return err
+	}
+	s.f = nil
+	os.Remove(s.rotated(s.MaxFiles))
+	for n := s.MaxFiles - 1; n > 0; n-- {
+		if err := os.Rename(s.rotated(n), s.rotated(n+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(s.Path, s.rotated(1)); err != nil {
+		return err
+	}
+	return s.open()
+}
+
+//rotated is the path of the file rotated n times.
+func (s *FileSink) rotated(n int) string {
+	return fmt.Sprintf("%s.%d", s.Path, n)
+}
+
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	s.f = nil
+	return err
+}
@@ -0,0 +1,269 @@
+package metrix
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/megamsys/libgo/events"
+	"github.com/megamsys/libgo/events/alerts"
+	constants "github.com/megamsys/libgo/utils"
+	"github.com/megamsys/vertice/carton"
+)
+
+const (
+	BALANCE     = "balance"
+	BURN_RATE   = "burn_rate" //an hour.
+	RUNS_OUT_AT = "runs_out_at"
+	WARNING     = "warning"
+
+	//an account that doesn't want to be warned.
+	NO_WARNINGS = "none"
+)
+
+//DefaultWarnings are 7 days, 3 days and 24 hours before the balance runs out.
+var DefaultWarnings = []time.Duration{7 * 24 * time.Hour, 3 * 24 * time.Hour, 24 * time.Hour}
+
+//balanceOf, warningsOf and warn are replaced in tests.
+var (
+	balanceOf  = carton.Balance
+	warningsOf = carton.BalanceWarnings
+	warn       = warnBalance
+)
+
+// Forecast is when the balance of an account runs out at the rate its
+// running assemblies are billed.
+type Forecast struct {
+	AccountId string
+	Balance   float64
+	BurnRate  float64 //an hour.
+	RunsOutAt time.Time
+	Warning   time.Duration //the threshold crossed.
+}
+
+// Forecaster warns the accounts before their balance runs out: once per
+// threshold they cross, the longest first. The thresholds are the ones the
+// account chose or the default ones.
+type Forecaster struct {
+	Warnings []time.Duration
+
+	mu     sync.Mutex
+	warned map[string]time.Duration //the last threshold each account was warned of.
+	file   string                   //where warned is kept, none when empty.
+}
+
+// NewForecaster returns a forecaster warning with the thresholds by default.
+func NewForecaster(warnings []time.Duration) *Forecaster {
+	return &Forecaster{Warnings: warnings, warned: make(map[string]time.Duration)}
+}
+
+// Load reads the thresholds the accounts were warned of from file and keeps
+// them there from now on, so a restart doesn't warn them again. A missing
+// file is no warnings.
+func (f *Forecaster) Load(file string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, err := ioutil.ReadFile(file)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return err
+	default:
+		warned := make(map[string]time.Duration)
+		if err = json.Unmarshal(data, &warned); err != nil {
+			return fmt.Errorf("%s : %s", file, err)
+		}
+		f.warned = warned
+	}
+	f.file = file
+	return nil
+}
+
+//save replaces the file of the warnings, when there is one.
+func (f *Forecaster) save() error {
+	if f.file == "" {
+		return nil
+	}
+	data, err := json.Marshal(f.warned)
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(f.file+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(f.file+".tmp", f.file)
+}
+
+// Forecast warns the accounts whose balance runs out within a threshold at
+// their burn rate, by account. An account whose balance goes back over the
+// thresholds is warned again when it crosses them.
+func (f *Forecaster) Forecast(rates map[string]float64, now time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	changed := false
+	defer func() {
+		if !changed {
+			return
+		}
+		if err := f.save(); err != nil {
+			log.Errorf("balance warnings %s : %s", f.file, err)
+		}
+	}()
+	for account := range f.warned {
+		if rates[account] <= 0 {
+			delete(f.warned, account)
+			changed = true
+		}
+	}
+	for account, rate := range rates {
+		if rate <= 0 {
+			continue
+		}
+		balance, err := balanceOf(account)
+		if err != nil {
+			log.Debugf("balance of %s : %s", account, err)
+			continue
+		}
+		//an account out of credit is left to the skews.
+		if balance <= 0 {
+			continue
+		}
+		warnings, err := f.warningsOf(account)
+		if err != nil {
+			log.Debugf("warnings of %s : %s", account, err)
+			continue
+		}
+		left := balance / rate
+		threshold, ok := crossed(warnings, left)
+		if !ok {
+			if _, ok = f.warned[account]; ok {
+				delete(f.warned, account)
+				changed = true
+			}
+			continue
+		}
+		if last, ok := f.warned[account]; ok && last <= threshold {
+			continue
+		}
+		fc := &Forecast{
+			AccountId: account,
+			Balance:   balance,
+			BurnRate:  rate,
+			RunsOutAt: now.Add(time.Duration(left * float64(time.Hour))),
+			Warning:   threshold,
+		}
+		if err = warn(fc); err != nil {
+			log.Errorf("warning %s of its balance failed : %s", account, err)
+			continue
+		}
+		f.warned[account] = threshold
+		changed = true
+	}
+}
+
+//warningsOf are the thresholds of the account, the default ones when it
+//didn't choose.
+func (f *Forecaster) warningsOf(account string) ([]time.Duration, error) {
+	s, err := warningsOf(account)
+	if err != nil {
+		return nil, err
+	}
+	if s == "" {
+		return f.Warnings, nil
+	}
+	return ParseWarnings(s)
+}
+
+//crossed is the shortest threshold the hours left are within.
+func crossed(warnings []time.Duration, left float64) (time.Duration, bool) {
+	var threshold time.Duration
+	ok := false
+	for _, w := range warnings {
+		if left <= w.Hours() && (!ok || w < threshold) {
+			threshold, ok = w, true
+		}
+	}
+	return threshold, ok
+}
+
+// ParseWarnings parses thresholds as "7d,3d,24h", the longest first. "none"
+// warns of nothing.
+func ParseWarnings(s string) ([]time.Duration, error) {
+	var warnings []time.Duration
+	if strings.TrimSpace(s) == NO_WARNINGS {
+		return warnings, nil
+	}
+	for _, w := range strings.Split(s, ",") {
+		w = strings.TrimSpace(w)
+		if w == "" {
+			continue
+		}
+		var d time.Duration
+		if strings.HasSuffix(w, "d") {
+			days, err := strconv.ParseFloat(strings.TrimSuffix(w, "d"), 64)
+			if err != nil {
+				return nil, fmt.Errorf("warning %s : %s", w, err)
+			}
+			d = time.Duration(days * 24 * float64(time.Hour))
+		} else {
+			var err error
+			if d, err = time.ParseDuration(w); err != nil {
+				return nil, fmt.Errorf("warning %s : %s", w, err)
+			}
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("warning %s isn't after now", w)
+		}
+		warnings = append(warnings, d)
+	}
+	sort.Slice(warnings, func(i, j int) bool { return warnings[i] > warnings[j] })
+	return warnings, nil
+}
+
+//warnBalance sends the warning of the forecast to eventsd.
+func warnBalance(fc *Forecast) error {
+	newEvent := events.NewMulti([]*events.Event{balanceWarning(fc)})
+	return newEvent.Write()
+}
+
+//balanceWarning is the warning of the forecast as the insufficient funds alert
+//of a machine, the one the notifiers mail the account, the threshold crossed
+//in its warning.
+func balanceWarning(fc *Forecast) *events.Event {
+	mi := make(map[string]string, 0)
+	mi[constants.ACCOUNTID] = fc.AccountId
+	mi[constants.EMAIL] = fc.AccountId
+	mi[constants.ALERT_MESSAGE] = fmt.Sprintf("the balance (%.2f) of %s runs out at %s", fc.Balance, fc.AccountId, fc.RunsOutAt.Format(time.RFC1123))
+	mi[BALANCE] = strconv.FormatFloat(fc.Balance, 'f', 2, 64)
+	mi[BURN_RATE] = strconv.FormatFloat(fc.BurnRate, 'f', 6, 64)
+	mi[RUNS_OUT_AT] = fc.RunsOutAt.Format(time.RFC3339)
+	mi[WARNING] = fc.Warning.String()
+	return &events.Event{
+		AccountsId:  fc.AccountId,
+		EventAction: alerts.INSUFFICIENT_FUND,
+		EventType:   constants.EventMachine,
+		EventData:   alerts.EventData{M: mi},
+		Timestamp:   time.Now().Local(),
+	}
+}
+
+//burnRates are what the sensors of the assemblies billed on demand cost an
+//hour, by account.
+func burnRates(sensors Sensors, unitsOf func(sensorType string) map[string]string) map[string]float64 {
+	rates := make(map[string]float64)
+	for _, s := range sensors {
+		if len(s.QuotaId) > 0 {
+			continue
+		}
+		cb, _ := strconv.ParseFloat(s.cost(unitsOf(s.SensorType)), 64)
+		rates[s.AccountId] += cb / s.billedInterval().Hours()
+	}
+	return rates
+}
@@ -0,0 +1,158 @@
+package metrix
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/megamsys/libgo/events/alerts"
+	constants "github.com/megamsys/libgo/utils"
+	"gopkg.in/check.v1"
+)
+
+//withBalances replaces the balances, the warnings of the accounts and the
+//events for the test, the warnings sent are appended to sent.
+func withBalances(balances map[string]float64, warnings map[string]string, sent *[]*Forecast) func() {
+	oldBalance, oldWarnings, oldWarn := balanceOf, warningsOf, warn
+	balanceOf = func(account string) (float64, error) {
+		b, ok := balances[account]
+		if !ok {
+			return 0, errors.New("no balance")
+		}
+		return b, nil
+	}
+	warningsOf = func(account string) (string, error) { return warnings[account], nil }
+	warn = func(fc *Forecast) error {
+		*sent = append(*sent, fc)
+		return nil
+	}
+	return func() { balanceOf, warningsOf, warn = oldBalance, oldWarnings, oldWarn }
+}
+
+func (s *S) TestForecastWarnsOncePerThreshold(c *check.C) {
+	balances := map[string]float64{"info@megam.io": 100}
+	var sent []*Forecast
+	defer withBalances(balances, nil, &sent)()
+	now := time.Date(2017, 6, 1, 0, 0, 0, 0, time.UTC)
+	f := NewForecaster(DefaultWarnings)
+	rates := map[string]float64{"info@megam.io": 0.5}
+
+	//200 hours left.
+	f.Forecast(rates, now)
+	c.Assert(sent, check.HasLen, 0)
+	//100 hours left, within 7 days.
+	balances["info@megam.io"] = 50
+	f.Forecast(rates, now)
+	f.Forecast(rates, now)
+	c.Assert(sent, check.HasLen, 1)
+	c.Assert(sent[0].Warning, check.Equals, 7*24*time.Hour)
+	c.Assert(sent[0].RunsOutAt, check.Equals, now.Add(100*time.Hour))
+	//10 hours left: straight to the last warning.
+	balances["info@megam.io"] = 5
+	f.Forecast(rates, now)
+	f.Forecast(rates, now)
+	c.Assert(sent, check.HasLen, 2)
+	c.Assert(sent[1].Warning, check.Equals, 24*time.Hour)
+	//recharged, warned again when it runs low.
+	balances["info@megam.io"] = 1000
+	f.Forecast(rates, now)
+	balances["info@megam.io"] = 30
+	f.Forecast(rates, now)
+	c.Assert(sent, check.HasLen, 3)
+	c.Assert(sent[2].Warning, check.Equals, 3*24*time.Hour)
+	//out of credit, left to the skews.
+	balances["info@megam.io"] = -1
+	f.Forecast(rates, now)
+	c.Assert(sent, check.HasLen, 3)
+}
+
+func (s *S) TestForecastWarningsOfTheAccount(c *check.C) {
+	balances := map[string]float64{"info@megam.io": 50, "quiet@megam.io": 1, "other@megam.io": 50}
+	warnings := map[string]string{"info@megam.io": "200h, 2d", "quiet@megam.io": "none"}
+	var sent []*Forecast
+	defer withBalances(balances, warnings, &sent)()
+	f := NewForecaster(DefaultWarnings)
+	//100 hours left.
+	f.Forecast(map[string]float64{"info@megam.io": 0.5, "quiet@megam.io": 1, "other@megam.io": 0.5, "none@megam.io": 1}, time.Now())
+	c.Assert(sent, check.HasLen, 2)
+	warned := map[string]time.Duration{}
+	for _, fc := range sent {
+		warned[fc.AccountId] = fc.Warning
+	}
+	c.Assert(warned, check.DeepEquals, map[string]time.Duration{"info@megam.io": 200 * time.Hour, "other@megam.io": 7 * 24 * time.Hour})
+}
+
+func (s *S) TestBalanceWarningIsMailed(c *check.C) {
+	runsOut := time.Date(2017, 6, 5, 4, 0, 0, 0, time.UTC)
+	fc := &Forecast{AccountId: "info@megam.io", Balance: 50, BurnRate: 0.5, RunsOutAt: runsOut, Warning: 7 * 24 * time.Hour}
+	e := balanceWarning(fc)
+	//an alert the notifiers send the account.
+	c.Assert(e.EventAction, check.Equals, alerts.INSUFFICIENT_FUND)
+	c.Assert(e.EventType, check.Equals, constants.EventMachine)
+	c.Assert(e.AccountsId, check.Equals, "info@megam.io")
+	c.Assert(e.EventData.M[constants.EMAIL], check.Equals, "info@megam.io")
+	c.Assert(e.EventData.M[constants.ALERT_MESSAGE], check.Equals, "the balance (50.00) of info@megam.io runs out at Mon, 05 Jun 2017 04:00:00 UTC")
+	c.Assert(e.EventData.M[RUNS_OUT_AT], check.Equals, "2017-06-05T04:00:00Z")
+	c.Assert(e.EventData.M[WARNING], check.Equals, "168h0m0s")
+}
+
+func (s *S) TestParseWarnings(c *check.C) {
+	w, err := ParseWarnings("24h, 7d,3d")
+	c.Assert(err, check.IsNil)
+	c.Assert(w, check.DeepEquals, []time.Duration{7 * 24 * time.Hour, 3 * 24 * time.Hour, 24 * time.Hour})
+	w, err = ParseWarnings("none")
+	c.Assert(err, check.IsNil)
+	c.Assert(w, check.HasLen, 0)
+	_, err = ParseWarnings("soon")
+	c.Assert(err, check.NotNil)
+	_, err = ParseWarnings("-1d")
+	c.Assert(err, check.NotNil)
+}
+
+func (s *S) TestBurnRates(c *check.C) {
+	units := map[string]string{CPU_UNIT: "1", MEMORY_UNIT: "1024", DISK_UNIT: "1024"}
+	sensor := func(account, quota string, interval time.Duration) *Sensor {
+		sc := NewSensor(ONE_VM_SENSOR)
+		sc.AccountId, sc.QuotaId, sc.Interval = account, quota, interval
+		sc.addMetric(CPU_COST, "0.1", "2", "delta")
+		return sc
+	}
+	rates := burnRates(Sensors{
+		sensor("info@megam.io", "", 15*time.Minute),
+		//a period billed after a while costs as much an hour.
+		sensor("info@megam.io", "", 3*time.Hour),
+		sensor("info@megam.io", "QUO1", 15*time.Minute),
+	}, func(string) map[string]string { return units })
+	c.Assert(rates, check.DeepEquals, map[string]float64{"info@megam.io": 0.4})
+}
+
+func (s *S) TestForecastWarningsKeptInFile(c *check.C) {
+	balances := map[string]float64{"info@megam.io": 50}
+	var sent []*Forecast
+	defer withBalances(balances, nil, &sent)()
+	file := filepath.Join(c.MkDir(), "balance_warnings.json")
+	rates := map[string]float64{"info@megam.io": 0.5}
+	f := NewForecaster(DefaultWarnings)
+	c.Assert(f.Load(file), check.IsNil)
+	f.Forecast(rates, time.Now())
+	c.Assert(sent, check.HasLen, 1)
+
+	//restarted, the warning isn't sent again.
+	f = NewForecaster(DefaultWarnings)
+	c.Assert(f.Load(file), check.IsNil)
+	f.Forecast(rates, time.Now())
+	c.Assert(sent, check.HasLen, 1)
+	balances["info@megam.io"] = 5
+	f.Forecast(rates, time.Now())
+	c.Assert(sent, check.HasLen, 2)
+
+	//recharged, the account is out of the file.
+	balances["info@megam.io"] = 1000
+	f.Forecast(rates, time.Now())
+	data, err := ioutil.ReadFile(file)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(data), check.Equals, "{}")
+	c.Assert(ioutil.WriteFile(file, []byte("{"), 0644), check.IsNil)
+	c.Assert(NewForecaster(DefaultWarnings).Load(file), check.NotNil)
+}
@@ -0,0 +1,57 @@
+package metrix
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// InfluxSink writes the metrics in the line protocol of InfluxDB to its write
+// endpoint, as http://localhost:8086/write?db=vertice. Every metric is a
+// measurement with a value field, tagged with the sensor it comes from.
+type InfluxSink struct {
+	httpSink
+}
+
+func NewInfluxSink(url, username, password string, timeout time.Duration) *InfluxSink {
+	return &InfluxSink{newHTTPSink(url, username, password, timeout)}
+}
+
+func (s *InfluxSink) Name() string {
+	return INFLUXDB
+}
+
+func (s *InfluxSink) Write(all Sensors, hostname string) error {
+	ps := points(all, hostname)
+	if len(ps) == 0 {
+		return nil
+	}
+	_, err := s.post(s.URL, lineProtocol(ps), map[string]string{"Content-Type": "text/plain; charset=utf-8"})
+	return err
+}
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "\n", `\n`)
+	tagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\n`)
+)
+
+//lineProtocol is a line a point, timestamped in nanoseconds.
+func lineProtocol(ps []*point) []byte {
+	var b bytes.Buffer
+	for _, p := range ps {
+		b.WriteString(measurementEscaper.Replace(p.name))
+		for _, t := range p.tags {
+			b.WriteByte(',')
+			b.WriteString(tagEscaper.Replace(t.key))
+			b.WriteByte('=')
+			b.WriteString(tagEscaper.Replace(t.value))
+		}
+		b.WriteString(" value=")
+		b.WriteString(strconv.FormatFloat(p.value, 'f', -1, 64))
+		b.WriteByte(' ')
+		b.WriteString(strconv.FormatInt(p.at.UnixNano(), 10))
+		b.WriteByte('\n')
+	}
+	return b.Bytes()
+}
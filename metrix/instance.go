@@ -24,6 +24,15 @@ type InstanceHandler struct {
 	Flavors        map[string]*carton.Flavor
 	VMUnits        map[string]string
 	SkewsActions   map[string]string
+	//the usage of the vms and containers is billed when they have a source,
+	//else their allocation. The units may have a DISK_IO_COST and NETWORK_COST per GB.
+	VMUsage        UsageSource
+	ContainerUsage UsageSource
+	//the periods billed are kept in the ledger when there is one, every
+	//collection bills the assemblies since their last charge.
+	Ledger *Ledger
+	//warns the accounts before their balance runs out when there is one.
+	Forecaster *Forecaster
 }
 
 func (on *InstanceHandler) Prefix() string {
@@ -48,20 +57,42 @@ func (i *InstanceHandler) Collect(mc *MetricsCollection) (e error) {
 		return
 	}
 
+	//the periods begun and not recorded are billed again next time.
+	defer abortBills(i.Ledger, mc)
 	if i.Deployd {
-		i.CollectMetricsFromStats(mc, instances[OPENNEBULA], ONE_VM_SENSOR)
+		i.CollectMetricsFromStats(mc, instances[OPENNEBULA], ONE_VM_SENSOR, i.VMUsage)
 	}
 	if i.Dockerd {
-		i.CollectMetricsFromStats(mc, instances[DOCKER], DOCKER_CONTAINER_SENSOR)
+		i.CollectMetricsFromStats(mc, instances[DOCKER], DOCKER_CONTAINER_SENSOR, i.ContainerUsage)
 	}
 
-	return i.DeductBill(mc)
+	e = i.DeductBill(mc)
+	if i.Forecaster != nil {
+		i.Forecaster.Forecast(burnRates(mc.Sensors, i.unitsOf), time.Now())
+	}
+	return
+}
+
+//unitsOf are the units the sensors of the vms or containers are billed in.
+func (i *InstanceHandler) unitsOf(sensorType string) map[string]string {
+	if sensorType == DOCKER_CONTAINER_SENSOR {
+		return i.ContainerUnits
+	}
+	return i.VMUnits
 }
 
 //actually the NewSensor can create trypes based on the event type.
-func (i *InstanceHandler) CollectMetricsFromStats(mc *MetricsCollection, amies []carton.Assemblies, sensorType string) {
+//The assemblies the source has the usage of are billed by usage.
+func (i *InstanceHandler) CollectMetricsFromStats(mc *MetricsCollection, amies []carton.Assemblies, sensorType string, src UsageSource) {
+	end := time.Now().Truncate(time.Second)
+	starts := i.starts(amies, sensorType, end)
+	used := usages(src, amies, starts, end)
 	for _, h := range amies {
 		for _, ay := range h.Assemblys {
+			start, ok := starts[ay.Id]
+			if !ok {
+				continue
+			}
 			resources := ay.Resources(i.Flavors[ay.FlavorId()])
 			sc := NewSensor(sensorType)
 			sc.QuotaId = ay.QuotaId()
@@ -75,19 +106,41 @@ func (i *InstanceHandler) CollectMetricsFromStats(mc *MetricsCollection, amies [
 			sc.Source = i.Prefix()
 			sc.Message = "vm billing"
 			sc.Status = ay.State
-			sc.AuditPeriodBeginning = time.Now().Add(-MetricsInterval).Format(time.RFC3339) // time.Unix(h.PStime, 0).String()
-			sc.AuditPeriodEnding = time.Now().Format(time.RFC3339)                          // time.Unix(h.PEtime, 0).String()
+			sc.AuditPeriodBeginning = start.Format(time.RFC3339) // time.Unix(h.PStime, 0).String()
+			sc.AuditPeriodEnding = end.Format(time.RFC3339)      // time.Unix(h.PEtime, 0).String()
 			sc.AuditPeriodDelta = ""
+			sc.Interval = end.Sub(start)
+			sc.CreatedAt = end
+			if u, ok := used[ay.Id]; ok {
+				//the usage is billed at the costs of the flavor even if it is stopped now.
+				i.usageSensor(sc, u, ay.AllocatedResources(i.Flavors[ay.FlavorId()]))
+				mc.Add(sc)
+				continue
+			}
 			sc.addMetric(constants.CPU_COST, resources[constants.CPU_COST], resources[constants.CPU], "delta")
 			sc.addMetric(constants.MEMORY_COST, resources[constants.MEMORY_COST], resources[constants.RAM], "delta")
 			sc.addMetric(constants.DISK_COST, resources[constants.DISK_COST], resources[constants.STORAGE], "delta")
-			sc.CreatedAt = time.Now()
 			mc.Add(sc)
 		}
 	}
 	return
 }
 
+//starts are when the periods billed for the assemblies begin, by assembly id:
+//since their last charge in the ledger, else the interval before end.
+//An assembly whose period is still being billed is left out.
+func (i *InstanceHandler) starts(amies []carton.Assemblies, sensorType string, end time.Time) map[string]time.Time {
+	starts := make(map[string]time.Time)
+	for _, h := range amies {
+		for id := range h.Assemblys {
+			if start, ok := beginBill(i.Ledger, BillKey(sensorType, id, h.Id), end); ok {
+				starts[id] = start
+			}
+		}
+	}
+	return starts
+}
+
 func (i *InstanceHandler) DeductBill(c *MetricsCollection) (e error) {
 	var action alerts.EventAction
 	defaultUnits := make(map[string]string)
@@ -97,9 +150,11 @@ func (i *InstanceHandler) DeductBill(c *MetricsCollection) (e error) {
 		} else if mc.SensorType == DOCKER_CONTAINER_SENSOR {
 			defaultUnits = i.ContainerUnits
 		}
+		var err error
 		if mc.QuotaId == "" {
-			mkBalance(mc, defaultUnits)
+			err = mkBalance(mc, defaultUnits)
 		}
+		recordBill(i.Ledger, mc, defaultUnits, err)
 
 		if i.SkewsActions[constants.ENABLED] == constants.TRUE {
 			if len(mc.QuotaId) > 0 {
@@ -120,6 +175,7 @@ func (i *InstanceHandler) DeductBill(c *MetricsCollection) (e error) {
 		}
 
 	}
+	flushBills(i.Ledger)
 	return
 }
 
@@ -0,0 +1,77 @@
+package metrix
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// KafkaSink writes the sensors to a topic through the REST proxy of Kafka (the
+// v2 api, as the Confluent REST proxy or the proxy of Redpanda serve it), as
+// json records keyed by account so the sensors of an account stay in order. A
+// batch retried is produced again whole.
+type KafkaSink struct {
+	httpSink
+	Topic string
+}
+
+type kafkaRecord struct {
+	Key   string  `json:"key"`
+	Value *Sensor `json:"value"`
+}
+
+type kafkaOffsets struct {
+	Offsets []struct {
+		Partition int    `json:"partition"`
+		ErrorCode *int   `json:"error_code"`
+		Error     string `json:"error"`
+	} `json:"offsets"`
+}
+
+func NewKafkaSink(proxy, topic, username, password string, timeout time.Duration) *KafkaSink {
+	return &KafkaSink{httpSink: newHTTPSink(proxy, username, password, timeout), Topic: topic}
+}
+
+func (s *KafkaSink) Name() string {
+	return KAFKA
+}
+
+func (s *KafkaSink) Write(all Sensors, hostname string) error {
+	if len(all) == 0 {
+		return nil
+	}
+	records := make([]*kafkaRecord, 0, len(all))
+	for _, m := range all {
+		records = append(records, &kafkaRecord{Key: m.AccountId, Value: m})
+	}
+	body, err := json.Marshal(map[string][]*kafkaRecord{"records": records})
+	if err != nil {
+		return err
+	}
+	res, err := s.post(strings.TrimSuffix(s.URL, "/")+"/topics/"+url.PathEscape(s.Topic), body, map[string]string{
+		"Content-Type": "application/vnd.kafka.json.v2+json",
+		"Accept":       "application/vnd.kafka.v2+json",
+	})
+	if err != nil {
+		return err
+	}
+	//the records are produced one by one, some may fail.
+	var offsets kafkaOffsets
+	if err = json.Unmarshal(res, &offsets); err != nil {
+		return err
+	}
+	failed := 0
+	var last string
+	for _, o := range offsets.Offsets {
+		if o.ErrorCode != nil || o.Error != "" {
+			failed++
+			last = o.Error
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d records not produced to %s : %s", failed, len(records), s.Topic, last)
+	}
+	return nil
+}
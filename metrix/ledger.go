@@ -0,0 +1,407 @@
+package metrix
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	POSTED  = "posted"  //the bill was deducted.
+	SKIPPED = "skipped" //nothing to deduct: no cost or paid by a quota.
+	FAILED  = "failed"  //the bill couldn't be posted, the period is billed again.
+
+	cursorsFile = "cursors.json"
+	monthLayout = "2006-01"
+)
+
+// the resource types the costs are billed for, with SNAPSHOTS and BACKUPS.
+const (
+	CPU_RESOURCE            = "cpu"
+	RAM_RESOURCE            = "ram"
+	DISK_RESOURCE           = "disk"
+	DISK_IO_RESOURCE        = "disk_io"
+	NETWORK_RESOURCE        = "network"
+	OBJECT_STORAGE_RESOURCE = "object_storage"
+)
+
+// LedgerEntry is a period billed for a resource of an account: an assembly,
+// its snapshots or backups, or the object storage.
+type LedgerEntry struct {
+	AccountId    string             `json:"account_id"`
+	AssemblyId   string             `json:"assembly_id"`
+	AssembliesId string             `json:"assemblies_id"`
+	AssemblyName string             `json:"assembly_name"`
+	SensorType   string             `json:"sensor_type"`
+	Billing      string             `json:"billing"` //quota or ondemand.
+	Start        time.Time          `json:"start"`
+	End          time.Time          `json:"end"`
+	Consumed     string             `json:"consumed"`
+	Items        map[string]float64 `json:"items,omitempty"` //the cost by resource type.
+	Status       string             `json:"status"`
+	Error        string             `json:"error,omitempty"`
+	At           time.Time          `json:"at"`
+}
+
+// Key is what is billed: the sensor and the assembly, the snapshot or backup
+// of the assembly, or the object storage of the account.
+func (e *LedgerEntry) Key() string {
+	if e.AssemblyId == "" && e.AssembliesId == "" {
+		return BillKey(e.SensorType, e.AccountId, "")
+	}
+	return BillKey(e.SensorType, e.AssemblyId, e.AssembliesId)
+}
+
+// BillKey is the key of the periods billed by a sensor.
+func BillKey(sensorType, asmId, asmsId string) string {
+	return sensorType + "/" + asmId + "/" + asmsId
+}
+
+// Ledger keeps the periods billed, so a collection of the assemblies bills
+// the period since their last charge: the time metricsd was down is billed
+// when it is back, and no period is billed twice.
+// The entries are appended to a journal per month (<dir>/2006-01.jsonl), the
+// end of the last period billed for every key (its cursor) is saved in
+// <dir>/cursors.json before the entry is journaled.
+type Ledger struct {
+	dir string
+
+	mu       sync.Mutex
+	cursors  map[string]time.Time
+	inflight map[string]bool
+	journal  *os.File
+	month    string
+}
+
+// OpenLedger opens the ledger in dir.
+func OpenLedger(dir string) (*Ledger, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	l := &Ledger{dir: dir, cursors: make(map[string]time.Time), inflight: make(map[string]bool)}
+	data, err := ioutil.ReadFile(filepath.Join(dir, cursorsFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if len(data) > 0 {
+		if err = json.Unmarshal(data, &l.cursors); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+// Begin is the period to bill the key for, ending at end: since its cursor,
+// or the interval when it has none. It is false while the period begun before
+// isn't recorded or aborted.
+func (l *Ledger) Begin(key string, end time.Time, interval time.Duration) (time.Time, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inflight[key] {
+		return time.Time{}, false
+	}
+	start, ok := l.cursors[key]
+	if !ok {
+		start = end.Add(-interval)
+	}
+	if !end.After(start) {
+		return time.Time{}, false
+	}
+	l.inflight[key] = true
+	return start, true
+}
+
+// Abort ends the period begun for the key without billing it, it is billed
+// again from the same cursor.
+func (l *Ledger) Abort(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.inflight, key)
+}
+
+// Record journals a period billed, the cursor of its key moves to its end
+// and is saved unless it failed.
+func (l *Ledger) Record(e *LedgerEntry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	key := e.Key()
+	delete(l.inflight, key)
+	if e.At.IsZero() {
+		e.At = time.Now()
+	}
+	if e.Status != FAILED && e.End.After(l.cursors[key]) {
+		l.cursors[key] = e.End
+		//saved first, a period can't be billed twice after a crash.
+		if err := l.saveCursors(); err != nil {
+			log.Errorf("ledger cursors of %s failed : %s", key, err)
+		}
+	}
+	month := e.End.UTC().Format(monthLayout)
+	if l.journal == nil || l.month != month {
+		if l.journal != nil {
+			l.journal.Close()
+		}
+		f, err := os.OpenFile(l.journalFile(month), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			l.journal = nil
+			return err
+		}
+		l.journal, l.month = f, month
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = l.journal.Write(append(data, '\n'))
+	return err
+}
+
+// Flush saves the journal and the cursors, after a collection.
+func (l *Ledger) Flush() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.journal != nil {
+		if err := l.journal.Sync(); err != nil {
+			return err
+		}
+	}
+	return l.saveCursors()
+}
+
+//saveCursors writes the cursors, the caller holds the lock.
+func (l *Ledger) saveCursors() error {
+	data, err := json.Marshal(l.cursors)
+	if err != nil {
+		return err
+	}
+	file := filepath.Join(l.dir, cursorsFile)
+	if err = ioutil.WriteFile(file+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(file+".tmp", file)
+}
+
+// Close flushes and closes the ledger.
+func (l *Ledger) Close() error {
+	err := l.Flush()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.journal != nil {
+		l.journal.Close()
+		l.journal = nil
+	}
+	return err
+}
+
+func (l *Ledger) journalFile(month string) string {
+	return filepath.Join(l.dir, month+".jsonl")
+}
+
+//scan reads the entries of the month, a missing month has none.
+func (l *Ledger) scan(month string, fn func(*LedgerEntry)) error {
+	f, err := os.Open(l.journalFile(month))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		e := &LedgerEntry{}
+		//a line cut by a crash is left out.
+		if json.Unmarshal([]byte(line), e) == nil {
+			fn(e)
+		}
+	}
+	return sc.Err()
+}
+
+// Entries are the entries of the account (every account when empty) whose
+// period ends in (from, to], by key and start.
+func (l *Ledger) Entries(account string, from, to time.Time) ([]*LedgerEntry, error) {
+	var entries []*LedgerEntry
+	for m := monthOf(from); m.Before(to); m = m.AddDate(0, 1, 0) {
+		err := l.scan(m.Format(monthLayout), func(e *LedgerEntry) {
+			if (account == "" || e.AccountId == account) && e.End.After(from) && !e.End.After(to) {
+				entries = append(entries, e)
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if ki, kj := entries[i].Key(), entries[j].Key(); ki != kj {
+			return ki < kj
+		}
+		return entries[i].Start.Before(entries[j].Start)
+	})
+	return entries, nil
+}
+
+func monthOf(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+const (
+	GAP     = "gap"
+	OVERLAP = "overlap"
+)
+
+// Discrepancy is a period billed more than once (overlap), never (gap) or
+// whose bill couldn't be posted (failed).
+type Discrepancy struct {
+	Kind         string    `json:"kind"`
+	AccountId    string    `json:"account_id"`
+	SensorType   string    `json:"sensor_type"`
+	AssemblyId   string    `json:"assembly_id"`
+	AssemblyName string    `json:"assembly_name"`
+	Start        time.Time `json:"start"`
+	End          time.Time `json:"end"`
+	Error        string    `json:"error,omitempty"`
+}
+
+// Reconcile lists the gaps and overlaps between the periods billed for every
+// key of the account in (from, to], and the failed posts.
+func (l *Ledger) Reconcile(account string, from, to time.Time) ([]Discrepancy, error) {
+	entries, err := l.Entries(account, from, to)
+	if err != nil {
+		return nil, err
+	}
+	var found []Discrepancy
+	var prev *LedgerEntry
+	for _, e := range entries {
+		d := Discrepancy{AccountId: e.AccountId, SensorType: e.SensorType, AssemblyId: e.AssemblyId, AssemblyName: e.AssemblyName}
+		if e.Status == FAILED {
+			d.Kind, d.Start, d.End, d.Error = FAILED, e.Start, e.End, e.Error
+			found = append(found, d)
+			continue
+		}
+		if prev != nil && prev.Key() == e.Key() {
+			switch {
+			case e.Start.After(prev.End):
+				d.Kind, d.Start, d.End = GAP, prev.End, e.Start
+				found = append(found, d)
+			case e.Start.Before(prev.End):
+				d.Kind, d.Start, d.End = OVERLAP, e.Start, prev.End
+				if e.End.Before(prev.End) {
+					d.End = e.End
+				}
+				found = append(found, d)
+			}
+		}
+		if prev == nil || prev.Key() != e.Key() || e.End.After(prev.End) {
+			prev = e
+		}
+	}
+	return found, nil
+}
+
+//beginBill is the period to bill the key for as Ledger.Begin, the interval
+//before end when there is no ledger.
+func beginBill(l *Ledger, key string, end time.Time) (time.Time, bool) {
+	if l == nil {
+		return end.Add(-MetricsInterval), true
+	}
+	return l.Begin(key, end, MetricsInterval)
+}
+
+//recordBill journals the period billed by the sensor when there is a ledger,
+//the cost by resource type included.
+func recordBill(l *Ledger, s *Sensor, units map[string]string, err error) {
+	if l == nil {
+		return
+	}
+	start, _ := time.Parse(time.RFC3339, s.AuditPeriodBeginning)
+	end, _ := time.Parse(time.RFC3339, s.AuditPeriodEnding)
+	e := &LedgerEntry{
+		AccountId:    s.AccountId,
+		AssemblyId:   s.AssemblyId,
+		AssembliesId: s.AssembliesId,
+		AssemblyName: s.AssemblyName,
+		SensorType:   s.SensorType,
+		Billing:      ONDEMAND,
+		Start:        start,
+		End:          end,
+		Consumed:     s.cost(units),
+		Items:        make(map[string]float64),
+		Status:       POSTED,
+	}
+	if len(s.QuotaId) > 0 {
+		e.Billing = QUOTA
+	}
+	for name, cost := range s.Metrics.Costs(units, s.billedInterval()) {
+		e.Items[resourceOf(s.SensorType, name)] += cost
+	}
+	cb, _ := strconv.ParseFloat(e.Consumed, 64)
+	switch {
+	case err != nil:
+		e.Status, e.Error = FAILED, err.Error()
+	case e.Billing == QUOTA || cb <= 0:
+		e.Status = SKIPPED
+	}
+	if err = l.Record(e); err != nil {
+		log.Errorf("ledger of %s %s [%s, %s] failed : %s", s.SensorType, s.AssemblyId, s.AuditPeriodBeginning, s.AuditPeriodEnding, err)
+	}
+}
+
+//abortBills ends the periods of the sensors that weren't recorded, as when
+//the bills of a collection stop short.
+func abortBills(l *Ledger, c *MetricsCollection) {
+	if l == nil {
+		return
+	}
+	for _, s := range c.Sensors {
+		l.Abort((&LedgerEntry{AccountId: s.AccountId, AssemblyId: s.AssemblyId, AssembliesId: s.AssembliesId, SensorType: s.SensorType}).Key())
+	}
+}
+
+//flushBills saves the ledger after the bills of a collection.
+func flushBills(l *Ledger) {
+	if l == nil {
+		return
+	}
+	if err := l.Flush(); err != nil {
+		log.Errorf("ledger flush failed : %s", err)
+	}
+}
+
+//resourceOf is the resource type a cost metric of the sensor bills.
+func resourceOf(sensorType, metric string) string {
+	switch metric {
+	case CPU_COST:
+		return CPU_RESOURCE
+	case MEMORY_COST:
+		return RAM_RESOURCE
+	case DISK_COST:
+		return DISK_RESOURCE
+	case DISK_IO_COST:
+		return DISK_IO_RESOURCE
+	case NETWORK_COST:
+		return NETWORK_RESOURCE
+	}
+	switch sensorType {
+	case SNAPSHOT_SENSOR:
+		return SNAPSHOTS
+	case BACKUPS_SENSOR:
+		return BACKUPS
+	}
+	return OBJECT_STORAGE_RESOURCE
+}
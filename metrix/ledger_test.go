@@ -0,0 +1,185 @@
+package metrix
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"time"
+
+	constants "github.com/megamsys/libgo/utils"
+	"github.com/megamsys/vertice/carton"
+	"gopkg.in/check.v1"
+)
+
+func openLedger(c *check.C) (*Ledger, string) {
+	dir, err := ioutil.TempDir("", "ledger")
+	c.Assert(err, check.IsNil)
+	l, err := OpenLedger(dir)
+	c.Assert(err, check.IsNil)
+	return l, dir
+}
+
+func vmEntry(asmId string, start, end time.Time, status string) *LedgerEntry {
+	return &LedgerEntry{AssemblyId: asmId, SensorType: ONE_VM_SENSOR, Start: start, End: end, Status: status}
+}
+
+func (s *S) TestLedgerBillsSinceLastCharge(c *check.C) {
+	l, dir := openLedger(c)
+	defer os.RemoveAll(dir)
+	t0 := time.Now().Truncate(time.Second)
+	key := BillKey(ONE_VM_SENSOR, "ASM1", "")
+	start, ok := l.Begin(key, t0, 10*time.Minute)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(start.Equal(t0.Add(-10*time.Minute)), check.Equals, true)
+	//a period is billed once at a time.
+	_, ok = l.Begin(key, t0, 10*time.Minute)
+	c.Assert(ok, check.Equals, false)
+	c.Assert(l.Record(vmEntry("ASM1", start, t0, POSTED)), check.IsNil)
+
+	//down for an hour, the hour is billed.
+	t1 := t0.Add(time.Hour)
+	start, ok = l.Begin(key, t1, 10*time.Minute)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(start.Equal(t0), check.Equals, true)
+	failed := vmEntry("ASM1", start, t1, FAILED)
+	failed.Error = "down"
+	c.Assert(l.Record(failed), check.IsNil)
+
+	//the failed post is billed again, nothing before the charge.
+	t2 := t1.Add(10 * time.Minute)
+	start, ok = l.Begin(key, t2, 10*time.Minute)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(start.Equal(t0), check.Equals, true)
+	c.Assert(l.Record(vmEntry("ASM1", start, t2, POSTED)), check.IsNil)
+	_, ok = l.Begin(key, t2, 10*time.Minute)
+	c.Assert(ok, check.Equals, false)
+	c.Assert(l.Close(), check.IsNil)
+}
+
+func (s *S) TestLedgerKeepsTheCursors(c *check.C) {
+	l, dir := openLedger(c)
+	defer os.RemoveAll(dir)
+	t0 := time.Now().Truncate(time.Second)
+	//last charged months ago, and crashed before the ledger was flushed.
+	old := t0.AddDate(0, -4, 0)
+	c.Assert(l.Record(vmEntry("ASM1", old.Add(-10*time.Minute), old, POSTED)), check.IsNil)
+	c.Assert(l.Record(vmEntry("ASM2", t0.Add(-10*time.Minute), t0, FAILED)), check.IsNil)
+
+	l, err := OpenLedger(dir)
+	c.Assert(err, check.IsNil)
+	start, ok := l.Begin(BillKey(ONE_VM_SENSOR, "ASM1", ""), t0, 10*time.Minute)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(start.Equal(old), check.Equals, true)
+	start, ok = l.Begin(BillKey(ONE_VM_SENSOR, "ASM2", ""), t0.Add(time.Minute), 10*time.Minute)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(start.Equal(t0.Add(-9*time.Minute)), check.Equals, true)
+}
+
+func (s *S) TestLedgerAbortsThePeriodsNotRecorded(c *check.C) {
+	l, dir := openLedger(c)
+	defer os.RemoveAll(dir)
+	t0 := time.Now().Truncate(time.Second)
+	key := BillKey(SNAPSHOT_SENSOR, "ASM1", "ASMS1")
+	start, ok := l.Begin(key, t0, 10*time.Minute)
+	c.Assert(ok, check.Equals, true)
+	sc := NewSensor(SNAPSHOT_SENSOR)
+	sc.AssemblyId, sc.AssembliesId = "ASM1", "ASMS1"
+	//the bills of the collection stopped before the snapshot was recorded.
+	abortBills(l, &MetricsCollection{Sensors: []*Sensor{sc}})
+	again, ok := l.Begin(key, t0, 10*time.Minute)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(again.Equal(start), check.Equals, true)
+	c.Assert(l.Close(), check.IsNil)
+}
+
+func (s *S) TestLedgerReconcile(c *check.C) {
+	l, dir := openLedger(c)
+	defer os.RemoveAll(dir)
+	t0 := time.Date(2017, 6, 30, 23, 40, 0, 0, time.UTC)
+	at := func(m int) time.Time { return t0.Add(time.Duration(m) * time.Minute) }
+	for _, e := range []*LedgerEntry{
+		{AccountId: "info@megam.io", AssemblyId: "ASM1", Start: at(0), End: at(10), Status: POSTED},
+		{AccountId: "info@megam.io", AssemblyId: "ASM1", Start: at(10), End: at(20), Status: SKIPPED},
+		//across the month.
+		{AccountId: "info@megam.io", AssemblyId: "ASM1", Start: at(30), End: at(40), Status: POSTED},
+		{AccountId: "info@megam.io", AssemblyId: "ASM1", Start: at(35), End: at(50), Status: POSTED},
+		{AccountId: "info@megam.io", AssemblyId: "ASM1", Start: at(50), End: at(60), Status: FAILED, Error: "down"},
+		{AccountId: "info@megam.io", AssemblyId: "ASM1", Start: at(50), End: at(70), Status: POSTED},
+		{AccountId: "info@megam.io", AssemblyId: "ASM2", Start: at(0), End: at(10), Status: POSTED},
+		{AccountId: "info@megam.io", AssemblyId: "ASM2", Start: at(20), End: at(30), Status: POSTED},
+		{AccountId: "other@megam.io", AssemblyId: "ASM3", Start: at(0), End: at(10), Status: POSTED},
+		{AccountId: "other@megam.io", AssemblyId: "ASM3", Start: at(20), End: at(30), Status: POSTED},
+	} {
+		c.Assert(l.Record(e), check.IsNil)
+	}
+	found, err := l.Reconcile("info@megam.io", at(0), at(70))
+	c.Assert(err, check.IsNil)
+	c.Assert(found, check.DeepEquals, []Discrepancy{
+		{Kind: GAP, AccountId: "info@megam.io", AssemblyId: "ASM1", Start: at(20), End: at(30)},
+		{Kind: OVERLAP, AccountId: "info@megam.io", AssemblyId: "ASM1", Start: at(35), End: at(40)},
+		{Kind: FAILED, AccountId: "info@megam.io", AssemblyId: "ASM1", Start: at(50), End: at(60), Error: "down"},
+		{Kind: GAP, AccountId: "info@megam.io", AssemblyId: "ASM2", Start: at(10), End: at(20)},
+	})
+
+	found, err = l.Reconcile("info@megam.io", at(25), at(70))
+	c.Assert(err, check.IsNil)
+	c.Assert(found, check.HasLen, 2)
+}
+
+func (s *S) TestRecordBill(c *check.C) {
+	l, dir := openLedger(c)
+	defer os.RemoveAll(dir)
+	units := map[string]string{CPU_UNIT: "1", MEMORY_UNIT: "1024", DISK_UNIT: "1024"}
+	end := time.Now().Truncate(time.Second)
+	start, ok := l.Begin(BillKey(ONE_VM_SENSOR, "ASM1", "AMS1"), end, 30*time.Minute)
+	c.Assert(ok, check.Equals, true)
+	sc := NewSensor(ONE_VM_SENSOR)
+	sc.AccountId, sc.AssemblyId, sc.AssembliesId = "info@megam.io", "ASM1", "AMS1"
+	sc.AuditPeriodBeginning, sc.AuditPeriodEnding = start.Format(time.RFC3339), end.Format(time.RFC3339)
+	sc.Interval = end.Sub(start)
+	sc.addMetric(CPU_COST, "0.1", "1", "delta")
+	sc.addMetric(MEMORY_COST, "0.2", "512", "delta")
+	recordBill(l, sc, units, errors.New("gulp is down"))
+	//the failed post is billed again.
+	_, ok = l.Begin(BillKey(ONE_VM_SENSOR, "ASM1", "AMS1"), end, 30*time.Minute)
+	c.Assert(ok, check.Equals, true)
+
+	entries, err := l.Entries("info@megam.io", start, end)
+	c.Assert(err, check.IsNil)
+	c.Assert(entries, check.HasLen, 1)
+	c.Assert(entries[0].Status, check.Equals, FAILED)
+	c.Assert(entries[0].Error, check.Equals, "gulp is down")
+	c.Assert(entries[0].Billing, check.Equals, ONDEMAND)
+	//the half hour is billed.
+	c.Assert(entries[0].Consumed, check.Equals, "0.100000")
+	c.Assert(entries[0].Items, check.DeepEquals, map[string]float64{CPU_RESOURCE: 0.05, RAM_RESOURCE: 0.05})
+	c.Assert(entries[0].Start.Equal(start), check.Equals, true)
+}
+
+func (s *S) TestSnapshotsBilledSinceTheLedger(c *check.C) {
+	MetricsInterval = 10 * time.Minute
+	l, dir := openLedger(c)
+	defer os.RemoveAll(dir)
+	snps := []carton.Snaps{{Id: "SNP1", AccountId: "info@megam.io", AssemblyId: "ASM1", Status: constants.ACTIVESNAP}}
+	sn := &Snapshots{DefaultUnits: map[string]string{STORAGE_COST_PER_HOUR: "0.1"}, Ledger: l}
+	mc := &MetricsCollection{}
+	sn.CollectMetricsFromStats(mc, snps)
+	c.Assert(mc.Sensors, check.HasLen, 1)
+	c.Assert(mc.Sensors[0].Interval, check.Equals, MetricsInterval)
+	//the period is still being billed.
+	next := &MetricsCollection{}
+	sn.CollectMetricsFromStats(next, snps)
+	c.Assert(next.Sensors, check.HasLen, 0)
+
+	recordBill(l, mc.Sensors[0], sn.DefaultUnits, nil)
+	sn.CollectMetricsFromStats(next, snps)
+	c.Assert(next.Sensors, check.HasLen, 1)
+	c.Assert(next.Sensors[0].AuditPeriodBeginning, check.Equals, mc.Sensors[0].AuditPeriodEnding)
+}
+
+func (s *S) TestStorageKeyedByAccount(c *check.C) {
+	e := &LedgerEntry{AccountId: "info@megam.io", SensorType: CEPH_STORAGE_SENSOR}
+	c.Assert(e.Key(), check.Equals, BillKey(CEPH_STORAGE_SENSOR, "info@megam.io", ""))
+	e.AssemblyId, e.AssembliesId = "ASM1", "SNP1"
+	c.Assert(e.Key(), check.Equals, BillKey(CEPH_STORAGE_SENSOR, "ASM1", "SNP1"))
+}
@@ -23,6 +23,11 @@ const (
 	STORAGE_COST          = "storage_cost"
 	STORAGE_UNIT          = "storage_unit"
 
+	//costs of the bytes used, per GB.
+	DISK_IO_COST = "disk_io_cost"
+	NETWORK_COST = "network_cost"
+	GB           = 1024 * 1024 * 1024
+
 	SKEWS_ACTIONS = "skews_actions"
 	SKEWS_ACTION  = "action"
 	GRACEPERIOD   = "grace_period"
@@ -67,9 +72,31 @@ func parseStringToStruct(str string, data interface{}) error {
 }
 
 func (m *Metrics) Totalcost(units map[string]string) string {
+	return m.TotalcostFor(units, MetricsInterval)
+}
+
+// TotalcostFor is the cost of the metrics billed for the interval.
+func (m *Metrics) TotalcostFor(units map[string]string, interval time.Duration) string {
+	costs := m.Costs(units, interval)
+	names := make([]string, 0, len(costs))
+	for name := range costs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var cost float64
+	for _, name := range names {
+		cost = cost + costs[name]
+	}
+	res := strconv.FormatFloat(cost, 'f', 6, 64)
+	return res //for 1 hr to 10min  based on interval it measures
+}
+
+// Costs is the cost of the metrics billed for the interval, by metric name.
+func (m *Metrics) Costs(units map[string]string, interval time.Duration) map[string]float64 {
 
 	//have to calculate metrics based on discount when flavour increases
-	var cost, diff_ival float64
+	var diff_ival float64
+	costs := make(map[string]float64)
 	defaultCpuUnit, _ := strconv.ParseFloat(units[CPU_UNIT], 64)
 	defaultRamUnit, _ := strconv.ParseFloat(units[MEMORY_UNIT], 64)
 	defaultDiskUnit, _ := strconv.ParseFloat(units[DISK_UNIT], 64)
@@ -77,22 +104,24 @@ func (m *Metrics) Totalcost(units map[string]string) string {
 
 	//Only For Hourly Billing
 
-	diff_ival = (1 * time.Hour).Minutes() / MetricsInterval.Minutes()
+	diff_ival = (1 * time.Hour).Minutes() / interval.Minutes()
 
 	for _, in := range *m {
 		consume, _ := strconv.ParseFloat(in.MetricValue, 64)
 		unit, _ := strconv.ParseFloat(in.MetricUnits, 64)
 		switch in.MetricName {
 		case CPU_COST:
-			cost = cost + (unit/defaultCpuUnit)*consume
+			costs[in.MetricName] += (unit / defaultCpuUnit) * consume / diff_ival
 		case MEMORY_COST:
-			cost = cost + (unit/defaultRamUnit)*consume
+			costs[in.MetricName] += (unit / defaultRamUnit) * consume / diff_ival
 		case DISK_COST:
-			cost = cost + (unit/defaultDiskUnit)*consume
+			costs[in.MetricName] += (unit / defaultDiskUnit) * consume / diff_ival
 		case STORAGE_COST:
-			cost = cost + (unit/defaultStorageUnit)*consume
+			costs[in.MetricName] += (unit / defaultStorageUnit) * consume / diff_ival
+		case DISK_IO_COST, NETWORK_COST:
+			//the GB used in the interval, not per hour.
+			costs[in.MetricName] += unit * consume
 		}
 	}
-	res := strconv.FormatFloat(cost/float64(diff_ival), 'f', 6, 64)
-	return res //for 1 hr to 10min  based on interval it measures
+	return costs
 }
@@ -1 +1,169 @@
 package metrix
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/megamsys/vertice/carton"
+)
+
+var oneClient = &http.Client{Timeout: time.Minute}
+
+// OneEndpoint is the xml-rpc endpoint of opennebula in a region.
+type OneEndpoint struct {
+	Endpoint string
+	User     string
+	Password string
+}
+
+// OneUsage reads the usage of the vms from opennebula: when they ran from the
+// accounting and what they used from the monitoring, by region.
+type OneUsage struct {
+	Regions map[string]OneEndpoint
+}
+
+type oneHistory struct {
+	VMId   string `xml:"OID"`
+	RSTime int64  `xml:"RSTIME"`
+	RETime int64  `xml:"RETIME"`
+}
+
+type oneMonitoring struct {
+	VMId     string  `xml:"ID"`
+	LastPoll int64   `xml:"LAST_POLL"`
+	CPU      float64 `xml:"MONITORING>CPU"`
+	Memory   float64 `xml:"MONITORING>MEMORY"`
+	NetRx    uint64  `xml:"MONITORING>NETRX"`
+	NetTx    uint64  `xml:"MONITORING>NETTX"`
+	DiskRd   uint64  `xml:"MONITORING>DISKRDBYTES"`
+	DiskWr   uint64  `xml:"MONITORING>DISKWRBYTES"`
+}
+
+// Usage is the usage of the vms of the regions with an endpoint.
+func (o *OneUsage) Usage(asms []*carton.Assembly, start, end time.Time) (map[string]*Usage, error) {
+	byRegion := make(map[string][]*carton.Assembly)
+	for _, a := range asms {
+		r := a.Inputs.Match(carton.REGION)
+		byRegion[r] = append(byRegion[r], a)
+	}
+	used := make(map[string]*Usage)
+	for region, ras := range byRegion {
+		e, ok := o.Regions[region]
+		if !ok {
+			continue
+		}
+		periods, err := e.periods(start, end)
+		if err != nil {
+			return nil, err
+		}
+		samples, err := e.samples()
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range ras {
+			//a vm without periods didn't run, only its storage is billed.
+			vmid := a.Outputs.Match(carton.INSTANCE_ID)
+			if vmid == "" {
+				continue
+			}
+			used[a.Id] = usageOf(samples[vmid], periods[vmid], start, end)
+		}
+	}
+	return used, nil
+}
+
+//periods are when the vms ran in [start, end), by vm id. A vm still running
+//has no end yet.
+func (e OneEndpoint) periods(start, end time.Time) (map[string][]period, error) {
+	var records struct {
+		History []oneHistory `xml:"HISTORY"`
+	}
+	if err := e.call(&records, "one.vmpool.accounting", -2, int(start.Unix()), int(end.Unix())); err != nil {
+		return nil, err
+	}
+	periods := make(map[string][]period)
+	for _, h := range records.History {
+		if h.RSTime <= 0 {
+			continue
+		}
+		p := period{start: time.Unix(h.RSTime, 0), end: end}
+		if h.RETime > 0 {
+			p.end = time.Unix(h.RETime, 0)
+		}
+		periods[h.VMId] = append(periods[h.VMId], p)
+	}
+	return periods, nil
+}
+
+//samples are the monitoring of the vms kept by opennebula, by vm id.
+func (e OneEndpoint) samples() (map[string][]sample, error) {
+	var data struct {
+		VMs []oneMonitoring `xml:"VM"`
+	}
+	if err := e.call(&data, "one.vmpool.monitoring", -2); err != nil {
+		return nil, err
+	}
+	samples := make(map[string][]sample)
+	for _, m := range data.VMs {
+		samples[m.VMId] = append(samples[m.VMId], sample{
+			at:        time.Unix(m.LastPoll, 0),
+			cpu:       m.CPU / 100,
+			memoryMB:  m.Memory / 1024,
+			diskBytes: m.DiskRd + m.DiskWr,
+			netBytes:  m.NetRx + m.NetTx,
+		})
+	}
+	return samples, nil
+}
+
+//oneResponse is the xml-rpc answer of opennebula: [ok, xml document or error, ..].
+type oneResponse struct {
+	Values []struct {
+		Boolean string `xml:"boolean"`
+		String  string `xml:"string"`
+	} `xml:"params>param>value>array>data>value"`
+	Fault string `xml:"fault>value>struct>member>value>string"`
+}
+
+//call calls the method with the session and the int params, the xml document
+//it answers is read into v.
+func (e OneEndpoint) call(v interface{}, method string, params ...int) error {
+	var body bytes.Buffer
+	body.WriteString(`<?xml version="1.0"?><methodCall><methodName>` + method + `</methodName><params><param><value><string>`)
+	xml.EscapeText(&body, []byte(e.User+":"+e.Password))
+	body.WriteString(`</string></value></param>`)
+	for _, p := range params {
+		body.WriteString(`<param><value><int>` + strconv.Itoa(p) + `</int></value></param>`)
+	}
+	body.WriteString(`</params></methodCall>`)
+	res, err := oneClient.Post(e.Endpoint, "text/xml", &body)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered %s", e.Endpoint, res.Status)
+	}
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	var r oneResponse
+	if err = xml.Unmarshal(data, &r); err != nil {
+		return fmt.Errorf("%s : %s", method, err)
+	}
+	switch {
+	case r.Fault != "":
+		return fmt.Errorf("%s : %s", method, r.Fault)
+	case len(r.Values) < 2:
+		return fmt.Errorf("%s : no answer", method)
+	case r.Values[0].Boolean != "1":
+		return fmt.Errorf("%s : %s", method, r.Values[1].String)
+	}
+	return xml.Unmarshal([]byte(r.Values[1].String), v)
+}
@@ -8,6 +8,8 @@ import (
 type OutputHandler struct {
 	ScyllaAddress string
 	Hostname      string
+	//the sensors are written to every sink as well.
+	Sinks []Sink
 }
 
 func (o *OutputHandler) WriteMetrics(all Sensors) (e error) {
@@ -23,6 +25,12 @@ func (o *OutputHandler) WriteMetrics(all Sensors) (e error) {
 		e = SendMetricsToScylla(all, o.Hostname)
 		sent = true
 	}
+	for _, s := range o.Sinks {
+		if err := s.Write(all, o.Hostname); err != nil {
+			log.Errorf("writing the metrics to %s : %s", s.Name(), err)
+		}
+		sent = true
+	}
 
 	if !sent {
 		SendMetricsToStdout(all, o.Hostname)
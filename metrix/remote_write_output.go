@@ -0,0 +1,110 @@
+package metrix
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+
+	"github.com/golang/snappy"
+)
+
+// RemoteWriteSink writes the metrics to a Prometheus remote-write endpoint,
+// as http://localhost:9090/api/v1/write: a WriteRequest in protobuf,
+// compressed with snappy. Every metric is a series named vertice_<metric>,
+// labelled with the sensor it comes from.
+type RemoteWriteSink struct {
+	httpSink
+}
+
+func NewRemoteWriteSink(url, username, password string, timeout time.Duration) *RemoteWriteSink {
+	return &RemoteWriteSink{newHTTPSink(url, username, password, timeout)}
+}
+
+func (s *RemoteWriteSink) Name() string {
+	return REMOTE_WRITE
+}
+
+func (s *RemoteWriteSink) Write(all Sensors, hostname string) error {
+	ps := points(all, hostname)
+	if len(ps) == 0 {
+		return nil
+	}
+	_, err := s.post(s.URL, snappy.Encode(nil, writeRequest(ps)), map[string]string{
+		"Content-Encoding":                  "snappy",
+		"Content-Type":                      "application/x-protobuf",
+		"X-Prometheus-Remote-Write-Version": "0.1.0",
+	})
+	return err
+}
+
+//writeRequest encodes the points as a WriteRequest of prometheus:
+//
+//	message WriteRequest { repeated TimeSeries timeseries = 1; }
+//	message TimeSeries { repeated Label labels = 1; repeated Sample samples = 2; }
+//	message Label { string name = 1; string value = 2; }
+//	message Sample { double value = 1; int64 timestamp = 2; }
+func writeRequest(ps []*point) []byte {
+	var req protoBuf
+	for _, p := range ps {
+		var ts protoBuf
+		//the labels are sorted by name, __name__ first.
+		for _, t := range append([]tag{{"__name__", seriesName(p.name)}}, p.tags...) {
+			var l protoBuf
+			l.string(1, t.key)
+			l.string(2, t.value)
+			ts.bytes(1, l)
+		}
+		var sm protoBuf
+		sm.double(1, p.value)
+		sm.varint(2, uint64(p.at.UnixNano()/int64(time.Millisecond)))
+		ts.bytes(2, sm)
+		req.bytes(1, ts)
+	}
+	return req
+}
+
+//seriesName is the metric prefixed by vertice_, with what prometheus doesn't
+//allow in a name as _.
+func seriesName(metric string) string {
+	b := []byte("vertice_" + metric)
+	for i, c := range b {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == ':') {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+//protoBuf is a protobuf message being encoded.
+type protoBuf []byte
+
+func (b *protoBuf) key(field int, wire uint64) {
+	b.uvarint(uint64(field)<<3 | wire)
+}
+
+func (b *protoBuf) uvarint(v uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	*b = append(*b, buf[:binary.PutUvarint(buf[:], v)]...)
+}
+
+func (b *protoBuf) varint(field int, v uint64) {
+	b.key(field, 0)
+	b.uvarint(v)
+}
+
+func (b *protoBuf) double(field int, v float64) {
+	b.key(field, 1)
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], math.Float64bits(v))
+	*b = append(*b, buf[:]...)
+}
+
+func (b *protoBuf) bytes(field int, p []byte) {
+	b.key(field, 2)
+	b.uvarint(uint64(len(p)))
+	*b = append(*b, p...)
+}
+
+func (b *protoBuf) string(field int, s string) {
+	b.bytes(field, []byte(s))
+}
@@ -27,7 +27,7 @@ func SendMetricsToScylla(metrics Sensors, hostname string) (err error) {
 func mkBalance(s *Sensor, du map[string]string) error {
 	mi := make(map[string]string, 0)
 
-	m := s.Metrics.Totalcost(du)
+	m := s.cost(du)
 	cb, _ := strconv.ParseFloat(m, 64)
 	if cb <= 0 {
 		return nil
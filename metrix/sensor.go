@@ -29,24 +29,25 @@ const (
 )
 
 type Sensor struct {
-	Id                   string    `json:"id" cql:"id"`
-	AccountId            string    `json:"account_id" cql:"account_id"`
-	SensorType           string    `json:"sensor_type" cql:"sensor_type"`
-	AssemblyId           string    `json:"assembly_id" cql:"assembly_id"`
-	AssemblyName         string    `json:"assembly_name" cql:"assembly_name"`
-	AssembliesId         string    `json:"assemblies_id" cql:"assemblies_id"`
-	Node                 string    `json:"node" cql:"node"`
-	System               string    `json:"system" cql:"system"`
-	Status               string    `json:"status" cql:"status"`
-	Source               string    `json:"source" cql:"source"`
-	Message              string    `json:"message" cql:"message"`
-	AuditPeriodBeginning string    `json:"audit_period_beginning" cql:"audit_period_beginning"`
-	AuditPeriodEnding    string    `json:"audit_period_ending" cql:"audit_period_ending"`
-	AuditPeriodDelta     string    `json:"audit_period_delta" cql:"audit_period_delta"`
-	Metrics              Metrics   `json:"metrics" cql:"metrics"`
-	CreatedAt            time.Time `json:"created_at" cql:"created_at"`
-	QuotaId              string    `json:"-"`
-	Resources            string    `json:"-"`
+	Id                   string        `json:"id" cql:"id"`
+	AccountId            string        `json:"account_id" cql:"account_id"`
+	SensorType           string        `json:"sensor_type" cql:"sensor_type"`
+	AssemblyId           string        `json:"assembly_id" cql:"assembly_id"`
+	AssemblyName         string        `json:"assembly_name" cql:"assembly_name"`
+	AssembliesId         string        `json:"assemblies_id" cql:"assemblies_id"`
+	Node                 string        `json:"node" cql:"node"`
+	System               string        `json:"system" cql:"system"`
+	Status               string        `json:"status" cql:"status"`
+	Source               string        `json:"source" cql:"source"`
+	Message              string        `json:"message" cql:"message"`
+	AuditPeriodBeginning string        `json:"audit_period_beginning" cql:"audit_period_beginning"`
+	AuditPeriodEnding    string        `json:"audit_period_ending" cql:"audit_period_ending"`
+	AuditPeriodDelta     string        `json:"audit_period_delta" cql:"audit_period_delta"`
+	Metrics              Metrics       `json:"metrics" cql:"metrics"`
+	CreatedAt            time.Time     `json:"created_at" cql:"created_at"`
+	QuotaId              string        `json:"-"`
+	Resources            string        `json:"-"`
+	Interval             time.Duration `json:"-"` //billed, MetricsInterval when zero.
 }
 
 func (s *Sensor) String() string {
@@ -77,6 +78,18 @@ func (s *Sensor) newMetric(me *Metric) {
 	s.Metrics = append(s.Metrics, me)
 }
 
+// cost is the cost of the metrics for the interval billed.
+func (s *Sensor) cost(units map[string]string) string {
+	return s.Metrics.TotalcostFor(units, s.billedInterval())
+}
+
+func (s *Sensor) billedInterval() time.Duration {
+	if s.Interval <= 0 {
+		return MetricsInterval
+	}
+	return s.Interval
+}
+
 func (s *Sensor) isOk() bool {
 	return s.AccountId != "" && s.AssemblyId != ""
 }
@@ -0,0 +1,237 @@
+package metrix
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/megamsys/vertice/instrument"
+)
+
+const (
+	INFLUXDB     = "influxdb"
+	KAFKA        = "kafka"
+	FILE         = "file"
+	REMOTE_WRITE = "remote_write"
+
+	DefaultSinkBackoff = 5 * time.Second
+	DefaultSinkBuffer  = 64
+	DefaultSinkTimeout = 10 * time.Second
+)
+
+// Sink writes the sensors collected somewhere else than the gateway.
+type Sink interface {
+	Name() string
+	Write(all Sensors, hostname string) error
+}
+
+// SinkPolicy is how a sink is retried and how much it holds while it is
+// behind.
+type SinkPolicy struct {
+	Retries int           //times a batch is written again when it fails.
+	Backoff time.Duration //before the first retry, doubled at each.
+	Buffer  int           //batches waiting to be written, the oldest dropped when full.
+}
+
+type batch struct {
+	all      Sensors
+	hostname string
+}
+
+// BufferedSink writes to its sink in the background with its policy, so a
+// slow or failing sink neither holds the collectors nor the other sinks.
+type BufferedSink struct {
+	Sink
+	Policy SinkPolicy
+
+	batches chan *batch
+	closing chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+// NewBufferedSink starts writing to the sink with the policy.
+func NewBufferedSink(s Sink, p SinkPolicy) *BufferedSink {
+	if p.Buffer < 1 {
+		p.Buffer = 1
+	}
+	b := &BufferedSink{
+		Sink:    s,
+		Policy:  p,
+		batches: make(chan *batch, p.Buffer),
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go b.loop()
+	return b
+}
+
+// Write queues the sensors, dropping the oldest batch when the buffer is full.
+func (b *BufferedSink) Write(all Sensors, hostname string) error {
+	select {
+	case <-b.closing:
+		return fmt.Errorf("sink %s is closed", b.Name())
+	default:
+	}
+	bt := &batch{all: all, hostname: hostname}
+	for {
+		select {
+		case b.batches <- bt:
+			return nil
+		default:
+		}
+		select {
+		case <-b.batches:
+			log.Warnf("sink %s is behind, dropped the oldest batch", b.Name())
+			instrument.SinkBatches.Inc(b.Name(), "dropped")
+		default:
+		}
+	}
+}
+
+func (b *BufferedSink) loop() {
+	defer close(b.done)
+	for {
+		select {
+		case bt := <-b.batches:
+			b.write(bt)
+		case <-b.closing:
+			//what is left is written, without waiting between the retries.
+			for {
+				select {
+				case bt := <-b.batches:
+					b.write(bt)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (b *BufferedSink) write(bt *batch) {
+	backoff := b.Policy.Backoff
+	for retry := 0; ; retry++ {
+		err := b.Sink.Write(bt.all, bt.hostname)
+		if err == nil {
+			instrument.SinkBatches.Inc(b.Name(), "ok")
+			return
+		}
+		if retry >= b.Policy.Retries {
+			log.Errorf("sink %s dropped %d sensors : %s", b.Name(), len(bt.all), err)
+			instrument.SinkBatches.Inc(b.Name(), "error")
+			return
+		}
+		log.Debugf("sink %s failed, retrying in %s : %s", b.Name(), backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-b.closing:
+			backoff = 0
+		}
+		backoff *= 2
+	}
+}
+
+// Close writes the batches queued, then closes the sink.
+func (b *BufferedSink) Close() error {
+	b.once.Do(func() { close(b.closing) })
+	<-b.done
+	if c, ok := b.Sink.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+//point is a metric of a sensor, as the time series databases see it.
+type point struct {
+	name  string
+	tags  []tag //sorted by key, none empty.
+	value float64
+	at    time.Time
+}
+
+type tag struct {
+	key, value string
+}
+
+//points are the metrics of the sensors that are numbers, tagged with where
+//they come from.
+func points(all Sensors, hostname string) []*point {
+	var ps []*point
+	for _, s := range all {
+		at, err := time.Parse(time.RFC3339, s.AuditPeriodEnding)
+		if err != nil {
+			at = s.CreatedAt
+		}
+		if at.IsZero() {
+			at = time.Now()
+		}
+		for _, m := range s.Metrics {
+			v, err := strconv.ParseFloat(m.MetricValue, 64)
+			if err != nil {
+				continue
+			}
+			tags := []tag{}
+			for _, t := range []tag{
+				{"account_id", s.AccountId},
+				{"assemblies_id", s.AssembliesId},
+				{"assembly_id", s.AssemblyId},
+				{"assembly_name", s.AssemblyName},
+				{"host", hostname},
+				{"sensor_type", s.SensorType},
+				{"units", m.MetricUnits},
+			} {
+				if t.value != "" {
+					tags = append(tags, t)
+				}
+			}
+			ps = append(ps, &point{name: m.MetricName, tags: tags, value: v, at: at})
+		}
+	}
+	return ps
+}
+
+//httpSink posts what a sink writes.
+type httpSink struct {
+	URL      string
+	Username string
+	Password string
+	client   *http.Client
+}
+
+func newHTTPSink(url, username, password string, timeout time.Duration) httpSink {
+	if timeout <= 0 {
+		timeout = DefaultSinkTimeout
+	}
+	return httpSink{URL: url, Username: username, Password: password, client: &http.Client{Timeout: timeout}}
+}
+
+//post posts the body and returns the response body, an error unless it is 2xx.
+func (h *httpSink) post(url string, body []byte, header map[string]string) ([]byte, error) {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	if h.Username != "" {
+		req.SetBasicAuth(h.Username, h.Password)
+	}
+	res, err := h.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	b, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if res.StatusCode/100 != 2 {
+		return b, fmt.Errorf("%s : %s %s", url, res.Status, bytes.TrimSpace(b))
+	}
+	return b, nil
+}
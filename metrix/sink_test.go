@@ -0,0 +1,204 @@
+package metrix
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/snappy"
+	"gopkg.in/check.v1"
+)
+
+func sinkSensors() Sensors {
+	sc := NewSensor(ONE_VM_SENSOR)
+	sc.AccountId, sc.AssemblyId, sc.AssembliesId, sc.AssemblyName = "info@megam.io", "ASM1", "AMS1", "web megambox.com"
+	sc.AuditPeriodEnding = "2017-06-01T00:10:00Z"
+	sc.addMetric(CPU_COST, "0.1", "2", "delta")
+	sc.addMetric("state", "running", "", "")
+	return Sensors{sc}
+}
+
+//request is what a test server was sent.
+type request struct {
+	path   string
+	header http.Header
+	body   []byte
+}
+
+func sinkServer(c *check.C, status int, res string) (*httptest.Server, chan *request) {
+	reqs := make(chan *request, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := ioutil.ReadAll(r.Body)
+		c.Check(err, check.IsNil)
+		reqs <- &request{path: r.URL.RequestURI(), header: r.Header, body: b}
+		w.WriteHeader(status)
+		w.Write([]byte(res))
+	}))
+	return ts, reqs
+}
+
+func (s *S) TestInfluxSink(c *check.C) {
+	ts, reqs := sinkServer(c, http.StatusNoContent, "")
+	defer ts.Close()
+	sk := NewInfluxSink(ts.URL+"/write?db=vertice", "", "", 0)
+	c.Assert(sk.Write(sinkSensors(), "node1"), check.IsNil)
+	r := <-reqs
+	c.Assert(r.path, check.Equals, "/write?db=vertice")
+	c.Assert(string(r.body), check.Equals,
+		`cpu_cost,account_id=info@megam.io,assemblies_id=AMS1,assembly_id=ASM1,assembly_name=web\ megambox.com,host=node1,sensor_type=compute.vm.exists,units=2 value=0.1 1496275800000000000`+"\n")
+
+	ts, _ = sinkServer(c, http.StatusBadRequest, `{"error":"unable to parse"}`)
+	defer ts.Close()
+	sk = NewInfluxSink(ts.URL+"/write?db=vertice", "", "", 0)
+	c.Assert(sk.Write(sinkSensors(), "node1"), check.ErrorMatches, `.*400 Bad Request \{"error":"unable to parse"\}`)
+}
+
+func (s *S) TestKafkaSink(c *check.C) {
+	ts, reqs := sinkServer(c, http.StatusOK, `{"offsets":[{"partition":1,"offset":10,"error_code":null,"error":null}]}`)
+	defer ts.Close()
+	sk := NewKafkaSink(ts.URL+"/", "vertice sensors", "", "", 0)
+	c.Assert(sk.Write(sinkSensors(), "node1"), check.IsNil)
+	r := <-reqs
+	c.Assert(r.path, check.Equals, "/topics/vertice%20sensors")
+	c.Assert(r.header.Get("Content-Type"), check.Equals, "application/vnd.kafka.json.v2+json")
+	var body struct {
+		Records []struct {
+			Key   string
+			Value *Sensor
+		}
+	}
+	c.Assert(json.Unmarshal(r.body, &body), check.IsNil)
+	c.Assert(body.Records, check.HasLen, 1)
+	c.Assert(body.Records[0].Key, check.Equals, "info@megam.io")
+	c.Assert(body.Records[0].Value.Metrics, check.HasLen, 2)
+
+	ts, _ = sinkServer(c, http.StatusOK, `{"offsets":[{"partition":null,"offset":null,"error_code":50002,"error":"not leader"}]}`)
+	defer ts.Close()
+	sk = NewKafkaSink(ts.URL, "sensors", "", "", 0)
+	c.Assert(sk.Write(sinkSensors(), "node1"), check.ErrorMatches, "1 of 1 records not produced to sensors : not leader")
+}
+
+func (s *S) TestRemoteWriteSink(c *check.C) {
+	ts, reqs := sinkServer(c, http.StatusNoContent, "")
+	defer ts.Close()
+	sk := NewRemoteWriteSink(ts.URL+"/api/v1/write", "prom", "secret", 0)
+	c.Assert(sk.Write(sinkSensors(), "node1"), check.IsNil)
+	r := <-reqs
+	c.Assert(r.header.Get("Content-Encoding"), check.Equals, "snappy")
+	c.Assert(r.header.Get("Authorization"), check.Equals, "Basic cHJvbTpzZWNyZXQ=")
+	b, err := snappy.Decode(nil, r.body)
+	c.Assert(err, check.IsNil)
+	var label, sample protoBuf
+	label.string(1, "__name__")
+	label.string(2, "vertice_cpu_cost")
+	sample.double(1, 0.1)
+	sample.varint(2, 1496275800000)
+	c.Assert(strings.Contains(string(b), string(label)), check.Equals, true)
+	c.Assert(strings.HasSuffix(string(b), string(sample)), check.Equals, true)
+	//the request is the timeseries.
+	c.Assert(b[0], check.Equals, byte(1<<3|2))
+	c.Assert(seriesName("disk.io-cost"), check.Equals, "vertice_disk_io_cost")
+}
+
+func (s *S) TestFileSinkRotates(c *check.C) {
+	dir, err := ioutil.TempDir("", "sink")
+	c.Assert(err, check.IsNil)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sensors", "sensors.jsonl")
+	sk := NewFileSink(path, 1, 2)
+	for i := 0; i < 4; i++ {
+		c.Assert(sk.Write(sinkSensors(), "node1"), check.IsNil)
+	}
+	c.Assert(sk.Close(), check.IsNil)
+	names := []string{}
+	files, _ := ioutil.ReadDir(filepath.Dir(path))
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	c.Assert(names, check.DeepEquals, []string{"sensors.jsonl", "sensors.jsonl.1", "sensors.jsonl.2"})
+	b, err := ioutil.ReadFile(path)
+	c.Assert(err, check.IsNil)
+	var sc Sensor
+	c.Assert(json.Unmarshal(b, &sc), check.IsNil)
+	c.Assert(sc.AssemblyId, check.Equals, "ASM1")
+	//a sink opened again appends.
+	sk = NewFileSink(path, 1<<20, 2)
+	c.Assert(sk.Write(sinkSensors(), "node1"), check.IsNil)
+	c.Assert(sk.Close(), check.IsNil)
+	b, _ = ioutil.ReadFile(path)
+	c.Assert(strings.Count(string(b), "\n"), check.Equals, 2)
+}
+
+//flakySink fails its first writes, a write waits for unblock when there is one.
+type flakySink struct {
+	mu      sync.Mutex
+	fails   int
+	writes  int
+	written []Sensors
+	unblock chan struct{}
+}
+
+func (f *flakySink) Name() string { return "flaky" }
+
+func (f *flakySink) Write(all Sensors, hostname string) error {
+	if f.unblock != nil {
+		<-f.unblock
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.writes++
+	if f.writes <= f.fails {
+		return errors.New("down")
+	}
+	f.written = append(f.written, all)
+	return nil
+}
+
+func (s *S) TestBufferedSinkRetries(c *check.C) {
+	f := &flakySink{fails: 2}
+	b := NewBufferedSink(f, SinkPolicy{Retries: 2, Backoff: time.Millisecond, Buffer: 4})
+	c.Assert(b.Write(sinkSensors(), "node1"), check.IsNil)
+	c.Assert(b.Close(), check.IsNil)
+	c.Assert(f.writes, check.Equals, 3)
+	c.Assert(f.written, check.HasLen, 1)
+	c.Assert(b.Write(sinkSensors(), "node1"), check.NotNil)
+
+	//out of retries, the batch is dropped.
+	f = &flakySink{fails: 2}
+	b = NewBufferedSink(f, SinkPolicy{Retries: 1, Backoff: time.Millisecond, Buffer: 4})
+	b.Write(sinkSensors(), "node1")
+	b.Write(sinkSensors(), "node1")
+	c.Assert(b.Close(), check.IsNil)
+	c.Assert(f.writes, check.Equals, 3)
+	c.Assert(f.written, check.HasLen, 1)
+}
+
+func (s *S) TestBufferedSinkDropsTheOldest(c *check.C) {
+	f := &flakySink{unblock: make(chan struct{})}
+	b := NewBufferedSink(f, SinkPolicy{Buffer: 2})
+	batches := []Sensors{}
+	for i := 0; i < 5; i++ {
+		sc := NewSensor(ONE_VM_SENSOR)
+		sc.AssemblyId = "ASM" + strconv.Itoa(i)
+		batches = append(batches, Sensors{sc})
+	}
+	c.Assert(b.Write(batches[0], "node1"), check.IsNil)
+	//the first one is being written, the next ones drop the oldest waiting.
+	for len(b.batches) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	for _, bt := range batches[1:] {
+		c.Assert(b.Write(bt, "node1"), check.IsNil)
+	}
+	close(f.unblock)
+	c.Assert(b.Close(), check.IsNil)
+	c.Assert(f.written, check.DeepEquals, []Sensors{batches[0], batches[3], batches[4]})
+}
@@ -13,6 +13,7 @@ const (
 type Snapshots struct {
 	DefaultUnits map[string]string
 	RawStatus    []byte
+	Ledger       *Ledger
 }
 
 func (r *Snapshots) Prefix() string {
@@ -21,8 +22,10 @@ func (r *Snapshots) Prefix() string {
 
 func (r *Snapshots) DeductBill(c *MetricsCollection) (e error) {
 	for _, mc := range c.Sensors {
-		mkBalance(mc, r.DefaultUnits)
+		err := mkBalance(mc, r.DefaultUnits)
+		recordBill(r.Ledger, mc, r.DefaultUnits, err)
 	}
+	flushBills(r.Ledger)
 	return
 }
 
@@ -33,6 +36,8 @@ func (s *Snapshots) Collect(c *MetricsCollection) (e error) {
 		return
 	}
 
+	//the periods begun and not recorded are billed again next time.
+	defer abortBills(s.Ledger, c)
 	s.CollectMetricsFromStats(c, snps)
 	e = s.DeductBill(c)
 	return
@@ -49,8 +54,14 @@ func (c *Snapshots) ReadUsers() ([]*carton.Account, error) {
 
 //actually the NewSensor can create trypes based on the event type.
 func (c *Snapshots) CollectMetricsFromStats(mc *MetricsCollection, snps []carton.Snaps) {
+	end := time.Now()
 	for _, a := range snps {
 		if !a.IsQuota() && a.IsAlive() {
+			//a snapshot is billed since its last charge in the ledger.
+			start, ok := beginBill(c.Ledger, BillKey(SNAPSHOT_SENSOR, a.AssemblyId, a.Id), end)
+			if !ok {
+				continue
+			}
 			sc := NewSensor(SNAPSHOT_SENSOR)
 			sc.AccountId = a.AccountId
 			sc.AssemblyId = a.AssemblyId
@@ -61,11 +72,12 @@ func (c *Snapshots) CollectMetricsFromStats(mc *MetricsCollection, snps []carton
 			sc.Source = c.Prefix()
 			sc.Message = "snapshot billing"
 			sc.Status = "health-ok"
-			sc.AuditPeriodBeginning = time.Now().Add(-MetricsInterval).Format(time.RFC3339)
-			sc.AuditPeriodEnding = time.Now().Format(time.RFC3339)
+			sc.AuditPeriodBeginning = start.Format(time.RFC3339)
+			sc.AuditPeriodEnding = end.Format(time.RFC3339)
 			sc.AuditPeriodDelta = ""
+			sc.Interval = end.Sub(start)
 			sc.addMetric(STORAGE_COST, c.DefaultUnits[STORAGE_COST_PER_HOUR], a.Sizeof(), "delta")
-			sc.CreatedAt = time.Now()
+			sc.CreatedAt = end
 			mc.Add(sc)
 		}
 	}
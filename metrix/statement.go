@@ -0,0 +1,253 @@
+package metrix
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	JSON = "json"
+	CSV  = "csv"
+	HTML = "html"
+
+	OTHER_RESOURCE = "other"
+)
+
+//the order of the resources in a statement.
+var resourceOrder = []string{CPU_RESOURCE, RAM_RESOURCE, DISK_RESOURCE, DISK_IO_RESOURCE, NETWORK_RESOURCE,
+	SNAPSHOTS, BACKUPS, OBJECT_STORAGE_RESOURCE, OTHER_RESOURCE}
+
+// Amount is an amount billed in millionths, the precision of the bills, so
+// the totals add up to the amounts deducted.
+type Amount int64
+
+// ParseAmount parses an amount billed, "0.050000".
+func ParseAmount(s string) Amount {
+	f, _ := strconv.ParseFloat(s, 64)
+	return amountOf(f)
+}
+
+func amountOf(f float64) Amount {
+	if f < 0 {
+		return -amountOf(-f)
+	}
+	return Amount(math.Floor(f*1e6 + 0.5))
+}
+
+func (a Amount) String() string {
+	sign := ""
+	if a < 0 {
+		sign, a = "-", -a
+	}
+	return fmt.Sprintf("%s%d.%06d", sign, a/1e6, a%1e6)
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return json.Marshal(a.String())
+}
+
+// StatementLine is what a resource of an assembly cost, paid by a quota or
+// deducted on demand.
+type StatementLine struct {
+	Resource string  `json:"resource"`
+	Billing  string  `json:"billing"`
+	Hours    float64 `json:"hours"`
+	Amount   Amount  `json:"amount"`
+}
+
+// StatementAssembly is what an assembly cost, its snapshots and backups
+// included. The object storage of the account has no assembly.
+type StatementAssembly struct {
+	AssemblyId   string           `json:"assembly_id"`
+	AssemblyName string           `json:"assembly_name"`
+	Lines        []*StatementLine `json:"lines"`
+	Ondemand     Amount           `json:"ondemand"`
+	Quota        Amount           `json:"quota"`
+}
+
+// Statement is what an account was billed for the periods ending in
+// (From, To]. Ondemand is the total deducted, Quota what the quotas paid.
+// The posts that failed aren't in it, they are billed again or listed by a
+// reconciliation.
+type Statement struct {
+	AccountId  string               `json:"account_id"`
+	From       time.Time            `json:"from"`
+	To         time.Time            `json:"to"`
+	Assemblies []*StatementAssembly `json:"assemblies"`
+	Ondemand   Amount               `json:"ondemand"`
+	Quota      Amount               `json:"quota"`
+	Failed     int                  `json:"failed"`
+	CreatedAt  time.Time            `json:"created_at"`
+}
+
+// Statement is the statement of the account for the periods ending in (from, to].
+func (l *Ledger) Statement(account string, from, to time.Time) (*Statement, error) {
+	entries, err := l.Entries(account, from, to)
+	if err != nil {
+		return nil, err
+	}
+	st := &Statement{AccountId: account, From: from, To: to, CreatedAt: time.Now()}
+	asms := make(map[string]*StatementAssembly)
+	lines := make(map[string]*StatementLine)
+	for _, e := range entries {
+		switch {
+		case e.Status == FAILED:
+			st.Failed++
+			continue
+		case e.Status == SKIPPED && e.Billing != QUOTA:
+			continue
+		}
+		a, ok := asms[e.AssemblyId]
+		if !ok {
+			a = &StatementAssembly{AssemblyId: e.AssemblyId, AssemblyName: e.AssemblyName}
+			asms[e.AssemblyId] = a
+		}
+		//the snapshots and backups are named after themselves.
+		if e.SensorType == ONE_VM_SENSOR || e.SensorType == DOCKER_CONTAINER_SENSOR {
+			a.AssemblyName = e.AssemblyName
+		}
+		for resource, amount := range split(ParseAmount(e.Consumed), e.Items) {
+			key := e.AssemblyId + "/" + resource + "/" + e.Billing
+			line, ok := lines[key]
+			if !ok {
+				line = &StatementLine{Resource: resource, Billing: e.Billing}
+				lines[key] = line
+				a.Lines = append(a.Lines, line)
+			}
+			line.Hours += e.End.Sub(e.Start).Hours()
+			line.Amount += amount
+			if e.Billing == QUOTA {
+				a.Quota += amount
+				st.Quota += amount
+			} else {
+				a.Ondemand += amount
+				st.Ondemand += amount
+			}
+		}
+	}
+	for _, a := range asms {
+		sort.Slice(a.Lines, func(i, j int) bool {
+			if a.Lines[i].Resource != a.Lines[j].Resource {
+				return resourceRank(a.Lines[i].Resource) < resourceRank(a.Lines[j].Resource)
+			}
+			return a.Lines[i].Billing < a.Lines[j].Billing
+		})
+		st.Assemblies = append(st.Assemblies, a)
+	}
+	sort.Slice(st.Assemblies, func(i, j int) bool {
+		if st.Assemblies[i].AssemblyName != st.Assemblies[j].AssemblyName {
+			return st.Assemblies[i].AssemblyName < st.Assemblies[j].AssemblyName
+		}
+		return st.Assemblies[i].AssemblyId < st.Assemblies[j].AssemblyId
+	})
+	return st, nil
+}
+
+//split splits the amount billed by resource as the costs, what the costs lose
+//by rounding goes to the biggest so the amounts add up to the one billed.
+func split(amount Amount, costs map[string]float64) map[string]Amount {
+	if len(costs) == 0 {
+		return map[string]Amount{OTHER_RESOURCE: amount}
+	}
+	names := make([]string, 0, len(costs))
+	for name := range costs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	split := make(map[string]Amount)
+	rest, biggest := amount, names[0]
+	for _, name := range names {
+		split[name] = amountOf(costs[name])
+		rest -= split[name]
+		if costs[name] > costs[biggest] {
+			biggest = name
+		}
+	}
+	split[biggest] += rest
+	return split
+}
+
+func resourceRank(resource string) int {
+	for i, r := range resourceOrder {
+		if r == resource {
+			return i
+		}
+	}
+	return len(resourceOrder)
+}
+
+// Write renders the statement as json, csv or html.
+func (st *Statement) Write(w io.Writer, format string) error {
+	switch format {
+	case JSON:
+		return json.NewEncoder(w).Encode(st)
+	case CSV:
+		return st.writeCSV(w)
+	case HTML:
+		return statementHTML.Execute(w, st)
+	}
+	return fmt.Errorf("unknown statement format %s, json, csv or html", format)
+}
+
+func (st *Statement) writeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"account_id", "assembly_id", "assembly_name", "resource", "billing", "hours", "amount"})
+	for _, a := range st.Assemblies {
+		for _, l := range a.Lines {
+			cw.Write([]string{st.AccountId, a.AssemblyId, a.AssemblyName, l.Resource, l.Billing,
+				strconv.FormatFloat(l.Hours, 'f', 2, 64), l.Amount.String()})
+		}
+	}
+	cw.Write([]string{st.AccountId, "", "total", "", ONDEMAND, "", st.Ondemand.String()})
+	cw.Write([]string{st.AccountId, "", "total", "", QUOTA, "", st.Quota.String()})
+	cw.Flush()
+	return cw.Error()
+}
+
+var statementHTML = template.Must(template.New("statement").Funcs(template.FuncMap{
+	"date":  func(t time.Time) string { return t.Format("02 Jan 2006 15:04 MST") },
+	"hours": func(h float64) string { return strconv.FormatFloat(h, 'f', 2, 64) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Statement {{.AccountId}}</title>
+<style>
+@page { size: A4; margin: 20mm; }
+body { font-family: Helvetica, Arial, sans-serif; font-size: 11px; color: #222; }
+h1 { font-size: 18px; margin: 0 0 4px; }
+table { width: 100%; border-collapse: collapse; margin: 12px 0; page-break-inside: avoid; }
+th, td { padding: 4px 6px; border-bottom: 1px solid #ddd; text-align: left; }
+th { background: #f4f4f4; }
+td.num, th.num { text-align: right; }
+tr.total td { font-weight: bold; border-top: 2px solid #222; }
+</style>
+</head>
+<body>
+<h1>Statement</h1>
+<p>{{.AccountId}}<br>{{date .From}} to {{date .To}}</p>
+{{range .Assemblies}}
+<table>
+<tr><th colspan="4">{{if .AssemblyName}}{{.AssemblyName}}{{else}}account{{end}} <small>{{.AssemblyId}}</small></th></tr>
+<tr><th>resource</th><th>billing</th><th class="num">hours</th><th class="num">amount</th></tr>
+{{range .Lines}}<tr><td>{{.Resource}}</td><td>{{.Billing}}</td><td class="num">{{hours .Hours}}</td><td class="num">{{.Amount}}</td></tr>
+{{end}}<tr class="total"><td colspan="3">ondemand</td><td class="num">{{.Ondemand}}</td></tr>
+{{if .Quota}}<tr class="total"><td colspan="3">quota</td><td class="num">{{.Quota}}</td></tr>{{end}}
+</table>
+{{end}}
+<table>
+<tr class="total"><td>total deducted</td><td class="num">{{.Ondemand}}</td></tr>
+<tr><td>paid by the quotas</td><td class="num">{{.Quota}}</td></tr>
+</table>
+{{if .Failed}}<p>{{.Failed}} periods couldn't be billed yet.</p>{{end}}
+<p><small>created {{date .CreatedAt}}</small></p>
+</body>
+</html>
+`))
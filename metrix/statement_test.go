@@ -0,0 +1,109 @@
+package metrix
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestAmount(c *check.C) {
+	c.Assert(ParseAmount("0.050000"), check.Equals, Amount(50000))
+	c.Assert(ParseAmount("1.2345676"), check.Equals, Amount(1234568))
+	c.Assert(Amount(1234568).String(), check.Equals, "1.234568")
+	c.Assert(Amount(-50000).String(), check.Equals, "-0.050000")
+	//what the costs lose by rounding goes to the biggest.
+	c.Assert(split(ParseAmount("0.100000"), map[string]float64{CPU_RESOURCE: 0.0333334, RAM_RESOURCE: 0.0333333, DISK_RESOURCE: 0.0333333}),
+		check.DeepEquals, map[string]Amount{CPU_RESOURCE: 33334, RAM_RESOURCE: 33333, DISK_RESOURCE: 33333})
+	c.Assert(split(ParseAmount("0.100000"), map[string]float64{CPU_RESOURCE: 0.0333333, RAM_RESOURCE: 0.0333333, DISK_RESOURCE: 0.0333333}),
+		check.DeepEquals, map[string]Amount{CPU_RESOURCE: 33334, RAM_RESOURCE: 33333, DISK_RESOURCE: 33333})
+	c.Assert(split(ParseAmount("0.5"), nil), check.DeepEquals, map[string]Amount{OTHER_RESOURCE: 500000})
+}
+
+func (s *S) TestStatement(c *check.C) {
+	l, dir := openLedger(c)
+	defer os.RemoveAll(dir)
+	t0 := time.Date(2017, 6, 1, 0, 0, 0, 0, time.UTC)
+	at := func(m int) time.Time { return t0.Add(time.Duration(m) * time.Minute) }
+	vm := func(asm, name, billing, consumed, status string, m int, items map[string]float64) *LedgerEntry {
+		return &LedgerEntry{AccountId: "info@megam.io", AssemblyId: asm, AssembliesId: "AMS" + asm, AssemblyName: name, SensorType: ONE_VM_SENSOR,
+			Billing: billing, Start: at(m - 10), End: at(m), Consumed: consumed, Items: items, Status: status}
+	}
+	thirds := map[string]float64{CPU_RESOURCE: 0.0333333, RAM_RESOURCE: 0.0333333, DISK_RESOURCE: 0.0333333}
+	var deducted Amount
+	for _, e := range []*LedgerEntry{
+		vm("ASM1", "web.megambox.com", ONDEMAND, "0.100000", POSTED, 10, thirds),
+		vm("ASM1", "web.megambox.com", ONDEMAND, "0.100000", POSTED, 20, thirds),
+		vm("ASM1", "web.megambox.com", ONDEMAND, "0.100000", FAILED, 30, thirds),
+		vm("ASM2", "db.megambox.com", QUOTA, "0.200000", SKIPPED, 10, map[string]float64{CPU_RESOURCE: 0.2}),
+		vm("ASM2", "db.megambox.com", ONDEMAND, "0.000000", SKIPPED, 20, map[string]float64{CPU_RESOURCE: 0}),
+		{AccountId: "info@megam.io", AssemblyId: "ASM1", AssembliesId: "SNP1", AssemblyName: "snap-1", SensorType: SNAPSHOT_SENSOR,
+			Billing: ONDEMAND, Start: at(0), End: at(10), Consumed: "0.010000", Items: map[string]float64{SNAPSHOTS: 0.01}, Status: POSTED},
+		{AccountId: "info@megam.io", SensorType: CEPH_STORAGE_SENSOR,
+			Billing: ONDEMAND, Start: at(0), End: at(10), Consumed: "0.020000", Items: map[string]float64{OBJECT_STORAGE_RESOURCE: 0.02}, Status: POSTED},
+		//another account and another period.
+		{AccountId: "other@megam.io", AssemblyId: "ASM3", SensorType: ONE_VM_SENSOR, Start: at(0), End: at(10), Consumed: "1.000000", Status: POSTED},
+		vm("ASM1", "web.megambox.com", ONDEMAND, "0.100000", POSTED, 24*60*30+10, thirds),
+	} {
+		c.Assert(l.Record(e), check.IsNil)
+		if e.AccountId == "info@megam.io" && e.Status == POSTED && e.End.Before(at(24*60*30)) {
+			deducted += ParseAmount(e.Consumed)
+		}
+	}
+	st, err := l.Statement("info@megam.io", t0, at(24*60*30))
+	c.Assert(err, check.IsNil)
+	//the totals are the amounts deducted.
+	c.Assert(st.Ondemand, check.Equals, deducted)
+	c.Assert(st.Ondemand.String(), check.Equals, "0.230000")
+	c.Assert(st.Quota.String(), check.Equals, "0.200000")
+	c.Assert(st.Failed, check.Equals, 1)
+	c.Assert(st.Assemblies, check.HasLen, 3)
+	names := []string{}
+	for _, a := range st.Assemblies {
+		names = append(names, a.AssemblyName)
+	}
+	c.Assert(names, check.DeepEquals, []string{"", "db.megambox.com", "web.megambox.com"})
+	web := st.Assemblies[2]
+	c.Assert(web.Ondemand.String(), check.Equals, "0.210000")
+	lines := []string{}
+	for _, l := range web.Lines {
+		lines = append(lines, l.Resource+" "+l.Billing+" "+l.Amount.String()+" "+strconv.FormatFloat(l.Hours, 'f', 2, 64))
+	}
+	c.Assert(lines, check.DeepEquals, []string{
+		"cpu ondemand 0.066668 0.33",
+		"ram ondemand 0.066666 0.33",
+		"disk ondemand 0.066666 0.33",
+		"snapshots ondemand 0.010000 0.17",
+	})
+	c.Assert(st.Assemblies[1].Lines, check.DeepEquals, []*StatementLine{{Resource: CPU_RESOURCE, Billing: QUOTA, Hours: 10 / 60.0, Amount: 200000}})
+	c.Assert(st.Assemblies[0].Lines[0].Resource, check.Equals, OBJECT_STORAGE_RESOURCE)
+}
+
+func (s *S) TestStatementWrite(c *check.C) {
+	t0 := time.Date(2017, 6, 1, 0, 0, 0, 0, time.UTC)
+	st := &Statement{AccountId: "info@megam.io", From: t0, To: t0.AddDate(0, 1, 0), Ondemand: 230000, Quota: 200000, CreatedAt: t0,
+		Assemblies: []*StatementAssembly{{AssemblyId: "ASM1", AssemblyName: "web.megambox.com", Ondemand: 230000, Quota: 200000,
+			Lines: []*StatementLine{{Resource: CPU_RESOURCE, Billing: ONDEMAND, Hours: 1, Amount: 230000}, {Resource: CPU_RESOURCE, Billing: QUOTA, Hours: 1, Amount: 200000}}}}}
+	var b bytes.Buffer
+	c.Assert(st.Write(&b, CSV), check.IsNil)
+	c.Assert(b.String(), check.Equals, `account_id,assembly_id,assembly_name,resource,billing,hours,amount
+info@megam.io,ASM1,web.megambox.com,cpu,ondemand,1.00,0.230000
+info@megam.io,ASM1,web.megambox.com,cpu,quota,1.00,0.200000
+info@megam.io,,total,,ondemand,,0.230000
+info@megam.io,,total,,quota,,0.200000
+`)
+	b.Reset()
+	c.Assert(st.Write(&b, JSON), check.IsNil)
+	var m map[string]interface{}
+	c.Assert(json.Unmarshal(b.Bytes(), &m), check.IsNil)
+	c.Assert(m["ondemand"], check.Equals, "0.230000")
+	b.Reset()
+	c.Assert(st.Write(&b, HTML), check.IsNil)
+	c.Assert(strings.Contains(b.String(), `<td>cpu</td><td>quota</td><td class="num">1.00</td><td class="num">0.200000</td>`), check.Equals, true)
+	c.Assert(strings.Contains(b.String(), "01 Jun 2017 00:00 UTC to 01 Jul 2017 00:00 UTC"), check.Equals, true)
+	c.Assert(st.Write(&b, "pdf"), check.NotNil)
+}
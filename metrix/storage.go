@@ -24,6 +24,7 @@ type CephRGWStats struct {
 	UserPrefix   string
 	DefaultUnits map[string]string
 	RawStatus    []byte
+	Ledger       *Ledger
 }
 
 func (rgw *CephRGWStats) Prefix() string {
@@ -32,8 +33,10 @@ func (rgw *CephRGWStats) Prefix() string {
 
 func (rgw *CephRGWStats) DeductBill(c *MetricsCollection) (e error) {
 	for _, mc := range c.Sensors {
-		mkBalance(mc, rgw.DefaultUnits)
+		err := mkBalance(mc, rgw.DefaultUnits)
+		recordBill(rgw.Ledger, mc, rgw.DefaultUnits, err)
 	}
+	flushBills(rgw.Ledger)
 	return
 }
 
@@ -43,6 +46,8 @@ func (rgw *CephRGWStats) Collect(c *MetricsCollection) (e error) {
 		return
 	}
 
+	//the periods begun and not recorded are billed again next time.
+	defer abortBills(rgw.Ledger, c)
 	rgw.CollectMetricsFromStats(c, acc)
 	e = rgw.DeductBill(c)
 	return
@@ -59,11 +64,17 @@ func (c *CephRGWStats) ReadUsers() ([]*carton.Account, error) {
 
 //actually the NewSensor can create trypes based on the event type.
 func (c *CephRGWStats) CollectMetricsFromStats(mc *MetricsCollection, acts []*carton.Account) {
+	end := time.Now()
 	for _, a := range acts {
 		r := storage.NewRgW(c.Url, c.AccessKey, c.SecretKey)
 		r.UserId = a.Email
 		err := r.GetUserStorageSize()
 		if err == nil {
+			//the storage of an account is billed since its last charge in the ledger.
+			start, ok := beginBill(c.Ledger, BillKey(CEPH_STORAGE_SENSOR, a.Email, ""), end)
+			if !ok {
+				continue
+			}
 			sc := NewSensor(CEPH_STORAGE_SENSOR)
 			sc.AccountId = a.Email
 			sc.System = c.Prefix()
@@ -72,11 +83,12 @@ func (c *CephRGWStats) CollectMetricsFromStats(mc *MetricsCollection, acts []*ca
 			sc.Source = c.Prefix()
 			sc.Message = "storage billing"
 			sc.Status = "health-ok"
-			sc.AuditPeriodBeginning = time.Now().Add(-MetricsInterval).Format(time.RFC3339)
-			sc.AuditPeriodEnding = time.Now().Format(time.RFC3339)
+			sc.AuditPeriodBeginning = start.Format(time.RFC3339)
+			sc.AuditPeriodEnding = end.Format(time.RFC3339)
 			sc.AuditPeriodDelta = ""
+			sc.Interval = end.Sub(start)
 			sc.addMetric(STORAGE_COST, c.DefaultUnits[STORAGE_COST_PER_HOUR], strconv.FormatFloat(r.TotalSizeMB, 'f', 4, 64), "delta")
-			sc.CreatedAt = time.Now()
+			sc.CreatedAt = end
 			mc.Add(sc)
 		}
 
@@ -0,0 +1,163 @@
+package metrix
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	constants "github.com/megamsys/libgo/utils"
+	"github.com/megamsys/vertice/carton"
+)
+
+const (
+	// ALLOCATION bills the resources of the flavor for the whole interval.
+	ALLOCATION = "allocation"
+	// USAGE bills the resources used while the assembly ran.
+	USAGE = "usage"
+
+	CPU_SECONDS   = "cpu_seconds"
+	RAM_HOURS     = "ram_mb_hours"
+	DISK_IO_BYTES = "disk_io_bytes"
+	NETWORK_BYTES = "network_bytes"
+	UPTIME        = "uptime_seconds"
+
+	USAGE_METRIC = "usage"
+)
+
+// Usage is what an assembly used in a period.
+type Usage struct {
+	Uptime     time.Duration //running time in the period.
+	CPUSeconds float64
+	RAMMBHours float64
+	DiskBytes  uint64 //read and written.
+	NetBytes   uint64 //received and sent.
+}
+
+// UsageSource reads the usage of the assemblies in the period [start, end),
+// by assembly id. An assembly it knows nothing about is left out.
+type UsageSource interface {
+	Usage(asms []*carton.Assembly, start, end time.Time) (map[string]*Usage, error)
+}
+
+type period struct {
+	start, end time.Time
+}
+
+//overlap is how long the periods run within [start, end).
+func overlap(periods []period, start, end time.Time) time.Duration {
+	var d time.Duration
+	for _, p := range periods {
+		s, e := p.start, p.end
+		if s.Before(start) {
+			s = start
+		}
+		if e.After(end) {
+			e = end
+		}
+		if e.After(s) {
+			d += e.Sub(s)
+		}
+	}
+	return d
+}
+
+//sample is a reading of the counters of an assembly.
+type sample struct {
+	at        time.Time
+	cpu       float64 //cpus busy since the previous sample, 1.5 is one and a half cpu.
+	memoryMB  float64
+	diskBytes uint64 //since the vm or container started.
+	netBytes  uint64
+}
+
+//usageOf sums the samples that fall in [start, end) while the assembly ran.
+//The usage between two samples is the one read by the later sample.
+func usageOf(samples []sample, periods []period, start, end time.Time) *Usage {
+	sort.Slice(samples, func(i, j int) bool { return samples[i].at.Before(samples[j].at) })
+	u := &Usage{Uptime: overlap(periods, start, end)}
+	for i := 1; i < len(samples); i++ {
+		p, q := samples[i-1], samples[i]
+		if !q.at.After(start) || q.at.After(end) {
+			continue
+		}
+		ran := overlap(periods, p.at, q.at)
+		u.CPUSeconds += q.cpu * ran.Seconds()
+		u.RAMMBHours += q.memoryMB * ran.Hours()
+		u.DiskBytes += counterDelta(p.diskBytes, q.diskBytes)
+		u.NetBytes += counterDelta(p.netBytes, q.netBytes)
+	}
+	return u
+}
+
+//counterDelta is the increase of a counter, which restarts at zero when the
+//vm or container restarts.
+func counterDelta(prev, cur uint64) uint64 {
+	if cur < prev {
+		return cur
+	}
+	return cur - prev
+}
+
+//usageSensor bills the usage of the assembly in the interval of the sensor:
+//the average cpus and memory used, the disk and network bytes and the storage.
+func (i *InstanceHandler) usageSensor(sc *Sensor, u *Usage, resources map[string]string) {
+	interval := sc.billedInterval()
+	units := i.unitsOf(sc.SensorType)
+	sc.Message = "usage billing"
+	sc.Resources = "cpu.ram.storage"
+	if u.Uptime <= 0 {
+		sc.Resources = "storage"
+	}
+	sc.AuditPeriodDelta = strconv.FormatFloat(u.Uptime.Seconds(), 'f', 0, 64)
+	sc.addMetric(constants.CPU_COST, resources[constants.CPU_COST], formatFloat(u.CPUSeconds/interval.Seconds()), "delta")
+	sc.addMetric(constants.MEMORY_COST, resources[constants.MEMORY_COST], formatFloat(u.RAMMBHours/interval.Hours()), "delta")
+	sc.addMetric(constants.DISK_COST, resources[constants.DISK_COST], resources[constants.STORAGE], "delta")
+	if cost := units[DISK_IO_COST]; cost != "" {
+		sc.addMetric(DISK_IO_COST, cost, formatFloat(float64(u.DiskBytes)/GB), "delta")
+	}
+	if cost := units[NETWORK_COST]; cost != "" {
+		sc.addMetric(NETWORK_COST, cost, formatFloat(float64(u.NetBytes)/GB), "delta")
+	}
+	sc.addMetric(UPTIME, formatFloat(u.Uptime.Seconds()), "seconds", USAGE_METRIC)
+	sc.addMetric(CPU_SECONDS, formatFloat(u.CPUSeconds), "seconds", USAGE_METRIC)
+	sc.addMetric(RAM_HOURS, formatFloat(u.RAMMBHours), "MB-hours", USAGE_METRIC)
+	sc.addMetric(DISK_IO_BYTES, strconv.FormatUint(u.DiskBytes, 10), "bytes", USAGE_METRIC)
+	sc.addMetric(NETWORK_BYTES, strconv.FormatUint(u.NetBytes, 10), "bytes", USAGE_METRIC)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', 6, 64)
+}
+
+//usages reads the usage of the assemblies since their start from the source,
+//none when the source fails: they are billed by allocation then.
+func usages(src UsageSource, amies []carton.Assemblies, starts map[string]time.Time, end time.Time) map[string]*Usage {
+	if src == nil {
+		return nil
+	}
+	//the assemblies billed since the same time are read together.
+	byStart := make(map[time.Time][]*carton.Assembly)
+	for _, h := range amies {
+		for id := range h.Assemblys {
+			start, ok := starts[id]
+			if !ok {
+				continue
+			}
+			ay := h.Assemblys[id]
+			byStart[start] = append(byStart[start], &ay)
+		}
+	}
+	used := make(map[string]*Usage)
+	for start, asms := range byStart {
+		us, err := src.Usage(asms, start, end)
+		if err != nil {
+			log.Errorf("usage of %d assemblies failed, billed by allocation : %s", len(asms), err)
+			continue
+		}
+		for id, u := range us {
+			used[id] = u
+		}
+	}
+	return used
+}
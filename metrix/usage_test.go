@@ -0,0 +1,172 @@
+package metrix
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/megamsys/vertice/carton"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestUsageOfStoppedHalfway(c *check.C) {
+	t0 := time.Date(2017, 6, 1, 10, 0, 0, 0, time.UTC)
+	periods := []period{{start: t0.Add(-time.Hour), end: t0.Add(5 * time.Minute)}}
+	var samples []sample
+	for i, net := range []uint64{100, 200, 300, 50, 150, 250} {
+		samples = append(samples, sample{at: t0.Add(time.Duration(i-1) * time.Minute), cpu: 1.5, memoryMB: 1024, netBytes: net})
+	}
+	//a sample after the vm stopped, read while it was resumed later.
+	samples = append(samples, sample{at: t0.Add(9 * time.Minute), cpu: 1.5, memoryMB: 1024, netBytes: 260})
+	u := usageOf(samples, periods, t0, t0.Add(10*time.Minute))
+	//the net counter restarted with the vm.
+	c.Assert(usage(u), check.Equals, usage(&Usage{Uptime: 5 * time.Minute, CPUSeconds: 450, RAMMBHours: 1024 * 5 / 60.0, NetBytes: 100 + 50 + 100 + 100 + 10}))
+}
+
+func (s *S) TestUsageSensorCost(c *check.C) {
+	MetricsInterval = 10 * time.Minute
+	i := &InstanceHandler{VMUnits: map[string]string{CPU_UNIT: "1", MEMORY_UNIT: "1024", DISK_UNIT: "1024", NETWORK_COST: "0.5"}}
+	sc := NewSensor(ONE_VM_SENSOR)
+	u := &Usage{Uptime: 5 * time.Minute, CPUSeconds: 450, RAMMBHours: 1024 * 5 / 60.0, NetBytes: 2 * GB}
+	i.usageSensor(sc, u, map[string]string{"cpu_cost": "10", "memory_cost": "6", "disk_cost": "0", "storage": "10240"})
+	//10 a cpu hour for 450 cpu seconds, 6 a GB hour for 1GB 5 minutes and 0.5 a GB sent.
+	c.Assert(sc.Metrics.Totalcost(i.VMUnits), check.Equals, "2.750000")
+	c.Assert(sc.AuditPeriodDelta, check.Equals, "300")
+	c.Assert(sc.Resources, check.Equals, "cpu.ram.storage")
+}
+
+func newUsageAssembly(id, region, instance string) *carton.Assembly {
+	a := &carton.Assembly{Id: id, Name: id, AccountId: "info@megam.io"}
+	a.Inputs.NukeAndSet(map[string][]string{carton.REGION: {region}})
+	a.Outputs.NukeAndSet(map[string][]string{carton.INSTANCE_ID: {instance}})
+	return a
+}
+
+func oneAnswer(doc string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(doc))
+	return `<?xml version="1.0"?><methodResponse><params><param><value><array><data>` +
+		`<value><boolean>1</boolean></value><value><string>` + b.String() + `</string></value>` +
+		`</data></array></value></param></params></methodResponse>`
+}
+
+func (s *S) TestOneUsage(c *check.C) {
+	t0 := time.Date(2017, 6, 1, 10, 0, 0, 0, time.UTC)
+	at := func(m int) string { return fmtUnix(t0.Add(time.Duration(m) * time.Minute)) }
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		c.Check(strings.Contains(string(body), "<string>oneadmin:onepass</string>"), check.Equals, true)
+		switch {
+		case strings.Contains(string(body), "one.vmpool.accounting"):
+			c.Check(strings.Contains(string(body), "<int>"+at(0)+"</int><"), check.Equals, true)
+			w.Write([]byte(oneAnswer(`<HISTORY_RECORDS>` +
+				`<HISTORY><OID>12</OID><RSTIME>` + at(-60) + `</RSTIME><RETIME>` + at(5) + `</RETIME></HISTORY>` +
+				`<HISTORY><OID>13</OID><RSTIME>` + at(-60) + `</RSTIME><RETIME>0</RETIME></HISTORY>` +
+				`</HISTORY_RECORDS>`)))
+		case strings.Contains(string(body), "one.vmpool.monitoring"):
+			var doc string
+			for m := 0; m <= 10; m += 5 {
+				doc += `<VM><ID>12</ID><LAST_POLL>` + at(m) + `</LAST_POLL><MONITORING><CPU>200</CPU><MEMORY>2097152</MEMORY>` +
+					`<NETRX>1000</NETRX><NETTX>1000</NETTX><DISKRDBYTES>0</DISKRDBYTES><DISKWRBYTES>0</DISKWRBYTES></MONITORING></VM>`
+				doc += `<VM><ID>13</ID><LAST_POLL>` + at(m) + `</LAST_POLL><MONITORING><CPU>50</CPU><MEMORY>1048576</MEMORY>` +
+					`<NETRX>` + at(m) + `</NETRX><NETTX>0</NETTX><DISKRDBYTES>10</DISKRDBYTES><DISKWRBYTES>0</DISKWRBYTES></MONITORING></VM>`
+			}
+			w.Write([]byte(oneAnswer(`<MONITORING_DATA>` + doc + `</MONITORING_DATA>`)))
+		default:
+			c.Errorf("unexpected call %s", body)
+		}
+	}))
+	defer srv.Close()
+	src := &OneUsage{Regions: map[string]OneEndpoint{"chennai": {Endpoint: srv.URL, User: "oneadmin", Password: "onepass"}}}
+	used, err := src.Usage([]*carton.Assembly{
+		newUsageAssembly("ASM12", "chennai", "12"),
+		newUsageAssembly("ASM13", "chennai", "13"),
+		newUsageAssembly("ASM14", "chennai", "14"),
+		newUsageAssembly("ASM99", "paris", "12"),
+	}, t0, t0.Add(10*time.Minute))
+	c.Assert(err, check.IsNil)
+	c.Assert(used, check.HasLen, 3)
+	c.Assert(usage(used["ASM12"]), check.Equals, usage(&Usage{Uptime: 5 * time.Minute, CPUSeconds: 600, RAMMBHours: 2048 * 5 / 60.0}))
+	c.Assert(usage(used["ASM13"]), check.Equals, usage(&Usage{Uptime: 10 * time.Minute, CPUSeconds: 300, RAMMBHours: 1024 * 10 / 60.0, NetBytes: 600}))
+	c.Assert(usage(used["ASM14"]), check.Equals, usage(&Usage{}))
+}
+
+func fmtUnix(t time.Time) string {
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
+//usage is the usage with its hours rounded, to compare them.
+func usage(u *Usage) string {
+	if u == nil {
+		return "none"
+	}
+	return fmt.Sprintf("uptime %s cpu %.3fs ram %.6fMBh disk %d net %d", u.Uptime, u.CPUSeconds, u.RAMMBHours, u.DiskBytes, u.NetBytes)
+}
+
+func (s *S) TestDockerUsage(c *check.C) {
+	read := time.Date(2017, 6, 1, 10, 0, 0, 0, time.UTC)
+	started := read.Add(-20 * time.Minute)
+	state := `{"State": {"Running": true, "StartedAt": "` + started.Format(time.RFC3339) + `", "FinishedAt": "0001-01-01T00:00:00Z"}}`
+	stats := func(at time.Time, cpu, net uint64) string {
+		b, _ := json.Marshal(map[string]interface{}{
+			"read":         at,
+			"cpu_stats":    map[string]interface{}{"cpu_usage": map[string]interface{}{"total_usage": cpu}},
+			"memory_stats": map[string]interface{}{"usage": 512 * 1024 * 1024},
+			"networks":     map[string]interface{}{"eth0": map[string]interface{}{"rx_bytes": net, "tx_bytes": 0}},
+			"blkio_stats":  map[string]interface{}{"io_service_bytes_recursive": []map[string]interface{}{{"op": "Read", "value": 0}}},
+		})
+		return string(b)
+	}
+	current := stats(read, 1200e9, 2000)
+	var mu sync.Mutex
+	set := func(st, cur string) {
+		mu.Lock()
+		defer mu.Unlock()
+		state, current = st, cur
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/containers/c1/json":
+			w.Write([]byte(state))
+		case "/containers/c1/stats":
+			c.Check(r.URL.Query().Get("stream"), check.Equals, "false")
+			w.Write([]byte(current))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+	src := &DockerUsage{Swarms: map[string]string{"chennai": strings.Replace(srv.URL, "http://", "tcp://", 1)}}
+	asms := []*carton.Assembly{newUsageAssembly("ASM1", "chennai", "c1")}
+
+	//the first read counts from the start of the period, the cpu ran at one cpu since it started.
+	used, err := src.Usage(asms, read.Add(-10*time.Minute), read)
+	c.Assert(err, check.IsNil)
+	c.Assert(usage(used["ASM1"]), check.Equals, usage(&Usage{Uptime: 10 * time.Minute, CPUSeconds: 600, RAMMBHours: 512 * 10 / 60.0, NetBytes: 1000}))
+
+	//the next one from the stats read before.
+	set(state, stats(read.Add(10*time.Minute), 1500e9, 2500))
+	used, err = src.Usage(asms, read, read.Add(10*time.Minute))
+	c.Assert(err, check.IsNil)
+	c.Assert(usage(used["ASM1"]), check.Equals, usage(&Usage{Uptime: 10 * time.Minute, CPUSeconds: 300, RAMMBHours: 512 * 10 / 60.0, NetBytes: 500}))
+
+	//a stopped container is billed for the time it ran.
+	set(`{"State": {"Running": false, "StartedAt": "`+started.Format(time.RFC3339)+`", "FinishedAt": "`+read.Add(15*time.Minute).Format(time.RFC3339)+`"}}`, "")
+	used, err = src.Usage(asms, read.Add(10*time.Minute), read.Add(20*time.Minute))
+	c.Assert(err, check.IsNil)
+	c.Assert(usage(used["ASM1"]), check.Equals, usage(&Usage{Uptime: 5 * time.Minute}))
+
+	asms = append(asms, newUsageAssembly("ASM2", "chennai", "c2"))
+	_, err = src.Usage(asms, read, read.Add(10*time.Minute))
+	c.Assert(err, check.NotNil)
+}
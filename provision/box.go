@@ -16,12 +16,14 @@
 package provision
 
 import (
+	log "github.com/Sirupsen/logrus"
 	"github.com/megamsys/libgo/api"
 	"github.com/megamsys/libgo/utils"
 	constants "github.com/megamsys/libgo/utils"
 	"github.com/megamsys/vertice/carton/bind"
 	lb "github.com/megamsys/vertice/logbox"
 	"github.com/megamsys/vertice/repository"
+	"github.com/megamsys/vertice/subd/dns"
 	"gopkg.in/yaml.v2"
 	"net/url"
 	"os"
@@ -50,13 +52,15 @@ var cnameRegexp = regexp.MustCompile(`^(\*\.)?[a-zA-Z0-9][\w-.]+$`)
 // Boxlevel represents the deployment level.
 type BoxLevel int
 
-// Boxlog represents a log entry.
+// Boxlog represents a log entry. The cursor orders the entries of a box,
+// it is set when they are stored.
 type Boxlog struct {
 	Timestamp string
 	Message   string
 	Source    string
 	Name      string
 	Unit      string
+	Cursor    uint64 `json:",omitempty"`
 }
 
 type BoxSSH struct {
@@ -135,6 +139,8 @@ type Box struct {
 	Status       utils.Status
 	State        utils.State
 	PolicyOps    *PolicyOps
+	Migration    *BoxMigration
+	Resize       *BoxResize
 	Provider     string
 	PublicIp     string
 	PublicUrl    string
@@ -155,6 +161,44 @@ type PolicyOps struct {
 	Rules      map[string]string
 }
 
+// BoxMigration is where a box is moved to, an empty region is the region of the box.
+type BoxMigration struct {
+	Region  string
+	Cluster string
+	Live    bool
+}
+
+//CrossRegion is true when the box leaves its region, it is then redeployed from a saved image.
+func (m *BoxMigration) CrossRegion(region string) bool {
+	return m.Region != "" && m.Region != region
+}
+
+// BoxResize is the flavor a box is resized to.
+type BoxResize struct {
+	FlavorId string
+	Compute  BoxCompute
+}
+
+func (r *BoxResize) GetCpushare() uint64 {
+	return r.Compute.numCpushare()
+}
+
+func (r *BoxResize) GetMemory() uint64 {
+	return r.Compute.numMemory()
+}
+
+func (r *BoxResize) ConGetMemory() uint64 {
+	return r.Compute.ConnumMemory()
+}
+
+func (r *BoxResize) GetSwap() uint64 {
+	return r.Compute.numSwap()
+}
+
+func (r *BoxResize) GetHDD() uint64 {
+	return r.Compute.numHDD()
+}
+
 func (b *Box) String() string {
 	if d, err := yaml.Marshal(b); err != nil {
 		return err.Error()
@@ -223,8 +267,9 @@ func (b *Box) Available() bool {
 		b.Status == constants.StatusError
 }
 
+// GetRouter is the dns router of the region of the box.
 func (box *Box) GetRouter() (string, error) {
-	return "route53", nil //dns.LoadConfig()
+	return dns.R53.RouterOf(box.Region), nil
 }
 
 // Log adds a log message to the app. Specifying a good source is good so the
@@ -244,25 +289,36 @@ func (box *Box) Log(message, source, unit string) error {
 		}
 	}
 	messages := strings.Split(lo, "\n")
-	logs := make([]interface{}, 0, len(messages))
+	name := box.GetFullName()
+	if box.Tosca == "docker" {
+		name = box.Name
+	}
+	now := time.Now()
+	bls := make([]Boxlog, 0, len(messages))
 	for _, msg := range messages {
 		if len(strings.TrimSpace(msg)) > 0 {
-			bl := Boxlog{
-				Timestamp: time.Now().Local().Format(time.RFC822),
+			bls = append(bls, Boxlog{
+				Timestamp: now.Local().Format(time.RFC822),
 				Message:   msg,
 				Source:    source,
 				Name:      box.Name,
 				Unit:      box.Id,
-			}
-			logs = append(logs, bl)
+			})
 		}
 	}
-	if len(logs) > 0 {
-		if box.Tosca == "docker" {
-			_ = notify(box.Name, logs)
-		} else {
-			_ = notify(box.GetFullName(), logs)
+	if len(bls) > 0 {
+		if Logs != nil {
+			if err := Logs.Append(name, box.AccountId, now, bls); err != nil {
+				log.Errorf("  logs of %s not stored : %s", name, err)
+			} else if err = Logs.Follow(name); err != nil {
+				log.Errorf("  logs of %s not followed : %s", name, err)
+			}
+		}
+		logs := make([]interface{}, 0, len(bls))
+		for _, bl := range bls {
+			logs = append(logs, bl)
 		}
+		_ = notify(name, logs)
 	}
 
 	return nil
@@ -215,6 +215,16 @@ func (c *Cluster) RestartContainer(id string, timeout uint) error {
 	return wrapError(node, node.RestartContainer(id, timeout))
 }
 
+// UpdateContainer changes the cpu shares and memory limits of a container,
+// the container keeps running.
+func (c *Cluster) UpdateContainer(id string, opts docker.UpdateContainerOptions) error {
+	node, err := c.getNodeForContainer(id)
+	if err != nil {
+		return err
+	}
+	return wrapError(node, node.UpdateContainer(id, opts))
+}
+
 // PauseContainer changes the container to the paused state.
 func (c *Cluster) PauseContainer(id string) error {
 	node, err := c.getNodeForContainer(id)
@@ -275,6 +275,21 @@ func (c *Container) Stop(p DockerProvisioner) error {
 	return nil
 }
 
+//Resize changes the cpu shares and memory of the container to the ones of the new flavor.
+func (c *Container) Resize(p DockerProvisioner, r *provision.BoxResize) error {
+	opts := docker.UpdateContainerOptions{
+		CPUShares:  int(r.GetCpushare()),
+		Memory:     int(r.ConGetMemory()),
+		MemorySwap: int(r.ConGetMemory() + r.GetSwap()),
+	}
+	err := p.Cluster().UpdateContainer(c.Id, opts)
+	if err != nil {
+		log.Errorf("error on resize container %s: %s", c.Id, err)
+		return err
+	}
+	return nil
+}
+
 type waitResult struct {
 	status int
 	err    error
@@ -344,6 +359,7 @@ type Pty struct {
 	Width  int
 	Height int
 	Term   string
+	Resize <-chan provision.ShellSize
 }
 
 func (c *Container) Shell(p DockerProvisioner, stdin io.Reader, stdout, stderr io.Writer, pty Pty) error {
@@ -388,7 +404,20 @@ func (c *Container) Shell(p DockerProvisioner, stdin io.Reader, stdout, stderr i
 		return err
 	}
 	p.Cluster().ResizeExecTTY(exec.ID, c.Id, pty.Height, pty.Width, c.Region)
-	return <-errs
+	for {
+		select {
+		case err = <-errs:
+			return err
+		case size, ok := <-pty.Resize:
+			if !ok {
+				pty.Resize = nil
+				continue
+			}
+			if err = p.Cluster().ResizeExecTTY(exec.ID, c.Id, size.Height, size.Width, c.Region); err != nil {
+				log.Errorf("error on resize shell of container %s: %s", c.Id, err)
+			}
+		}
+	}
 }
 
 type execErr struct {
@@ -22,7 +22,11 @@ import (
 	"github.com/megamsys/vertice/provision/docker/container"
 	"github.com/megamsys/vertice/repository"
 	"github.com/megamsys/vertice/router"
+	_ "github.com/megamsys/vertice/router/powerdns"
+	_ "github.com/megamsys/vertice/router/proxy"
+	_ "github.com/megamsys/vertice/router/rfc2136"
 	_ "github.com/megamsys/vertice/router/route53"
+	_ "github.com/megamsys/vertice/router/zonefile"
 	"github.com/megamsys/vertice/toml"
 )
 
@@ -175,6 +179,7 @@ func (p *dockerProvisioner) deployPipeline(box *provision.Box, imageId string, w
 		&updateStatusInScylla,
 	}
 	p.Cluster().Region = box.Region
+	opId, actions := provision.Operations.Track(box, "deploy", actions)
 	pipeline := action.NewPipeline(actions...)
 
 	args := runContainerActionsArgs{
@@ -188,6 +193,7 @@ func (p *dockerProvisioner) deployPipeline(box *provision.Box, imageId string, w
 		provisioner:     p,
 	}
 	err := pipeline.Execute(args)
+	provision.Operations.Finish(opId, err)
 	if err != nil {
 
 		fmt.Fprintf(w, lb.W(lb.DEPLOY, lb.ERROR, fmt.Sprintf("deploy pipeline for box (%s) --> %s", box.GetFullName(), err)))
@@ -216,11 +222,13 @@ func (p *dockerProvisioner) Destroy(box *provision.Box, w io.Writer) error {
 		provisioner: p,
 		boxDestroy:  true,
 	}
-	pipeline := action.NewPipeline(
+	opId, actions := provision.Operations.Track(box, "destroy", []*action.Action{
 		&destroyOldContainers,
 		&removeOldRoutes,
-	)
+	})
+	pipeline := action.NewPipeline(actions...)
 	err = pipeline.Execute(args)
+	provision.Operations.Finish(opId, err)
 	if err != nil {
 		return err
 	}
@@ -266,6 +274,23 @@ func (p *dockerProvisioner) Stop(box *provision.Box, process string, w io.Writer
 	}, nil, true)
 }
 
+func (p *dockerProvisioner) Resize(box *provision.Box, w io.Writer) error {
+	containers, err := p.listContainersByBox(box)
+	if err != nil {
+		fmt.Fprintf(w, lb.W(lb.UPDATING, lb.ERROR, fmt.Sprintf("Failed to list box containers (%s) --> %s", box.GetFullName(), err)))
+		return err
+	}
+	p.Cluster().Region = box.Region
+	fmt.Fprintf(w, lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf("--- resize box %s to flavor %s", box.GetFullName(), box.Resize.FlavorId)))
+	return runInContainers(containers, func(c *container.Container, _ chan *container.Container) error {
+		err := c.Resize(p, box.Resize)
+		if err != nil {
+			log.Errorf("Failed to resize %q: %s", box.GetFullName(), err)
+		}
+		return err
+	}, nil, true)
+}
+
 func (p *dockerProvisioner) Restart(box *provision.Box, process string, w io.Writer) error {
 	return nil
 }
@@ -396,7 +421,7 @@ func (p *dockerProvisioner) Shell(opts provision.ShellOptions) error {
 	if err != nil {
 		return err
 	}
-	return c.Shell(p, opts.Conn, opts.Conn, opts.Conn, container.Pty{Width: opts.Width, Height: opts.Height, Term: opts.Term})
+	return c.Shell(p, opts.Conn, opts.Conn, opts.Conn, container.Pty{Width: opts.Width, Height: opts.Height, Term: opts.Term, Resize: opts.Resize})
 }
 
 func (p *dockerProvisioner) ExecuteCommandOnce(stdout, stderr io.Writer, box *provision.Box, cmd string, args ...string) error {
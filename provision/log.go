@@ -6,6 +6,8 @@ import (
 	nsqc "github.com/crackcomm/nsqueue/consumer"
 	nsqp "github.com/crackcomm/nsqueue/producer"
 	"github.com/megamsys/vertice/meta"
+	"strconv"
+	"time"
 )
 
 const (
@@ -23,12 +25,42 @@ func logQueue(boxName string) string {
 	return boxName + LogPubSubQueueSuffix
 }
 
+//logChannel is a channel of its own for every listener, a shared one would
+//hand each log to one of the listeners only.
+func logChannel() string {
+	return "clients-" + strconv.FormatInt(time.Now().UnixNano(), 36) + "#ephemeral"
+}
+
+//storeLogChannel is the channel the log store reads the topic of a box on,
+//one for all the stores so a log is stored once.
+const storeLogChannel = "logstore"
+
+//followLogs hands the messages of the topic on the channel to fn till the
+//func returned is called, replaced in tests.
+var followLogs = func(topic, channel string, fn func(body []byte)) (func(), error) {
+	cons := nsqc.New()
+	if err := cons.Register(topic, channel, maxInFlight, func(m *nsqc.Message) { fn(m.Body) }); err != nil {
+		return nil, err
+	}
+	go func() {
+		if err := cons.Connect(meta.MC.NSQd...); err != nil {
+			log.Errorf("%s: %s", topic, err)
+			return
+		}
+		cons.Start(true)
+	}()
+	return cons.Stop, nil
+}
+
+//publishLogs is replaced in tests.
+var publishLogs = notify
+
 func NewLogListener(a *Box) (*LogListener, error) {
 	b := make(chan Boxlog, maxInFlight)
 	cons := nsqc.New()
 	go func() {
 		defer close(b)
-		if err := cons.Register(logQueue(a.Name), "clients", maxInFlight, dumpLog(b)); err != nil {
+		if err := cons.Register(logQueue(a.Name), logChannel(), maxInFlight, dumpLog(b)); err != nil {
 			return
 		}
 
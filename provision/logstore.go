@@ -0,0 +1,584 @@
+package provision
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	// DefaultLogSegmentSize is the size a log segment of a box is rotated at.
+	DefaultLogSegmentSize = 8 << 20
+
+	// DefaultLogSegments is the number of segments kept for a box.
+	DefaultLogSegments = 8
+
+	// DefaultLogLimit is the most logs a query returns.
+	DefaultLogLimit = 1000
+
+	logSegmentExt = ".log"
+	logIndexFile  = "index"
+	logOwnerFile  = "owner"
+	maxLogLine    = 1 << 20
+)
+
+// Logs is where the logs of the boxes are kept, nil when they aren't.
+var Logs *LogStore
+
+// LogQuery filters the logs of a box. The logs are after the cursor After,
+// at or after Since and at or before Until, the zero values don't filter.
+type LogQuery struct {
+	After  uint64
+	Since  time.Time
+	Until  time.Time
+	Source string
+	Unit   string
+	Limit  int
+
+	//before bounds the cursors, it fills the gaps of a tail.
+	before uint64
+}
+
+//matches is the source and unit filter, the live logs have no time of their own.
+func (q LogQuery) matches(bl Boxlog) bool {
+	return (q.Source == "" || q.Source == bl.Source) && (q.Unit == "" || q.Unit == bl.Unit)
+}
+
+// logRecord is a line of a segment, the time it was stored at orders the
+// logs as the Timestamp is only to the minute.
+type logRecord struct {
+	Boxlog
+	At int64
+}
+
+// logSegment is an entry of the index of a box: the first cursor of the
+// segment and the time of its first log.
+type logSegment struct {
+	First uint64
+	At    int64
+}
+
+// LogStore keeps the logs of every box in dir/<box> as segments of json lines,
+// <first cursor>.log. A segment is rotated after segmentSize bytes and the
+// oldest ones past maxSegments are removed. The index of a box lists its
+// segments, so a query by cursor or time only reads the segments it needs.
+//
+// The logs other publishers put on the <box>_log topic of nsq (eg: the agent
+// in a machine) are kept too, the store follows the topic of every box it has.
+type LogStore struct {
+	sync.Mutex
+	dir         string
+	segmentSize int64
+	maxSegments int
+	boxes       map[string]*boxLogs
+	followed    map[string]func()
+}
+
+type boxLogs struct {
+	sync.Mutex
+	dir      string
+	owner    string
+	cursor   uint64
+	segments []logSegment
+	f        *os.File
+	size     int64
+}
+
+func NewLogStore(dir string, segmentSize int64, maxSegments int) (*LogStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if segmentSize <= 0 {
+		segmentSize = DefaultLogSegmentSize
+	}
+	if maxSegments <= 0 {
+		maxSegments = DefaultLogSegments
+	}
+	return &LogStore{
+		dir:         dir,
+		segmentSize: segmentSize,
+		maxSegments: maxSegments,
+		boxes:       make(map[string]*boxLogs),
+		followed:    make(map[string]func()),
+	}, nil
+}
+
+// Append stores the logs of the box owned by the account, each one gets the
+// next cursor of the box.
+func (s *LogStore) Append(name, owner string, at time.Time, logs []Boxlog) error {
+	b, err := s.box(name, true)
+	if err != nil {
+		return err
+	}
+	b.Lock()
+	defer b.Unlock()
+	if b.owner == "" && owner != "" {
+		if err = ioutil.WriteFile(filepath.Join(b.dir, logOwnerFile), []byte(owner), 0644); err != nil {
+			return err
+		}
+		b.owner = owner
+	}
+	var buf bytes.Buffer
+	for i := range logs {
+		if b.f == nil {
+			if err = s.rotate(b, at); err != nil {
+				return err
+			}
+		}
+		logs[i].Cursor = b.cursor + 1
+		line, err := json.Marshal(logRecord{Boxlog: logs[i], At: at.UnixNano()})
+		if err != nil {
+			return err
+		}
+		buf.Reset()
+		buf.Write(line)
+		buf.WriteByte('\n')
+		n, err := b.f.Write(buf.Bytes())
+		b.size += int64(n)
+		if err != nil {
+			return err
+		}
+		b.cursor++
+		if b.size >= s.segmentSize {
+			b.f.Close()
+			b.f = nil
+		}
+	}
+	return nil
+}
+
+// Query returns the logs of the box that match, oldest first.
+func (s *LogStore) Query(name string, q LogQuery) ([]Boxlog, error) {
+	b, err := s.box(name, false)
+	if err != nil {
+		return nil, err
+	}
+	if q.Limit <= 0 || q.Limit > DefaultLogLimit {
+		q.Limit = DefaultLogLimit
+	}
+	b.Lock()
+	defer b.Unlock()
+	logs := make([]Boxlog, 0)
+	for _, sg := range b.segments[b.start(q):] {
+		done, err := b.read(sg, func(r *logRecord) bool {
+			if (!q.Until.IsZero() && r.At > q.Until.UnixNano()) || (q.before > 0 && r.Cursor >= q.before) {
+				return true
+			}
+			if r.Cursor > q.After && (q.Since.IsZero() || r.At >= q.Since.UnixNano()) && q.matches(r.Boxlog) {
+				logs = append(logs, r.Boxlog)
+			}
+			return len(logs) >= q.Limit
+		})
+		if err != nil {
+			return nil, err
+		}
+		if done {
+			break
+		}
+	}
+	return logs, nil
+}
+
+// Owner is the account the logs of the box belong to.
+func (s *LogStore) Owner(name string) (string, error) {
+	b, err := s.box(name, false)
+	if err != nil {
+		return "", err
+	}
+	b.Lock()
+	defer b.Unlock()
+	return b.owner, nil
+}
+
+// Cursor is the cursor of the last log of the box.
+func (s *LogStore) Cursor(name string) (uint64, error) {
+	b, err := s.box(name, false)
+	if err != nil {
+		return 0, err
+	}
+	b.Lock()
+	defer b.Unlock()
+	return b.cursor, nil
+}
+
+// Follow stores the logs other publishers put on the nsq topic of the box,
+// once whatever the number of clients following it. The logs vertice wrote
+// have a cursor, they are stored already. A log stored is published again
+// with its cursor, for the clients to hand it out in order.
+func (s *LogStore) Follow(name string) error {
+	if _, err := s.box(name, false); err != nil {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.followed[name]; ok {
+		return nil
+	}
+	stop, err := followLogs(logQueue(name), storeLogChannel, s.store(name))
+	if err != nil {
+		return err
+	}
+	s.followed[name] = stop
+	return nil
+}
+
+// FollowAll follows the topics of the boxes that have logs in the store.
+func (s *LogStore) FollowAll() error {
+	dirs, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		if err = s.Follow(d.Name()); err != nil {
+			log.Errorf("  logs of %s not followed : %s", d.Name(), err)
+		}
+	}
+	return nil
+}
+
+// Following tells if the store follows the topic of the box.
+func (s *LogStore) Following(name string) bool {
+	s.Lock()
+	defer s.Unlock()
+	_, ok := s.followed[name]
+	return ok
+}
+
+//store is the handler of the topic of the box.
+func (s *LogStore) store(name string) func(body []byte) {
+	return func(body []byte) {
+		bl := Boxlog{}
+		if err := json.Unmarshal(body, &bl); err != nil {
+			log.Errorf("Unparsable log message, ignoring: %s", string(body))
+			return
+		}
+		if bl.Cursor != 0 {
+			return
+		}
+		logs := []Boxlog{bl}
+		if err := s.Append(name, "", time.Now(), logs); err != nil {
+			log.Errorf("  logs of %s not stored : %s", name, err)
+			return
+		}
+		if err := publishLogs(name, []interface{}{logs[0]}); err != nil {
+			log.Errorf("  logs of %s not published : %s", name, err)
+		}
+	}
+}
+
+// Close stops following the topics and closes the segments being written,
+// they are opened again by the next Append.
+func (s *LogStore) Close() error {
+	s.Lock()
+	defer s.Unlock()
+	for name, stop := range s.followed {
+		stop()
+		delete(s.followed, name)
+	}
+	for _, b := range s.boxes {
+		b.Lock()
+		if b.f != nil {
+			b.f.Close()
+			b.f = nil
+		}
+		b.Unlock()
+	}
+	return nil
+}
+
+//box loads the index of the box the first time it is used, a box
+//without logs is only made by Append.
+func (s *LogStore) box(name string, create bool) (*boxLogs, error) {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return nil, fmt.Errorf("invalid box name %q", name)
+	}
+	s.Lock()
+	defer s.Unlock()
+	if b, ok := s.boxes[name]; ok {
+		return b, nil
+	}
+	b := &boxLogs{dir: filepath.Join(s.dir, name)}
+	if _, err := os.Stat(b.dir); os.IsNotExist(err) && !create {
+		return b, nil
+	}
+	if err := os.MkdirAll(b.dir, 0755); err != nil {
+		return nil, err
+	}
+	if err := b.load(); err != nil {
+		return nil, err
+	}
+	s.boxes[name] = b
+	return b, nil
+}
+
+//rotate starts a new segment, the oldest ones past the most kept are removed.
+func (s *LogStore) rotate(b *boxLogs, at time.Time) error {
+	sg := logSegment{First: b.cursor + 1, At: at.UnixNano()}
+	f, err := os.OpenFile(b.path(sg), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	b.f, b.size = f, 0
+	b.segments = append(b.segments, sg)
+	if len(b.segments) <= s.maxSegments {
+		return b.appendIndex(sg)
+	}
+	old := b.segments[:len(b.segments)-s.maxSegments]
+	b.segments = b.segments[len(old):]
+	if err = b.writeIndex(); err != nil {
+		return err
+	}
+	for _, o := range old {
+		if err = os.Remove(b.path(o)); err != nil && !os.IsNotExist(err) {
+			log.Errorf("  log segment %s : %s", b.path(o), err)
+		}
+	}
+	return nil
+}
+
+func (b *boxLogs) path(sg logSegment) string {
+	return filepath.Join(b.dir, fmt.Sprintf("%020d", sg.First)+logSegmentExt)
+}
+
+//start is the first segment a query reads: the one its cursor or its time is in.
+func (b *boxLogs) start(q LogQuery) int {
+	i := sort.Search(len(b.segments), func(i int) bool { return b.segments[i].First > q.After+1 }) - 1
+	if !q.Since.IsZero() {
+		since := q.Since.UnixNano()
+		if j := sort.Search(len(b.segments), func(i int) bool { return b.segments[i].At >= since }) - 1; j > i {
+			i = j
+		}
+	}
+	if i < 0 {
+		i = 0
+	}
+	return i
+}
+
+//read hands the records of the segment to fn until it returns true.
+func (b *boxLogs) read(sg logSegment, fn func(*logRecord) bool) (bool, error) {
+	f, err := os.Open(b.path(sg))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), maxLogLine)
+	for sc.Scan() {
+		r := &logRecord{}
+		if err := json.Unmarshal(sc.Bytes(), r); err != nil {
+			return false, fmt.Errorf("log segment %s : %s", f.Name(), err)
+		}
+		if fn(r) {
+			return true, nil
+		}
+	}
+	return false, sc.Err()
+}
+
+//load reads the index and the owner of the box, and the cursor from the end
+//of its last segment. An index missing a segment is built again from them.
+func (b *boxLogs) load() error {
+	if o, err := ioutil.ReadFile(filepath.Join(b.dir, logOwnerFile)); err == nil {
+		b.owner = strings.TrimSpace(string(o))
+	}
+	files, err := filepath.Glob(filepath.Join(b.dir, "*"+logSegmentExt))
+	if err != nil {
+		return err
+	}
+	if b.segments, err = b.readIndex(); err != nil || len(b.segments) != len(files) {
+		if err = b.rebuildIndex(files); err != nil {
+			return err
+		}
+	}
+	if len(b.segments) == 0 {
+		return nil
+	}
+	//a log cut short by a crash is dropped, the segment ends with a whole line.
+	last := b.segments[len(b.segments)-1]
+	data, err := ioutil.ReadFile(b.path(last))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if i := bytes.LastIndexByte(data, '\n'); i+1 < len(data) {
+		log.Warnf("  log segment %s : dropped %d bytes of a partial log", b.path(last), len(data)-i-1)
+		if err = os.Truncate(b.path(last), int64(i+1)); err != nil {
+			return err
+		}
+		data = data[:i+1]
+	}
+	b.cursor = last.First - 1
+	if _, err = b.read(last, func(r *logRecord) bool {
+		b.cursor = r.Cursor
+		return false
+	}); err != nil {
+		return err
+	}
+	if b.f, err = os.OpenFile(b.path(last), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644); err != nil {
+		return err
+	}
+	b.size = int64(len(data))
+	return nil
+}
+
+func (b *boxLogs) readIndex() ([]logSegment, error) {
+	data, err := ioutil.ReadFile(filepath.Join(b.dir, logIndexFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	sgs := make([]logSegment, 0)
+	for _, l := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if l == "" {
+			continue
+		}
+		f := strings.Fields(l)
+		if len(f) != 2 {
+			return nil, fmt.Errorf("invalid log index line %q", l)
+		}
+		first, err := strconv.ParseUint(f[0], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		at, err := strconv.ParseInt(f[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		sgs = append(sgs, logSegment{First: first, At: at})
+	}
+	return sgs, nil
+}
+
+func (b *boxLogs) rebuildIndex(files []string) error {
+	b.segments = make([]logSegment, 0, len(files))
+	for _, file := range files {
+		first, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(file), logSegmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		sg := logSegment{First: first}
+		if _, err = b.read(sg, func(r *logRecord) bool {
+			sg.At = r.At
+			return true
+		}); err != nil {
+			log.Warnf("  log segment %s : %s", file, err)
+		}
+		b.segments = append(b.segments, sg)
+	}
+	sort.Slice(b.segments, func(i, j int) bool { return b.segments[i].First < b.segments[j].First })
+	return b.writeIndex()
+}
+
+func (b *boxLogs) writeIndex() error {
+	var buf bytes.Buffer
+	for _, sg := range b.segments {
+		fmt.Fprintf(&buf, "%d %d\n", sg.First, sg.At)
+	}
+	tmp := filepath.Join(b.dir, logIndexFile+".tmp")
+	if err := ioutil.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(b.dir, logIndexFile))
+}
+
+func (b *boxLogs) appendIndex(sg logSegment) error {
+	f, err := os.OpenFile(filepath.Join(b.dir, logIndexFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = fmt.Fprintf(f, "%d %d\n", sg.First, sg.At)
+	return err
+}
+
+// LogTail hands out the logs of a box after a cursor once, whether they are
+// read from the store or arrive live.
+type LogTail struct {
+	store *LogStore
+	name  string
+	q     LogQuery
+}
+
+// Tail follows the logs of the box after the cursor of the query. The store
+// may be nil, the live logs are then handed out as they arrive.
+func (s *LogStore) Tail(name string, q LogQuery) *LogTail {
+	return &LogTail{store: s, name: name, q: q}
+}
+
+// Cursor is the cursor of the last log handed out.
+func (t *LogTail) Cursor() uint64 {
+	return t.q.After
+}
+
+// History returns the stored logs after the cursor, a page at a time, it is
+// empty once the tail is at the end of the store.
+func (t *LogTail) History() ([]Boxlog, error) {
+	if t.store == nil {
+		return nil, nil
+	}
+	logs, err := t.store.Query(t.name, t.q)
+	if err != nil {
+		return nil, err
+	}
+	if len(logs) > 0 {
+		t.q.After = logs[len(logs)-1].Cursor
+	}
+	return logs, nil
+}
+
+// Live returns what to hand out for a log that arrived live: the stored logs
+// it skipped over followed by itself, nothing when it was already handed out.
+// A log without a cursor is handed out as it is, but when the store follows
+// the box: it is handed out once the store published it again with a cursor.
+func (t *LogTail) Live(bl Boxlog) ([]Boxlog, error) {
+	if bl.Cursor == 0 && t.store != nil && t.store.Following(t.name) {
+		return nil, nil
+	}
+	if bl.Cursor == 0 || t.store == nil {
+		if t.q.matches(bl) {
+			return []Boxlog{bl}, nil
+		}
+		return nil, nil
+	}
+	if bl.Cursor <= t.q.After {
+		return nil, nil
+	}
+	logs := make([]Boxlog, 0, 1)
+	q := t.q
+	q.before = bl.Cursor
+	for q.After+1 < bl.Cursor {
+		missed, err := t.store.Query(t.name, q)
+		if err != nil {
+			return nil, err
+		}
+		if len(missed) == 0 {
+			break
+		}
+		logs = append(logs, missed...)
+		q.After = missed[len(missed)-1].Cursor
+	}
+	t.q.After = bl.Cursor
+	if t.q.matches(bl) {
+		logs = append(logs, bl)
+	}
+	return logs, nil
+}
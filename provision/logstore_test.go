@@ -0,0 +1,194 @@
+package provision
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+func boxlogs(msgs ...string) []Boxlog {
+	logs := make([]Boxlog, 0, len(msgs))
+	for _, m := range msgs {
+		sp := strings.Split(m, ":")
+		logs = append(logs, Boxlog{Message: sp[0], Source: sp[1], Unit: sp[2], Name: "box1"})
+	}
+	return logs
+}
+
+func messages(logs []Boxlog) []string {
+	m := make([]string, 0, len(logs))
+	for _, l := range logs {
+		m = append(m, l.Message)
+	}
+	return m
+}
+
+func (s *S) TestLogStoreQuery(c *check.C) {
+	st, err := NewLogStore(c.MkDir(), 0, 0)
+	c.Assert(err, check.IsNil)
+	t0 := time.Date(2017, 3, 1, 10, 0, 0, 0, time.UTC)
+	logs := boxlogs("a:deploy:u1", "b:shell:u1", "c:deploy:u2")
+	c.Assert(st.Append("box1", "info@megam.io", t0, logs), check.IsNil)
+	c.Assert(logs[2].Cursor, check.Equals, uint64(3))
+	c.Assert(st.Append("box1", "", t0.Add(time.Hour), boxlogs("d:deploy:u1")), check.IsNil)
+
+	all, err := st.Query("box1", LogQuery{})
+	c.Assert(err, check.IsNil)
+	c.Assert(messages(all), check.DeepEquals, []string{"a", "b", "c", "d"})
+	got, _ := st.Query("box1", LogQuery{After: 2})
+	c.Assert(messages(got), check.DeepEquals, []string{"c", "d"})
+	got, _ = st.Query("box1", LogQuery{Source: "deploy", Unit: "u1"})
+	c.Assert(messages(got), check.DeepEquals, []string{"a", "d"})
+	got, _ = st.Query("box1", LogQuery{Since: t0.Add(time.Minute)})
+	c.Assert(messages(got), check.DeepEquals, []string{"d"})
+	got, _ = st.Query("box1", LogQuery{Until: t0})
+	c.Assert(messages(got), check.DeepEquals, []string{"a", "b", "c"})
+	got, _ = st.Query("box1", LogQuery{Limit: 2})
+	c.Assert(messages(got), check.DeepEquals, []string{"a", "b"})
+
+	owner, _ := st.Owner("box1")
+	c.Assert(owner, check.Equals, "info@megam.io")
+	got, err = st.Query("box2", LogQuery{})
+	c.Assert(err, check.IsNil)
+	c.Assert(got, check.HasLen, 0)
+	_, err = st.Query("../box1", LogQuery{})
+	c.Assert(err, check.NotNil)
+}
+
+func (s *S) TestLogStoreRotates(c *check.C) {
+	dir := c.MkDir()
+	st, err := NewLogStore(dir, 1, 2)
+	c.Assert(err, check.IsNil)
+	t0 := time.Date(2017, 3, 1, 10, 0, 0, 0, time.UTC)
+	for i, m := range []string{"a", "b", "c", "d"} {
+		c.Assert(st.Append("box1", "info@megam.io", t0.Add(time.Duration(i)*time.Minute), boxlogs(m+":deploy:u1")), check.IsNil)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "box1", "*.log"))
+	c.Assert(files, check.HasLen, 2)
+	all, err := st.Query("box1", LogQuery{})
+	c.Assert(err, check.IsNil)
+	c.Assert(messages(all), check.DeepEquals, []string{"c", "d"})
+	got, _ := st.Query("box1", LogQuery{Since: t0.Add(3 * time.Minute)})
+	c.Assert(messages(got), check.DeepEquals, []string{"d"})
+	index, _ := ioutil.ReadFile(filepath.Join(dir, "box1", logIndexFile))
+	c.Assert(strings.Count(string(index), "\n"), check.Equals, 2)
+}
+
+func (s *S) TestLogStoreReopens(c *check.C) {
+	dir := c.MkDir()
+	st, err := NewLogStore(dir, 0, 0)
+	c.Assert(err, check.IsNil)
+	now := time.Now()
+	c.Assert(st.Append("box1", "info@megam.io", now, boxlogs("a:deploy:u1", "b:deploy:u1")), check.IsNil)
+	c.Assert(st.Close(), check.IsNil)
+	//a log cut short by a crash.
+	f, err := os.OpenFile(filepath.Join(dir, "box1", "00000000000000000001.log"), os.O_WRONLY|os.O_APPEND, 0644)
+	c.Assert(err, check.IsNil)
+	f.WriteString(`{"Message":"c","Cur`)
+	f.Close()
+	os.Remove(filepath.Join(dir, "box1", logIndexFile))
+
+	st, err = NewLogStore(dir, 0, 0)
+	c.Assert(err, check.IsNil)
+	cursor, err := st.Cursor("box1")
+	c.Assert(err, check.IsNil)
+	c.Assert(cursor, check.Equals, uint64(2))
+	logs := boxlogs("c:deploy:u1")
+	c.Assert(st.Append("box1", "", now, logs), check.IsNil)
+	c.Assert(logs[0].Cursor, check.Equals, uint64(3))
+	all, err := st.Query("box1", LogQuery{})
+	c.Assert(err, check.IsNil)
+	c.Assert(messages(all), check.DeepEquals, []string{"a", "b", "c"})
+	owner, _ := st.Owner("box1")
+	c.Assert(owner, check.Equals, "info@megam.io")
+}
+
+func (s *S) TestLogTail(c *check.C) {
+	st, err := NewLogStore(c.MkDir(), 0, 0)
+	c.Assert(err, check.IsNil)
+	now := time.Now()
+	logs := boxlogs("a:deploy:u1", "b:deploy:u1", "c:deploy:u1")
+	c.Assert(st.Append("box1", "info@megam.io", now, logs), check.IsNil)
+
+	tail := st.Tail("box1", LogQuery{After: 1})
+	got, err := tail.History()
+	c.Assert(err, check.IsNil)
+	c.Assert(messages(got), check.DeepEquals, []string{"b", "c"})
+	got, _ = tail.History()
+	c.Assert(got, check.HasLen, 0)
+	//c arrives live after it was read from the store.
+	got, _ = tail.Live(logs[2])
+	c.Assert(got, check.HasLen, 0)
+
+	more := boxlogs("d:deploy:u1", "e:shell:u1", "f:deploy:u1")
+	c.Assert(st.Append("box1", "", now, more), check.IsNil)
+	//d and e never arrived live, f brings them along.
+	got, err = tail.Live(more[2])
+	c.Assert(err, check.IsNil)
+	c.Assert(messages(got), check.DeepEquals, []string{"d", "e", "f"})
+	got, _ = tail.Live(more[0])
+	c.Assert(got, check.HasLen, 0)
+	c.Assert(tail.Cursor(), check.Equals, uint64(6))
+
+	filtered := st.Tail("box1", LogQuery{After: 3, Source: "deploy"})
+	got, _ = filtered.Live(more[2])
+	c.Assert(messages(got), check.DeepEquals, []string{"d", "f"})
+
+	var none *LogStore
+	got, _ = none.Tail("box1", LogQuery{}).Live(Boxlog{Message: "g"})
+	c.Assert(messages(got), check.DeepEquals, []string{"g"})
+}
+
+func (s *S) TestLogStoreFollowsTheTopic(c *check.C) {
+	defer func(f func(string, string, func([]byte)) (func(), error), p func(string, []interface{}) error) {
+		followLogs, publishLogs = f, p
+	}(followLogs, publishLogs)
+	handlers := make(map[string]func([]byte))
+	stopped := 0
+	followLogs = func(topic, channel string, fn func([]byte)) (func(), error) {
+		c.Assert(channel, check.Equals, storeLogChannel)
+		handlers[topic] = fn
+		return func() { stopped++ }, nil
+	}
+	published := make([]Boxlog, 0)
+	publishLogs = func(name string, msgs []interface{}) error {
+		for _, m := range msgs {
+			published = append(published, m.(Boxlog))
+		}
+		return nil
+	}
+	dir := c.MkDir()
+	st, err := NewLogStore(dir, 0, 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(st.Append("box1", "info@megam.io", time.Now(), boxlogs("a:deploy:u1")), check.IsNil)
+	st, err = NewLogStore(dir, 0, 0)
+	c.Assert(err, check.IsNil)
+	c.Assert(st.FollowAll(), check.IsNil)
+	c.Assert(st.Follow("box1"), check.IsNil)
+	c.Assert(handlers, check.HasLen, 1)
+	c.Assert(st.Following("box1"), check.Equals, true)
+
+	tail := st.Tail("box1", LogQuery{After: 1})
+	agent := Boxlog{Message: "b", Source: "agent", Unit: "u1", Name: "box1"}
+	got, _ := tail.Live(agent)
+	c.Assert(got, check.HasLen, 0)
+	handlers["box1_log"]([]byte(`{"Message":"b","Source":"agent","Unit":"u1","Name":"box1"}`))
+	//the logs vertice wrote are stored already.
+	handlers["box1_log"]([]byte(`{"Message":"a","Source":"deploy","Unit":"u1","Name":"box1","Cursor":1}`))
+	all, err := st.Query("box1", LogQuery{})
+	c.Assert(err, check.IsNil)
+	c.Assert(messages(all), check.DeepEquals, []string{"a", "b"})
+	c.Assert(published, check.HasLen, 1)
+	c.Assert(published[0].Cursor, check.Equals, uint64(2))
+	got, _ = tail.Live(published[0])
+	c.Assert(messages(got), check.DeepEquals, []string{"b"})
+	owner, _ := st.Owner("box1")
+	c.Assert(owner, check.Equals, "info@megam.io")
+	c.Assert(st.Close(), check.IsNil)
+	c.Assert(stopped, check.Equals, 1)
+	c.Assert(st.Following("box1"), check.Equals, false)
+}
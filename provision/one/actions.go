@@ -339,6 +339,74 @@ var stopMachine = action.Action{
 	MinParams: 1,
 }
 
+//powers off a running vm for a change that needs it off, it is powered on again on a rollback.
+var cycleStopMachine = action.Action{
+	Name: "cycle-stop-machine",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		mach := ctx.Previous.(machine.Machine)
+		args := ctx.Params[0].(runMachineActionsArgs)
+		if !args.box.CanCycleStop() {
+			return mach, nil
+		}
+		//a vm powered off in one is left off, the state of the box can be behind it.
+		off, err := mach.IsVMState(args.provisioner, vm.POWEROFF, vm.LCM_INIT)
+		if err != nil {
+			return nil, err
+		}
+		if off {
+			return mach, nil
+		}
+		fmt.Fprintf(args.writer, lb.W(lb.STOPPING, lb.INFO, fmt.Sprintf("  stopping machine %s for the change", mach.Name)))
+		if err := mach.LifecycleOps(args.provisioner, constants.STOP); err != nil {
+			return nil, err
+		}
+		if err := mach.WaitUntillVMState(args.provisioner, vm.POWEROFF, vm.LCM_INIT); err != nil {
+			return nil, err
+		}
+		mach.CycleStopped = true
+		fmt.Fprintf(args.writer, lb.W(lb.STOPPING, lb.INFO, fmt.Sprintf("  stopping machine %s for the change OK", mach.Name)))
+		return mach, nil
+	},
+	Backward: func(ctx action.BWContext) {
+		args := ctx.Params[0].(runMachineActionsArgs)
+		mach := ctx.FWResult.(machine.Machine)
+		if !mach.CycleStopped {
+			return
+		}
+		if err := mach.LifecycleOps(args.provisioner, constants.START); err != nil {
+			fmt.Fprintf(args.writer, lb.W(lb.STARTING, lb.ERROR, fmt.Sprintf("  starting machine %s again %s", mach.Name, err.Error())))
+		}
+	},
+	OnError:   rollbackNotice,
+	MinParams: 1,
+}
+
+//powers on a vm stopped by cycleStopMachine, a vm that wasn't running is left off.
+var cycleStartMachine = action.Action{
+	Name: "cycle-start-machine",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		mach := ctx.Previous.(machine.Machine)
+		args := ctx.Params[0].(runMachineActionsArgs)
+		if !mach.CycleStopped {
+			return mach, nil
+		}
+		fmt.Fprintf(args.writer, lb.W(lb.STARTING, lb.INFO, fmt.Sprintf("  starting machine %s after the change", mach.Name)))
+		if err := mach.LifecycleOps(args.provisioner, constants.START); err != nil {
+			return nil, err
+		}
+		if err := mach.WaitUntillVMState(args.provisioner, vm.ACTIVE, vm.RUNNING); err != nil {
+			return nil, err
+		}
+		mach.CycleStopped = false
+		fmt.Fprintf(args.writer, lb.W(lb.STARTING, lb.INFO, fmt.Sprintf("  starting machine %s after the change OK", mach.Name)))
+		return mach, nil
+	},
+	Backward: func(ctx action.BWContext) {
+	},
+	OnError:   rollbackNotice,
+	MinParams: 1,
+}
+
 var restartMachine = action.Action{
 	Name: "restart-machine",
 	Forward: func(ctx action.FWContext) (action.Result, error) {
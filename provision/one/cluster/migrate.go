@@ -0,0 +1,144 @@
+package cluster
+
+import (
+	"encoding/xml"
+	"fmt"
+	"path"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/megamsys/opennebula-go/compute"
+)
+
+const (
+	VM_MIGRATE     = "one.vm.migrate"
+	CLUSTER_INFO   = "one.cluster.info"
+	HOST_INFO      = "one.host.info"
+	DATASTORE_INFO = "one.datastore.info"
+
+	//url the images of a region are exported at, used to move an image to another region.
+	MIGRATE_URL = "migrate_url"
+
+	hostMonitored   = 2
+	systemDatastore = 1
+)
+
+type oneCluster struct {
+	Id         int   `xml:"ID"`
+	Hosts      []int `xml:"HOSTS>ID"`
+	Datastores []int `xml:"DATASTORES>ID"`
+}
+
+type oneHost struct {
+	Id         int    `xml:"ID"`
+	Name       string `xml:"NAME"`
+	State      int    `xml:"STATE"`
+	RunningVMs int    `xml:"HOST_SHARE>RUNNING_VMS"`
+	FreeMem    int64  `xml:"HOST_SHARE>FREE_MEM"`
+}
+
+type oneDatastore struct {
+	Id   int `xml:"ID"`
+	Type int `xml:"TYPE"`
+}
+
+// MigrateVM moves the vm to a host of the cluster clusterId in the same region.
+// The cluster must be one of the enabled clusters of the region. A live migration
+// keeps the vm running, else the vm is saved and resumed on the new host.
+func (c *Cluster) MigrateVM(opts compute.VirtualMachine, clusterId string, live bool) error {
+	nodeo, err := c.storage().RetrieveNode(opts.Region)
+	if err != nil {
+		return err
+	}
+	if _, ok := nodeo.Clusters[clusterId]; !ok {
+		return fmt.Errorf("cluster (%s) is not enabled in the region (%s)", clusterId, opts.Region)
+	}
+	node, err := c.getNodeByObject(nodeo)
+	if err != nil {
+		return err
+	}
+	defer node.Client.Client.Close()
+
+	cl := &oneCluster{}
+	if err = node.info(CLUSTER_INFO, clusterId, cl); err != nil {
+		return wrapErrorWithCmd(node, err, "MigrateVM")
+	}
+	hosts := make([]*oneHost, 0, len(cl.Hosts))
+	for _, id := range cl.Hosts {
+		h := &oneHost{}
+		if err = node.info(HOST_INFO, id, h); err != nil {
+			return wrapErrorWithCmd(node, err, "MigrateVM")
+		}
+		hosts = append(hosts, h)
+	}
+	host, err := pickHost(hosts)
+	if err != nil {
+		return fmt.Errorf("cluster (%s) : %s", clusterId, err)
+	}
+	dsId := -1
+	for _, id := range cl.Datastores {
+		ds := &oneDatastore{}
+		if err = node.info(DATASTORE_INFO, id, ds); err != nil {
+			return wrapErrorWithCmd(node, err, "MigrateVM")
+		}
+		if ds.Type == systemDatastore {
+			dsId = ds.Id
+			break
+		}
+	}
+
+	log.Debugf("  migrating vm (%d) to host %s of cluster (%s) live=%t", opts.VMId, host.Name, clusterId, live)
+	args := []interface{}{node.Client.Key, opts.VMId, host.Id, live, false, dsId}
+	if _, err = node.Client.Call(VM_MIGRATE, args); err != nil {
+		return wrapErrorWithCmd(node, err, "MigrateVM")
+	}
+	return nil
+}
+
+//info reads the xml of the one object id into v.
+func (n node) info(method string, id interface{}, v interface{}) error {
+	res, err := n.Client.Call(method, []interface{}{n.Client.Key, id})
+	if err != nil {
+		return err
+	}
+	if len(res) < 2 {
+		return fmt.Errorf("%s : empty response", method)
+	}
+	body, ok := res[1].(string)
+	if !ok {
+		return fmt.Errorf("%s : unexpected response %v", method, res[1])
+	}
+	return xml.Unmarshal([]byte(body), v)
+}
+
+//pickHost is the monitored host running the fewest vms, the one with more free memory on a tie.
+func pickHost(hosts []*oneHost) (*oneHost, error) {
+	var best *oneHost
+	for _, h := range hosts {
+		if h.State != hostMonitored {
+			continue
+		}
+		if best == nil || h.RunningVMs < best.RunningVMs ||
+			(h.RunningVMs == best.RunningVMs && h.FreeMem > best.FreeMem) {
+			best = h
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("no monitored host to migrate to")
+	}
+	return best, nil
+}
+
+// ExportUrl is the url the image source of the region is downloaded from by
+// another region, it is the migrate_url of the region joined with the file of the source.
+func (c *Cluster) ExportUrl(region, source string) (string, error) {
+	nodeo, err := c.storage().RetrieveNode(region)
+	if err != nil {
+		return "", err
+	}
+	base := strings.TrimSpace(nodeo.Metadata[MIGRATE_URL])
+	if base == "" {
+		return "", fmt.Errorf("%s is empty in the region (%s), images can't be moved out of it", MIGRATE_URL, region)
+	}
+	return strings.TrimRight(base, "/") + "/" + path.Base(source), nil
+}
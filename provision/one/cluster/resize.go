@@ -0,0 +1,55 @@
+package cluster
+
+import (
+	"fmt"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/megamsys/opennebula-go/api"
+	"github.com/megamsys/opennebula-go/compute"
+)
+
+const (
+	VM_RESIZE      = "one.vm.resize"
+	VM_DISK_RESIZE = "one.vm.diskresize"
+)
+
+// ResizeVM changes the cpu and memory (MB) of a powered off vm. The cpu is
+// throttled like it is when the vm is created.
+func (c *Cluster) ResizeVM(opts compute.VirtualMachine, throttle string) error {
+	nodeo, err := c.storage().RetrieveNode(opts.Region)
+	if err != nil {
+		return err
+	}
+	if nodeo.Metadata[api.VCPU_PERCENTAGE] != "" {
+		throttle = nodeo.Metadata[api.VCPU_PERCENTAGE]
+	}
+	node, err := c.getNodeByObject(nodeo)
+	if err != nil {
+		return err
+	}
+	defer node.Client.Client.Close()
+
+	tmpl := fmt.Sprintf("CPU=%s\nVCPU=%s\nMEMORY=%s", cpuThrottle(throttle, opts.Cpu), opts.Cpu, opts.Memory)
+	log.Debugf("  resizing vm (%d) to %s", opts.VMId, tmpl)
+	args := []interface{}{node.Client.Key, opts.VMId, tmpl, true}
+	if _, err = node.Client.Call(VM_RESIZE, args); err != nil {
+		return wrapErrorWithCmd(node, err, "ResizeVM")
+	}
+	return nil
+}
+
+// ResizeDisk grows the disk diskId of the vm to size MB.
+func (c *Cluster) ResizeDisk(opts compute.VirtualMachine, diskId int, size uint64) error {
+	node, err := c.getNodeRegion(opts.Region)
+	if err != nil {
+		return err
+	}
+	defer node.Client.Client.Close()
+
+	args := []interface{}{node.Client.Key, opts.VMId, diskId, strconv.FormatUint(size, 10)}
+	if _, err = node.Client.Call(VM_DISK_RESIZE, args); err != nil {
+		return wrapErrorWithCmd(node, err, "ResizeDisk")
+	}
+	return nil
+}
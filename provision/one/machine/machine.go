@@ -54,6 +54,14 @@ type Machine struct {
 	PublicUrl    string
 	Status       utils.Status
 	State        utils.State
+
+	//the vm left behind and the image it is moved with, while migrating to another region.
+	SourceVMId     string
+	SourceRegion   string
+	MigrateImageId string
+
+	//the vm was powered off for a change, it is powered on again after it.
+	CycleStopped bool
 }
 
 type CreateArgs struct {
@@ -252,6 +260,15 @@ func (m *Machine) WaitUntillVMState(p OneProvisioner, vm virtualmachine.VmState,
 	return nil
 }
 
+//IsVMState tells if the vm is in the state vm, lcm in one.
+func (m *Machine) IsVMState(p OneProvisioner, vm virtualmachine.VmState, lcm virtualmachine.LcmState) (bool, error) {
+	res, err := p.Cluster().GetVM(virtualmachine.Vnc{VmId: m.VMId}, m.Region)
+	if err != nil {
+		return false, err
+	}
+	return res.State == int(vm) && res.LcmState == int(lcm), nil
+}
+
 func (m *Machine) UpdateVncHostPost() error {
 	var vnc = make(map[string][]string)
 	var port, host []string
@@ -1195,3 +1212,144 @@ func (m *Machine) SetStatusErr(status utils.Status, causeof error) error {
 	}
 	return nil
 }
+
+//Migrate moves the vm to a host of the cluster clusterId in its region.
+func (m *Machine) Migrate(p OneProvisioner, clusterId string, live bool) error {
+	log.Debugf("  migrating machine in one (%s) to cluster %s", m.Name, clusterId)
+	id, _ := strconv.Atoi(m.VMId)
+	opts := compute.VirtualMachine{
+		Name:   m.Name,
+		Region: m.Region,
+		VMId:   id,
+	}
+	return p.Cluster().MigrateVM(opts, clusterId, live)
+}
+
+//VmHost reads the host and vnc port of the vm as it is, without waiting for it to run.
+func (m *Machine) VmHost(p OneProvisioner) error {
+	res, err := p.Cluster().GetVM(virtualmachine.Vnc{VmId: m.VMId}, m.Region)
+	if err != nil {
+		return err
+	}
+	m.VNCHost = res.GetHostIp()
+	m.VNCPort = res.GetPort()
+	return nil
+}
+
+//SaveMigrationImage saves the disk of the vm as an image of its region.
+func (m *Machine) SaveMigrationImage(p OneProvisioner) error {
+	vmid, _ := strconv.Atoi(m.VMId)
+	opts := compute.Image{
+		Name:   m.Name + "-migrate-" + strconv.FormatInt(time.Now().Unix(), 10),
+		Region: m.Region,
+		VMId:   vmid,
+		DiskId: 0,
+		SnapId: -1,
+	}
+	id, err := p.Cluster().SaveDiskImage(opts)
+	if err != nil {
+		return err
+	}
+	m.ImageId = id
+	return nil
+}
+
+//ImportMigrationImage creates the saved image in the region, downloaded from the
+//migrate_url of the region of the vm.
+func (m *Machine) ImportMigrationImage(p OneProvisioner, region string) error {
+	id, _ := strconv.Atoi(m.ImageId)
+	res, err := p.Cluster().GetImage(images.Image{Id: id}, m.Region)
+	if err != nil {
+		return err
+	}
+	url, err := p.Cluster().ExportUrl(m.Region, res.Source)
+	if err != nil {
+		return err
+	}
+	opts := images.Image{
+		Name: res.Name,
+		Path: url,
+		Type: images.OPERATING_SYSTEM,
+	}
+	img, err := p.Cluster().ImageCreate(opts, region)
+	if err != nil {
+		return err
+	}
+	m.MigrateImageId = img.(string)
+	return nil
+}
+
+func (m *Machine) IsMigrateImageReady(p OneProvisioner, region string) error {
+	id, _ := strconv.Atoi(m.MigrateImageId)
+	return p.Cluster().IsImageReady(&images.Image{Id: id}, region)
+}
+
+//CreateMigratedVM deploys the vm in the region from the imported image. The
+//networks of the region are used, so the vm gets new ips.
+func (m *Machine) CreateMigratedVM(args *CreateArgs, region string) error {
+	id, _ := strconv.Atoi(m.MigrateImageId)
+	img, err := args.Provisioner.Cluster().GetImage(images.Image{Id: id}, region)
+	if err != nil {
+		return err
+	}
+	opts, _, err := m.create(args)
+	if err != nil {
+		return err
+	}
+	opts.Region = region
+	opts.Image = img.Name
+	_, _, vmid, err := args.Provisioner.Cluster().CreateVM(opts, m.VCPUThrottle, m.StorageType, []*template.NIC{})
+	if err != nil {
+		return err
+	}
+	m.SourceVMId, m.SourceRegion = m.VMId, m.Region
+	m.VMId, m.Region = vmid, region
+	return nil
+}
+
+//UpdateMigratedRegion points the assembly to the vm and the region it was migrated to.
+func (m *Machine) UpdateMigratedRegion() error {
+	asm, err := carton.NewAssembly(m.CartonId, m.AccountId, "")
+	if err != nil {
+		return err
+	}
+	if err = asm.NukeAndSetOutputs(map[string][]string{carton.INSTANCE_ID: []string{m.VMId}}); err != nil {
+		return err
+	}
+	return asm.NukeAndSetInputs(map[string][]string{carton.REGION: []string{m.Region}})
+}
+
+//RemoveMigrationSource removes the vm left in the old region and the image it was saved to.
+func (m *Machine) RemoveMigrationSource(p OneProvisioner) error {
+	old := Machine{Name: m.Name, Region: m.SourceRegion, VMId: m.SourceVMId, ImageId: m.ImageId}
+	if err := old.Remove(p); err != nil {
+		return err
+	}
+	return old.RemoveImage(p)
+}
+
+//Resize changes the cpu and memory (MB) of the powered off vm.
+func (m *Machine) Resize(p OneProvisioner, cpu, memory uint64) error {
+	log.Debugf("  resizing machine in one (%s) to cpu %d, memory %dMB", m.Name, cpu, memory)
+	id, _ := strconv.Atoi(m.VMId)
+	opts := compute.VirtualMachine{
+		Name:   m.Name,
+		Region: m.Region,
+		VMId:   id,
+		Cpu:    strconv.FormatUint(cpu, 10),
+		Memory: strconv.FormatUint(memory, 10),
+	}
+	return p.Cluster().ResizeVM(opts, m.VCPUThrottle)
+}
+
+//GrowDisk grows the root disk of the vm to size MB.
+func (m *Machine) GrowDisk(p OneProvisioner, size uint64) error {
+	log.Debugf("  growing disk of machine in one (%s) to %dMB", m.Name, size)
+	id, _ := strconv.Atoi(m.VMId)
+	opts := compute.VirtualMachine{
+		Name:   m.Name,
+		Region: m.Region,
+		VMId:   id,
+	}
+	return p.Cluster().ResizeDisk(opts, 0, size)
+}
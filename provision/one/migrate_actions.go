@@ -0,0 +1,195 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+
+package one
+
+import (
+	"fmt"
+
+	"github.com/megamsys/libgo/action"
+	vm "github.com/megamsys/opennebula-go/virtualmachine"
+	"github.com/megamsys/vertice/carton"
+	lb "github.com/megamsys/vertice/logbox"
+	"github.com/megamsys/vertice/provision/one/machine"
+)
+
+//moves the vm to a host of the cluster in its region, the vm ends up in the state it was in.
+var migrateMachine = action.Action{
+	Name: "migrate-machine",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		mach := ctx.Previous.(machine.Machine)
+		args := ctx.Params[0].(runMachineActionsArgs)
+		mg := args.box.Migration
+		fmt.Fprintf(args.writer, lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf("  migrating machine %s to cluster %s (live:%t)", mach.Name, mg.Cluster, mg.Live)))
+		if err := mach.Migrate(args.provisioner, mg.Cluster, mg.Live); err != nil {
+			return nil, err
+		}
+		var err error
+		if args.box.CanCycleStop() {
+			err = mach.WaitUntillVMState(args.provisioner, vm.ACTIVE, vm.RUNNING)
+		} else {
+			err = mach.WaitUntillVMState(args.provisioner, vm.POWEROFF, vm.LCM_INIT)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err = mach.VmHost(args.provisioner); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(args.writer, lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf("  migrating machine %s to cluster %s OK", mach.Name, mg.Cluster)))
+		return mach, nil
+	},
+	Backward: func(ctx action.BWContext) {
+	},
+	OnError:   rollbackNotice,
+	MinParams: 1,
+}
+
+var saveMigrationImage = action.Action{
+	Name: "save-migration-image",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		mach := ctx.Previous.(machine.Machine)
+		args := ctx.Params[0].(runMachineActionsArgs)
+		fmt.Fprintf(args.writer, lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf("  saving disk of machine %s", mach.Name)))
+		if err := mach.SaveMigrationImage(args.provisioner); err != nil {
+			return nil, err
+		}
+		if err := mach.IsImageReady(args.provisioner); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(args.writer, lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf("  saving disk of machine %s (image:%s) OK", mach.Name, mach.ImageId)))
+		return mach, nil
+	},
+	Backward: func(ctx action.BWContext) {
+		mach := ctx.FWResult.(machine.Machine)
+		args := ctx.Params[0].(runMachineActionsArgs)
+		if err := mach.RemoveImage(args.provisioner); err != nil {
+			fmt.Fprintf(args.writer, lb.W(lb.DESTORYING, lb.ERROR, fmt.Sprintf("  removing migration image %s", err.Error())))
+		}
+	},
+	OnError:   rollbackNotice,
+	MinParams: 1,
+}
+
+var importMigrationImage = action.Action{
+	Name: "import-migration-image",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		mach := ctx.Previous.(machine.Machine)
+		args := ctx.Params[0].(runMachineActionsArgs)
+		region := args.box.Migration.Region
+		fmt.Fprintf(args.writer, lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf("  moving image %s of machine %s to region %s", mach.ImageId, mach.Name, region)))
+		if err := mach.ImportMigrationImage(args.provisioner, region); err != nil {
+			return nil, err
+		}
+		if err := mach.IsMigrateImageReady(args.provisioner, region); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(args.writer, lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf("  moving image %s of machine %s to region %s OK", mach.ImageId, mach.Name, region)))
+		return mach, nil
+	},
+	Backward: func(ctx action.BWContext) {
+		mach := ctx.FWResult.(machine.Machine)
+		args := ctx.Params[0].(runMachineActionsArgs)
+		img := machine.Machine{Name: mach.Name, Region: args.box.Migration.Region, ImageId: mach.MigrateImageId}
+		if err := img.RemoveImage(args.provisioner); err != nil {
+			fmt.Fprintf(args.writer, lb.W(lb.DESTORYING, lb.ERROR, fmt.Sprintf("  removing migration image %s", err.Error())))
+		}
+	},
+	OnError:   rollbackNotice,
+	MinParams: 1,
+}
+
+var createMigratedMachine = action.Action{
+	Name: "create-migrated-machine",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		mach := ctx.Previous.(machine.Machine)
+		args := ctx.Params[0].(runMachineActionsArgs)
+		region := args.box.Migration.Region
+		fmt.Fprintf(args.writer, lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf("  create machine %s in region %s", mach.Name, region)))
+		err := mach.CreateMigratedVM(&machine.CreateArgs{
+			Box:         args.box,
+			Compute:     args.box.Compute,
+			Provisioner: args.provisioner,
+		}, region)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(args.writer, lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf("  create machine %s in region %s (vm:%s) OK", mach.Name, region, mach.VMId)))
+		return mach, nil
+	},
+	Backward: func(ctx action.BWContext) {
+		mach := ctx.FWResult.(machine.Machine)
+		args := ctx.Params[0].(runMachineActionsArgs)
+		if err := mach.Remove(args.provisioner); err != nil {
+			fmt.Fprintf(args.writer, lb.W(lb.DESTORYING, lb.ERROR, fmt.Sprintf("  removing migrated machine %s", err.Error())))
+		}
+	},
+	OnError:   rollbackNotice,
+	MinParams: 1,
+}
+
+var updateMigratedRegion = action.Action{
+	Name: "update-migrated-region",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		mach := ctx.Previous.(machine.Machine)
+		if err := mach.UpdateMigratedRegion(); err != nil {
+			return nil, err
+		}
+		return mach, nil
+	},
+	Backward: func(ctx action.BWContext) {
+		mach := ctx.FWResult.(machine.Machine)
+		args := ctx.Params[0].(runMachineActionsArgs)
+		old := mach
+		old.VMId, old.Region = mach.SourceVMId, mach.SourceRegion
+		if err := old.UpdateMigratedRegion(); err != nil {
+			fmt.Fprintf(args.writer, lb.W(lb.UPDATING, lb.ERROR, fmt.Sprintf("  restoring region of machine %s %s", mach.Name, err.Error())))
+		}
+	},
+	OnError:   rollbackNotice,
+	MinParams: 1,
+}
+
+var removeMigrationSource = action.Action{
+	Name: "remove-migration-source",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		mach := ctx.Previous.(machine.Machine)
+		args := ctx.Params[0].(runMachineActionsArgs)
+		fmt.Fprintf(args.writer, lb.W(lb.DESTORYING, lb.INFO, fmt.Sprintf("  removing machine %s (vm:%s) in region %s", mach.Name, mach.SourceVMId, mach.SourceRegion)))
+		if err := mach.RemoveMigrationSource(args.provisioner); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(args.writer, lb.W(lb.DESTORYING, lb.INFO, fmt.Sprintf("  removing machine %s (vm:%s) in region %s OK", mach.Name, mach.SourceVMId, mach.SourceRegion)))
+		return mach, nil
+	},
+	Backward: func(ctx action.BWContext) {
+	},
+	OnError:   rollbackNotice,
+	MinParams: 1,
+}
+
+var setMigratedStatus = action.Action{
+	Name: "set-migrated-status",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		mach := ctx.Previous.(machine.Machine)
+		mach.Status = carton.StatusMigrated
+		return mach, nil
+	},
+	Backward: func(ctx action.BWContext) {
+	},
+	OnError:   rollbackNotice,
+	MinParams: 1,
+}
@@ -37,7 +37,10 @@ import (
 	"github.com/megamsys/vertice/provision/one/cluster"
 	"github.com/megamsys/vertice/repository"
 	"github.com/megamsys/vertice/router"
+	_ "github.com/megamsys/vertice/router/powerdns"
+	_ "github.com/megamsys/vertice/router/rfc2136"
 	_ "github.com/megamsys/vertice/router/route53"
+	_ "github.com/megamsys/vertice/router/zonefile"
 )
 
 var mainOneProvisioner *oneProvisioner
@@ -73,6 +76,7 @@ type Region struct {
 	VCPUPercentage string    `json:"vcpu_percentage" toml:"vcpu_percentage"`
 	Datastore      string    `json:"one_datastore_id" toml:"one_datastore_id"`
 	Certificate    string    `json:"certificate" toml:"certificate"`
+	MigrateUrl     string    `json:"migrate_url" toml:"migrate_url"`
 	Clusters       []Cluster `json:"cluster" toml:"cluster"`
 }
 
@@ -150,6 +154,7 @@ func (c Region) ToMap() map[string]string {
 	m[api.IMAGE] = c.Image
 	m[api.VCPU_PERCENTAGE] = c.VCPUPercentage
 	m[constants.DATASTORE] = c.Datastore
+	m[cluster.MIGRATE_URL] = c.MigrateUrl
 	return m
 }
 
@@ -250,6 +255,10 @@ func (p *oneProvisioner) deployPipeline(box *provision.Box, imageId string, back
 
 	fmt.Fprintf(w, lb.W(lb.DEPLOY, lb.INFO, fmt.Sprintf("--- deploy box (%s, image:%s)", box.GetFullName(), imageId)))
 
+	kind := "deploy"
+	if backup {
+		kind = "backupdeploy"
+	}
 	actions := []*action.Action{&machCreating}
 	if events.IsEnabled(constants.BILLMGR) && !strings.Contains(box.Authority, "admin") {
 		if !(len(box.QuotaId) > 0) {
@@ -267,6 +276,7 @@ func (p *oneProvisioner) deployPipeline(box *provision.Box, imageId string, back
 	}
 	actions = append(actions, &getVmHostIpPort, &mileStoneUpdate, &updateStatusInScylla, &updateVnchostPostInScylla, &updateStatusInScylla, &setFinalStatus, &updateStatusInScylla, &followLogs)
 
+	opId, actions := provision.Operations.Track(box, kind, actions)
 	pipeline := action.NewPipeline(actions...)
 
 	args := runMachineActionsArgs{
@@ -280,6 +290,7 @@ func (p *oneProvisioner) deployPipeline(box *provision.Box, imageId string, back
 	}
 
 	err := pipeline.Execute(args)
+	provision.Operations.Finish(opId, err)
 	if err != nil {
 		fmt.Fprintf(w, lb.W(lb.DEPLOY, lb.ERROR, fmt.Sprintf("--- deploy pipeline for box (%s, image:%s)\n --> %s", box.GetFullName(), imageId, err)))
 		return "", err
@@ -313,9 +324,11 @@ func (p *oneProvisioner) Destroy(box *provision.Box, w io.Writer) error {
 
 	actions = append(actions, &destroyOldRoute, &mileStoneUpdate, &updateStatusInScylla)
 
+	opId, actions := provision.Operations.Track(box, "destroy", actions)
 	pipeline := action.NewPipeline(actions...)
 
 	err := pipeline.Execute(args)
+	provision.Operations.Finish(opId, err)
 	if err != nil {
 
 		fmt.Fprintf(w, lb.W(lb.DESTORYING, lb.ERROR, fmt.Sprintf("--- destroying box (%s)--> %s", box.GetFullName(), err)))
@@ -893,6 +906,84 @@ func (p *oneProvisioner) NetworkUpdate(box *provision.Box, w io.Writer) error {
 	return nil
 }
 
+// Migrate moves the vm of the box to another cluster of its region, live or cold.
+// A vm moved to another region is saved to an image, the image is downloaded by
+// that region and the vm is deployed again from it, then the old vm is removed.
+func (p *oneProvisioner) Migrate(box *provision.Box, w io.Writer) error {
+	fmt.Fprintf(w, lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf("--- migrate box %s", box.GetFullName())))
+	actions := []*action.Action{&machCreating, &updateStatusInScylla}
+	if box.Migration.CrossRegion(box.Region) {
+		actions = append(actions,
+			&cycleStopMachine,
+			&saveMigrationImage,
+			&importMigrationImage,
+			&createMigratedMachine,
+			&getVmHostIpPort,
+			&updateMigratedRegion,
+			&updateVnchostPostInScylla,
+			&updateNetworkIps,
+			&removeMigrationSource,
+		)
+	} else {
+		actions = append(actions, &migrateMachine, &updateVnchostPostInScylla, &updateNetworkIps)
+	}
+	actions = append(actions, &setMigratedStatus, &updateStatusInScylla)
+	opId, actions := provision.Operations.Track(box, "migrate", actions)
+	pipeline := action.NewPipeline(actions...)
+
+	args := runMachineActionsArgs{
+		box:           box,
+		writer:        w,
+		machineStatus: carton.StatusMigrating,
+		machineState:  box.State,
+		provisioner:   p,
+	}
+
+	err := pipeline.Execute(args)
+	provision.Operations.Finish(opId, err)
+	if err != nil {
+		fmt.Fprintf(w, lb.W(lb.UPDATING, lb.ERROR, fmt.Sprintf("--- migrate box %s --> %s", box.GetFullName(), err)))
+		return err
+	}
+
+	fmt.Fprintf(w, lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf("--- migrate box %s OK", box.GetFullName())))
+	return nil
+}
+
+func (p *oneProvisioner) Resize(box *provision.Box, w io.Writer) error {
+	fmt.Fprintf(w, lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf("--- resize box %s", box.GetFullName())))
+	actions := []*action.Action{
+		&machCreating,
+		&updateStatusInScylla,
+		&cycleStopMachine,
+		&resizeMachine,
+		&growDisk,
+		&cycleStartMachine,
+		&setResizedStatus,
+		&updateStatusInScylla,
+	}
+	opId, actions := provision.Operations.Track(box, "resize", actions)
+	pipeline := action.NewPipeline(actions...)
+
+	args := runMachineActionsArgs{
+		box:           box,
+		writer:        w,
+		machineStatus: carton.StatusResizing,
+		machineState:  box.State,
+		provisioner:   p,
+	}
+
+	err := pipeline.Execute(args)
+	provision.Operations.Finish(opId, err)
+	if err != nil {
+		fmt.Fprintf(w, lb.W(lb.UPDATING, lb.ERROR, fmt.Sprintf("--- resize box %s --> %s", box.GetFullName(), err)))
+		return err
+	}
+
+	fmt.Fprintf(w, lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf("--- resize box %s OK", box.GetFullName())))
+	return nil
+}
+
 func (p *oneProvisioner) networkAttach(box *provision.Box, w io.Writer) error {
 
 	fmt.Fprintf(w, lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf("--- network attach for box %s", box.GetFullName())))
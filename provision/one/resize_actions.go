@@ -0,0 +1,83 @@
+/*
+** Copyright [2013-2017] [Megam Systems]
+**
+** Licensed under the Apache License, Version 2.0 (the "License");
+** you may not use this file except in compliance with the License.
+** You may obtain a copy of the License at
+**
+** http://www.apache.org/licenses/LICENSE-2.0
+**
+** Unless required by applicable law or agreed to in writing, software
+** distributed under the License is distributed on an "AS IS" BASIS,
+** WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+** See the License for the specific language governing permissions and
+** limitations under the License.
+ */
+
+package one
+
+import (
+	"fmt"
+
+	"github.com/megamsys/libgo/action"
+	"github.com/megamsys/vertice/carton"
+	lb "github.com/megamsys/vertice/logbox"
+	"github.com/megamsys/vertice/provision/one/machine"
+)
+
+//changes the cpu and memory of the powered off vm to the ones of the new flavor.
+var resizeMachine = action.Action{
+	Name: "resize-machine",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		mach := ctx.Previous.(machine.Machine)
+		args := ctx.Params[0].(runMachineActionsArgs)
+		r := args.box.Resize
+		fmt.Fprintf(args.writer, lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf("  resizing machine %s to flavor %s (cpu:%d, memory:%dMB)", mach.Name, r.FlavorId, r.GetCpushare(), r.GetMemory())))
+		if err := mach.Resize(args.provisioner, r.GetCpushare(), r.GetMemory()); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(args.writer, lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf("  resizing machine %s to flavor %s OK", mach.Name, r.FlavorId)))
+		return mach, nil
+	},
+	Backward: func(ctx action.BWContext) {
+		mach := ctx.FWResult.(machine.Machine)
+		args := ctx.Params[0].(runMachineActionsArgs)
+		if err := mach.Resize(args.provisioner, args.box.GetCpushare(), args.box.GetMemory()); err != nil {
+			fmt.Fprintf(args.writer, lb.W(lb.UPDATING, lb.ERROR, fmt.Sprintf("  resizing machine %s back %s", mach.Name, err.Error())))
+		}
+	},
+	OnError:   rollbackNotice,
+	MinParams: 1,
+}
+
+//grows the root disk when the new flavor has a bigger one, a disk can't be shrunk back.
+var growDisk = action.Action{
+	Name: "grow-disk",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		mach := ctx.Previous.(machine.Machine)
+		args := ctx.Params[0].(runMachineActionsArgs)
+		size := args.box.Resize.GetHDD()
+		if size <= args.box.GetHDD() {
+			return mach, nil
+		}
+		fmt.Fprintf(args.writer, lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf("  growing disk of machine %s to %dMB", mach.Name, size)))
+		if err := mach.GrowDisk(args.provisioner, size); err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(args.writer, lb.W(lb.UPDATING, lb.INFO, fmt.Sprintf("  growing disk of machine %s to %dMB OK", mach.Name, size)))
+		return mach, nil
+	},
+	Backward: func(ctx action.BWContext) {
+	},
+	OnError:   rollbackNotice,
+	MinParams: 1,
+}
+
+var setResizedStatus = action.Action{
+	Name: "set-resized-status",
+	Forward: func(ctx action.FWContext) (action.Result, error) {
+		mach := ctx.Previous.(machine.Machine)
+		mach.Status = carton.StatusResized
+		return mach, nil
+	},
+}
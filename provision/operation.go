@@ -0,0 +1,282 @@
+package provision
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/megamsys/libgo/action"
+	"github.com/megamsys/vertice/instrument"
+)
+
+const (
+	StepPending    = "pending"
+	StepRunning    = "running"
+	StepDone       = "done"
+	StepFailed     = "failed"
+	StepRolledBack = "rolledback"
+
+	OperationRunning = "running"
+	OperationDone    = "done"
+	OperationFailed  = "failed"
+
+	// DefaultOperationRetention is how long a finished operation is kept.
+	DefaultOperationRetention = 24 * time.Hour
+)
+
+// Operations are the pipelines run on the boxes, with the progress of their steps.
+var Operations = NewOperationStore(0)
+
+// OperationStep is the state of an action of the pipeline.
+type OperationStep struct {
+	Name       string     `json:"name"`
+	Status     string     `json:"status"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// Operation is a pipeline run on a box (deploy, destroy, resize..), its
+// steps are the actions in the order they run.
+type Operation struct {
+	Id           string           `json:"id"`
+	Kind         string           `json:"kind"`
+	BoxId        string           `json:"box_id"`
+	BoxName      string           `json:"box_name"`
+	AssemblyId   string           `json:"assembly_id"`
+	AssembliesId string           `json:"assemblies_id"`
+	AccountId    string           `json:"account_id"`
+	Status       string           `json:"status"`
+	Error        string           `json:"error,omitempty"`
+	Progress     int              `json:"progress"`
+	Steps        []*OperationStep `json:"steps"`
+	CreatedAt    time.Time        `json:"created_at"`
+	FinishedAt   *time.Time       `json:"finished_at,omitempty"`
+}
+
+func (o *Operation) finished() bool {
+	return o.Status != OperationRunning
+}
+
+//progress is the percent of the steps done.
+func (o *Operation) progress() int {
+	if len(o.Steps) == 0 {
+		return 100
+	}
+	done := 0
+	for _, st := range o.Steps {
+		if st.Status == StepDone {
+			done++
+		}
+	}
+	return done * 100 / len(o.Steps)
+}
+
+//copy is a snapshot of the operation, the steps keep changing.
+func (o *Operation) copy() Operation {
+	c := *o
+	c.Steps = make([]*OperationStep, len(o.Steps))
+	for i, st := range o.Steps {
+		s := *st
+		c.Steps[i] = &s
+	}
+	return c
+}
+
+// OperationStore keeps the operations in memory, the finished ones are
+// dropped after the retention. A watcher gets the operation on every change.
+type OperationStore struct {
+	mu        sync.Mutex
+	all       map[string]*Operation
+	watchers  map[string][]chan Operation
+	seq       uint64
+	Retention time.Duration
+}
+
+// NewOperationStore makes the store, the default retention is used for zero.
+func NewOperationStore(retention time.Duration) *OperationStore {
+	if retention <= 0 {
+		retention = DefaultOperationRetention
+	}
+	return &OperationStore{
+		all:       make(map[string]*Operation),
+		watchers:  make(map[string][]chan Operation),
+		Retention: retention,
+	}
+}
+
+// Track starts an operation of the box, the actions returned run the given
+// ones and record the progress of each step. The operation ends with Finish.
+func (s *OperationStore) Track(box *Box, kind string, actions []*action.Action) (string, []*action.Action) {
+	now := time.Now()
+	s.mu.Lock()
+	s.seq++
+	op := &Operation{
+		Id:           "OPN" + strconv.FormatInt(now.UnixNano(), 10) + strconv.FormatUint(s.seq, 10),
+		Kind:         kind,
+		BoxId:        box.Id,
+		BoxName:      box.GetFullName(),
+		AssemblyId:   box.CartonId,
+		AssembliesId: box.CartonsId,
+		AccountId:    box.AccountId,
+		Status:       OperationRunning,
+		Steps:        make([]*OperationStep, len(actions)),
+		CreatedAt:    now,
+	}
+	for i, a := range actions {
+		op.Steps[i] = &OperationStep{Name: a.Name, Status: StepPending}
+	}
+	for id, o := range s.all {
+		if o.FinishedAt != nil && now.Sub(*o.FinishedAt) > s.Retention {
+			delete(s.all, id)
+		}
+	}
+	s.all[op.Id] = op
+	s.mu.Unlock()
+
+	tracked := make([]*action.Action, len(actions))
+	for i, a := range actions {
+		tracked[i] = s.track(op.Id, i, a)
+	}
+	return op.Id, tracked
+}
+
+//track wraps the action, the ones of the pipelines are shared so they aren't changed.
+func (s *OperationStore) track(id string, i int, a *action.Action) *action.Action {
+	forward, backward := a.Forward, a.Backward
+	t := &action.Action{
+		Name:      a.Name,
+		OnError:   a.OnError,
+		MinParams: a.MinParams,
+		Forward: func(ctx action.FWContext) (action.Result, error) {
+			s.step(id, i, StepRunning, nil)
+			r, err := forward(ctx)
+			if err != nil {
+				s.step(id, i, StepFailed, err)
+			} else {
+				s.step(id, i, StepDone, nil)
+			}
+			return r, err
+		},
+	}
+	if backward != nil {
+		t.Backward = func(ctx action.BWContext) {
+			backward(ctx)
+			s.step(id, i, StepRolledBack, nil)
+		}
+	}
+	return t
+}
+
+func (s *OperationStore) step(id string, i int, status string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	op, ok := s.all[id]
+	if !ok {
+		return
+	}
+	now := time.Now()
+	st := op.Steps[i]
+	st.Status = status
+	switch status {
+	case StepRunning:
+		st.StartedAt, st.FinishedAt, st.Error = &now, nil, ""
+	default:
+		st.FinishedAt = &now
+	}
+	if err != nil {
+		st.Error = err.Error()
+	}
+	if status == StepFailed {
+		instrument.StepFailures.Inc(op.Kind, st.Name)
+	}
+	op.Progress = op.progress()
+	s.notify(op)
+}
+
+// Finish ends the operation with the result of its pipeline.
+func (s *OperationStore) Finish(id string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	op, ok := s.all[id]
+	if !ok {
+		return
+	}
+	now := time.Now()
+	op.Status, op.FinishedAt = OperationDone, &now
+	if err != nil {
+		op.Status, op.Error = OperationFailed, err.Error()
+	}
+	op.Progress = op.progress()
+	s.notify(op)
+	for _, ch := range s.watchers[id] {
+		close(ch)
+	}
+	delete(s.watchers, id)
+}
+
+//notify hands the operation to its watchers, a watcher behind gets the latest only.
+func (s *OperationStore) notify(op *Operation) {
+	for _, ch := range s.watchers[op.Id] {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- op.copy()
+	}
+}
+
+func (s *OperationStore) Get(id string) (Operation, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	op, ok := s.all[id]
+	if !ok {
+		return Operation{}, false
+	}
+	return op.copy(), true
+}
+
+// Of are the operations on the boxes of the assemblies, oldest first.
+func (s *OperationStore) Of(asmsId string) []Operation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ops := make([]Operation, 0)
+	for _, op := range s.all {
+		if op.AssembliesId == asmsId {
+			ops = append(ops, op.copy())
+		}
+	}
+	sort.Slice(ops, func(i, j int) bool { return ops[i].CreatedAt.Before(ops[j].CreatedAt) })
+	return ops
+}
+
+// Watch gets the operation every time it changes, the channel is closed once
+// it finished. stop is called when the watcher leaves before that.
+func (s *OperationStore) Watch(id string) (ch <-chan Operation, stop func(), ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	op, ok := s.all[id]
+	if !ok {
+		return nil, func() {}, false
+	}
+	c := make(chan Operation, 1)
+	c <- op.copy()
+	if op.finished() {
+		close(c)
+		return c, func() {}, true
+	}
+	s.watchers[id] = append(s.watchers[id], c)
+	return c, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		ws := s.watchers[id]
+		for i, w := range ws {
+			if w == c {
+				s.watchers[id] = append(ws[:i], ws[i+1:]...)
+				close(c)
+				break
+			}
+		}
+	}, true
+}
@@ -0,0 +1,91 @@
+package provision
+
+import (
+	"errors"
+
+	"github.com/megamsys/libgo/action"
+	"github.com/megamsys/vertice/instrument"
+	"gopkg.in/check.v1"
+)
+
+func step(name string, fail bool, undone *[]string) *action.Action {
+	return &action.Action{
+		Name: name,
+		Forward: func(ctx action.FWContext) (action.Result, error) {
+			if fail {
+				return nil, errors.New(name + " failed")
+			}
+			return name, nil
+		},
+		Backward: func(ctx action.BWContext) {
+			*undone = append(*undone, name)
+		},
+		MinParams: 1,
+	}
+}
+
+func (s *S) TestOperationTracksSteps(c *check.C) {
+	st := NewOperationStore(0)
+	box := &Box{Id: "ASM001", CartonId: "ASM001", CartonsId: "AMS001", AccountId: "info@megam.io", Name: "web", DomainName: "megam.io"}
+	var undone []string
+	create := step("create-machine", false, &undone)
+	id, actions := st.Track(box, "deploy", []*action.Action{step("machine-struct-creating", false, &undone), create, step("balance-check", true, &undone)})
+	c.Assert(actions[1], check.Not(check.Equals), create)
+	ch, stop, ok := st.Watch(id)
+	c.Assert(ok, check.Equals, true)
+	defer stop()
+	first := <-ch
+	c.Assert(first.Status, check.Equals, OperationRunning)
+	c.Assert(first.Steps[0].Status, check.Equals, StepPending)
+
+	failures := instrument.StepFailures.Value("deploy", "balance-check")
+	err := action.NewPipeline(actions...).Execute("args")
+	c.Assert(err, check.NotNil)
+	st.Finish(id, err)
+	c.Assert(instrument.StepFailures.Value("deploy", "balance-check"), check.Equals, failures+1)
+	c.Assert(undone, check.DeepEquals, []string{"create-machine", "machine-struct-creating"})
+
+	op, ok := st.Get(id)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(op.Kind, check.Equals, "deploy")
+	c.Assert(op.AssembliesId, check.Equals, "AMS001")
+	c.Assert(op.Status, check.Equals, OperationFailed)
+	c.Assert(op.Error, check.Equals, "balance-check failed")
+	c.Assert(op.Steps[0].Status, check.Equals, StepRolledBack)
+	c.Assert(op.Steps[1].Status, check.Equals, StepRolledBack)
+	c.Assert(op.Steps[1].StartedAt, check.NotNil)
+	c.Assert(op.Steps[2].Status, check.Equals, StepFailed)
+	c.Assert(op.Steps[2].Error, check.Equals, "balance-check failed")
+	c.Assert(op.FinishedAt, check.NotNil)
+
+	//the watcher is behind, it gets the last change and the channel is closed.
+	last, open := <-ch
+	c.Assert(open, check.Equals, true)
+	c.Assert(last.Status, check.Equals, OperationFailed)
+	_, open = <-ch
+	c.Assert(open, check.Equals, false)
+	c.Assert(st.Of("AMS001"), check.HasLen, 1)
+	c.Assert(st.Of("AMS002"), check.HasLen, 0)
+}
+
+func (s *S) TestOperationProgress(c *check.C) {
+	st := NewOperationStore(0)
+	var undone []string
+	id, actions := st.Track(&Box{CartonsId: "AMS001"}, "resize", []*action.Action{step("resize-machine", false, &undone), step("grow-disk", false, &undone)})
+	c.Assert(action.NewPipeline(actions[:1]...).Execute("args"), check.IsNil)
+	op, _ := st.Get(id)
+	c.Assert(op.Progress, check.Equals, 50)
+	c.Assert(action.NewPipeline(actions[1:]...).Execute("args"), check.IsNil)
+	st.Finish(id, nil)
+	op, _ = st.Get(id)
+	c.Assert(op.Progress, check.Equals, 100)
+	c.Assert(op.Status, check.Equals, OperationDone)
+	//a finished operation is watched once.
+	ch, _, ok := st.Watch(id)
+	c.Assert(ok, check.Equals, true)
+	c.Assert((<-ch).Status, check.Equals, OperationDone)
+	_, open := <-ch
+	c.Assert(open, check.Equals, false)
+	_, _, ok = st.Watch("OPN000")
+	c.Assert(ok, check.Equals, false)
+}
@@ -77,6 +77,14 @@ type ShellOptions struct {
 	Height int
 	Unit   string
 	Term   string
+	//the sizes the client resizes its terminal to.
+	Resize <-chan ShellSize
+}
+
+// ShellSize is the size of the terminal of a shell.
+type ShellSize struct {
+	Width  int
+	Height int
 }
 
 // GitDeployer is a provisioner that can deploy the box from a Git
@@ -111,6 +119,16 @@ type Network interface {
 	NetworkUpdate(b *Box, w io.Writer) error
 }
 
+// Resizer changes the cpu, memory and disk of a deployed box to its Resize.
+type Resizer interface {
+	Resize(b *Box, w io.Writer) error
+}
+
+// Migrator moves a deployed box to the cluster or region in its Migration.
+type Migrator interface {
+	Migrate(b *Box, w io.Writer) error
+}
+
 // Provisioner is the basic interface of this package.
 //
 // Any vertice provisioner must implement this interface in order to provision
@@ -22,7 +22,10 @@ import (
 	"github.com/megamsys/vertice/provision/rancher/container"
 	"github.com/megamsys/vertice/repository"
 	"github.com/megamsys/vertice/router"
+	_ "github.com/megamsys/vertice/router/powerdns"
+	_ "github.com/megamsys/vertice/router/rfc2136"
 	_ "github.com/megamsys/vertice/router/route53"
+	_ "github.com/megamsys/vertice/router/zonefile"
 	"github.com/megamsys/vertice/toml"
 )
 
@@ -0,0 +1,57 @@
+package dnsmsg
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"time"
+)
+
+// DefaultTimeout is how long an exchange with a server takes at most.
+const DefaultTimeout = 10 * time.Second
+
+// Exchange sends the message to the server over tcp and reads its answer.
+// A server without a port is on 53.
+func Exchange(server string, wire []byte, timeout time.Duration) (*Message, error) {
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	conn, err := net.DialTimeout("tcp", server, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	if err = WriteTCP(conn, wire); err != nil {
+		return nil, err
+	}
+	b, err := ReadTCP(conn)
+	if err != nil {
+		return nil, err
+	}
+	return Unpack(b)
+}
+
+// WriteTCP writes a message with the length before it, as on tcp.
+func WriteTCP(w io.Writer, wire []byte) error {
+	b := make([]byte, 2, 2+len(wire))
+	binary.BigEndian.PutUint16(b, uint16(len(wire)))
+	_, err := w.Write(append(b, wire...))
+	return err
+}
+
+// ReadTCP reads a message written with its length before it.
+func ReadTCP(r io.Reader) ([]byte, error) {
+	var l [2]byte
+	if _, err := io.ReadFull(r, l[:]); err != nil {
+		return nil, err
+	}
+	b := make([]byte, binary.BigEndian.Uint16(l[:]))
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
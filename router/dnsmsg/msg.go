@@ -0,0 +1,387 @@
+// Package dnsmsg reads and writes the dns messages (rfc 1035) the dns routers
+// exchange, with the update opcode (rfc 2136) and tsig signatures (rfc 2845).
+package dnsmsg
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+const (
+	TypeA     uint16 = 1
+	TypeNS    uint16 = 2
+	TypeCNAME uint16 = 5
+	TypeSOA   uint16 = 6
+	TypeTXT   uint16 = 16
+	TypeAAAA  uint16 = 28
+	TypeTSIG  uint16 = 250
+	TypeANY   uint16 = 255
+
+	ClassINET uint16 = 1
+	ClassNONE uint16 = 254
+	ClassANY  uint16 = 255
+
+	OpcodeQuery  = 0
+	OpcodeUpdate = 5
+
+	RcodeSuccess  = 0
+	RcodeFormErr  = 1
+	RcodeServFail = 2
+	RcodeNXDomain = 3
+	RcodeNotImp   = 4
+	RcodeRefused  = 5
+	RcodeNotAuth  = 9
+	RcodeNotZone  = 10
+)
+
+var rcodes = map[int]string{
+	RcodeFormErr:  "FORMERR",
+	RcodeServFail: "SERVFAIL",
+	RcodeNXDomain: "NXDOMAIN",
+	RcodeNotImp:   "NOTIMP",
+	RcodeRefused:  "REFUSED",
+	6:             "YXDOMAIN",
+	7:             "YXRRSET",
+	8:             "NXRRSET",
+	RcodeNotAuth:  "NOTAUTH",
+	RcodeNotZone:  "NOTZONE",
+}
+
+// RcodeString is the name of the rcode, eg: REFUSED.
+func RcodeString(rcode int) string {
+	if s, ok := rcodes[rcode]; ok {
+		return s
+	}
+	return fmt.Sprintf("RCODE%d", rcode)
+}
+
+var ErrShort = errors.New("dns message is too short")
+
+type Question struct {
+	Name  string
+	Type  uint16
+	Class uint16
+}
+
+// RR is a resource record, its data is kept in the wire format.
+type RR struct {
+	Name  string
+	Type  uint16
+	Class uint16
+	TTL   uint32
+	Data  []byte
+}
+
+// Message is a dns message. An update uses the sections as zone (Questions),
+// prerequisites (Answers) and updates (Authority).
+type Message struct {
+	Id                 uint16
+	Response           bool
+	Opcode             int
+	Authoritative      bool
+	Truncated          bool
+	RecursionDesired   bool
+	RecursionAvailable bool
+	Rcode              int
+	Questions          []Question
+	Answers            []RR
+	Authority          []RR
+	Additional         []RR
+}
+
+// Fqdn ends the name with a dot.
+func Fqdn(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+// A is the record of an ipv4 address, AAAA of an ipv6 one.
+func A(name string, ttl uint32, ip net.IP) RR {
+	if ip4 := ip.To4(); ip4 != nil {
+		return RR{Name: name, Type: TypeA, Class: ClassINET, TTL: ttl, Data: []byte(ip4)}
+	}
+	return RR{Name: name, Type: TypeAAAA, Class: ClassINET, TTL: ttl, Data: []byte(ip.To16())}
+}
+
+// Address is the record of the target, an ip or the name it is a cname of.
+func Address(name string, ttl uint32, target string) RR {
+	if ip := net.ParseIP(target); ip != nil {
+		return A(name, ttl, ip)
+	}
+	return CNAME(name, ttl, Fqdn(target))
+}
+
+func CNAME(name string, ttl uint32, target string) RR {
+	return RR{Name: name, Type: TypeCNAME, Class: ClassINET, TTL: ttl, Data: packName(nil, target)}
+}
+
+// TXT is a record of the texts, a text longer than 255 bytes is split.
+func TXT(name string, ttl uint32, texts ...string) RR {
+	var data []byte
+	for _, t := range texts {
+		for len(t) > 255 {
+			data = append(append(data, 255), t[:255]...)
+			t = t[255:]
+		}
+		data = append(append(data, byte(len(t))), t...)
+	}
+	return RR{Name: name, Type: TypeTXT, Class: ClassINET, TTL: ttl, Data: data}
+}
+
+// SOA is the start of authority of a zone, the times are in seconds.
+func SOA(zone string, ttl uint32, ns, mbox string, serial, refresh, retry, expire, minimum uint32) RR {
+	data := packName(packName(nil, ns), mbox)
+	for _, v := range []uint32{serial, refresh, retry, expire, minimum} {
+		data = appendUint32(data, v)
+	}
+	return RR{Name: zone, Type: TypeSOA, Class: ClassINET, TTL: ttl, Data: data}
+}
+
+func NS(zone string, ttl uint32, ns string) RR {
+	return RR{Name: zone, Type: TypeNS, Class: ClassINET, TTL: ttl, Data: packName(nil, ns)}
+}
+
+// IP is the address of an A or AAAA record, nil for the other types.
+func (rr RR) IP() net.IP {
+	switch {
+	case rr.Type == TypeA && len(rr.Data) == net.IPv4len:
+		return net.IP(rr.Data)
+	case rr.Type == TypeAAAA && len(rr.Data) == net.IPv6len:
+		return net.IP(rr.Data)
+	}
+	return nil
+}
+
+// Pack is the message in the wire format, the names aren't compressed.
+func (m *Message) Pack() ([]byte, error) {
+	b := make([]byte, 12, 512)
+	binary.BigEndian.PutUint16(b[0:], m.Id)
+	var flags uint16
+	if m.Response {
+		flags |= 1 << 15
+	}
+	flags |= uint16(m.Opcode&0xf) << 11
+	if m.Authoritative {
+		flags |= 1 << 10
+	}
+	if m.Truncated {
+		flags |= 1 << 9
+	}
+	if m.RecursionDesired {
+		flags |= 1 << 8
+	}
+	if m.RecursionAvailable {
+		flags |= 1 << 7
+	}
+	flags |= uint16(m.Rcode & 0xf)
+	binary.BigEndian.PutUint16(b[2:], flags)
+	binary.BigEndian.PutUint16(b[4:], uint16(len(m.Questions)))
+	binary.BigEndian.PutUint16(b[6:], uint16(len(m.Answers)))
+	binary.BigEndian.PutUint16(b[8:], uint16(len(m.Authority)))
+	binary.BigEndian.PutUint16(b[10:], uint16(len(m.Additional)))
+	for _, q := range m.Questions {
+		if err := checkName(q.Name); err != nil {
+			return nil, err
+		}
+		b = packName(b, q.Name)
+		b = appendUint16(appendUint16(b, q.Type), q.Class)
+	}
+	for _, sec := range [][]RR{m.Answers, m.Authority, m.Additional} {
+		for _, rr := range sec {
+			if err := checkName(rr.Name); err != nil {
+				return nil, err
+			}
+			b = rr.pack(b)
+		}
+	}
+	return b, nil
+}
+
+func (rr RR) pack(b []byte) []byte {
+	b = packName(b, rr.Name)
+	b = appendUint16(appendUint16(b, rr.Type), rr.Class)
+	b = appendUint32(b, rr.TTL)
+	b = appendUint16(b, uint16(len(rr.Data)))
+	return append(b, rr.Data...)
+}
+
+// Unpack reads a message in the wire format.
+func Unpack(b []byte) (*Message, error) {
+	if len(b) < 12 {
+		return nil, ErrShort
+	}
+	flags := binary.BigEndian.Uint16(b[2:])
+	m := &Message{
+		Id:                 binary.BigEndian.Uint16(b[0:]),
+		Response:           flags&(1<<15) != 0,
+		Opcode:             int(flags>>11) & 0xf,
+		Authoritative:      flags&(1<<10) != 0,
+		Truncated:          flags&(1<<9) != 0,
+		RecursionDesired:   flags&(1<<8) != 0,
+		RecursionAvailable: flags&(1<<7) != 0,
+		Rcode:              int(flags & 0xf),
+	}
+	qd := int(binary.BigEndian.Uint16(b[4:]))
+	counts := []int{
+		int(binary.BigEndian.Uint16(b[6:])),
+		int(binary.BigEndian.Uint16(b[8:])),
+		int(binary.BigEndian.Uint16(b[10:])),
+	}
+	off := 12
+	for i := 0; i < qd; i++ {
+		name, n, err := unpackName(b, off)
+		if err != nil {
+			return nil, err
+		}
+		if n+4 > len(b) {
+			return nil, ErrShort
+		}
+		m.Questions = append(m.Questions, Question{
+			Name:  name,
+			Type:  binary.BigEndian.Uint16(b[n:]),
+			Class: binary.BigEndian.Uint16(b[n+2:]),
+		})
+		off = n + 4
+	}
+	secs := []*[]RR{&m.Answers, &m.Authority, &m.Additional}
+	for s, count := range counts {
+		for i := 0; i < count; i++ {
+			name, n, err := unpackName(b, off)
+			if err != nil {
+				return nil, err
+			}
+			if n+10 > len(b) {
+				return nil, ErrShort
+			}
+			rr := RR{
+				Name:  name,
+				Type:  binary.BigEndian.Uint16(b[n:]),
+				Class: binary.BigEndian.Uint16(b[n+2:]),
+				TTL:   binary.BigEndian.Uint32(b[n+4:]),
+			}
+			l := int(binary.BigEndian.Uint16(b[n+8:]))
+			if n+10+l > len(b) {
+				return nil, ErrShort
+			}
+			if rr.Data, err = expandData(b, n+10, l, rr.Type); err != nil {
+				return nil, err
+			}
+			*secs[s] = append(*secs[s], rr)
+			off = n + 10 + l
+		}
+	}
+	return m, nil
+}
+
+//expandData copies the data of a record, the compressed names in it are
+//expanded so the record means the same outside of the message.
+func expandData(b []byte, off, l int, typ uint16) ([]byte, error) {
+	if l == 0 {
+		//the updates that delete a set have no data.
+		return nil, nil
+	}
+	switch typ {
+	case TypeCNAME, TypeNS:
+		name, _, err := unpackName(b, off)
+		if err != nil {
+			return nil, err
+		}
+		return packName(nil, name), nil
+	case TypeSOA:
+		ns, n, err := unpackName(b, off)
+		if err != nil {
+			return nil, err
+		}
+		mbox, n, err := unpackName(b, n)
+		if err != nil {
+			return nil, err
+		}
+		if n+20 > off+l {
+			return nil, ErrShort
+		}
+		return append(packName(packName(nil, ns), mbox), b[n:n+20]...), nil
+	}
+	return append([]byte(nil), b[off:off+l]...), nil
+}
+
+// Name reads the name at the start of the data of a record, eg: a cname. The
+// offset after it is returned.
+func Name(data []byte) (string, int, error) {
+	return unpackName(data, 0)
+}
+
+func checkName(name string) error {
+	if len(name) > 254 {
+		return fmt.Errorf("dns name %s is too long", name)
+	}
+	for _, l := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if len(l) > 63 || (l == "" && name != ".") {
+			return fmt.Errorf("dns name %q has an invalid label", name)
+		}
+	}
+	return nil
+}
+
+//packName writes the name as labels, the name is taken as fully qualified.
+func packName(b []byte, name string) []byte {
+	name = strings.TrimSuffix(name, ".")
+	if name != "" {
+		for _, l := range strings.Split(name, ".") {
+			b = append(append(b, byte(len(l))), l...)
+		}
+	}
+	return append(b, 0)
+}
+
+//unpackName reads the name at off, following the compression pointers. The
+//offset after the name where it started is returned.
+func unpackName(b []byte, off int) (string, int, error) {
+	var labels []string
+	end, jumps := -1, 0
+	for {
+		if off >= len(b) {
+			return "", 0, ErrShort
+		}
+		c := int(b[off])
+		switch c & 0xc0 {
+		case 0x00:
+			if c == 0 {
+				if end < 0 {
+					end = off + 1
+				}
+				return strings.Join(labels, ".") + ".", end, nil
+			}
+			if off+1+c > len(b) {
+				return "", 0, ErrShort
+			}
+			labels = append(labels, string(b[off+1:off+1+c]))
+			off += 1 + c
+		case 0xc0:
+			if off+1 >= len(b) {
+				return "", 0, ErrShort
+			}
+			if jumps++; jumps > 32 {
+				return "", 0, errors.New("dns name has a compression loop")
+			}
+			if end < 0 {
+				end = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(b[off:]) & 0x3fff)
+		default:
+			return "", 0, fmt.Errorf("dns name has an unknown label type %#x", c)
+		}
+	}
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
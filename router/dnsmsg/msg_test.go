@@ -0,0 +1,146 @@
+package dnsmsg
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestPackUnpack(c *check.C) {
+	m := &Message{
+		Id:        4242,
+		Opcode:    OpcodeUpdate,
+		Questions: []Question{{Name: "megambox.com.", Type: TypeSOA, Class: ClassINET}},
+		Authority: []RR{
+			{Name: "myapp.megambox.com.", Type: TypeCNAME, Class: ClassANY},
+			A("myapp.megambox.com.", 300, net.ParseIP("192.168.1.10")),
+			A("myapp.megambox.com.", 300, net.ParseIP("2001:db8::1")),
+			CNAME("www.megambox.com.", 60, "myapp.megambox.com."),
+			TXT("myapp.megambox.com.", 60, "assembly=ASM001"),
+		},
+	}
+	wire, err := m.Pack()
+	c.Assert(err, check.IsNil)
+	got, err := Unpack(wire)
+	c.Assert(err, check.IsNil)
+	c.Assert(got, check.DeepEquals, m)
+	c.Assert(got.Authority[1].IP().String(), check.Equals, "192.168.1.10")
+	c.Assert(got.Authority[2].Type, check.Equals, TypeAAAA)
+	c.Assert(got.Authority[2].IP().String(), check.Equals, "2001:db8::1")
+	target, _, err := Name(got.Authority[3].Data)
+	c.Assert(err, check.IsNil)
+	c.Assert(target, check.Equals, "myapp.megambox.com.")
+}
+
+func (s *S) TestUnpackCompressed(c *check.C) {
+	//an answer to myapp.megambox.com CNAME, the names point at the question.
+	wire := []byte{0, 1, 0x81, 0x80, 0, 1, 0, 1, 0, 0, 0, 0}
+	wire = packName(wire, "myapp.megambox.com.")
+	wire = appendUint16(appendUint16(wire, TypeCNAME), ClassINET)
+	wire = append(wire, 0xc0, 12)
+	wire = appendUint16(appendUint16(wire, TypeCNAME), ClassINET)
+	wire = appendUint32(wire, 60)
+	wire = appendUint16(wire, 6)
+	wire = append(wire, 3, 'w', 'e', 'b', 0xc0, 18)
+	m, err := Unpack(wire)
+	c.Assert(err, check.IsNil)
+	c.Assert(m.Response, check.Equals, true)
+	c.Assert(m.RecursionDesired, check.Equals, true)
+	c.Assert(m.Answers, check.HasLen, 1)
+	c.Assert(m.Answers[0].Name, check.Equals, "myapp.megambox.com.")
+	target, _, err := Name(m.Answers[0].Data)
+	c.Assert(err, check.IsNil)
+	c.Assert(target, check.Equals, "web.megambox.com.")
+}
+
+func (s *S) TestUnpackLoop(c *check.C) {
+	wire := []byte{0, 1, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0xc0, 12, 0, 1, 0, 1}
+	_, err := Unpack(wire)
+	c.Assert(err, check.ErrorMatches, ".*compression loop")
+	_, err = Unpack(wire[:6])
+	c.Assert(err, check.Equals, ErrShort)
+}
+
+func (s *S) TestPackInvalidName(c *check.C) {
+	m := &Message{Questions: []Question{{Name: "my..app.", Type: TypeA, Class: ClassINET}}}
+	_, err := m.Pack()
+	c.Assert(err, check.NotNil)
+}
+
+func (s *S) TestTSIGSign(c *check.C) {
+	secret := []byte("vertice-secret")
+	key := TSIG{Name: "Vertice", Secret: base64.StdEncoding.EncodeToString(secret)}
+	m := &Message{
+		Id:        7,
+		Opcode:    OpcodeUpdate,
+		Questions: []Question{{Name: "megambox.com.", Type: TypeSOA, Class: ClassINET}},
+		Authority: []RR{A("myapp.megambox.com.", 300, net.ParseIP("10.0.0.1"))},
+	}
+	now := time.Unix(1500000000, 0)
+	wire, err := key.Sign(m, now)
+	c.Assert(err, check.IsNil)
+	got, err := Unpack(wire)
+	c.Assert(err, check.IsNil)
+	c.Assert(got.Additional, check.HasLen, 1)
+	rr := got.Additional[0]
+	c.Assert(rr.Name, check.Equals, "vertice.")
+	c.Assert(rr.Type, check.Equals, TypeTSIG)
+	c.Assert(rr.Class, check.Equals, ClassANY)
+	alg, n, err := Name(rr.Data)
+	c.Assert(err, check.IsNil)
+	c.Assert(alg, check.Equals, HmacSHA256)
+	c.Assert(rr.Data[n+5], check.Equals, byte(1500000000&0xff))
+
+	//the mac is of the message without the tsig and of the variables of rfc 2845.
+	unsigned, err := m.Pack()
+	c.Assert(err, check.IsNil)
+	vars := appendUint32(appendUint16(packName(nil, "vertice."), ClassANY), 0)
+	vars = packName(vars, HmacSHA256)
+	vars = append(vars, rr.Data[n:n+8]...)
+	vars = append(vars, 0, 0, 0, 0)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(unsigned)
+	mac.Write(vars)
+	l := int(rr.Data[n+8])<<8 | int(rr.Data[n+9])
+	c.Assert(bytes.Equal(rr.Data[n+10:n+10+l], mac.Sum(nil)), check.Equals, true)
+
+	_, err = TSIG{Name: "vertice", Algorithm: "hmac-gost", Secret: key.Secret}.Sign(m, now)
+	c.Assert(err, check.ErrorMatches, ".*isn't supported")
+}
+
+func (s *S) TestExchange(c *check.C) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, check.IsNil)
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		b, err := ReadTCP(conn)
+		if err != nil {
+			return
+		}
+		m, err := Unpack(b)
+		if err != nil {
+			return
+		}
+		m.Response = true
+		m.Answers = []RR{A(m.Questions[0].Name, 60, net.ParseIP("10.0.0.9"))}
+		wire, _ := m.Pack()
+		WriteTCP(conn, wire)
+	}()
+	q := &Message{Id: 9, Questions: []Question{{Name: "myapp.megambox.com.", Type: TypeA, Class: ClassINET}}}
+	wire, err := q.Pack()
+	c.Assert(err, check.IsNil)
+	res, err := Exchange(l.Addr().String(), wire, time.Second)
+	c.Assert(err, check.IsNil)
+	c.Assert(res.Id, check.Equals, uint16(9))
+	c.Assert(res.Answers[0].IP().String(), check.Equals, "10.0.0.9")
+}
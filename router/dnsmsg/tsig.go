@@ -0,0 +1,102 @@
+package dnsmsg
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"strings"
+	"time"
+)
+
+const (
+	HmacMD5    = "hmac-md5.sig-alg.reg.int."
+	HmacSHA1   = "hmac-sha1."
+	HmacSHA256 = "hmac-sha256."
+	HmacSHA512 = "hmac-sha512."
+
+	// DefaultFudge is the clock skew the server allows, in seconds.
+	DefaultFudge = 300
+)
+
+var algorithms = map[string]func() hash.Hash{
+	HmacMD5:    md5.New,
+	HmacSHA1:   sha1.New,
+	HmacSHA256: sha256.New,
+	HmacSHA512: sha512.New,
+}
+
+// TSIG is a key shared with a dns server, the secret is in base64 as bind
+// and tsig-keygen print it.
+type TSIG struct {
+	Name      string
+	Algorithm string
+	Secret    string
+}
+
+func (t TSIG) algorithm() (string, func() hash.Hash, error) {
+	alg := HmacSHA256
+	if t.Algorithm != "" {
+		alg = Fqdn(strings.ToLower(t.Algorithm))
+	}
+	if alg == "hmac-md5." {
+		alg = HmacMD5
+	}
+	h, ok := algorithms[alg]
+	if !ok {
+		return "", nil, fmt.Errorf("tsig algorithm %s isn't supported", t.Algorithm)
+	}
+	return alg, h, nil
+}
+
+// Sign packs the message with a tsig record of the key at now.
+func (t TSIG) Sign(m *Message, now time.Time) ([]byte, error) {
+	alg, h, err := t.algorithm()
+	if err != nil {
+		return nil, err
+	}
+	secret, err := base64.StdEncoding.DecodeString(t.Secret)
+	if err != nil {
+		return nil, fmt.Errorf("tsig secret of %s : %s", t.Name, err)
+	}
+	wire, err := m.Pack()
+	if err != nil {
+		return nil, err
+	}
+	name := Fqdn(strings.ToLower(t.Name))
+	signed := uint64(now.Unix())
+	timers := []byte{byte(signed >> 40), byte(signed >> 32), byte(signed >> 24), byte(signed >> 16), byte(signed >> 8), byte(signed)}
+	timers = appendUint16(timers, DefaultFudge)
+
+	//the variables of rfc 2845 4.3: the name, class and ttl of the record, the
+	//algorithm, the times, the error and no other data.
+	vars := packName(nil, name)
+	vars = appendUint16(vars, ClassANY)
+	vars = appendUint32(vars, 0)
+	vars = packName(vars, alg)
+	vars = append(vars, timers...)
+	vars = appendUint16(appendUint16(vars, 0), 0)
+
+	mac := hmac.New(h, secret)
+	mac.Write(wire)
+	mac.Write(vars)
+	sum := mac.Sum(nil)
+
+	data := packName(nil, alg)
+	data = append(data, timers...)
+	data = appendUint16(data, uint16(len(sum)))
+	data = append(data, sum...)
+	data = appendUint16(data, m.Id)
+	data = appendUint16(appendUint16(data, 0), 0)
+	rr := RR{Name: name, Type: TypeTSIG, Class: ClassANY, Data: data}
+
+	wire = rr.pack(wire)
+	arcount := uint16(wire[10])<<8 | uint16(wire[11])
+	arcount++
+	wire[10], wire[11] = byte(arcount>>8), byte(arcount)
+	return wire, nil
+}
@@ -0,0 +1,271 @@
+// Package powerdns sets the records of the assemblies with the http api of a
+// powerdns authoritative server.
+package powerdns
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/megamsys/vertice/router"
+	"github.com/megamsys/vertice/subd/dns"
+)
+
+const (
+	routerName = "powerdns"
+
+	// DefaultServerId is the server of the api, powerdns has only localhost.
+	DefaultServerId = "localhost"
+)
+
+func init() {
+	router.Register(routerName, createRouter)
+}
+
+type powerdnsRouter struct {
+	name   string
+	region *dns.Region
+	client *http.Client
+}
+
+type record struct {
+	Content  string `json:"content"`
+	Disabled bool   `json:"disabled"`
+}
+
+type rrset struct {
+	Name       string   `json:"name"`
+	Type       string   `json:"type"`
+	TTL        uint32   `json:"ttl,omitempty"`
+	ChangeType string   `json:"changetype,omitempty"`
+	Records    []record `json:"records"`
+}
+
+type zone struct {
+	Name   string  `json:"name"`
+	RRsets []rrset `json:"rrsets"`
+}
+
+func createRouter(name string) (router.Router, error) {
+	region, err := dns.R53.RegionOf(name)
+	if err != nil {
+		return nil, err
+	}
+	r, err := newRouter(name, region, 30*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("%s ready", name)
+	return r, nil
+}
+
+func newRouter(name string, region *dns.Region, timeout time.Duration) (*powerdnsRouter, error) {
+	if region.ApiUrl == "" {
+		return nil, fmt.Errorf("router %s has no api_url", name)
+	}
+	return &powerdnsRouter{name: name, region: region, client: &http.Client{Timeout: timeout}}, nil
+}
+
+// HealthCheck reads the zone of the region with the api key, or the server
+// of the api when the region has no zone, so a wrong key is down too.
+func HealthCheck(region dns.Region, timeout time.Duration) func() error {
+	return func() error {
+		r, err := newRouter(routerName+":"+region.Region, &region, timeout)
+		if err != nil {
+			return err
+		}
+		url := r.serverUrl()
+		if region.Zone != "" {
+			url += "/zones/" + fqdn(region.Zone)
+		}
+		if _, err = r.do("GET", url, nil); err == router.ErrDomainNotFound {
+			return fmt.Errorf("%s : %s", url, err)
+		}
+		return err
+	}
+}
+
+func (r *powerdnsRouter) String() string {
+	return "PowerDNS:(" + r.region.ApiUrl + ")"
+}
+
+//typeOf is the type of the record of the address, an ip or a name.
+func typeOf(addr string) (string, string) {
+	ip := net.ParseIP(addr)
+	switch {
+	case ip == nil:
+		return "CNAME", fqdn(addr)
+	case ip.To4() != nil:
+		return "A", ip.String()
+	}
+	return "AAAA", ip.String()
+}
+
+func fqdn(name string) string {
+	return strings.TrimSuffix(name, ".") + "."
+}
+
+//SetCName replaces the records of cname by the address, an ip or a name.
+func (r *powerdnsRouter) SetCName(cname, addr string) error {
+	if len(strings.TrimSpace(cname)) <= 0 || len(strings.TrimSpace(addr)) <= 0 {
+		return router.ErrCNameMissingArgs
+	}
+	name := fqdn(cname)
+	t, content := typeOf(addr)
+	//a cname is alone at its name, an address replaces the cname and the other way round.
+	sets := []rrset{{Name: name, Type: "CNAME", ChangeType: "DELETE", Records: []record{}}}
+	if t == "CNAME" {
+		sets = []rrset{
+			{Name: name, Type: "A", ChangeType: "DELETE", Records: []record{}},
+			{Name: name, Type: "AAAA", ChangeType: "DELETE", Records: []record{}},
+		}
+	}
+	sets = append(sets, rrset{Name: name, Type: t, TTL: r.region.RecordTTL(), ChangeType: "REPLACE", Records: []record{{Content: content}}})
+	log.Debugf("  %s (%s, %s)", r.name, cname, addr)
+	return r.patch(cname, sets)
+}
+
+//UnsetCName removes the record of the ip of cname, its addresses and cname
+//when no ip is given.
+func (r *powerdnsRouter) UnsetCName(cname, addr string) error {
+	if len(strings.TrimSpace(cname)) <= 0 {
+		return router.ErrCNameMissingArgs
+	}
+	name := fqdn(cname)
+	log.Debugf("  %s delete (%s, %s)", r.name, cname, addr)
+	if ip := net.ParseIP(addr); ip != nil {
+		t, content := typeOf(addr)
+		z, err := r.zone(cname)
+		if err != nil {
+			return err
+		}
+		for _, set := range z.RRsets {
+			if !strings.EqualFold(set.Name, name) || set.Type != t {
+				continue
+			}
+			kept := make([]record, 0, len(set.Records))
+			for _, rec := range set.Records {
+				if rec.Content != content {
+					kept = append(kept, rec)
+				}
+			}
+			set.ChangeType = "REPLACE"
+			if len(kept) == 0 {
+				set.ChangeType = "DELETE"
+			}
+			set.Records = kept
+			return r.patch(cname, []rrset{set})
+		}
+		return nil
+	}
+	sets := make([]rrset, 0, 3)
+	for _, t := range []string{"A", "AAAA", "CNAME"} {
+		sets = append(sets, rrset{Name: name, Type: t, ChangeType: "DELETE", Records: []record{}})
+	}
+	return r.patch(cname, sets)
+}
+
+//Addr is the address of cname in the zone, its ip or the name it is a cname of.
+func (r *powerdnsRouter) Addr(cname string) (string, error) {
+	z, err := r.zone(cname)
+	if err != nil {
+		return "", err
+	}
+	name := fqdn(cname)
+	for _, set := range z.RRsets {
+		if !strings.EqualFold(set.Name, name) || len(set.Records) == 0 {
+			continue
+		}
+		switch set.Type {
+		case "A", "AAAA", "CNAME":
+			return strings.TrimSuffix(set.Records[0].Content, "."), nil
+		}
+	}
+	return "", router.ErrCNameNotFound
+}
+
+func (r *powerdnsRouter) StartupMessage() (string, error) {
+	return r.name + " router ok!", nil
+}
+
+func (r *powerdnsRouter) zoneUrl(cname string) (string, error) {
+	z, err := router.Zone(r.region.Zone, cname)
+	if err != nil {
+		return "", router.ErrInvalidCName
+	}
+	return r.serverUrl() + "/zones/" + z, nil
+}
+
+func (r *powerdnsRouter) serverUrl() string {
+	id := r.region.ServerId
+	if id == "" {
+		id = DefaultServerId
+	}
+	return fmt.Sprintf("%s/api/v1/servers/%s", strings.TrimRight(r.region.ApiUrl, "/"), id)
+}
+
+func (r *powerdnsRouter) zone(cname string) (*zone, error) {
+	url, err := r.zoneUrl(cname)
+	if err != nil {
+		return nil, err
+	}
+	body, err := r.do("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	z := &zone{}
+	if err = json.Unmarshal(body, z); err != nil {
+		return nil, fmt.Errorf("%s : %s", url, err)
+	}
+	return z, nil
+}
+
+func (r *powerdnsRouter) patch(cname string, sets []rrset) error {
+	url, err := r.zoneUrl(cname)
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(map[string][]rrset{"rrsets": sets})
+	if err != nil {
+		return err
+	}
+	_, err = r.do("PATCH", url, body)
+	return err
+}
+
+func (r *powerdnsRouter) do(method, url string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-API-Key", r.region.ApiKey)
+	req.Header.Set("Content-Type", "application/json")
+	res, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return nil, router.ErrDomainNotFound
+	case res.StatusCode >= http.StatusBadRequest:
+		var e struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &e) == nil && e.Error != "" {
+			return nil, fmt.Errorf("%s %s : %s", method, url, e.Error)
+		}
+		return nil, fmt.Errorf("%s %s : %s", method, url, res.Status)
+	}
+	return data, nil
+}
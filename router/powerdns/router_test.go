@@ -0,0 +1,125 @@
+package powerdns
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/megamsys/vertice/router"
+	"github.com/megamsys/vertice/subd/dns"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+type S struct {
+	server  *httptest.Server
+	patches [][]rrset
+	zone    zone
+}
+
+var _ = check.Suite(&S{})
+
+func (s *S) SetUpTest(c *check.C) {
+	s.patches = nil
+	s.zone = zone{Name: "megambox.com.", RRsets: []rrset{
+		{Name: "myapp.megambox.com.", Type: "A", TTL: 300, Records: []record{{Content: "192.168.1.10"}, {Content: "192.168.1.11"}}},
+		{Name: "web.megambox.com.", Type: "CNAME", TTL: 300, Records: []record{{Content: "myapp.megambox.com."}}},
+	}}
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-API-Key") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"Unauthorized"}`))
+			return
+		}
+		if r.URL.Path != "/api/v1/servers/localhost/zones/megambox.com." {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		switch r.Method {
+		case "GET":
+			json.NewEncoder(w).Encode(s.zone)
+		case "PATCH":
+			body, _ := ioutil.ReadAll(r.Body)
+			var p struct {
+				RRsets []rrset `json:"rrsets"`
+			}
+			c.Check(json.Unmarshal(body, &p), check.IsNil)
+			s.patches = append(s.patches, p.RRsets)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	cf := dns.NewConfig()
+	cf.Regions = []dns.Region{{Region: "chennai", Router: routerName, ApiUrl: s.server.URL + "/", ApiKey: "secret"}}
+	cf.MkGlobal()
+}
+
+func (s *S) TearDownTest(c *check.C) {
+	s.server.Close()
+}
+
+func (s *S) router(c *check.C) *powerdnsRouter {
+	got, err := router.Get("powerdns:chennai")
+	c.Assert(err, check.IsNil)
+	return got.(*powerdnsRouter)
+}
+
+func (s *S) TestSetCName(c *check.C) {
+	r := s.router(c)
+	c.Assert(r.SetCName("myapp.megambox.com", "192.168.1.12"), check.IsNil)
+	c.Assert(r.SetCName("web.megambox.com", "myapp.megambox.com"), check.IsNil)
+	c.Assert(s.patches, check.DeepEquals, [][]rrset{
+		{
+			{Name: "myapp.megambox.com.", Type: "CNAME", ChangeType: "DELETE", Records: []record{}},
+			{Name: "myapp.megambox.com.", Type: "A", TTL: 300, ChangeType: "REPLACE", Records: []record{{Content: "192.168.1.12"}}},
+		},
+		{
+			{Name: "web.megambox.com.", Type: "A", ChangeType: "DELETE", Records: []record{}},
+			{Name: "web.megambox.com.", Type: "AAAA", ChangeType: "DELETE", Records: []record{}},
+			{Name: "web.megambox.com.", Type: "CNAME", TTL: 300, ChangeType: "REPLACE", Records: []record{{Content: "myapp.megambox.com."}}},
+		},
+	})
+}
+
+func (s *S) TestUnsetCName(c *check.C) {
+	r := s.router(c)
+	c.Assert(r.UnsetCName("myapp.megambox.com", "192.168.1.10"), check.IsNil)
+	c.Assert(r.UnsetCName("web.megambox.com", ""), check.IsNil)
+	c.Assert(s.patches, check.HasLen, 2)
+	c.Assert(s.patches[0], check.DeepEquals, []rrset{
+		{Name: "myapp.megambox.com.", Type: "A", TTL: 300, ChangeType: "REPLACE", Records: []record{{Content: "192.168.1.11"}}},
+	})
+	c.Assert(s.patches[1], check.HasLen, 3)
+	c.Assert(s.patches[1][2].Type, check.Equals, "CNAME")
+	c.Assert(s.patches[1][2].ChangeType, check.Equals, "DELETE")
+}
+
+func (s *S) TestAddr(c *check.C) {
+	r := s.router(c)
+	addr, err := r.Addr("web.megambox.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(addr, check.Equals, "myapp.megambox.com")
+	_, err = r.Addr("db.megambox.com")
+	c.Assert(err, check.Equals, router.ErrCNameNotFound)
+	_, err = r.Addr("db.megam.io")
+	c.Assert(err, check.Equals, router.ErrDomainNotFound)
+}
+
+func (s *S) TestApiError(c *check.C) {
+	dns.R53.Regions[0].ApiKey = "wrong"
+	err := s.router(c).SetCName("myapp.megambox.com", "192.168.1.12")
+	c.Assert(err, check.ErrorMatches, "PATCH .* : Unauthorized")
+}
+
+func (s *S) TestHealthCheck(c *check.C) {
+	region := dns.R53.Regions[0]
+	region.Zone = "megambox.com"
+	c.Assert(HealthCheck(region, time.Second)(), check.IsNil)
+	region.Zone = "megam.io"
+	c.Assert(HealthCheck(region, time.Second)(), check.ErrorMatches, ".*/zones/megam.io. : Domain not found")
+	region.Zone, region.ApiKey = "megambox.com", "wrong"
+	c.Assert(HealthCheck(region, time.Second)(), check.ErrorMatches, "GET .* : Unauthorized")
+}
@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrNoCertificate = errors.New("no certificate for the host")
+
+// Certs are the certificates the proxy terminates tls with. The certificate
+// of a host is in dir as <host>.crt and <host>.key, a wildcard one as
+// _.<domain>.crt and _.<domain>.key, the default one is used for the other
+// hosts. A certificate replaced on disk is read again on the next handshake.
+type Certs struct {
+	dir         string
+	defaultCert string
+	defaultKey  string
+
+	mu    sync.Mutex
+	cache map[string]*cert
+}
+
+type cert struct {
+	modTime time.Time
+	tls     *tls.Certificate
+}
+
+// NewCerts returns the certificates in dir, with the default certificate
+// and key; any of them may be empty.
+func NewCerts(dir, certFile, keyFile string) *Certs {
+	return &Certs{dir: dir, defaultCert: certFile, defaultKey: keyFile, cache: make(map[string]*cert)}
+}
+
+// GetCertificate is the certificate of the server name of the handshake,
+// for tls.Config.
+func (c *Certs) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	name := host(hello.ServerName)
+	var files [][2]string
+	if c.dir != "" && name != "" && !strings.ContainsAny(name, `/\`) {
+		files = append(files, [2]string{filepath.Join(c.dir, name+".crt"), filepath.Join(c.dir, name+".key")})
+		if i := strings.Index(name, "."); i > 0 {
+			wild := "_" + name[i:]
+			files = append(files, [2]string{filepath.Join(c.dir, wild+".crt"), filepath.Join(c.dir, wild+".key")})
+		}
+	}
+	if c.defaultCert != "" {
+		files = append(files, [2]string{c.defaultCert, c.defaultKey})
+	}
+	for _, f := range files {
+		crt, err := c.load(f[0], f[1])
+		if os.IsNotExist(err) {
+			continue
+		}
+		return crt, err
+	}
+	return nil, ErrNoCertificate
+}
+
+//load reads the certificate unless it didn't change since it was read.
+func (c *Certs) load(certFile, keyFile string) (*tls.Certificate, error) {
+	ci, err := os.Stat(certFile)
+	if err != nil {
+		return nil, err
+	}
+	ki, err := os.Stat(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	modTime := ci.ModTime()
+	if ki.ModTime().After(modTime) {
+		modTime = ki.ModTime()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cached, ok := c.cache[certFile]; ok && cached.modTime.Equal(modTime) {
+		return cached.tls, nil
+	}
+	crt, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	c.cache[certFile] = &cert{modTime: modTime, tls: &crt}
+	return &crt, nil
+}
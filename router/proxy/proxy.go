@@ -0,0 +1,101 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+type backendKey struct{}
+
+// Proxy proxies the requests to a backend of their host.
+type Proxy struct {
+	table *Table
+	rp    *httputil.ReverseProxy
+}
+
+// NewProxy returns the proxy of the hosts in the table.
+func NewProxy(t *Table) *Proxy {
+	p := &Proxy{table: t}
+	p.rp = &httputil.ReverseProxy{
+		Director: p.direct,
+		Transport: &transport{
+			table: t,
+			base: &http.Transport{
+				DialContext: (&net.Dialer{
+					Timeout:   10 * time.Second,
+					KeepAlive: 30 * time.Second,
+				}).DialContext,
+				MaxIdleConnsPerHost:   16,
+				IdleConnTimeout:       90 * time.Second,
+				ResponseHeaderTimeout: 5 * time.Minute,
+			},
+		},
+		FlushInterval: 100 * time.Millisecond,
+	}
+	return p
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b, err := p.table.Pick(r.Host)
+	switch err {
+	case nil:
+	case ErrNoRoute:
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	default:
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	p.rp.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), backendKey{}, b)))
+}
+
+//direct sends the request to the backend picked for it.
+func (p *Proxy) direct(r *http.Request) {
+	b := r.Context().Value(backendKey{}).(*Backend)
+	r.URL.Scheme = "http"
+	r.URL.Host = b.Addr
+	r.Header.Set("X-Forwarded-Host", r.Host)
+	if r.TLS != nil {
+		r.Header.Set("X-Forwarded-Proto", "https")
+	} else {
+		r.Header.Set("X-Forwarded-Proto", "http")
+	}
+}
+
+//transport marks the backends that can't be reached as failed. A request
+//without a body is sent once more to another backend.
+type transport struct {
+	table *Table
+	base  http.RoundTripper
+}
+
+func (t *transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	res, err := t.base.RoundTrip(r)
+	if err == nil {
+		return res, nil
+	}
+	b := r.Context().Value(backendKey{}).(*Backend)
+	log.Warnf("proxy %s to %s : %s", r.Host, b.Addr, err)
+	t.table.Failed(b)
+	if r.Body != nil {
+		return nil, err
+	}
+	next, perr := t.table.Pick(r.Host)
+	if perr != nil || next == b {
+		return nil, err
+	}
+	retry := r.WithContext(context.WithValue(r.Context(), backendKey{}, next))
+	u := *r.URL
+	u.Host = next.Addr
+	retry.URL = &u
+	res, err = t.base.RoundTrip(retry)
+	if err != nil {
+		t.table.Failed(next)
+	}
+	return res, err
+}
@@ -0,0 +1,123 @@
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+func backend(name string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(name + " " + r.Host + " " + r.Header.Get("X-Forwarded-Host") + " " + r.URL.Path))
+	}))
+}
+
+func get(c *check.C, p http.Handler, host string) (int, string) {
+	req := httptest.NewRequest("GET", "http://"+host+"/index.html", nil)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+	return w.Code, w.Body.String()
+}
+
+func (s *S) TestProxyBalances(c *check.C) {
+	a, b := backend("a"), backend("b")
+	defer a.Close()
+	defer b.Close()
+	t := NewTable("")
+	c.Assert(t.Add("myapp.megambox.com", strings.TrimPrefix(a.URL, "http://")), check.IsNil)
+	c.Assert(t.Add("myapp.megambox.com", strings.TrimPrefix(b.URL, "http://")), check.IsNil)
+	p := NewProxy(t)
+	seen := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		code, body := get(c, p, "myapp.megambox.com")
+		c.Assert(code, check.Equals, http.StatusOK)
+		c.Assert(strings.HasSuffix(body, " myapp.megambox.com myapp.megambox.com /index.html"), check.Equals, true)
+		seen[body[:1]] = true
+	}
+	c.Assert(seen, check.DeepEquals, map[string]bool{"a": true, "b": true})
+
+	code, _ := get(c, p, "other.megambox.com")
+	c.Assert(code, check.Equals, http.StatusNotFound)
+}
+
+func (s *S) TestProxyRetriesAnotherBackend(c *check.C) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, check.IsNil)
+	dead := l.Addr().String()
+	l.Close()
+	a := backend("a")
+	defer a.Close()
+	t := NewTable("")
+	c.Assert(t.Add("myapp.megambox.com", dead), check.IsNil)
+	c.Assert(t.Add("myapp.megambox.com", strings.TrimPrefix(a.URL, "http://")), check.IsNil)
+	p := NewProxy(t)
+	for i := 0; i < 3; i++ {
+		code, body := get(c, p, "myapp.megambox.com")
+		c.Assert(code, check.Equals, http.StatusOK)
+		c.Assert(body[:1], check.Equals, "a")
+	}
+	a.Close()
+	code, _ := get(c, p, "myapp.megambox.com")
+	c.Assert(code, check.Equals, http.StatusBadGateway)
+	code, _ = get(c, p, "myapp.megambox.com")
+	c.Assert(code, check.Equals, http.StatusServiceUnavailable)
+}
+
+func writeCert(c *check.C, dir, name string, hosts ...string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, check.IsNil)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: hosts[0]},
+		DNSNames:     hosts,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	c.Assert(err, check.IsNil)
+	kder, err := x509.MarshalECPrivateKey(key)
+	c.Assert(err, check.IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, name+".crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644), check.IsNil)
+	c.Assert(ioutil.WriteFile(filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: kder}), 0600), check.IsNil)
+}
+
+func commonName(c *check.C, crt *tls.Certificate) string {
+	x, err := x509.ParseCertificate(crt.Certificate[0])
+	c.Assert(err, check.IsNil)
+	return x.Subject.CommonName
+}
+
+func (s *S) TestCerts(c *check.C) {
+	writeCert(c, s.dir, "myapp.megambox.com", "myapp.megambox.com")
+	writeCert(c, s.dir, "_.megambox.com", "*.megambox.com")
+	writeCert(c, s.dir, "default", "vertice")
+	certs := NewCerts(s.dir, filepath.Join(s.dir, "default.crt"), filepath.Join(s.dir, "default.key"))
+	for host, cn := range map[string]string{
+		"myapp.megambox.com": "myapp.megambox.com",
+		"web.megambox.com":   "*.megambox.com",
+		"example.com":        "vertice",
+		"":                   "vertice",
+	} {
+		crt, err := certs.GetCertificate(&tls.ClientHelloInfo{ServerName: host})
+		c.Assert(err, check.IsNil)
+		c.Assert(commonName(c, crt), check.Equals, cn)
+	}
+
+	none := NewCerts(s.dir, "", "")
+	_, err := none.GetCertificate(&tls.ClientHelloInfo{ServerName: "example.com"})
+	c.Assert(err, check.Equals, ErrNoCertificate)
+}
@@ -0,0 +1,94 @@
+// Package proxy is a http router: the requests to the hosts (cnames) of the
+// assemblies are proxied to their containers, so the containers share the
+// public address of the proxy.
+package proxy
+
+import (
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/megamsys/vertice/router"
+)
+
+const routerName = "proxy"
+
+func init() {
+	router.Register(routerName, createRouter)
+}
+
+type proxyRouter struct {
+	name  string
+	table *Table
+}
+
+func createRouter(name string) (router.Router, error) {
+	return &proxyRouter{name: name, table: Routes}, nil
+}
+
+func (r *proxyRouter) String() string {
+	return "Proxy:(" + r.table.PublicAddress + ")"
+}
+
+// SetCName routes the cname to the container at addr too, the requests are
+// balanced over the containers of a cname.
+func (r *proxyRouter) SetCName(cname, addr string) error {
+	if len(strings.TrimSpace(cname)) <= 0 || len(strings.TrimSpace(addr)) <= 0 {
+		return router.ErrCNameMissingArgs
+	}
+	first := len(r.table.Backends(cname)) == 0
+	if err := r.table.Add(cname, addr); err != nil {
+		return err
+	}
+	log.Debugf("  %s (%s, %s)", r.name, cname, addr)
+	if first {
+		return r.record(cname, true)
+	}
+	return nil
+}
+
+// UnsetCName stops routing the cname to the container at addr, to all of
+// its containers when addr is empty.
+func (r *proxyRouter) UnsetCName(cname, addr string) error {
+	if len(strings.TrimSpace(cname)) <= 0 {
+		return router.ErrCNameMissingArgs
+	}
+	if err := r.table.Remove(cname, addr); err != nil {
+		if err == ErrNoRoute {
+			return router.ErrCNameNotFound
+		}
+		return err
+	}
+	log.Debugf("  %s delete (%s, %s)", r.name, cname, addr)
+	if len(r.table.Backends(cname)) == 0 {
+		return r.record(cname, false)
+	}
+	return nil
+}
+
+// Addr is the first container of the cname.
+func (r *proxyRouter) Addr(cname string) (string, error) {
+	backends := r.table.Backends(cname)
+	if len(backends) == 0 {
+		return "", router.ErrCNameNotFound
+	}
+	return backends[0], nil
+}
+
+func (r *proxyRouter) StartupMessage() (string, error) {
+	return r.name + " router ok!", nil
+}
+
+//record points the cname at the proxy with the dns router, when one is set.
+func (r *proxyRouter) record(cname string, set bool) error {
+	if r.table.DNSRouter == "" || r.table.PublicAddress == "" {
+		return nil
+	}
+	dr, err := router.Get(r.table.DNSRouter)
+	if err != nil {
+		return err
+	}
+	if set {
+		return dr.SetCName(cname, r.table.PublicAddress)
+	}
+	return dr.UnsetCName(cname, r.table.PublicAddress)
+}
@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/megamsys/vertice/router"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+type S struct {
+	dir string
+}
+
+var _ = check.Suite(&S{})
+
+func (s *S) SetUpTest(c *check.C) {
+	s.dir = c.MkDir()
+	Routes = NewTable(filepath.Join(s.dir, "routes.json"))
+	records = make(map[string]string)
+}
+
+//records are the cnames set by the fake dns router.
+var records map[string]string
+
+type fakeDNS struct{}
+
+func (fakeDNS) SetCName(cname, addr string) error {
+	records[cname] = addr
+	return nil
+}
+
+func (fakeDNS) UnsetCName(cname, addr string) error {
+	delete(records, cname)
+	return nil
+}
+
+func (fakeDNS) Addr(cname string) (string, error) { return records[cname], nil }
+
+func (fakeDNS) StartupMessage() (string, error) { return "", nil }
+
+func init() {
+	router.Register("fakedns", func(name string) (router.Router, error) { return fakeDNS{}, nil })
+}
+
+func (s *S) TestSetAndUnsetCName(c *check.C) {
+	Routes.DNSRouter = "fakedns"
+	Routes.PublicAddress = "203.0.113.10"
+	r, err := router.Get("proxy:chennai")
+	c.Assert(err, check.IsNil)
+	c.Assert(r.SetCName("myapp.megambox.com", "172.17.0.2"), check.IsNil)
+	c.Assert(r.SetCName("myapp.megambox.com", "172.17.0.3:8080"), check.IsNil)
+	c.Assert(Routes.Backends("MyApp.megambox.com."), check.DeepEquals, []string{"172.17.0.2:80", "172.17.0.3:8080"})
+	c.Assert(records, check.DeepEquals, map[string]string{"myapp.megambox.com": "203.0.113.10"})
+	addr, err := r.Addr("myapp.megambox.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(addr, check.Equals, "172.17.0.2:80")
+
+	c.Assert(r.UnsetCName("myapp.megambox.com", "172.17.0.2"), check.IsNil)
+	c.Assert(records, check.HasLen, 1)
+	c.Assert(r.UnsetCName("myapp.megambox.com", ""), check.IsNil)
+	c.Assert(records, check.HasLen, 0)
+	c.Assert(r.UnsetCName("myapp.megambox.com", ""), check.Equals, router.ErrCNameNotFound)
+	_, err = r.Addr("myapp.megambox.com")
+	c.Assert(err, check.Equals, router.ErrCNameNotFound)
+	c.Assert(r.SetCName("", "172.17.0.2"), check.Equals, router.ErrCNameMissingArgs)
+}
@@ -0,0 +1,341 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// DefaultPort is the port of a backend given without one.
+	DefaultPort = "80"
+
+	// DefaultDownTime is how long a backend that failed isn't picked.
+	DefaultDownTime = 10 * time.Second
+)
+
+var (
+	ErrNoRoute   = errors.New("no route to the host")
+	ErrNoBackend = errors.New("no backend of the host is up")
+)
+
+// Routes is the route table of the proxy, the proxy routers change it.
+var Routes = NewTable("")
+
+// Backend is a container a host is routed to.
+type Backend struct {
+	Addr string
+	down int64 //unix nano until when it isn't picked.
+}
+
+func (b *Backend) isDown(now time.Time) bool {
+	return atomic.LoadInt64(&b.down) > now.UnixNano()
+}
+
+type route struct {
+	backends []*Backend
+	next     uint32
+}
+
+// Table routes the hosts (cnames) to their backends. The routes set by the
+// routers are kept in file, the routes found on the docker cluster are added
+// to them.
+type Table struct {
+	mu      sync.RWMutex
+	set     map[string][]string
+	found   map[string][]string
+	routes  map[string]*route
+	file    string
+	modTime time.Time
+
+	//Port is the port of the backends given without one, DNSRouter (a name for
+	//router.Get) points the hosts at PublicAddress, the address of the proxy.
+	Port          string
+	DNSRouter     string
+	PublicAddress string
+	DownTime      time.Duration
+	now           func() time.Time
+}
+
+// NewTable returns an empty table that keeps its routes in file, none when
+// file is empty.
+func NewTable(file string) *Table {
+	return &Table{
+		set:      make(map[string][]string),
+		found:    make(map[string][]string),
+		routes:   make(map[string]*route),
+		file:     file,
+		Port:     DefaultPort,
+		DownTime: DefaultDownTime,
+		now:      time.Now,
+	}
+}
+
+// SetFile makes the table keep its routes in file.
+func (t *Table) SetFile(file string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.file = file
+	t.modTime = time.Time{}
+}
+
+//host is the name of a cname or of the host of a request, without port.
+func host(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if h, _, err := net.SplitHostPort(name); err == nil {
+		name = h
+	}
+	return strings.TrimSuffix(name, ".")
+}
+
+func (t *Table) backendAddr(addr string) string {
+	addr = strings.TrimSpace(addr)
+	if _, _, err := net.SplitHostPort(addr); err == nil {
+		return addr
+	}
+	return net.JoinHostPort(addr, t.Port)
+}
+
+// Add routes the cname to the backend too, it is kept in the file.
+func (t *Table) Add(cname, addr string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	name, addr := host(cname), t.backendAddr(addr)
+	for _, a := range t.set[name] {
+		if a == addr {
+			return nil
+		}
+	}
+	t.set[name] = append(t.set[name], addr)
+	t.rebuild()
+	return t.save()
+}
+
+// Remove stops routing the cname to the backend, to all of its backends
+// when addr is empty. A backend found on the cluster is removed until the
+// cluster is read again.
+func (t *Table) Remove(cname, addr string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	name := host(cname)
+	if _, ok := t.routes[name]; !ok {
+		return ErrNoRoute
+	}
+	if addr == "" {
+		delete(t.set, name)
+		delete(t.found, name)
+	} else {
+		addr = t.backendAddr(addr)
+		t.set[name] = without(t.set[name], addr)
+		t.found[name] = without(t.found[name], addr)
+	}
+	t.rebuild()
+	return t.save()
+}
+
+func without(addrs []string, addr string) []string {
+	kept := make([]string, 0, len(addrs))
+	for _, a := range addrs {
+		if a != addr {
+			kept = append(kept, a)
+		}
+	}
+	return kept
+}
+
+// Found replaces the routes found on the cluster.
+func (t *Table) Found(found map[string][]string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.found = make(map[string][]string, len(found))
+	for cname, addrs := range found {
+		name := host(cname)
+		for _, a := range addrs {
+			t.found[name] = append(t.found[name], t.backendAddr(a))
+		}
+	}
+	t.rebuild()
+}
+
+//rebuild merges the routes set and found, the backends already known keep
+//their state.
+func (t *Table) rebuild() {
+	known := make(map[string]*Backend)
+	for _, r := range t.routes {
+		for _, b := range r.backends {
+			known[b.Addr] = b
+		}
+	}
+	routes := make(map[string]*route)
+	for _, src := range []map[string][]string{t.set, t.found} {
+		for name, addrs := range src {
+			r, ok := routes[name]
+			if !ok {
+				r = &route{}
+				if old, ok := t.routes[name]; ok {
+					r.next = atomic.LoadUint32(&old.next)
+				}
+			}
+			for _, a := range addrs {
+				if r.has(a) {
+					continue
+				}
+				b, ok := known[a]
+				if !ok {
+					b = &Backend{Addr: a}
+				}
+				r.backends = append(r.backends, b)
+			}
+			if len(r.backends) > 0 {
+				routes[name] = r
+			}
+		}
+	}
+	t.routes = routes
+}
+
+func (r *route) has(addr string) bool {
+	for _, b := range r.backends {
+		if b.Addr == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// Backends are the addresses the host is routed to.
+func (t *Table) Backends(name string) []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	r, ok := t.routes[host(name)]
+	if !ok {
+		return nil
+	}
+	addrs := make([]string, 0, len(r.backends))
+	for _, b := range r.backends {
+		addrs = append(addrs, b.Addr)
+	}
+	return addrs
+}
+
+// Hosts are the hosts routed, sorted.
+func (t *Table) Hosts() []string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	hosts := make([]string, 0, len(t.routes))
+	for name := range t.routes {
+		hosts = append(hosts, name)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// Pick is the next backend of the host in turn, the backends that failed
+// lately are skipped while another one is up.
+func (t *Table) Pick(name string) (*Backend, error) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	r, ok := t.routes[host(name)]
+	if !ok {
+		return nil, ErrNoRoute
+	}
+	n := uint32(len(r.backends))
+	start := atomic.AddUint32(&r.next, 1)
+	now := t.now()
+	for i := uint32(0); i < n; i++ {
+		if b := r.backends[(start+i)%n]; !b.isDown(now) {
+			return b, nil
+		}
+	}
+	return nil, ErrNoBackend
+}
+
+// Failed marks the backend down for the down time of the table.
+func (t *Table) Failed(b *Backend) {
+	atomic.StoreInt64(&b.down, t.now().Add(t.DownTime).UnixNano())
+}
+
+// Load reads the routes kept in the file, a missing file has no routes.
+func (t *Table) Load() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.load()
+}
+
+func (t *Table) load() error {
+	if t.file == "" {
+		return nil
+	}
+	fi, err := os.Stat(t.file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(t.file)
+	if err != nil {
+		return err
+	}
+	set := make(map[string][]string)
+	if err = json.Unmarshal(data, &set); err != nil {
+		return err
+	}
+	t.set = make(map[string][]string, len(set))
+	for cname, addrs := range set {
+		for _, a := range addrs {
+			t.set[host(cname)] = append(t.set[host(cname)], t.backendAddr(a))
+		}
+	}
+	t.modTime = fi.ModTime()
+	t.rebuild()
+	return nil
+}
+
+// Reload reads the file again when it changed since it was read or written,
+// eg: by another vertice or by hand.
+func (t *Table) Reload() (bool, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.file == "" {
+		return false, nil
+	}
+	fi, err := os.Stat(t.file)
+	if err != nil || fi.ModTime().Equal(t.modTime) {
+		return false, nil
+	}
+	return true, t.load()
+}
+
+//save writes the routes set to the file, replaced at once.
+func (t *Table) save() error {
+	if t.file == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(t.set, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(t.file), 0755); err != nil {
+		return err
+	}
+	tmp := t.file + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, t.file); err != nil {
+		return err
+	}
+	if fi, err := os.Stat(t.file); err == nil {
+		t.modTime = fi.ModTime()
+	}
+	return nil
+}
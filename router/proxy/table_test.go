@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestTablePick(c *check.C) {
+	t := NewTable("")
+	now := time.Date(2017, 6, 1, 10, 0, 0, 0, time.UTC)
+	t.now = func() time.Time { return now }
+	c.Assert(t.Add("myapp.megambox.com", "172.17.0.2"), check.IsNil)
+	c.Assert(t.Add("myapp.megambox.com", "172.17.0.3"), check.IsNil)
+	c.Assert(t.Add("myapp.megambox.com", "172.17.0.3"), check.IsNil)
+	seen := make(map[string]int)
+	for i := 0; i < 4; i++ {
+		b, err := t.Pick("myapp.megambox.com:80")
+		c.Assert(err, check.IsNil)
+		seen[b.Addr]++
+	}
+	c.Assert(seen, check.DeepEquals, map[string]int{"172.17.0.2:80": 2, "172.17.0.3:80": 2})
+
+	//a failed backend isn't picked for the down time.
+	b, _ := t.Pick("myapp.megambox.com")
+	t.Failed(b)
+	for i := 0; i < 3; i++ {
+		got, err := t.Pick("myapp.megambox.com")
+		c.Assert(err, check.IsNil)
+		c.Assert(got, check.Not(check.Equals), b)
+	}
+	other, _ := t.Pick("myapp.megambox.com")
+	t.Failed(other)
+	_, err := t.Pick("myapp.megambox.com")
+	c.Assert(err, check.Equals, ErrNoBackend)
+	now = now.Add(DefaultDownTime + time.Second)
+	_, err = t.Pick("myapp.megambox.com")
+	c.Assert(err, check.IsNil)
+	_, err = t.Pick("other.megambox.com")
+	c.Assert(err, check.Equals, ErrNoRoute)
+}
+
+func (s *S) TestTableFound(c *check.C) {
+	t := NewTable("")
+	c.Assert(t.Add("myapp.megambox.com", "172.17.0.2"), check.IsNil)
+	b, _ := t.Pick("myapp.megambox.com")
+	t.Failed(b)
+	t.Found(map[string][]string{"myapp.megambox.com": {"172.17.0.2", "172.17.0.4"}, "web.megambox.com": {"172.17.0.5"}})
+	c.Assert(t.Hosts(), check.DeepEquals, []string{"myapp.megambox.com", "web.megambox.com"})
+	c.Assert(t.Backends("myapp.megambox.com"), check.DeepEquals, []string{"172.17.0.2:80", "172.17.0.4:80"})
+	//the known backend keeps its state.
+	got, err := t.Pick("myapp.megambox.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(got.Addr, check.Equals, "172.17.0.4:80")
+
+	t.Found(nil)
+	c.Assert(t.Hosts(), check.DeepEquals, []string{"myapp.megambox.com"})
+	c.Assert(t.Remove("web.megambox.com", ""), check.Equals, ErrNoRoute)
+}
+
+func (s *S) TestTableFile(c *check.C) {
+	file := filepath.Join(s.dir, "lib", "routes.json")
+	t := NewTable(file)
+	c.Assert(t.Load(), check.IsNil)
+	c.Assert(t.Hosts(), check.HasLen, 0)
+	c.Assert(t.Add("myapp.megambox.com", "172.17.0.2"), check.IsNil)
+	c.Assert(t.Add("web.megambox.com", "172.17.0.5"), check.IsNil)
+	c.Assert(t.Remove("web.megambox.com", "172.17.0.5"), check.IsNil)
+	changed, err := t.Reload()
+	c.Assert(err, check.IsNil)
+	c.Assert(changed, check.Equals, false)
+
+	other := NewTable(file)
+	c.Assert(other.Load(), check.IsNil)
+	c.Assert(other.Hosts(), check.DeepEquals, []string{"myapp.megambox.com"})
+
+	//a change by hand is read by the reload.
+	data := `{"myapp.megambox.com": ["172.17.0.2:80", "172.17.0.9:8080"]}`
+	c.Assert(ioutil.WriteFile(file, []byte(data), 0644), check.IsNil)
+	later := time.Now().Add(time.Minute)
+	c.Assert(os.Chtimes(file, later, later), check.IsNil)
+	changed, err = t.Reload()
+	c.Assert(err, check.IsNil)
+	c.Assert(changed, check.Equals, true)
+	c.Assert(t.Backends("myapp.megambox.com"), check.DeepEquals, []string{"172.17.0.2:80", "172.17.0.9:8080"})
+}
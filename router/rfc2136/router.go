@@ -0,0 +1,220 @@
+// Package rfc2136 sets the records of the assemblies on a dns server that
+// takes dynamic updates (rfc 2136) signed with a tsig key, eg: bind or knot.
+package rfc2136
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/megamsys/vertice/router"
+	"github.com/megamsys/vertice/router/dnsmsg"
+	"github.com/megamsys/vertice/subd/dns"
+)
+
+const routerName = "rfc2136"
+
+func init() {
+	router.Register(routerName, createRouter)
+}
+
+type rfc2136Router struct {
+	name    string
+	region  *dns.Region
+	tsig    *dnsmsg.TSIG
+	timeout time.Duration
+}
+
+func createRouter(name string) (router.Router, error) {
+	region, err := dns.R53.RegionOf(name)
+	if err != nil {
+		return nil, err
+	}
+	r, err := newRouter(name, region)
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("%s ready", name)
+	return r, nil
+}
+
+func newRouter(name string, region *dns.Region) (*rfc2136Router, error) {
+	if region.Server == "" {
+		return nil, fmt.Errorf("router %s has no server", name)
+	}
+	r := &rfc2136Router{name: name, region: region}
+	if region.TSIGName != "" {
+		r.tsig = &dnsmsg.TSIG{Name: region.TSIGName, Algorithm: region.TSIGAlgorithm, Secret: region.TSIGSecret}
+	}
+	return r, nil
+}
+
+// HealthCheck asks the server of the region for the soa of its zone, signed
+// with the tsig key, so a wrong key is down too. A region without a zone is
+// up when the server takes a connection.
+func HealthCheck(region dns.Region, timeout time.Duration) func() error {
+	return func() error {
+		r, err := newRouter(routerName+":"+region.Region, &region)
+		if err != nil {
+			return err
+		}
+		if timeout <= 0 {
+			timeout = dnsmsg.DefaultTimeout
+		}
+		r.timeout = timeout
+		if region.Zone == "" {
+			addr := region.Server
+			if _, _, err = net.SplitHostPort(addr); err != nil {
+				addr = net.JoinHostPort(addr, "53")
+			}
+			conn, err := net.DialTimeout("tcp", addr, timeout)
+			if err != nil {
+				return err
+			}
+			return conn.Close()
+		}
+		_, err = r.exchange(&dnsmsg.Message{
+			Id:        uint16(rand.Intn(1 << 16)),
+			Questions: []dnsmsg.Question{{Name: dnsmsg.Fqdn(region.Zone), Type: dnsmsg.TypeSOA, Class: dnsmsg.ClassINET}},
+		})
+		return err
+	}
+}
+
+func (r *rfc2136Router) String() string {
+	return "RFC2136:(" + r.region.Server + "," + r.region.TSIGName + ")"
+}
+
+//SetCName replaces the records of cname by the address, an ip or a name.
+func (r *rfc2136Router) SetCName(cname, addr string) error {
+	if len(strings.TrimSpace(cname)) <= 0 || len(strings.TrimSpace(addr)) <= 0 {
+		return router.ErrCNameMissingArgs
+	}
+	name := dnsmsg.Fqdn(cname)
+	rr := dnsmsg.Address(name, r.region.RecordTTL(), addr)
+	//a cname is alone at its name, an address replaces the cname and the other way round.
+	var updates []dnsmsg.RR
+	if rr.Type == dnsmsg.TypeCNAME {
+		updates = append(updates, deleteSet(name, dnsmsg.TypeA), deleteSet(name, dnsmsg.TypeAAAA))
+	} else {
+		updates = append(updates, deleteSet(name, dnsmsg.TypeCNAME))
+	}
+	updates = append(updates, deleteSet(name, rr.Type), rr)
+	log.Debugf("  %s (%s, %s)", r.name, cname, addr)
+	return r.update(cname, updates)
+}
+
+//UnsetCName removes the record of the ip of cname, all of its records
+//when no ip is given.
+func (r *rfc2136Router) UnsetCName(cname, addr string) error {
+	if len(strings.TrimSpace(cname)) <= 0 {
+		return router.ErrCNameMissingArgs
+	}
+	name := dnsmsg.Fqdn(cname)
+	var rr dnsmsg.RR
+	switch ip := net.ParseIP(addr); {
+	case ip != nil:
+		rr = dnsmsg.A(name, 0, ip)
+		rr.Class = dnsmsg.ClassNONE
+	case strings.TrimSpace(addr) != "":
+		rr = deleteSet(name, dnsmsg.TypeCNAME)
+	default:
+		rr = deleteSet(name, dnsmsg.TypeANY)
+	}
+	log.Debugf("  %s delete (%s, %s)", r.name, cname, addr)
+	return r.update(cname, []dnsmsg.RR{rr})
+}
+
+//Addr is the address of cname on the server, its ip or the name it is a cname of.
+func (r *rfc2136Router) Addr(cname string) (string, error) {
+	name := dnsmsg.Fqdn(cname)
+	for _, t := range []uint16{dnsmsg.TypeA, dnsmsg.TypeAAAA, dnsmsg.TypeCNAME} {
+		m := &dnsmsg.Message{
+			Id:        uint16(rand.Intn(1 << 16)),
+			Questions: []dnsmsg.Question{{Name: name, Type: t, Class: dnsmsg.ClassINET}},
+		}
+		res, err := r.exchange(m)
+		if err != nil {
+			return "", err
+		}
+		for _, rr := range res.Answers {
+			if ip := rr.IP(); ip != nil && strings.EqualFold(rr.Name, name) {
+				return ip.String(), nil
+			}
+			if rr.Type == dnsmsg.TypeCNAME && strings.EqualFold(rr.Name, name) {
+				target, _, err := dnsmsg.Name(rr.Data)
+				if err != nil {
+					return "", err
+				}
+				return strings.TrimSuffix(target, "."), nil
+			}
+		}
+	}
+	return "", router.ErrCNameNotFound
+}
+
+func (r *rfc2136Router) StartupMessage() (string, error) {
+	return r.name + " router ok!", nil
+}
+
+//deleteSet is the update that deletes the records of the type at name.
+func deleteSet(name string, t uint16) dnsmsg.RR {
+	return dnsmsg.RR{Name: name, Type: t, Class: dnsmsg.ClassANY}
+}
+
+//update sends the updates to the zone of cname.
+func (r *rfc2136Router) update(cname string, updates []dnsmsg.RR) error {
+	zone, err := router.Zone(r.region.Zone, cname)
+	if err != nil {
+		return router.ErrInvalidCName
+	}
+	m := &dnsmsg.Message{
+		Id:        uint16(rand.Intn(1 << 16)),
+		Opcode:    dnsmsg.OpcodeUpdate,
+		Questions: []dnsmsg.Question{{Name: zone, Type: dnsmsg.TypeSOA, Class: dnsmsg.ClassINET}},
+		Authority: updates,
+	}
+	_, err = r.exchange(m)
+	return err
+}
+
+//exchange sends the message signed with the tsig key, an answer that isn't
+//a success is an error.
+func (r *rfc2136Router) exchange(m *dnsmsg.Message) (*dnsmsg.Message, error) {
+	var wire []byte
+	var err error
+	if r.tsig != nil {
+		wire, err = r.tsig.Sign(m, time.Now())
+	} else {
+		wire, err = m.Pack()
+	}
+	if err != nil {
+		return nil, err
+	}
+	res, err := dnsmsg.Exchange(r.region.Server, wire, r.timeout)
+	if err != nil {
+		return nil, fmt.Errorf("%s : %s", r.region.Server, err)
+	}
+	if res.Id != m.Id {
+		return nil, fmt.Errorf("%s answered another message (%d)", r.region.Server, res.Id)
+	}
+	switch res.Rcode {
+	case dnsmsg.RcodeSuccess:
+		return res, nil
+	case dnsmsg.RcodeNXDomain:
+		if m.Opcode == dnsmsg.OpcodeQuery {
+			return res, nil
+		}
+	}
+	return nil, fmt.Errorf("%s refused the %s : %s", r.region.Server, opcode(m), dnsmsg.RcodeString(res.Rcode))
+}
+
+func opcode(m *dnsmsg.Message) string {
+	if m.Opcode == dnsmsg.OpcodeUpdate {
+		return "update of " + m.Questions[0].Name
+	}
+	return "query of " + m.Questions[0].Name
+}
@@ -0,0 +1,160 @@
+package rfc2136
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/megamsys/vertice/router"
+	"github.com/megamsys/vertice/router/dnsmsg"
+	"github.com/megamsys/vertice/subd/dns"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+type S struct {
+	l        net.Listener
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	received []*dnsmsg.Message
+	rcode    int
+}
+
+var _ = check.Suite(&S{})
+
+//serve answers the updates with rcode and the queries of myapp with an address.
+func (s *S) serve(l net.Listener) {
+	defer s.wg.Done()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		b, err := dnsmsg.ReadTCP(conn)
+		if err == nil {
+			received, _ := dnsmsg.Unpack(b)
+			m, _ := dnsmsg.Unpack(b)
+			s.mu.Lock()
+			s.received = append(s.received, received)
+			m.Response, m.Rcode = true, s.rcode
+			s.mu.Unlock()
+			m.Additional = nil
+			if m.Opcode == dnsmsg.OpcodeQuery {
+				q := m.Questions[0]
+				switch {
+				case q.Name == "myapp.megambox.com." && q.Type == dnsmsg.TypeA:
+					m.Answers = []dnsmsg.RR{dnsmsg.A(q.Name, 60, net.ParseIP("192.168.1.10"))}
+				case q.Name == "web.megambox.com." && q.Type == dnsmsg.TypeCNAME:
+					m.Answers = []dnsmsg.RR{dnsmsg.CNAME(q.Name, 60, "myapp.megambox.com.")}
+				}
+			}
+			wire, _ := m.Pack()
+			dnsmsg.WriteTCP(conn, wire)
+		}
+		conn.Close()
+	}
+}
+
+func (s *S) SetUpTest(c *check.C) {
+	var err error
+	s.l, err = net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, check.IsNil)
+	s.received, s.rcode = nil, dnsmsg.RcodeSuccess
+	s.wg.Add(1)
+	go s.serve(s.l)
+	cf := dns.NewConfig()
+	cf.Regions = []dns.Region{{
+		Region:     "chennai",
+		Router:     routerName,
+		Zone:       "megambox.com",
+		Server:     s.l.Addr().String(),
+		TSIGName:   "vertice",
+		TSIGSecret: "c2VjcmV0",
+	}}
+	cf.MkGlobal()
+}
+
+func (s *S) TearDownTest(c *check.C) {
+	s.l.Close()
+	s.wg.Wait()
+}
+
+//messages are the messages the server received so far.
+func (s *S) messages() []*dnsmsg.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*dnsmsg.Message(nil), s.received...)
+}
+
+func (s *S) setRcode(rcode int) {
+	s.mu.Lock()
+	s.rcode = rcode
+	s.mu.Unlock()
+}
+
+func (s *S) router(c *check.C) router.Router {
+	got, err := router.Get("rfc2136:chennai")
+	c.Assert(err, check.IsNil)
+	return got
+}
+
+func (s *S) TestSetCName(c *check.C) {
+	c.Assert(s.router(c).SetCName("myapp.megambox.com", "192.168.1.10"), check.IsNil)
+	c.Assert(s.messages(), check.HasLen, 1)
+	m := s.messages()[0]
+	c.Assert(m.Opcode, check.Equals, dnsmsg.OpcodeUpdate)
+	c.Assert(m.Questions, check.DeepEquals, []dnsmsg.Question{{Name: "megambox.com.", Type: dnsmsg.TypeSOA, Class: dnsmsg.ClassINET}})
+	c.Assert(m.Authority, check.DeepEquals, []dnsmsg.RR{
+		{Name: "myapp.megambox.com.", Type: dnsmsg.TypeCNAME, Class: dnsmsg.ClassANY},
+		{Name: "myapp.megambox.com.", Type: dnsmsg.TypeA, Class: dnsmsg.ClassANY},
+		dnsmsg.A("myapp.megambox.com.", dns.DefaultTTL, net.ParseIP("192.168.1.10")),
+	})
+	c.Assert(m.Additional, check.HasLen, 1)
+	c.Assert(m.Additional[0].Type, check.Equals, dnsmsg.TypeTSIG)
+	c.Assert(m.Additional[0].Name, check.Equals, "vertice.")
+}
+
+func (s *S) TestUnsetCName(c *check.C) {
+	r := s.router(c)
+	c.Assert(r.UnsetCName("myapp.megambox.com", "192.168.1.10"), check.IsNil)
+	c.Assert(r.UnsetCName("myapp.megambox.com", ""), check.IsNil)
+	c.Assert(s.messages(), check.HasLen, 2)
+	ip := dnsmsg.A("myapp.megambox.com.", 0, net.ParseIP("192.168.1.10"))
+	ip.Class = dnsmsg.ClassNONE
+	c.Assert(s.messages()[0].Authority, check.DeepEquals, []dnsmsg.RR{ip})
+	c.Assert(s.messages()[1].Authority, check.DeepEquals, []dnsmsg.RR{{Name: "myapp.megambox.com.", Type: dnsmsg.TypeANY, Class: dnsmsg.ClassANY}})
+}
+
+func (s *S) TestRefused(c *check.C) {
+	s.setRcode(dnsmsg.RcodeNotAuth)
+	err := s.router(c).SetCName("myapp.megambox.com", "192.168.1.10")
+	c.Assert(err, check.ErrorMatches, ".* refused the update of megambox.com. : NOTAUTH")
+}
+
+func (s *S) TestAddr(c *check.C) {
+	r := s.router(c)
+	addr, err := r.Addr("myapp.megambox.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(addr, check.Equals, "192.168.1.10")
+	addr, err = r.Addr("web.megambox.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(addr, check.Equals, "myapp.megambox.com")
+	_, err = r.Addr("db.megambox.com")
+	c.Assert(err, check.Equals, router.ErrCNameNotFound)
+}
+
+func (s *S) TestHealthCheck(c *check.C) {
+	region := dns.R53.Regions[0]
+	c.Assert(HealthCheck(region, time.Second)(), check.IsNil)
+	c.Assert(s.messages(), check.HasLen, 1)
+	c.Assert(s.messages()[0].Questions, check.DeepEquals, []dnsmsg.Question{{Name: "megambox.com.", Type: dnsmsg.TypeSOA, Class: dnsmsg.ClassINET}})
+	c.Assert(s.messages()[0].Additional, check.HasLen, 1)
+	s.setRcode(dnsmsg.RcodeNotAuth)
+	c.Assert(HealthCheck(region, time.Second)(), check.ErrorMatches, ".* refused the query of megambox.com. : NOTAUTH")
+	region.Zone = ""
+	c.Assert(HealthCheck(region, time.Second)(), check.IsNil)
+	s.l.Close()
+	c.Assert(HealthCheck(region, time.Second)(), check.NotNil)
+}
@@ -1,6 +1,7 @@
 package route53
 
 import (
+	"errors"
 	"strings"
 
 	log "github.com/Sirupsen/logrus"
@@ -38,6 +39,18 @@ func createRouter(name string) (router.Router, error) {
 	return vRouter, nil
 }
 
+// HealthCheck lists the hosted zones with the keys, route53 is down when
+// none can be read.
+func HealthCheck(access, secret string) func() error {
+	return func() error {
+		client := route53.AccessIdentifiers{AccessKey: access, SecretKey: secret}
+		if len(client.Zones().HostedZones) == 0 {
+			return errors.New("no hosted zones readable with the access key " + access)
+		}
+		return nil
+	}
+}
+
 func (r *route53Router) String() string {
 	return "R53:(" + dns.R53.AccessKey + "," + dns.R53.SecretKey + ")"
 }
@@ -22,9 +22,14 @@ func Register(name string, r routerFactory) {
 	routers[name] = r
 }
 
-// Get gets the named router from the registry.
+// Get gets the named router from the registry. A name of a region, eg:
+// rfc2136:chennai, gets the router of its kind (rfc2136) for that region.
 func Get(name string) (Router, error) {
-	factory, ok := routers[name]
+	kind := name
+	if i := strings.Index(name, ":"); i >= 0 {
+		kind = name[:i]
+	}
+	factory, ok := routers[kind]
 	if !ok {
 		return nil, fmt.Errorf("unknown router: %q.", name)
 	}
@@ -54,3 +59,16 @@ func ChopDomain(cname string) (string, error) {
 	}
 	return "", ErrInvalidCName
 }
+
+// Zone is the zone given, or the domain of the cname when none is, as a
+// fully qualified name.
+func Zone(zone, cname string) (string, error) {
+	if zone == "" {
+		d, err := ChopDomain(strings.TrimSuffix(cname, "."))
+		if err != nil {
+			return "", err
+		}
+		zone = d
+	}
+	return strings.TrimSuffix(zone, ".") + ".", nil
+}
@@ -28,3 +28,28 @@ func (s *S) TestRegisterAndGetCustomNamedRouter(c *check.C) {
 	_, err := Get("myrouter")
 	c.Assert(err, check.IsNil)
 }
+
+func (s *S) TestGetRouterOfRegion(c *check.C) {
+	var prefixes []string
+	Register("regional", func(prefix string) (Router, error) {
+		prefixes = append(prefixes, prefix)
+		var r Router
+		return r, nil
+	})
+	_, err := Get("regional:chennai")
+	c.Assert(err, check.IsNil)
+	c.Assert(prefixes, check.DeepEquals, []string{"regional:chennai"})
+	_, err = Get("unknown:chennai")
+	c.Assert(err, check.NotNil)
+}
+
+func (s *S) TestZone(c *check.C) {
+	z, err := Zone("", "myapp.megambox.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(z, check.Equals, "megambox.com.")
+	z, err = Zone("apps.megambox.com", "myapp.apps.megambox.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(z, check.Equals, "apps.megambox.com.")
+	_, err = Zone("", "localhost")
+	c.Assert(err, check.Equals, ErrInvalidCName)
+}
@@ -0,0 +1,303 @@
+// Package zonefile writes the records of the assemblies to a zone file (rfc
+// 1035 master file) a local nameserver loads, eg: bind, nsd or coredns.
+package zonefile
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/megamsys/vertice/router"
+	"github.com/megamsys/vertice/subd/dns"
+)
+
+const routerName = "zonefile"
+
+//the soa times of the zone: refresh, retry, expire, minimum.
+var soaTimes = []uint32{3600, 600, 1209600, 300}
+
+func init() {
+	router.Register(routerName, createRouter)
+}
+
+//files serializes the changes of a zone file, routers of many regions may share it.
+var files = struct {
+	sync.Mutex
+	locks map[string]*sync.Mutex
+}{locks: make(map[string]*sync.Mutex)}
+
+func lock(path string) *sync.Mutex {
+	files.Lock()
+	defer files.Unlock()
+	l, ok := files.locks[path]
+	if !ok {
+		l = &sync.Mutex{}
+		files.locks[path] = l
+	}
+	return l
+}
+
+type zonefileRouter struct {
+	name   string
+	region *dns.Region
+	now    func() time.Time
+}
+
+type zoneRecord struct {
+	Name  string
+	TTL   uint32
+	Type  string
+	Value string
+}
+
+type zone struct {
+	origin  string
+	serial  uint32
+	records []zoneRecord
+}
+
+func createRouter(name string) (router.Router, error) {
+	region, err := dns.R53.RegionOf(name)
+	if err != nil {
+		return nil, err
+	}
+	r, err := newRouter(name, region)
+	if err != nil {
+		return nil, err
+	}
+	log.Debugf("%s ready", name)
+	return r, nil
+}
+
+func newRouter(name string, region *dns.Region) (*zonefileRouter, error) {
+	if region.File == "" || region.Zone == "" {
+		return nil, fmt.Errorf("router %s needs a file and a zone", name)
+	}
+	return &zonefileRouter{name: name, region: region, now: time.Now}, nil
+}
+
+// HealthCheck reads the zone file of the region and writes next to it, as a
+// change does before it renames the new zone over the file.
+func HealthCheck(region dns.Region) func() error {
+	return func() error {
+		r, err := newRouter(routerName+":"+region.Region, &region)
+		if err != nil {
+			return err
+		}
+		l := lock(region.File)
+		l.Lock()
+		defer l.Unlock()
+		if _, err = r.read(); err != nil {
+			return err
+		}
+		if err = os.MkdirAll(filepath.Dir(region.File), 0755); err != nil {
+			return err
+		}
+		tmp := region.File + ".tmp"
+		if err = ioutil.WriteFile(tmp, nil, 0644); err != nil {
+			return err
+		}
+		return os.Remove(tmp)
+	}
+}
+
+func (r *zonefileRouter) String() string {
+	return "ZoneFile:(" + r.region.File + ")"
+}
+
+func (r *zonefileRouter) origin() string {
+	return strings.ToLower(strings.TrimSuffix(r.region.Zone, ".")) + "."
+}
+
+//relative is the name of cname in the zone, @ for the zone itself.
+func (r *zonefileRouter) relative(cname string) (string, error) {
+	name := strings.ToLower(strings.TrimSuffix(cname, ".")) + "."
+	origin := r.origin()
+	switch {
+	case name == origin:
+		return "@", nil
+	case strings.HasSuffix(name, "."+origin):
+		return strings.TrimSuffix(name, "."+origin), nil
+	}
+	return "", router.ErrDomainNotFound
+}
+
+//SetCName replaces the records of cname by the address, an ip or a name.
+func (r *zonefileRouter) SetCName(cname, addr string) error {
+	if len(strings.TrimSpace(cname)) <= 0 || len(strings.TrimSpace(addr)) <= 0 {
+		return router.ErrCNameMissingArgs
+	}
+	name, err := r.relative(cname)
+	if err != nil {
+		return err
+	}
+	rec := zoneRecord{Name: name, TTL: r.region.RecordTTL(), Type: "CNAME", Value: strings.TrimSuffix(addr, ".") + "."}
+	if ip := net.ParseIP(addr); ip != nil {
+		rec.Type, rec.Value = "A", ip.String()
+		if ip.To4() == nil {
+			rec.Type = "AAAA"
+		}
+	}
+	log.Debugf("  %s (%s, %s)", r.name, cname, addr)
+	return r.change(func(z *zone) {
+		//a cname is alone at its name, an address replaces the cname and the other way round.
+		z.remove(func(o zoneRecord) bool {
+			return o.Name == name && (o.Type == rec.Type || o.Type == "CNAME" || rec.Type == "CNAME")
+		})
+		z.records = append(z.records, rec)
+	})
+}
+
+//UnsetCName removes the record of the ip of cname, all of its records when
+//no ip is given.
+func (r *zonefileRouter) UnsetCName(cname, addr string) error {
+	if len(strings.TrimSpace(cname)) <= 0 {
+		return router.ErrCNameMissingArgs
+	}
+	name, err := r.relative(cname)
+	if err != nil {
+		return err
+	}
+	log.Debugf("  %s delete (%s, %s)", r.name, cname, addr)
+	ip := net.ParseIP(addr)
+	return r.change(func(z *zone) {
+		z.remove(func(o zoneRecord) bool {
+			return o.Name == name && (ip == nil || (o.Type != "CNAME" && net.ParseIP(o.Value).Equal(ip)))
+		})
+	})
+}
+
+//Addr is the address of cname in the zone, its ip or the name it is a cname of.
+func (r *zonefileRouter) Addr(cname string) (string, error) {
+	name, err := r.relative(cname)
+	if err != nil {
+		return "", err
+	}
+	l := lock(r.region.File)
+	l.Lock()
+	defer l.Unlock()
+	z, err := r.read()
+	if err != nil {
+		return "", err
+	}
+	for _, rec := range z.records {
+		if rec.Name == name {
+			return strings.TrimSuffix(rec.Value, "."), nil
+		}
+	}
+	return "", router.ErrCNameNotFound
+}
+
+func (r *zonefileRouter) StartupMessage() (string, error) {
+	return r.name + " router ok!", nil
+}
+
+func (z *zone) remove(match func(zoneRecord) bool) {
+	kept := z.records[:0]
+	for _, rec := range z.records {
+		if !match(rec) {
+			kept = append(kept, rec)
+		}
+	}
+	z.records = kept
+}
+
+//change reads the zone, changes its records and writes it with the next serial.
+func (r *zonefileRouter) change(fn func(*zone)) error {
+	l := lock(r.region.File)
+	l.Lock()
+	defer l.Unlock()
+	z, err := r.read()
+	if err != nil {
+		return err
+	}
+	fn(z)
+	//the serial is the date and a count of the changes of the day, as YYYYMMDDnn.
+	day, _ := strconv.ParseUint(r.now().UTC().Format("20060102"), 10, 32)
+	if z.serial < uint32(day)*100 {
+		z.serial = uint32(day) * 100
+	} else {
+		z.serial++
+	}
+	return r.write(z)
+}
+
+//read parses the zone file as written by write, a missing file is an empty zone.
+func (r *zonefileRouter) read() (*zone, error) {
+	z := &zone{origin: r.origin()}
+	f, err := os.Open(r.region.File)
+	if os.IsNotExist(err) {
+		return z, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "$") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 5 || fields[2] != "IN" {
+			return nil, fmt.Errorf("%s:%d : unknown record %q", r.region.File, n, line)
+		}
+		switch fields[3] {
+		case "SOA":
+			if len(fields) < 7 {
+				return nil, fmt.Errorf("%s:%d : short soa %q", r.region.File, n, line)
+			}
+			serial, err := strconv.ParseUint(fields[6], 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d : soa serial %s", r.region.File, n, err)
+			}
+			z.serial = uint32(serial)
+		case "NS":
+		default:
+			ttl, err := strconv.ParseUint(fields[1], 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d : ttl %s", r.region.File, n, err)
+			}
+			z.records = append(z.records, zoneRecord{Name: fields[0], TTL: uint32(ttl), Type: fields[3], Value: fields[4]})
+		}
+	}
+	return z, sc.Err()
+}
+
+//write replaces the zone file, the nameserver never reads half of it.
+func (r *zonefileRouter) write(z *zone) error {
+	ns := r.region.Nameserver
+	if ns == "" {
+		ns = "ns1." + z.origin
+	}
+	ns = strings.TrimSuffix(ns, ".") + "."
+	ttl := r.region.RecordTTL()
+	sort.SliceStable(z.records, func(i, j int) bool { return z.records[i].Name < z.records[j].Name })
+	w := &bytes.Buffer{}
+	fmt.Fprintf(w, "; %s, written by vertice. Only the records are kept between changes.\n", z.origin)
+	fmt.Fprintf(w, "$ORIGIN %s\n$TTL %d\n", z.origin, ttl)
+	fmt.Fprintf(w, "@\t%d\tIN\tSOA\t%s hostmaster.%s %d %d %d %d %d\n", ttl, ns, z.origin, z.serial, soaTimes[0], soaTimes[1], soaTimes[2], soaTimes[3])
+	fmt.Fprintf(w, "@\t%d\tIN\tNS\t%s\n", ttl, ns)
+	for _, rec := range z.records {
+		fmt.Fprintf(w, "%s\t%d\tIN\t%s\t%s\n", rec.Name, rec.TTL, rec.Type, rec.Value)
+	}
+	if err := os.MkdirAll(filepath.Dir(r.region.File), 0755); err != nil {
+		return err
+	}
+	tmp := r.region.File + ".tmp"
+	if err := ioutil.WriteFile(tmp, w.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.region.File)
+}
@@ -0,0 +1,108 @@
+package zonefile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/megamsys/vertice/router"
+	"github.com/megamsys/vertice/subd/dns"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) { check.TestingT(t) }
+
+type S struct {
+	dir string
+}
+
+var _ = check.Suite(&S{})
+
+func (s *S) SetUpTest(c *check.C) {
+	s.dir = c.MkDir()
+	cf := dns.NewConfig()
+	cf.Regions = []dns.Region{{Region: "chennai", Router: routerName, Zone: "megambox.com", File: filepath.Join(s.dir, "megambox.com.zone"), TTL: 60}}
+	cf.MkGlobal()
+}
+
+func (s *S) router(c *check.C, now time.Time) *zonefileRouter {
+	got, err := router.Get("zonefile:chennai")
+	c.Assert(err, check.IsNil)
+	r := got.(*zonefileRouter)
+	r.now = func() time.Time { return now }
+	return r
+}
+
+func (s *S) TestSetCName(c *check.C) {
+	r := s.router(c, time.Date(2017, 6, 1, 10, 0, 0, 0, time.UTC))
+	c.Assert(r.SetCName("myapp.megambox.com", "192.168.1.10"), check.IsNil)
+	c.Assert(r.SetCName("web.megambox.com", "myapp.megambox.com"), check.IsNil)
+	c.Assert(r.SetCName("megambox.com", "2001:db8::1"), check.IsNil)
+	data, err := ioutil.ReadFile(r.region.File)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(data), check.Equals, `; megambox.com., written by vertice. Only the records are kept between changes.
+$ORIGIN megambox.com.
+$TTL 60
+@	60	IN	SOA	ns1.megambox.com. hostmaster.megambox.com. 2017060102 3600 600 1209600 300
+@	60	IN	NS	ns1.megambox.com.
+@	60	IN	AAAA	2001:db8::1
+myapp	60	IN	A	192.168.1.10
+web	60	IN	CNAME	myapp.megambox.com.
+`)
+	addr, err := r.Addr("web.megambox.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(addr, check.Equals, "myapp.megambox.com")
+
+	//the address replaces the cname, the serial goes on the next day.
+	r.now = func() time.Time { return time.Date(2017, 6, 2, 10, 0, 0, 0, time.UTC) }
+	c.Assert(r.SetCName("web.megambox.com", "192.168.1.11"), check.IsNil)
+	addr, err = r.Addr("web.megambox.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(addr, check.Equals, "192.168.1.11")
+	z, err := r.read()
+	c.Assert(err, check.IsNil)
+	c.Assert(z.serial, check.Equals, uint32(2017060200))
+	c.Assert(z.records, check.HasLen, 3)
+}
+
+func (s *S) TestUnsetCName(c *check.C) {
+	r := s.router(c, time.Now())
+	c.Assert(r.SetCName("myapp.megambox.com", "192.168.1.10"), check.IsNil)
+	c.Assert(r.SetCName("web.megambox.com", "myapp.megambox.com"), check.IsNil)
+	c.Assert(r.UnsetCName("myapp.megambox.com", "192.168.1.99"), check.IsNil)
+	_, err := r.Addr("myapp.megambox.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(r.UnsetCName("myapp.megambox.com", "192.168.1.10"), check.IsNil)
+	_, err = r.Addr("myapp.megambox.com")
+	c.Assert(err, check.Equals, router.ErrCNameNotFound)
+	c.Assert(r.UnsetCName("web.megambox.com", ""), check.IsNil)
+	_, err = r.Addr("web.megambox.com")
+	c.Assert(err, check.Equals, router.ErrCNameNotFound)
+}
+
+func (s *S) TestOutsideOfZone(c *check.C) {
+	r := s.router(c, time.Now())
+	c.Assert(r.SetCName("myapp.megam.io", "192.168.1.10"), check.Equals, router.ErrDomainNotFound)
+	c.Assert(r.SetCName("myapp.megambox.com", ""), check.Equals, router.ErrCNameMissingArgs)
+	_, err := os.Stat(r.region.File)
+	c.Assert(os.IsNotExist(err), check.Equals, true)
+}
+
+func (s *S) TestNeedsFile(c *check.C) {
+	cf := dns.NewConfig()
+	cf.Regions = []dns.Region{{Region: "paris", Router: routerName, Zone: "megambox.com"}}
+	cf.MkGlobal()
+	_, err := router.Get("zonefile:paris")
+	c.Assert(err, check.ErrorMatches, ".*needs a file and a zone")
+}
+
+func (s *S) TestHealthCheck(c *check.C) {
+	region := dns.R53.Regions[0]
+	c.Assert(HealthCheck(region)(), check.IsNil)
+	_, err := os.Stat(region.File + ".tmp")
+	c.Assert(os.IsNotExist(err), check.Equals, true)
+	c.Assert(ioutil.WriteFile(region.File, []byte("myapp 60 IN A\n"), 0644), check.IsNil)
+	c.Assert(HealthCheck(region)(), check.ErrorMatches, ".*megambox.com.zone:1 : unknown record .*")
+}
@@ -6,10 +6,13 @@ import (
 	"github.com/megamsys/libgo/cmd"
 	constants "github.com/megamsys/libgo/utils"
 	"github.com/megamsys/opennebula-go/api"
+	"github.com/megamsys/vertice/provision"
 	"github.com/megamsys/vertice/provision/one"
+	"github.com/megamsys/vertice/toml"
 	"strconv"
 	"strings"
 	"text/tabwriter"
+	"time"
 )
 
 const (
@@ -47,11 +50,97 @@ const (
 	DefaultOneVnetPub = "vnet-pub"
 
 	ONEZONE = "zone"
+
+	// DefaultJournalDir is where the in-flight requests are journaled.
+	DefaultJournalDir = "/var/lib/megam/vertice/journal"
+
+	// DefaultMaxAttempts is the number of times a failed request is requeued before giving up.
+	DefaultMaxAttempts = 3
+
+	// DefaultRequeueDelay is the delay before a failed request is redelivered.
+	DefaultRequeueDelay = 30 * time.Second
+
+	// DefaultIdempotencyWindow is how long an accepted payload id is remembered.
+	DefaultIdempotencyWindow = 24 * time.Hour
+
+	// DefaultIdempotencyFile is where the accepted payload ids are stored.
+	DefaultIdempotencyFile = "/var/lib/megam/vertice/idempotency.json"
+
+	// DefaultWorkers is the number of requests that are processed at the same time.
+	DefaultWorkers = 10
+
+	// DefaultReportInterval is how often the worker pool reports its queue.
+	DefaultReportInterval = 5 * time.Minute
+
+	// DefaultWorkflowDir is where the state of the workflows is stored.
+	DefaultWorkflowDir = "/var/lib/megam/vertice/workflows"
+
+	// DefaultBatchDir is where the batches and their reports are stored.
+	DefaultBatchDir = "/var/lib/megam/vertice/batches"
+
+	// DefaultLogDir is where the logs of the boxes are stored.
+	DefaultLogDir = "/var/lib/megam/vertice/logs"
 )
 
 type Config struct {
-	Provider string  `json:"provider" toml:"provider"`
-	One      one.One `json:"one" toml:"one"`
+	Provider    string      `json:"provider" toml:"provider"`
+	One         one.One     `json:"one" toml:"one"`
+	Journal     Journal     `json:"journal" toml:"journal"`
+	Workers     Workers     `json:"workers" toml:"workers"`
+	Idempotency Idempotency `json:"idempotency" toml:"idempotency"`
+	Workflows   Workflows   `json:"workflows" toml:"workflows"`
+	Batches     Batches     `json:"batches" toml:"batches"`
+	Logs        Logs        `json:"logs" toml:"logs"`
+}
+
+// Journal controls how the in-flight requests are persisted and what
+// happens to the ones left over after a restart.
+// When resume is false the left over requests are run again by their
+// redelivery from nsq, the ones out of max_attempts are failed.
+type Journal struct {
+	Dir          string        `json:"dir" toml:"dir"`
+	Resume       bool          `json:"resume" toml:"resume"`
+	MaxAttempts  int           `json:"max_attempts" toml:"max_attempts"`
+	RequeueDelay toml.Duration `json:"requeue_delay" toml:"requeue_delay"`
+}
+
+// Idempotency controls how long a payload redelivered by nsq is dropped as a duplicate.
+type Idempotency struct {
+	Enabled bool          `json:"enabled" toml:"enabled"`
+	Window  toml.Duration `json:"window" toml:"window"`
+	File    string        `json:"file" toml:"file"`
+}
+
+// Workers controls the pool that processes the requests. Requests for
+// the same assembly are always processed one at a time.
+type Workers struct {
+	Size           int           `json:"size" toml:"size"`
+	ReportInterval toml.Duration `json:"report_interval" toml:"report_interval"`
+}
+
+// Workflows controls where the multi step workflows run by (workflow, run)
+// requests are stored and inspected.
+type Workflows struct {
+	Enabled bool   `json:"enabled" toml:"enabled"`
+	Dir     string `json:"dir" toml:"dir"`
+}
+
+// Batches controls where the batch operations run by (batch, run) requests
+// are stored along with their per assembly reports.
+type Batches struct {
+	Enabled bool   `json:"enabled" toml:"enabled"`
+	Dir     string `json:"dir" toml:"dir"`
+}
+
+// Logs controls where the logs of the boxes are kept, so they can be read
+// back and followed from a cursor. The segments of a box are rotated at
+// segment_size, the oldest past segments are removed. The logs other publishers
+// put on the nsq topic of a box are kept too.
+type Logs struct {
+	Enabled     bool      `json:"enabled" toml:"enabled"`
+	Dir         string    `json:"dir" toml:"dir"`
+	SegmentSize toml.Size `json:"segment_size" toml:"segment_size"`
+	Segments    int       `json:"segments" toml:"segments"`
 }
 
 /*
@@ -94,9 +183,50 @@ func NewConfig() *Config {
 		VCPUPercentage: DefaultCpuThrottle,
 	}
 
+	j := Journal{
+		Dir:          DefaultJournalDir,
+		Resume:       true,
+		MaxAttempts:  DefaultMaxAttempts,
+		RequeueDelay: toml.Duration(DefaultRequeueDelay),
+	}
+
+	wk := Workers{
+		Size:           DefaultWorkers,
+		ReportInterval: toml.Duration(DefaultReportInterval),
+	}
+
+	id := Idempotency{
+		Enabled: true,
+		Window:  toml.Duration(DefaultIdempotencyWindow),
+		File:    DefaultIdempotencyFile,
+	}
+
+	wf := Workflows{
+		Enabled: true,
+		Dir:     DefaultWorkflowDir,
+	}
+
+	bt := Batches{
+		Enabled: true,
+		Dir:     DefaultBatchDir,
+	}
+
+	lg := Logs{
+		Enabled:     true,
+		Dir:         DefaultLogDir,
+		SegmentSize: toml.Size(provision.DefaultLogSegmentSize),
+		Segments:    provision.DefaultLogSegments,
+	}
+
 	return &Config{
-		Provider: DefaultProvider,
-		One:      o,
+		Provider:    DefaultProvider,
+		One:         o,
+		Journal:     j,
+		Workers:     wk,
+		Idempotency: id,
+		Workflows:   wf,
+		Batches:     bt,
+		Logs:        lg,
 	}
 }
 
@@ -116,6 +246,9 @@ func (c Config) String() string {
 		b.Write([]byte(api.TEMPLATE + "\t" + v.OneTemplate + "\n"))
 		b.Write([]byte(api.IMAGE + "    \t" + v.Image + "\n"))
 		b.Write([]byte(api.VCPU_PERCENTAGE + "\t" + v.VCPUPercentage + "\n"))
+		if v.MigrateUrl != "" {
+			b.Write([]byte("migrate_url" + "\t" + v.MigrateUrl + "\n"))
+		}
 		for _, k := range v.Clusters {
 			if k.Enabled {
 				b.Write([]byte(api.CLUSTER + "\t" + k.ClusterId + "  storage type" + k.StorageType + "\n"))
@@ -123,6 +256,14 @@ func (c Config) String() string {
 		}
 		b.Write([]byte("---\n"))
 	}
+	b.Write([]byte("journal      " + "\t" + c.Journal.Dir + "\n"))
+	b.Write([]byte("resume       " + "\t" + strconv.FormatBool(c.Journal.Resume) + "\n"))
+	b.Write([]byte("max_attempts " + "\t" + strconv.Itoa(c.Journal.MaxAttempts) + "\n"))
+	b.Write([]byte("workers      " + "\t" + strconv.Itoa(c.Workers.Size) + "\n"))
+	b.Write([]byte("idempotency  " + "\t" + strconv.FormatBool(c.Idempotency.Enabled) + " " + c.Idempotency.Window.String() + "\n"))
+	b.Write([]byte("workflows    " + "\t" + strconv.FormatBool(c.Workflows.Enabled) + " " + c.Workflows.Dir + "\n"))
+	b.Write([]byte("batches      " + "\t" + strconv.FormatBool(c.Batches.Enabled) + " " + c.Batches.Dir + "\n"))
+	b.Write([]byte("logs         " + "\t" + strconv.FormatBool(c.Logs.Enabled) + " " + c.Logs.Dir + "\n"))
 	fmt.Fprintln(w)
 	w.Flush()
 	return strings.TrimSpace(b.String())
@@ -31,3 +31,8 @@ func (h *Handler) serveNSQ(r *carton.Requests) error {
 
 	return nil
 }
+
+// fail gives up on the request, the assemblies it operates on are marked as errored.
+func (h *Handler) fail(r *carton.Requests, cause error) error {
+	return carton.NewReqOperator(r).Fail(cause)
+}
@@ -0,0 +1,179 @@
+package deployd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/megamsys/vertice/carton"
+)
+
+const (
+	journalExt = ".json"
+
+	// EntryQueued is the status of a request that is journaled but not picked yet.
+	EntryQueued = "queued"
+	// EntryRunning is the status of a request whose MegdProcessor is running.
+	EntryRunning = "running"
+)
+
+// JournalEntry is a single in-flight carton request stored on the disk.
+type JournalEntry struct {
+	Id        string           `json:"id"`
+	Request   *carton.Requests `json:"request"`
+	Status    string           `json:"status"`
+	Attempts  int              `json:"attempts"`
+	LastError string           `json:"last_error"`
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
+}
+
+// Journal is a durable record of the carton requests accepted by deployd.
+// An entry is written before the request is processed and removed once it
+// is acked, so the entries found at startup are the ones a crash left behind.
+type Journal struct {
+	sync.Mutex
+	dir       string
+	recovered map[string]bool
+}
+
+// NewJournal returns a journal that stores its entries under dir.
+func NewJournal(dir string) (*Journal, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("unable to create journal %s\n --> %s", dir, err)
+	}
+	return &Journal{dir: dir, recovered: make(map[string]bool)}, nil
+}
+
+// Append journals the request r under id. A redelivered request keeps its
+// original entry and just bumps the attempts.
+func (j *Journal) Append(id string, r *carton.Requests) (*JournalEntry, error) {
+	j.Lock()
+	defer j.Unlock()
+	e, err := j.read(id)
+	if err != nil {
+		e = &JournalEntry{Id: id, Request: r, CreatedAt: time.Now()}
+	}
+	e.Status = EntryQueued
+	e.Attempts++
+	return e, j.write(e)
+}
+
+// Running marks the entry as picked by a worker.
+func (j *Journal) Running(id string) error {
+	return j.update(id, func(e *JournalEntry) {
+		e.Status = EntryRunning
+	})
+}
+
+// Requeue records the failure of the last attempt and puts the entry back in
+// the queued status.
+func (j *Journal) Requeue(id string, cause error) error {
+	return j.update(id, func(e *JournalEntry) {
+		e.Status = EntryQueued
+		e.LastError = cause.Error()
+	})
+}
+
+// Ack removes the entry from the journal.
+func (j *Journal) Ack(id string) error {
+	j.Lock()
+	defer j.Unlock()
+	if err := os.Remove(j.path(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Pending returns the entries left over in the journal, oldest first.
+// The ids are remembered so that a redelivery of the same request is
+// recognized by IsRecovered.
+func (j *Journal) Pending() ([]*JournalEntry, error) {
+	j.Lock()
+	defer j.Unlock()
+	files, err := ioutil.ReadDir(j.dir)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*JournalEntry, 0)
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), journalExt) {
+			continue
+		}
+		e, err := j.read(strings.TrimSuffix(f.Name(), journalExt))
+		if err != nil {
+			log.Errorf("skip journal entry %s : %s", f.Name(), err)
+			continue
+		}
+		j.recovered[e.Id] = true
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(a, b int) bool {
+		return entries[a].CreatedAt.Before(entries[b].CreatedAt)
+	})
+	return entries, nil
+}
+
+// IsRecovered returns true when id was left over from a previous run.
+func (j *Journal) IsRecovered(id string) bool {
+	j.Lock()
+	defer j.Unlock()
+	return j.recovered[id]
+}
+
+// Forget stops recognizing id as recovered, once its recovery failed its
+// redelivery is processed again.
+func (j *Journal) Forget(id string) {
+	j.Lock()
+	defer j.Unlock()
+	delete(j.recovered, id)
+}
+
+func (j *Journal) update(id string, fn func(e *JournalEntry)) error {
+	j.Lock()
+	defer j.Unlock()
+	e, err := j.read(id)
+	if err != nil {
+		return err
+	}
+	fn(e)
+	return j.write(e)
+}
+
+func (j *Journal) path(id string) string {
+	return filepath.Join(j.dir, id+journalExt)
+}
+
+func (j *Journal) read(id string) (*JournalEntry, error) {
+	b, err := ioutil.ReadFile(j.path(id))
+	if err != nil {
+		return nil, err
+	}
+	e := &JournalEntry{}
+	if err = json.Unmarshal(b, e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+//the entry is written to a temp file and renamed, so a crash never leaves
+//a half written entry behind.
+func (j *Journal) write(e *JournalEntry) error {
+	e.UpdatedAt = time.Now()
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	tmp := j.path(e.Id) + ".tmp"
+	if err = ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, j.path(e.Id))
+}
@@ -0,0 +1,59 @@
+package deployd
+
+import (
+	"errors"
+
+	"github.com/megamsys/vertice/carton"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestJournalAppendAndAck(c *check.C) {
+	j, err := NewJournal(c.MkDir())
+	c.Assert(err, check.IsNil)
+	r := &carton.Requests{Id: "RER00001", CatId: "ASM00001", Category: carton.STATE, Action: carton.CREATE}
+	e, err := j.Append(r.Id, r)
+	c.Assert(err, check.IsNil)
+	c.Assert(e.Status, check.Equals, EntryQueued)
+	c.Assert(e.Attempts, check.Equals, 1)
+	c.Assert(j.Running(r.Id), check.IsNil)
+	pending, err := j.Pending()
+	c.Assert(err, check.IsNil)
+	c.Assert(pending, check.HasLen, 1)
+	c.Assert(pending[0].Status, check.Equals, EntryRunning)
+	c.Assert(pending[0].Request.CatId, check.Equals, "ASM00001")
+	c.Assert(j.Ack(r.Id), check.IsNil)
+	pending, err = j.Pending()
+	c.Assert(err, check.IsNil)
+	c.Assert(pending, check.HasLen, 0)
+}
+
+func (s *S) TestJournalRequeueKeepsEntry(c *check.C) {
+	j, err := NewJournal(c.MkDir())
+	c.Assert(err, check.IsNil)
+	r := &carton.Requests{Id: "RER00002", Category: carton.SNAPSHOT, Action: carton.SNAPCREATE}
+	_, err = j.Append(r.Id, r)
+	c.Assert(err, check.IsNil)
+	c.Assert(j.Requeue(r.Id, errors.New("one is down")), check.IsNil)
+	e, err := j.Append(r.Id, r)
+	c.Assert(err, check.IsNil)
+	c.Assert(e.Attempts, check.Equals, 2)
+	c.Assert(e.LastError, check.Equals, "one is down")
+}
+
+func (s *S) TestJournalRecoveredAfterRestart(c *check.C) {
+	dir := c.MkDir()
+	j, err := NewJournal(dir)
+	c.Assert(err, check.IsNil)
+	r := &carton.Requests{Id: "RER00003", Category: carton.CONTROL, Action: carton.STOP}
+	_, err = j.Append(r.Id, r)
+	c.Assert(err, check.IsNil)
+	c.Assert(j.IsRecovered(r.Id), check.Equals, false)
+	restarted, err := NewJournal(dir)
+	c.Assert(err, check.IsNil)
+	pending, err := restarted.Pending()
+	c.Assert(err, check.IsNil)
+	c.Assert(pending, check.HasLen, 1)
+	c.Assert(restarted.IsRecovered(r.Id), check.Equals, true)
+	restarted.Forget(r.Id)
+	c.Assert(restarted.IsRecovered(r.Id), check.Equals, false)
+}
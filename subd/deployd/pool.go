@@ -0,0 +1,217 @@
+package deployd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/megamsys/vertice/carton"
+)
+
+var errClosed = errors.New("deployd workers were closed")
+
+// ProcessFunc runs a single journaled request.
+type ProcessFunc func(id string, r *carton.Requests) error
+
+type job struct {
+	id   string
+	r    *carton.Requests
+	keys []string //the assemblies it operates.
+	done func(error)
+}
+
+//boxesOf are the keys of a request in the pool, the ids of the assemblies it
+//operates: a snapshot, disk or backup is of one assembly. The cat_id is the
+//key when they can't be read.
+var boxesOf = func(r *carton.Requests) []string {
+	ids, err := carton.NewReqOperator(r).AssemblyIds()
+	if err != nil {
+		log.Debugf("assemblies of %s %s.%s : %s", r.CatId, r.Category, r.Action, err)
+	}
+	if len(ids) == 0 {
+		return []string{r.CatId}
+	}
+	return ids
+}
+
+// WorkerStatus is the request a worker is currently busy with.
+type WorkerStatus struct {
+	Worker  int              `json:"worker"`
+	Id      string           `json:"id"`
+	Request *carton.Requests `json:"request"`
+	Since   time.Time        `json:"since"`
+}
+
+func (w WorkerStatus) idle() bool {
+	return w.Request == nil
+}
+
+// PoolStats reports the queue depth and the current work of each worker.
+type PoolStats struct {
+	Depth   int            `json:"depth"`
+	Workers []WorkerStatus `json:"workers"`
+}
+
+func (p PoolStats) String() string {
+	w := new(tabwriter.Writer)
+	var b bytes.Buffer
+	w.Init(&b, 0, 8, 0, '\t', 0)
+	b.Write([]byte("queue depth" + "\t" + strconv.Itoa(p.Depth) + "\n"))
+	for _, v := range p.Workers {
+		if v.idle() {
+			b.Write([]byte("worker " + strconv.Itoa(v.Worker) + "\t" + "idle" + "\n"))
+			continue
+		}
+		b.Write([]byte(fmt.Sprintf("worker %d\t%s %s.%s (%s)\n", v.Worker, v.Request.CatId,
+			v.Request.Category, v.Request.Action, time.Since(v.Since).String())))
+	}
+	fmt.Fprintln(w)
+	w.Flush()
+	return b.String()
+}
+
+// Pool is a bounded set of workers running carton requests. Requests on the
+// same assembly, be it through its assemblies or one of its snapshots, disks
+// or backups, are run one after another in the order they were submitted;
+// requests on different assemblies run in parallel.
+type Pool struct {
+	sync.Mutex
+	cond    *sync.Cond
+	fn      ProcessFunc
+	queued  []*job
+	running map[string]bool //the assemblies of the running requests.
+	workers []WorkerStatus
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+// NewPool starts size workers that run the submitted requests with fn.
+func NewPool(size int, fn ProcessFunc) *Pool {
+	if size < 1 {
+		size = 1
+	}
+	p := &Pool{
+		fn:      fn,
+		running: make(map[string]bool),
+		workers: make([]WorkerStatus, size),
+	}
+	p.cond = sync.NewCond(p)
+	for i := range p.workers {
+		p.workers[i].Worker = i
+		p.wg.Add(1)
+		go p.work(i)
+	}
+	return p
+}
+
+// Submit queues the request behind the ones already queued for the same
+// assemblies. done is called with the result once the request is processed.
+func (p *Pool) Submit(id string, r *carton.Requests, done func(error)) {
+	keys := boxesOf(r)
+	p.Lock()
+	defer p.Unlock()
+	if p.closed {
+		if done != nil {
+			go done(errClosed)
+		}
+		return
+	}
+	p.queued = append(p.queued, &job{id: id, r: r, keys: keys, done: done})
+	p.cond.Broadcast()
+}
+
+// Stats returns the queue depth and what each worker is doing.
+func (p *Pool) Stats() PoolStats {
+	p.Lock()
+	defer p.Unlock()
+	workers := make([]WorkerStatus, len(p.workers))
+	copy(workers, p.workers)
+	return PoolStats{Depth: len(p.queued), Workers: workers}
+}
+
+// Close stops the workers once their current request is done. The requests
+// still queued are done with errClosed, they are left in the journal to be
+// resumed on the next start.
+func (p *Pool) Close() {
+	p.Lock()
+	p.closed = true
+	queued := p.queued
+	p.queued = nil
+	p.cond.Broadcast()
+	p.Unlock()
+	for _, j := range queued {
+		if j.done != nil {
+			j.done(errClosed)
+		}
+	}
+	p.wg.Wait()
+}
+
+func (p *Pool) work(i int) {
+	defer p.wg.Done()
+	for {
+		j := p.next(i)
+		if j == nil {
+			return
+		}
+		err := p.fn(j.id, j.r)
+		if j.done != nil {
+			j.done(err)
+		}
+		p.release(i, j.keys)
+	}
+}
+
+func (p *Pool) next(i int) *job {
+	p.Lock()
+	defer p.Unlock()
+	for !p.closed {
+		if k := p.runnable(); k >= 0 {
+			j := p.queued[k]
+			p.queued = append(p.queued[:k], p.queued[k+1:]...)
+			for _, key := range j.keys {
+				p.running[key] = true
+			}
+			p.workers[i] = WorkerStatus{Worker: i, Id: j.id, Request: j.r, Since: time.Now()}
+			return j
+		}
+		p.cond.Wait()
+	}
+	return nil
+}
+
+//runnable is the first queued job whose assemblies aren't running nor wanted
+//by a job queued before it, -1 when there is none.
+func (p *Pool) runnable() int {
+	wanted := make(map[string]bool)
+	for k, j := range p.queued {
+		free := true
+		for _, key := range j.keys {
+			if p.running[key] || wanted[key] {
+				free = false
+			}
+		}
+		if free {
+			return k
+		}
+		for _, key := range j.keys {
+			wanted[key] = true
+		}
+	}
+	return -1
+}
+
+func (p *Pool) release(i int, keys []string) {
+	p.Lock()
+	defer p.Unlock()
+	for _, key := range keys {
+		delete(p.running, key)
+	}
+	p.workers[i] = WorkerStatus{Worker: i}
+	p.cond.Broadcast()
+}
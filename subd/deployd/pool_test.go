@@ -0,0 +1,172 @@
+package deployd
+
+import (
+	"sync"
+	"time"
+
+	"github.com/megamsys/vertice/carton"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestPoolSerializesSameAssembly(c *check.C) {
+	var mu sync.Mutex
+	active := make(map[string]int)
+	overlap := false
+	order := make([]string, 0)
+	fn := func(id string, r *carton.Requests) error {
+		mu.Lock()
+		active[r.CatId]++
+		if active[r.CatId] > 1 {
+			overlap = true
+		}
+		order = append(order, id)
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		active[r.CatId]--
+		mu.Unlock()
+		return nil
+	}
+	p := NewPool(4, fn)
+	var wg sync.WaitGroup
+	for _, id := range []string{"stop", "snapcreate", "start"} {
+		wg.Add(1)
+		p.Submit(id, &carton.Requests{CatId: "ASM00001"}, func(error) { wg.Done() })
+	}
+	wg.Wait()
+	p.Close()
+	c.Assert(overlap, check.Equals, false)
+	c.Assert(order, check.DeepEquals, []string{"stop", "snapcreate", "start"})
+}
+
+func (s *S) TestPoolRunsAssembliesInParallel(c *check.C) {
+	release := make(chan struct{})
+	started := make(chan string, 2)
+	fn := func(id string, r *carton.Requests) error {
+		started <- r.CatId
+		<-release
+		return nil
+	}
+	p := NewPool(2, fn)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	p.Submit("RER00001", &carton.Requests{CatId: "ASM00001"}, func(error) { wg.Done() })
+	p.Submit("RER00002", &carton.Requests{CatId: "ASM00002"}, func(error) { wg.Done() })
+	<-started
+	<-started
+	stats := p.Stats()
+	c.Assert(stats.Depth, check.Equals, 0)
+	c.Assert(stats.Workers[0].idle(), check.Equals, false)
+	c.Assert(stats.Workers[1].idle(), check.Equals, false)
+	close(release)
+	wg.Wait()
+	p.Close()
+}
+
+func (s *S) TestPoolStatsQueueDepth(c *check.C) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	p := NewPool(1, func(id string, r *carton.Requests) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	})
+	var wg sync.WaitGroup
+	wg.Add(3)
+	for _, id := range []string{"RER00001", "RER00002", "RER00003"} {
+		p.Submit(id, &carton.Requests{CatId: id}, func(error) { wg.Done() })
+	}
+	<-started
+	stats := p.Stats()
+	c.Assert(stats.Depth, check.Equals, 2)
+	c.Assert(stats.Workers[0].Id, check.Equals, "RER00001")
+	go func() {
+		for range started {
+		}
+	}()
+	close(release)
+	wg.Wait()
+	p.Close()
+	close(started)
+}
+
+func (s *S) TestPoolCloseDoesTheQueued(c *check.C) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	p := NewPool(1, func(id string, r *carton.Requests) error {
+		close(started)
+		<-release
+		return nil
+	})
+	var mu sync.Mutex
+	results := make(map[string]error)
+	done := func(id string) func(error) {
+		return func(err error) {
+			mu.Lock()
+			results[id] = err
+			mu.Unlock()
+		}
+	}
+	p.Submit("RER00001", &carton.Requests{CatId: "ASM00001"}, done("RER00001"))
+	<-started
+	p.Submit("RER00002", &carton.Requests{CatId: "ASM00001"}, done("RER00002"))
+	p.Submit("RER00003", &carton.Requests{CatId: "ASM00002"}, done("RER00003"))
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+	}()
+	p.Close()
+	c.Assert(results, check.DeepEquals, map[string]error{"RER00001": nil, "RER00002": errClosed, "RER00003": errClosed})
+	closed := make(chan error)
+	p.Submit("RER00004", &carton.Requests{CatId: "ASM00003"}, func(err error) { closed <- err })
+	c.Assert(<-closed, check.Equals, errClosed)
+}
+
+func (s *S) TestPoolSerializesSnapshotOfAssembly(c *check.C) {
+	defer func(b func(*carton.Requests) []string) { boxesOf = b }(boxesOf)
+	boxes := map[string][]string{
+		"AMS00001": []string{"ASM00001", "ASM00002"},
+		"SNP00001": []string{"ASM00002"},
+		"AMS00002": []string{"ASM00003"},
+	}
+	boxesOf = func(r *carton.Requests) []string { return boxes[r.CatId] }
+	var mu sync.Mutex
+	active := make(map[string]int)
+	overlap := false
+	order := make([]string, 0)
+	fn := func(id string, r *carton.Requests) error {
+		mu.Lock()
+		for _, box := range boxes[r.CatId] {
+			active[box]++
+			if active[box] > 1 {
+				overlap = true
+			}
+		}
+		order = append(order, id)
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		for _, box := range boxes[r.CatId] {
+			active[box]--
+		}
+		mu.Unlock()
+		return nil
+	}
+	p := NewPool(4, fn)
+	var wg sync.WaitGroup
+	wg.Add(4)
+	p.Submit("stop", &carton.Requests{CatId: "AMS00001", Category: carton.CONTROL, Action: carton.STOP}, func(error) { wg.Done() })
+	p.Submit("snapcreate", &carton.Requests{CatId: "SNP00001", Category: carton.SNAPSHOT, Action: carton.SNAPCREATE}, func(error) { wg.Done() })
+	p.Submit("start", &carton.Requests{CatId: "AMS00001", Category: carton.CONTROL, Action: carton.START}, func(error) { wg.Done() })
+	p.Submit("other", &carton.Requests{CatId: "AMS00002", Category: carton.CONTROL, Action: carton.STOP}, func(error) { wg.Done() })
+	wg.Wait()
+	p.Close()
+	c.Assert(overlap, check.Equals, false)
+	ours := make([]string, 0)
+	for _, id := range order {
+		if id != "other" {
+			ours = append(ours, id)
+		}
+	}
+	c.Assert(ours, check.DeepEquals, []string{"stop", "snapcreate", "start"})
+}
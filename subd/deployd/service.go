@@ -1,14 +1,17 @@
 package deployd
 
 import (
+	"errors"
 	"fmt"
 	"sync"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	nsq "github.com/crackcomm/nsqueue/consumer"
 	"github.com/megamsys/libgo/cmd"
 	constants "github.com/megamsys/libgo/utils"
 	"github.com/megamsys/vertice/carton"
+	"github.com/megamsys/vertice/instrument"
 	"github.com/megamsys/vertice/meta"
 	"github.com/megamsys/vertice/provision"
 	_ "github.com/megamsys/vertice/provision/one"
@@ -17,8 +20,13 @@ import (
 const (
 	TOPIC       = "vms"
 	maxInFlight = 150
+
+	// touchInterval keeps nsqd from timing out a message whose request is still running.
+	touchInterval = 30 * time.Second
 )
 
+var errInterrupted = errors.New("request was interrupted by a restart of vertice")
+
 // Service manages the listener and handler for an HTTP endpoint.
 type Service struct {
 	wg       sync.WaitGroup
@@ -27,6 +35,9 @@ type Service struct {
 	Consumer *nsq.Consumer
 	Meta     *meta.Config
 	Deployd  *Config
+	Journal  *Journal
+	Pool     *Pool
+	stop     chan struct{}
 }
 
 // NewService returns a new instance of Service.
@@ -43,6 +54,56 @@ func NewService(c *meta.Config, d *Config) *Service {
 
 // Open starts the service
 func (s *Service) Open() error {
+	j, err := NewJournal(s.Deployd.Journal.Dir)
+	if err != nil {
+		return err
+	}
+	s.Journal = j
+	if s.Deployd.Idempotency.Enabled {
+		st, err := carton.NewIdempotencyStore(time.Duration(s.Deployd.Idempotency.Window), s.Deployd.Idempotency.File)
+		if err != nil {
+			return err
+		}
+		carton.Idempotency = st
+	}
+	if s.Deployd.Workflows.Enabled {
+		wf, err := carton.NewWorkflowStore(s.Deployd.Workflows.Dir)
+		if err != nil {
+			return err
+		}
+		carton.Workflows = wf
+	}
+	if s.Deployd.Batches.Enabled {
+		bt, err := carton.NewBatchStore(s.Deployd.Batches.Dir)
+		if err != nil {
+			return err
+		}
+		carton.Batches = bt
+	}
+	if s.Deployd.Logs.Enabled {
+		lg, err := provision.NewLogStore(s.Deployd.Logs.Dir, int64(s.Deployd.Logs.SegmentSize), s.Deployd.Logs.Segments)
+		if err != nil {
+			return err
+		}
+		provision.Logs = lg
+		if err = lg.FollowAll(); err != nil {
+			return err
+		}
+	}
+	s.Pool = NewPool(s.Deployd.Workers.Size, s.process)
+	s.stop = make(chan struct{})
+	if s.Deployd.Workers.ReportInterval > 0 {
+		go s.report()
+	}
+	if s.Deployd.One.Enabled {
+		if err := s.setProvisioner(constants.PROVIDER_ONE); err != nil {
+			return err
+		}
+	}
+	//the requests left over are known before their redeliveries come in.
+	if err := s.recover(); err != nil {
+		return err
+	}
 	go func() error {
 		log.Info("starting deployd service")
 		if err := nsq.Register(TOPIC, "engine", maxInFlight, s.processNSQ); err != nil {
@@ -55,36 +116,226 @@ func (s *Service) Open() error {
 		nsq.Start(true)
 		return nil
 	}()
-	if s.Deployd.One.Enabled {
-		if err := s.setProvisioner(constants.PROVIDER_ONE); err != nil {
-			return err
-		}
-	}
 	return nil
 }
 
+// processNSQ journals the request and runs it. The message is acked or
+// requeued only after the request is processed.
 func (s *Service) processNSQ(msg *nsq.Message) {
 	log.Debugf(TOPIC + " queue received message  :" + string(msg.Body))
+	instrument.NSQConsumed.Inc(TOPIC)
+	msg.DisableAutoResponse()
 	p, err := carton.NewPayload(msg.Body)
 	if err != nil {
+		msg.Finish()
 		return
 	}
 	re, err := p.Convert()
+	if err == carton.ErrDuplicatePayload {
+		msg.Finish()
+		return
+	}
 	if err != nil {
 		log.Errorf("%s", err)
+		s.requeue(msg)
 		return
 	}
-	go s.Handler.serveNSQ(re)
+	id := re.Id
+	if id == "" {
+		id = string(msg.ID[:])
+	}
+	if s.Journal.IsRecovered(id) {
+		log.Infof("%s was recovered from the journal, dropping the redelivery", id)
+		//the message is finished, nsq doesn't deliver it again.
+		s.Journal.Forget(id)
+		msg.Finish()
+		return
+	}
+	if _, err = s.Journal.Append(id, re); err != nil {
+		log.Errorf("unable to journal %s : %s", id, err)
+		s.forget(re)
+		s.requeue(msg)
+		return
+	}
+	s.serve(id, re, msg)
 	return
 }
 
+// serve queues the request in the worker pool, the message is kept alive
+// while it waits behind other requests of the same assembly.
+func (s *Service) serve(id string, r *carton.Requests, msg *nsq.Message) {
+	done := make(chan struct{})
+	go touch(msg, done)
+	s.Pool.Submit(id, r, func(err error) {
+		close(done)
+		s.settle(id, r, msg, err)
+	})
+}
+
+func (s *Service) settle(id string, r *carton.Requests, msg *nsq.Message, err error) {
+	if err == nil {
+		msg.Finish()
+		return
+	}
+	//closed before it ran, it stays in the journal and nsq delivers it again.
+	if err == errClosed {
+		s.forget(r)
+		msg.Requeue(time.Duration(s.Deployd.Journal.RequeueDelay))
+		return
+	}
+	if int(msg.Attempts) < s.Deployd.Journal.MaxAttempts {
+		if jerr := s.Journal.Requeue(id, err); jerr != nil {
+			log.Errorf("unable to requeue %s in journal : %s", id, jerr)
+		}
+		s.forget(r)
+		msg.Requeue(time.Duration(s.Deployd.Journal.RequeueDelay))
+		return
+	}
+	s.giveUp(id, r, err)
+	msg.Finish()
+}
+
+// Dispatch journals a request that did not come from nsq (eg: a scheduled one)
+// and queues it in the worker pool. done is called with its result, a failed
+// request is dropped from the journal and not retried. One the workers were
+// closed on is left in the journal.
+func (s *Service) Dispatch(r *carton.Requests, done func(error)) error {
+	if s.Pool == nil {
+		return errors.New("deployd service is not open")
+	}
+	if _, err := s.Journal.Append(r.Id, r); err != nil {
+		return err
+	}
+	s.Pool.Submit(r.Id, r, func(err error) {
+		if err != nil && err != errClosed {
+			if jerr := s.Journal.Ack(r.Id); jerr != nil {
+				log.Errorf("unable to ack %s in journal : %s", r.Id, jerr)
+			}
+		}
+		done(err)
+	})
+	return nil
+}
+
+// process runs the request and acks its journal entry when it succeeds. A
+// failed ack is only logged, the request done isn't run again for it.
+func (s *Service) process(id string, r *carton.Requests) error {
+	if err := s.Journal.Running(id); err != nil {
+		log.Errorf("unable to mark %s running in journal : %s", id, err)
+	}
+	if err := s.Handler.serveNSQ(r); err != nil {
+		return err
+	}
+	if err := s.Journal.Ack(id); err != nil {
+		log.Errorf("unable to ack %s in journal : %s", id, err)
+	}
+	return nil
+}
+
+// giveUp fails the request and drops it from the journal.
+func (s *Service) giveUp(id string, r *carton.Requests, cause error) {
+	log.Errorf("giving up on %s %s.%s : %s", id, r.Category, r.Action, cause)
+	if err := s.Handler.fail(r, cause); err != nil {
+		log.Errorf("unable to fail %s : %s", id, err)
+	}
+	if err := s.Journal.Ack(id); err != nil {
+		log.Errorf("unable to ack %s in journal : %s", id, err)
+	}
+}
+
+// recover handles the requests left in the journal by the previous run. A
+// request is resumed, and its redeliveries are dropped; or, without resume,
+// left to its redelivery which runs it again as it was never seen. A request
+// out of attempts, or whose resume failed, is failed and not run again.
+func (s *Service) recover() error {
+	entries, err := s.Journal.Pending()
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.Attempts > s.Deployd.Journal.MaxAttempts {
+			s.giveUp(e.Id, e.Request, errInterrupted)
+			continue
+		}
+		if !s.Deployd.Journal.Resume {
+			log.Infof("%s %s.%s left %s is run again when redelivered", e.Id, e.Request.Category, e.Request.Action, e.Status)
+			if err := s.Journal.Ack(e.Id); err != nil {
+				log.Errorf("unable to ack %s in journal : %s", e.Id, err)
+			}
+			s.Journal.Forget(e.Id)
+			s.forget(e.Request)
+			continue
+		}
+		log.Infof("resuming %s %s.%s left %s", e.Id, e.Request.Category, e.Request.Action, e.Status)
+		e := e
+		s.Pool.Submit(e.Id, e.Request, func(err error) {
+			switch {
+			case err == nil && carton.Idempotency != nil:
+				//its redelivery is dropped as a duplicate from now on.
+				s.Journal.Forget(e.Id)
+			case err != nil && err != errClosed:
+				s.giveUp(e.Id, e.Request, err)
+			}
+		})
+	}
+	return nil
+}
+
+// forget lets the redelivery of a requeued request through the idempotency store.
+func (s *Service) forget(r *carton.Requests) {
+	if err := carton.ForgetRequest(r); err != nil {
+		log.Errorf("unable to forget %s : %s", r.IdempotencyKey(), err)
+	}
+}
+
+func (s *Service) requeue(msg *nsq.Message) {
+	if int(msg.Attempts) < s.Deployd.Journal.MaxAttempts {
+		msg.Requeue(time.Duration(s.Deployd.Journal.RequeueDelay))
+		return
+	}
+	msg.Finish()
+}
+
+// report logs the queue depth and the current work of each worker.
+func (s *Service) report() {
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-time.After(time.Duration(s.Deployd.Workers.ReportInterval)):
+			log.Infof("deployd workers\n%s", s.Pool.Stats())
+		}
+	}
+}
+
+func touch(msg *nsq.Message, done chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case <-time.After(touchInterval):
+			msg.Touch()
+		}
+	}
+}
+
 // Close closes the underlying subscribe channel.
 func (s *Service) Close() error {
 	if s.Consumer != nil {
 		s.Consumer.Stop()
 	}
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+	if s.Pool != nil {
+		s.Pool.Close()
+	}
 
 	s.wg.Wait()
+	if provision.Logs != nil {
+		provision.Logs.Close()
+	}
 	return nil
 }
 
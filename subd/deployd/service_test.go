@@ -1,8 +1,10 @@
 package deployd
 
 import (
-	"gopkg.in/check.v1"
 	"testing"
+
+	"github.com/megamsys/vertice/carton"
+	"gopkg.in/check.v1"
 )
 
 func Test(t *testing.T) {
@@ -16,6 +18,8 @@ type S struct {
 var _ = check.Suite(&S{})
 
 func (s *S) SetUpSuite(c *check.C) {
+	//the requests of the tests are on the assembly of their cat_id.
+	boxesOf = func(r *carton.Requests) []string { return []string{r.CatId} }
 	srv := NewService(nil, &Config{})
 	s.service = srv
 	c.Assert(srv, check.NotNil)
@@ -10,14 +10,87 @@ import (
 	"github.com/megamsys/libgo/cmd"
 )
 
+const (
+	// DefaultRouter is the router of the regions that don't choose one.
+	DefaultRouter = "route53"
+
+	// DefaultTTL is the ttl of the records set by the routers, in seconds.
+	DefaultTTL = 300
+)
+
 type Config struct {
-	Enabled   bool   `toml:"enabled"`
-	AccessKey string `toml:"access_key"`
-	SecretKey string `toml:"secret_key"`
+	Enabled   bool     `toml:"enabled"`
+	AccessKey string   `toml:"access_key"`
+	SecretKey string   `toml:"secret_key"`
+	Router    string   `toml:"router"`
+	Regions   []Region `toml:"region"`
+}
+
+// Region is the router of the assemblies of a region, with the settings of
+// its kind of router.
+type Region struct {
+	Region string `toml:"region"`
+	Router string `toml:"router"`
+	Zone   string `toml:"zone"`
+	TTL    int    `toml:"ttl"`
+
+	//rfc2136: the primary server (host:port) takes the updates signed by the tsig key.
+	Server        string `toml:"server"`
+	TSIGName      string `toml:"tsig_name"`
+	TSIGAlgorithm string `toml:"tsig_algorithm"`
+	TSIGSecret    string `toml:"tsig_secret"`
+
+	//powerdns: the http api of the server.
+	ApiUrl   string `toml:"api_url"`
+	ApiKey   string `toml:"api_key"`
+	ServerId string `toml:"server_id"`
+
+	//zonefile: the zone is written to file, served by the nameserver.
+	File       string `toml:"file"`
+	Nameserver string `toml:"nameserver"`
 }
 
 var R53 *Config
 
+// RouterOf is the name of the router of the region, as router.Get takes it:
+// the kind of router and the region, eg: rfc2136:chennai.
+func (c *Config) RouterOf(region string) string {
+	if c == nil {
+		return DefaultRouter
+	}
+	for _, r := range c.Regions {
+		if r.Region == region && r.Router != "" {
+			return r.Router + ":" + region
+		}
+	}
+	if c.Router != "" {
+		return c.Router
+	}
+	return DefaultRouter
+}
+
+// RegionOf is the config of the region of a router name, eg: rfc2136:chennai.
+func (c *Config) RegionOf(name string) (*Region, error) {
+	i := strings.Index(name, ":")
+	if c == nil || i < 0 {
+		return nil, fmt.Errorf("router %s has no region", name)
+	}
+	for k := range c.Regions {
+		if r := &c.Regions[k]; r.Region == name[i+1:] && r.Router == name[:i] {
+			return r, nil
+		}
+	}
+	return nil, fmt.Errorf("router %s isn't configured in [[dns.region]]", name)
+}
+
+// RecordTTL is the ttl of the records of the region.
+func (r *Region) RecordTTL() uint32 {
+	if r.TTL <= 0 {
+		return DefaultTTL
+	}
+	return uint32(r.TTL)
+}
+
 func (c Config) String() string {
 	w := new(tabwriter.Writer)
 	var b bytes.Buffer
@@ -27,6 +100,9 @@ func (c Config) String() string {
 	b.Write([]byte("enabled  " + "\t" + strconv.FormatBool(c.Enabled) + "\n"))
 	b.Write([]byte("access_key" + "\t" + c.AccessKey + "\n"))
 	b.Write([]byte("secret_key" + "\t" + c.SecretKey + "\n"))
+	for _, r := range c.Regions {
+		b.Write([]byte("region    " + "\t" + r.Region + " (" + r.Router + " " + r.Zone + ")\n"))
+	}
 	b.Write([]byte("---\n"))
 	fmt.Fprintln(w)
 	w.Flush()
@@ -36,6 +112,7 @@ func (c Config) String() string {
 func NewConfig() *Config {
 	return &Config{
 		Enabled: true,
+		Router:  DefaultRouter,
 	}
 }
 
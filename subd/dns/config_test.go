@@ -26,3 +26,39 @@ secret_key = "xxx"
 	c.Assert(cm.SecretKey, check.Equals, "xxx")
 	c.Assert(cm.AccessKey, check.Equals, ":9000")
 }
+
+func (s *S) TestDnsConfig_Regions(c *check.C) {
+	cm := NewConfig()
+	if _, err := toml.Decode(`
+enabled = true
+[[region]]
+  region = "chennai"
+  router = "rfc2136"
+  zone = "megambox.com"
+  server = "10.0.0.2:53"
+  tsig_name = "vertice"
+  tsig_secret = "c2VjcmV0"
+[[region]]
+  region = "paris"
+  router = "zonefile"
+  file = "/var/lib/vertice/megambox.com.zone"
+  ttl = 60
+`, cm); err != nil {
+		c.Fatal(err)
+	}
+	c.Assert(cm.Regions, check.HasLen, 2)
+	c.Assert(cm.RouterOf("chennai"), check.Equals, "rfc2136:chennai")
+	c.Assert(cm.RouterOf("paris"), check.Equals, "zonefile:paris")
+	c.Assert(cm.RouterOf("tokyo"), check.Equals, DefaultRouter)
+	r, err := cm.RegionOf("rfc2136:chennai")
+	c.Assert(err, check.IsNil)
+	c.Assert(r.Server, check.Equals, "10.0.0.2:53")
+	c.Assert(r.RecordTTL(), check.Equals, uint32(DefaultTTL))
+	r, err = cm.RegionOf("zonefile:paris")
+	c.Assert(err, check.IsNil)
+	c.Assert(r.RecordTTL(), check.Equals, uint32(60))
+	_, err = cm.RegionOf("powerdns:chennai")
+	c.Assert(err, check.NotNil)
+	var none *Config
+	c.Assert(none.RouterOf("chennai"), check.Equals, DefaultRouter)
+}
@@ -0,0 +1,101 @@
+package dnsd
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/megamsys/libgo/cmd"
+	"github.com/megamsys/vertice/toml"
+)
+
+const (
+	// DefaultBindAddress is where the dns server listens, on udp and tcp.
+	DefaultBindAddress = ":53"
+
+	// DefaultTTL is the ttl of the answers, in seconds. It is short as the
+	// addresses of the assemblies change.
+	DefaultTTL = 60
+
+	// DefaultSyncInterval is how often all the assemblies are read again.
+	DefaultSyncInterval = 5 * time.Minute
+)
+
+// DefaultPrivateNetworks are the clients that get the private addresses.
+var DefaultPrivateNetworks = []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "127.0.0.0/8", "fc00::/7", "::1/128"}
+
+// Config is the built-in dns server, authoritative for the zones of the
+// assemblies.
+type Config struct {
+	Enabled     bool   `toml:"enabled"`
+	BindAddress string `toml:"bind_address"`
+
+	//the zones answered (the domains of the assemblies), the other names are refused.
+	Zones      []string `toml:"zones"`
+	Nameserver string   `toml:"nameserver"`
+	TTL        int      `toml:"ttl"`
+
+	//the clients in private_networks get the private addresses of the assemblies,
+	//the others get the public addresses.
+	PrivateNetworks []string `toml:"private_networks"`
+
+	//the assemblies are read every sync_interval, the changes in between come as they happen.
+	SyncInterval toml.Duration `toml:"sync_interval"`
+}
+
+func NewConfig() *Config {
+	return &Config{
+		Enabled:         false,
+		BindAddress:     DefaultBindAddress,
+		TTL:             DefaultTTL,
+		PrivateNetworks: DefaultPrivateNetworks,
+		SyncInterval:    toml.Duration(DefaultSyncInterval),
+	}
+}
+
+// Networks parses the private networks, an address alone is a network of one.
+func (c *Config) Networks() ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(c.PrivateNetworks))
+	for _, n := range c.PrivateNetworks {
+		if !strings.Contains(n, "/") {
+			ip := net.ParseIP(n)
+			if ip == nil {
+				return nil, fmt.Errorf("private network %q isn't an address", n)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipn, err := net.ParseCIDR(n)
+		if err != nil {
+			return nil, fmt.Errorf("private network %q : %s", n, err)
+		}
+		nets = append(nets, ipn)
+	}
+	return nets, nil
+}
+
+func (c Config) String() string {
+	w := new(tabwriter.Writer)
+	var b bytes.Buffer
+	w.Init(&b, 0, 8, 0, '\t', 0)
+	b.Write([]byte(cmd.Colorfy("Config:", "white", "", "bold") + "\t" +
+		cmd.Colorfy("Dnsd", "cyan", "", "") + "\n"))
+	b.Write([]byte("enabled     " + "\t" + strconv.FormatBool(c.Enabled) + "\n"))
+	b.Write([]byte("bind_address" + "\t" + c.BindAddress + "\n"))
+	b.Write([]byte("zones       " + "\t" + strings.Join(c.Zones, ",") + "\n"))
+	b.Write([]byte("ttl         " + "\t" + strconv.Itoa(c.TTL) + "\n"))
+	b.Write([]byte("private     " + "\t" + strings.Join(c.PrivateNetworks, ",") + "\n"))
+	b.Write([]byte("sync        " + "\t" + c.SyncInterval.String() + "\n"))
+	b.Write([]byte("---\n"))
+	fmt.Fprintln(w)
+	w.Flush()
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,34 @@
+package dnsd
+
+import (
+	"net"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/check.v1"
+)
+
+// Ensure the configuration can be parsed.
+func (s *S) TestConfig_Parse(c *check.C) {
+	cm := NewConfig()
+	if _, err := toml.Decode(`
+enabled = true
+bind_address = "127.0.0.1:5353"
+zones = ["megambox.com", "megam.io"]
+private_networks = ["10.0.0.0/8", "192.168.1.7", "fd00::/8"]
+sync_interval = "1m"
+`, cm); err != nil {
+		c.Fatal(err)
+	}
+	c.Assert(cm.BindAddress, check.Equals, "127.0.0.1:5353")
+	c.Assert(cm.Zones, check.DeepEquals, []string{"megambox.com", "megam.io"})
+	c.Assert(cm.TTL, check.Equals, DefaultTTL)
+	c.Assert(cm.SyncInterval.String(), check.Equals, "1m0s")
+	nets, err := cm.Networks()
+	c.Assert(err, check.IsNil)
+	c.Assert(nets, check.HasLen, 3)
+	c.Assert(nets[1].Contains(net.ParseIP("192.168.1.7")), check.Equals, true)
+	c.Assert(nets[1].Contains(net.ParseIP("192.168.1.8")), check.Equals, false)
+	cm.PrivateNetworks = []string{"10.0.0.0/33"}
+	_, err = cm.Networks()
+	c.Assert(err, check.NotNil)
+}
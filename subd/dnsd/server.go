@@ -0,0 +1,162 @@
+package dnsd
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/megamsys/vertice/instrument"
+	"github.com/megamsys/vertice/router/dnsmsg"
+)
+
+const (
+	//a udp answer longer than udpSize is truncated, the client asks again over tcp.
+	udpSize = 512
+
+	tcpIdle = 10 * time.Second
+)
+
+// Server answers the queries on udp and tcp from the zone.
+type Server struct {
+	zone    *Zone
+	private []*net.IPNet
+	udp     net.PacketConn
+	tcp     net.Listener
+	wg      sync.WaitGroup
+}
+
+// Listen opens the udp and tcp listeners on addr.
+func Listen(addr string, z *Zone, private []*net.IPNet) (*Server, error) {
+	udp, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	//the tcp port is the one udp got, addr may have asked for any port.
+	tcp, err := net.Listen("tcp", udp.LocalAddr().String())
+	if err != nil {
+		udp.Close()
+		return nil, err
+	}
+	s := &Server{zone: z, private: private, udp: udp, tcp: tcp}
+	s.wg.Add(2)
+	go s.serveUDP()
+	go s.serveTCP()
+	return s, nil
+}
+
+// Addr is the address the server listens on.
+func (s *Server) Addr() net.Addr {
+	return s.udp.LocalAddr()
+}
+
+// Close stops the listeners and waits for them.
+func (s *Server) Close() error {
+	s.udp.Close()
+	s.tcp.Close()
+	s.wg.Wait()
+	return nil
+}
+
+//isPrivate is true for the clients in the private networks.
+func (s *Server) isPrivate(addr net.Addr) bool {
+	var ip net.IP
+	switch a := addr.(type) {
+	case *net.UDPAddr:
+		ip = a.IP
+	case *net.TCPAddr:
+		ip = a.IP
+	}
+	for _, n := range s.private {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+//answer is the answer to the query in wire format, nil when the query can't
+//be read enough to answer it.
+func (s *Server) answer(b []byte, from net.Addr, limit int) []byte {
+	q, err := dnsmsg.Unpack(b)
+	var res *dnsmsg.Message
+	switch {
+	case err == nil:
+		res = s.zone.Answer(q, s.isPrivate(from))
+	case len(b) >= 12:
+		log.Debugf("dnsd query of %s : %s", from, err)
+		res = &dnsmsg.Message{Id: uint16(b[0])<<8 | uint16(b[1]), Response: true, Rcode: dnsmsg.RcodeFormErr}
+	default:
+		return nil
+	}
+	view := "public"
+	if s.isPrivate(from) {
+		view = "private"
+	}
+	instrument.DNSQueries.Inc(view, rcodeLabel(res.Rcode))
+	wire, err := res.Pack()
+	if err == nil && limit > 0 && len(wire) > limit {
+		res.Truncated = true
+		res.Answers, res.Authority, res.Additional = nil, nil, nil
+		wire, err = res.Pack()
+	}
+	if err != nil {
+		log.Errorf("dnsd answer to %s : %s", from, err)
+		return nil
+	}
+	return wire
+}
+
+func rcodeLabel(rcode int) string {
+	if rcode == dnsmsg.RcodeSuccess {
+		return "NOERROR"
+	}
+	return dnsmsg.RcodeString(rcode)
+}
+
+func (s *Server) serveUDP() {
+	defer s.wg.Done()
+	b := make([]byte, 65535)
+	for {
+		n, from, err := s.udp.ReadFrom(b)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return
+		}
+		if wire := s.answer(b[:n], from, udpSize); wire != nil {
+			s.udp.WriteTo(wire, from)
+		}
+	}
+}
+
+func (s *Server) serveTCP() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.tcp.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				continue
+			}
+			return
+		}
+		go s.serveConn(conn)
+	}
+}
+
+//serveConn answers the queries of a tcp client until it is idle for tcpIdle.
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+	for {
+		conn.SetDeadline(time.Now().Add(tcpIdle))
+		b, err := dnsmsg.ReadTCP(conn)
+		if err != nil {
+			return
+		}
+		wire := s.answer(b, conn.RemoteAddr(), 0)
+		if wire == nil || dnsmsg.WriteTCP(conn, wire) != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package dnsd
+
+import (
+	"net"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	constants "github.com/megamsys/libgo/utils"
+	"github.com/megamsys/vertice/carton"
+)
+
+//assemblies are all the assemblies, read with the master credentials.
+var assemblies = carton.AssemblyBox
+
+// Service is the built-in dns server. It answers for the assemblies in the
+// zones with their addresses, kept as the assemblies change.
+type Service struct {
+	err    chan error
+	stop   chan struct{}
+	Config *Config
+	Zone   *Zone
+	server *Server
+}
+
+// NewService returns a new instance of Service.
+func NewService(c *Config) *Service {
+	ttl := c.TTL
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &Service{
+		err:    make(chan error),
+		Config: c,
+		Zone:   NewZone(c.Zones, c.Nameserver, uint32(ttl)),
+	}
+}
+
+// Open starts the service
+func (s *Service) Open() error {
+	log.Info("starting dnsd service")
+	if s.stop != nil {
+		return nil
+	}
+	nets, err := s.Config.Networks()
+	if err != nil {
+		return err
+	}
+	if s.server, err = Listen(s.Config.BindAddress, s.Zone, nets); err != nil {
+		return err
+	}
+	log.Infof("dnsd listening on %s for %s", s.server.Addr(), strings.Join(s.Config.Zones, ","))
+	carton.Watch(s)
+	s.stop = make(chan struct{})
+	go s.backgroundLoop()
+	return nil
+}
+
+func (s *Service) backgroundLoop() {
+	for {
+		if err := s.sync(); err != nil {
+			log.Errorf("dnsd sync failed : %s", err)
+		}
+		select {
+		case <-s.stop:
+			log.Info("dnsd terminating")
+			return
+		case <-time.After(time.Duration(s.Config.SyncInterval)):
+		}
+	}
+}
+
+//sync reads all the assemblies into the zone.
+func (s *Service) sync() error {
+	gen := s.Zone.Gen()
+	asms, err := assemblies()
+	if err != nil {
+		return err
+	}
+	hosts := make([]Host, 0, len(asms))
+	for i := range asms {
+		if h, ok := hostOf(&asms[i]); ok {
+			hosts = append(hosts, h)
+		}
+	}
+	s.Zone.Replace(hosts, gen)
+	log.Debugf("dnsd synced %d hosts of %d assemblies", len(hosts), len(asms))
+	return nil
+}
+
+// AssemblyChanged sets the records of an assembly whose addresses changed.
+func (s *Service) AssemblyChanged(a *carton.Assembly) {
+	if h, ok := hostOf(a); ok {
+		s.Zone.Set(h)
+		return
+	}
+	s.Zone.Remove(a.Id)
+}
+
+// AssemblyRemoved removes the records of a destroyed assembly.
+func (s *Service) AssemblyRemoved(id string) {
+	s.Zone.Remove(id)
+}
+
+//hostOf is the host of the assembly, false when it has no records: it is
+//destroyed, has no domain or no address.
+func hostOf(a *carton.Assembly) (Host, bool) {
+	if a.State == constants.DESTROYING || a.State == constants.DESTROYED {
+		return Host{}, false
+	}
+	name := a.GetFullName()
+	if !strings.Contains(name, ".") {
+		return Host{}, false
+	}
+	h := Host{
+		Id:      a.Id,
+		Name:    name,
+		Private: parseIPs(a.Outputs.Match(constants.PRIVATEIPV4), a.Outputs.Match(constants.PRIVATEIPV6)),
+		Public:  parseIPs(a.Outputs.Match(constants.PUBLICIPV4), a.Outputs.Match(constants.PUBLICIPV6)),
+		Texts:   []string{"asm_id=" + a.Id},
+	}
+	if region := a.Inputs.Match(carton.REGION); region != "" {
+		h.Texts = append(h.Texts, "region="+region)
+	}
+	//a container without addresses of its own is reached on the host it runs on.
+	if len(h.Private) == 0 && len(h.Public) == 0 && strings.Contains(a.Tosca, ".") && a.IsContainer() {
+		if host := a.HostName(); host != "" && net.ParseIP(host) == nil {
+			h.Target = host
+		}
+	}
+	return h, h.Target != "" || len(h.Private) > 0 || len(h.Public) > 0
+}
+
+//parseIPs reads the addresses of the outputs, a list is separated by commas.
+func parseIPs(values ...string) []net.IP {
+	var ips []net.IP
+	for _, v := range values {
+		for _, s := range strings.Split(v, ",") {
+			if ip := net.ParseIP(strings.TrimSpace(s)); ip != nil {
+				ips = append(ips, ip)
+			}
+		}
+	}
+	return ips
+}
+
+func (s *Service) Close() error {
+	if s.stop == nil {
+		return nil
+	}
+	carton.Unwatch(s)
+	close(s.stop)
+	s.stop = nil
+	return s.server.Close()
+}
+
+// Err returns a channel for fatal errors that occur on the listener.
+func (s *Service) Err() <-chan error { return s.err }
@@ -0,0 +1,136 @@
+package dnsd
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	constants "github.com/megamsys/libgo/utils"
+	"github.com/megamsys/vertice/carton"
+	"github.com/megamsys/vertice/router/dnsmsg"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type S struct{}
+
+var _ = check.Suite(&S{})
+
+func newAssembly(id, name, state string, outputs map[string][]string) carton.Assembly {
+	a := carton.Assembly{Id: id, Name: name, State: state, Tosca: "tosca.torpedo.ubuntu"}
+	a.Inputs.NukeAndSet(map[string][]string{carton.DOMAIN: {"megambox.com"}, carton.REGION: {"chennai"}})
+	a.Outputs.NukeAndSet(outputs)
+	return a
+}
+
+func (s *S) TestHostOf(c *check.C) {
+	a := newAssembly("ASM001", "myapp", "running", map[string][]string{
+		constants.PRIVATEIPV4: {"10.0.0.5, 10.0.0.7"},
+		constants.PUBLICIPV4:  {"103.56.92.5"},
+	})
+	h, ok := hostOf(&a)
+	c.Assert(ok, check.Equals, true)
+	c.Assert(h.Name, check.Equals, "myapp.megambox.com")
+	c.Assert(h.Private, check.DeepEquals, []net.IP{net.ParseIP("10.0.0.5"), net.ParseIP("10.0.0.7")})
+	c.Assert(h.Public, check.DeepEquals, []net.IP{net.ParseIP("103.56.92.5")})
+	c.Assert(h.Texts, check.DeepEquals, []string{"asm_id=ASM001", "region=chennai"})
+
+	a.State = constants.DESTROYING
+	_, ok = hostOf(&a)
+	c.Assert(ok, check.Equals, false)
+	a = newAssembly("ASM002", "noip", "running", map[string][]string{constants.PUBLICIPV4: {""}})
+	_, ok = hostOf(&a)
+	c.Assert(ok, check.Equals, false)
+}
+
+func (s *S) TestSyncAndWatch(c *check.C) {
+	defer func(f func() ([]carton.Assembly, error)) { assemblies = f }(assemblies)
+	assemblies = func() ([]carton.Assembly, error) {
+		return []carton.Assembly{
+			newAssembly("ASM001", "myapp", "running", map[string][]string{constants.PUBLICIPV4: {"103.56.92.5"}}),
+			newAssembly("ASM002", "gone", constants.DESTROYED, map[string][]string{constants.PUBLICIPV4: {"103.56.92.6"}}),
+		}, nil
+	}
+	cf := NewConfig()
+	cf.Zones = []string{"megambox.com"}
+	srv := NewService(cf)
+	c.Assert(srv.sync(), check.IsNil)
+	c.Assert(srv.Zone.Len(), check.Equals, 1)
+
+	//re-ip of an assembly, then destroy.
+	a := newAssembly("ASM001", "myapp", "running", map[string][]string{constants.PUBLICIPV4: {"103.56.92.50"}})
+	srv.AssemblyChanged(&a)
+	res := srv.Zone.Answer(query("myapp.megambox.com.", dnsmsg.TypeA), false)
+	c.Assert(res.Answers[0].IP().String(), check.Equals, "103.56.92.50")
+	srv.AssemblyRemoved("ASM001")
+	c.Assert(srv.Zone.Len(), check.Equals, 0)
+
+	assemblies = func() ([]carton.Assembly, error) { return nil, errors.New("gateway down") }
+	c.Assert(srv.sync(), check.ErrorMatches, "gateway down")
+}
+
+func exchange(c *check.C, network, addr string, q *dnsmsg.Message) *dnsmsg.Message {
+	wire, err := q.Pack()
+	c.Assert(err, check.IsNil)
+	if network == "tcp" {
+		res, err := dnsmsg.Exchange(addr, wire, time.Second)
+		c.Assert(err, check.IsNil)
+		return res
+	}
+	conn, err := net.Dial("udp", addr)
+	c.Assert(err, check.IsNil)
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Second))
+	_, err = conn.Write(wire)
+	c.Assert(err, check.IsNil)
+	b := make([]byte, 65535)
+	n, err := conn.Read(b)
+	c.Assert(err, check.IsNil)
+	res, err := dnsmsg.Unpack(b[:n])
+	c.Assert(err, check.IsNil)
+	return res
+}
+
+func (s *S) TestServer(c *check.C) {
+	z := newTestZone()
+	nets, err := NewConfig().Networks()
+	c.Assert(err, check.IsNil)
+	srv, err := Listen("127.0.0.1:0", z, nets)
+	c.Assert(err, check.IsNil)
+	defer srv.Close()
+	addr := srv.Addr().String()
+
+	//the clients on loopback are in the private view.
+	res := exchange(c, "udp", addr, query("myapp.megambox.com.", dnsmsg.TypeA))
+	c.Assert(res.Answers, check.HasLen, 1)
+	c.Assert(res.Answers[0].IP().String(), check.Equals, "10.0.0.5")
+	res = exchange(c, "tcp", addr, query("db.megambox.com.", dnsmsg.TypeA))
+	c.Assert(res.Answers[0].IP().String(), check.Equals, "10.0.0.6")
+
+	//an answer too long for udp is truncated, tcp has all of it.
+	var ips []net.IP
+	for i := 1; i <= 40; i++ {
+		ips = append(ips, net.IPv4(103, 56, 92, byte(i)))
+	}
+	z.Set(Host{Id: "ASM009", Name: "big.megambox.com", Public: ips})
+	res = exchange(c, "udp", addr, query("big.megambox.com.", dnsmsg.TypeA))
+	c.Assert(res.Truncated, check.Equals, true)
+	c.Assert(res.Answers, check.HasLen, 0)
+	res = exchange(c, "tcp", addr, query("big.megambox.com.", dnsmsg.TypeA))
+	c.Assert(res.Truncated, check.Equals, false)
+	c.Assert(res.Answers, check.HasLen, 40)
+}
+
+func (s *S) TestServerPublicView(c *check.C) {
+	srv, err := Listen("127.0.0.1:0", newTestZone(), nil)
+	c.Assert(err, check.IsNil)
+	defer srv.Close()
+	res := exchange(c, "udp", srv.Addr().String(), query("myapp.megambox.com.", dnsmsg.TypeA))
+	c.Assert(res.Answers[0].IP().String(), check.Equals, "103.56.92.5")
+	res = exchange(c, "udp", srv.Addr().String(), query("db.megambox.com.", dnsmsg.TypeA))
+	c.Assert(res.Rcode, check.Equals, dnsmsg.RcodeNXDomain)
+}
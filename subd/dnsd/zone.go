@@ -0,0 +1,283 @@
+package dnsd
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/megamsys/vertice/router/dnsmsg"
+)
+
+//the soa times of the zones: refresh, retry, expire.
+var soaTimes = []uint32{3600, 600, 1209600}
+
+// Host is the records of an assembly: the addresses it has in the private and
+// the public view, the name it is a cname of when it has no address, its texts.
+type Host struct {
+	Id      string
+	Name    string
+	Private []net.IP
+	Public  []net.IP
+	Target  string
+	Texts   []string
+}
+
+//addrs are the addresses of the host in a view, the private view falls back
+//to the public addresses.
+func (h *Host) addrs(private bool) []net.IP {
+	if private && len(h.Private) > 0 {
+		return h.Private
+	}
+	return h.Public
+}
+
+//visible is false for the hosts a view has no records of, eg: the hosts with
+//only private addresses aren't in the public view.
+func (h *Host) visible(private bool) bool {
+	return len(h.addrs(private)) > 0 || h.Target != ""
+}
+
+// Zone is the records of the hosts in the zones served. It is changed as the
+// assemblies change, a full sync replaces it.
+type Zone struct {
+	mu      sync.RWMutex
+	origins []string
+	ns      string
+	ttl     uint32
+	serial  uint32
+	hosts   map[string]*Host
+	names   map[string]*Host
+
+	//gen counts the changes, changed is the gen of the last change of a host
+	//so a sync doesn't undo what changed while it read the assemblies.
+	gen     uint64
+	changed map[string]uint64
+	now     func() time.Time
+}
+
+// NewZone returns the empty zones, ns is the nameserver of their soa.
+func NewZone(origins []string, ns string, ttl uint32) *Zone {
+	z := &Zone{
+		ns:      ns,
+		ttl:     ttl,
+		hosts:   make(map[string]*Host),
+		names:   make(map[string]*Host),
+		changed: make(map[string]uint64),
+		now:     time.Now,
+	}
+	for _, o := range origins {
+		z.origins = append(z.origins, fqdn(o))
+	}
+	z.bump()
+	return z
+}
+
+func fqdn(name string) string {
+	return dnsmsg.Fqdn(strings.ToLower(strings.TrimSpace(name)))
+}
+
+//bump moves the serial on, it is the unix time of the change unless the
+//changes are faster than a second.
+func (z *Zone) bump() {
+	z.gen++
+	if s := uint32(z.now().Unix()); s > z.serial {
+		z.serial = s
+		return
+	}
+	z.serial++
+}
+
+// Gen is the count of the changes, a sync started at gen keeps the changes
+// made after it.
+func (z *Zone) Gen() uint64 {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+	return z.gen
+}
+
+// Set adds the host or replaces the host of the same id.
+func (z *Zone) Set(h Host) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	z.bump()
+	z.set(h)
+	z.changed[h.Id] = z.gen
+}
+
+func (z *Zone) set(h Host) {
+	h.Name = fqdn(h.Name)
+	if h.Target != "" {
+		h.Target = fqdn(h.Target)
+	}
+	z.remove(h.Id)
+	z.hosts[h.Id] = &h
+	z.names[h.Name] = &h
+}
+
+// Remove removes the host of the id.
+func (z *Zone) Remove(id string) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	z.bump()
+	z.remove(id)
+	z.changed[id] = z.gen
+}
+
+func (z *Zone) remove(id string) {
+	if old, ok := z.hosts[id]; ok {
+		delete(z.hosts, id)
+		if z.names[old.Name] == old {
+			delete(z.names, old.Name)
+		}
+	}
+}
+
+// Replace makes the hosts the records of the zone, except for the hosts that
+// changed after gen.
+func (z *Zone) Replace(hosts []Host, gen uint64) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	keep := make(map[string]*Host)
+	for id, g := range z.changed {
+		if g > gen {
+			keep[id] = z.hosts[id]
+		}
+	}
+	z.hosts = make(map[string]*Host)
+	z.names = make(map[string]*Host)
+	for _, h := range hosts {
+		if _, ok := keep[h.Id]; !ok {
+			z.set(h)
+		}
+	}
+	for _, h := range keep {
+		if h != nil {
+			z.set(*h)
+		}
+	}
+	z.changed = make(map[string]uint64)
+	z.bump()
+}
+
+// Len is the count of the hosts.
+func (z *Zone) Len() int {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+	return len(z.hosts)
+}
+
+//origin is the zone of the name, empty when it isn't served.
+func (z *Zone) origin(name string) string {
+	best := ""
+	for _, o := range z.origins {
+		if (name == o || strings.HasSuffix(name, "."+o)) && len(o) > len(best) {
+			best = o
+		}
+	}
+	return best
+}
+
+func (z *Zone) soa(origin string) dnsmsg.RR {
+	ns := z.ns
+	if ns == "" {
+		ns = "ns1." + origin
+	}
+	return dnsmsg.SOA(origin, z.ttl, fqdn(ns), "hostmaster."+origin, z.serial, soaTimes[0], soaTimes[1], soaTimes[2], z.ttl)
+}
+
+func (z *Zone) nameserver(origin string) dnsmsg.RR {
+	ns := z.ns
+	if ns == "" {
+		ns = "ns1." + origin
+	}
+	return dnsmsg.NS(origin, z.ttl, fqdn(ns))
+}
+
+// Answer is the answer to the query in the view of the client, the private
+// view when private is true.
+func (z *Zone) Answer(q *dnsmsg.Message, private bool) *dnsmsg.Message {
+	res := &dnsmsg.Message{
+		Id:               q.Id,
+		Response:         true,
+		Opcode:           q.Opcode,
+		RecursionDesired: q.RecursionDesired,
+		Questions:        q.Questions,
+	}
+	switch {
+	case q.Opcode != dnsmsg.OpcodeQuery:
+		res.Rcode = dnsmsg.RcodeNotImp
+		return res
+	case len(q.Questions) != 1:
+		res.Rcode = dnsmsg.RcodeFormErr
+		return res
+	}
+	qn := q.Questions[0]
+	name := strings.ToLower(qn.Name)
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+	origin := z.origin(name)
+	if origin == "" || (qn.Class != dnsmsg.ClassINET && qn.Class != dnsmsg.ClassANY) {
+		res.Rcode = dnsmsg.RcodeRefused
+		return res
+	}
+	res.Authoritative = true
+	if name == origin {
+		if qn.Type == dnsmsg.TypeSOA || qn.Type == dnsmsg.TypeANY {
+			res.Answers = append(res.Answers, z.soa(origin))
+		}
+		if qn.Type == dnsmsg.TypeNS || qn.Type == dnsmsg.TypeANY {
+			res.Answers = append(res.Answers, z.nameserver(origin))
+		}
+		if len(res.Answers) == 0 {
+			res.Authority = []dnsmsg.RR{z.soa(origin)}
+		}
+		return res
+	}
+	h, ok := z.names[name]
+	if !ok || !h.visible(private) {
+		res.Rcode = dnsmsg.RcodeNXDomain
+		res.Authority = []dnsmsg.RR{z.soa(origin)}
+		return res
+	}
+	res.Answers = z.records(h, qn.Type, private)
+	if len(res.Answers) == 0 {
+		res.Authority = []dnsmsg.RR{z.soa(origin)}
+	}
+	return res
+}
+
+//records are the records of the host of the type, the cname and the records
+//of its target when the host is a cname.
+func (z *Zone) records(h *Host, t uint16, private bool) []dnsmsg.RR {
+	var rrs []dnsmsg.RR
+	if t == dnsmsg.TypeTXT || t == dnsmsg.TypeANY {
+		for _, txt := range h.Texts {
+			rrs = append(rrs, dnsmsg.TXT(h.Name, z.ttl, txt))
+		}
+	}
+	addrs := h.addrs(private)
+	if len(addrs) == 0 && h.Target != "" {
+		if t == dnsmsg.TypeTXT {
+			return rrs
+		}
+		rrs = append(rrs, dnsmsg.CNAME(h.Name, z.ttl, h.Target))
+		//the target served here is answered too, once: a cname of a cname stops.
+		if target, ok := z.names[h.Target]; ok && target.Target == "" && t != dnsmsg.TypeCNAME {
+			rrs = append(rrs, z.addresses(target, t, private)...)
+		}
+		return rrs
+	}
+	return append(rrs, z.addresses(h, t, private)...)
+}
+
+func (z *Zone) addresses(h *Host, t uint16, private bool) []dnsmsg.RR {
+	var rrs []dnsmsg.RR
+	for _, ip := range h.addrs(private) {
+		rr := dnsmsg.A(h.Name, z.ttl, ip)
+		if rr.Type == t || t == dnsmsg.TypeANY {
+			rrs = append(rrs, rr)
+		}
+	}
+	return rrs
+}
@@ -0,0 +1,126 @@
+package dnsd
+
+import (
+	"net"
+	"time"
+
+	"github.com/megamsys/vertice/router/dnsmsg"
+	"gopkg.in/check.v1"
+)
+
+func newTestZone() *Zone {
+	z := NewZone([]string{"megambox.com", "apps.megambox.com."}, "", 60)
+	z.now = func() time.Time { return time.Unix(1500000000, 0) }
+	z.Set(Host{
+		Id:      "ASM001",
+		Name:    "MyApp.megambox.com",
+		Private: []net.IP{net.ParseIP("10.0.0.5"), net.ParseIP("fd00::5")},
+		Public:  []net.IP{net.ParseIP("103.56.92.5")},
+		Texts:   []string{"asm_id=ASM001"},
+	})
+	z.Set(Host{Id: "ASM002", Name: "db.megambox.com", Private: []net.IP{net.ParseIP("10.0.0.6")}})
+	z.Set(Host{Id: "ASM003", Name: "web.apps.megambox.com", Target: "myapp.megambox.com"})
+	return z
+}
+
+func query(name string, t uint16) *dnsmsg.Message {
+	return &dnsmsg.Message{Id: 42, RecursionDesired: true, Questions: []dnsmsg.Question{{Name: name, Type: t, Class: dnsmsg.ClassINET}}}
+}
+
+func (s *S) TestAnswerViews(c *check.C) {
+	z := newTestZone()
+	res := z.Answer(query("myapp.megambox.com.", dnsmsg.TypeA), true)
+	c.Assert(res.Id, check.Equals, uint16(42))
+	c.Assert(res.Authoritative, check.Equals, true)
+	c.Assert(res.RecursionDesired, check.Equals, true)
+	c.Assert(res.Answers, check.DeepEquals, []dnsmsg.RR{dnsmsg.A("myapp.megambox.com.", 60, net.ParseIP("10.0.0.5"))})
+	res = z.Answer(query("myapp.megambox.com.", dnsmsg.TypeA), false)
+	c.Assert(res.Answers, check.DeepEquals, []dnsmsg.RR{dnsmsg.A("myapp.megambox.com.", 60, net.ParseIP("103.56.92.5"))})
+	res = z.Answer(query("myapp.megambox.com.", dnsmsg.TypeAAAA), true)
+	c.Assert(res.Answers, check.HasLen, 1)
+	c.Assert(res.Answers[0].IP().String(), check.Equals, "fd00::5")
+
+	//the public view has no ipv6, it is an answer without records.
+	res = z.Answer(query("myapp.megambox.com.", dnsmsg.TypeAAAA), false)
+	c.Assert(res.Rcode, check.Equals, dnsmsg.RcodeSuccess)
+	c.Assert(res.Answers, check.HasLen, 0)
+	c.Assert(res.Authority[0].Type, check.Equals, dnsmsg.TypeSOA)
+
+	//a host with only private addresses isn't in the public view.
+	res = z.Answer(query("db.megambox.com.", dnsmsg.TypeA), false)
+	c.Assert(res.Rcode, check.Equals, dnsmsg.RcodeNXDomain)
+	res = z.Answer(query("db.megambox.com.", dnsmsg.TypeA), true)
+	c.Assert(res.Answers, check.HasLen, 1)
+}
+
+func (s *S) TestAnswerCNameAndTXT(c *check.C) {
+	z := newTestZone()
+	res := z.Answer(query("web.apps.megambox.com.", dnsmsg.TypeA), false)
+	c.Assert(res.Answers, check.DeepEquals, []dnsmsg.RR{
+		dnsmsg.CNAME("web.apps.megambox.com.", 60, "myapp.megambox.com."),
+		dnsmsg.A("myapp.megambox.com.", 60, net.ParseIP("103.56.92.5")),
+	})
+	res = z.Answer(query("web.apps.megambox.com.", dnsmsg.TypeCNAME), false)
+	c.Assert(res.Answers, check.HasLen, 1)
+	res = z.Answer(query("myapp.megambox.com.", dnsmsg.TypeTXT), false)
+	c.Assert(res.Answers, check.DeepEquals, []dnsmsg.RR{dnsmsg.TXT("myapp.megambox.com.", 60, "asm_id=ASM001")})
+	res = z.Answer(query("myapp.megambox.com.", dnsmsg.TypeANY), true)
+	c.Assert(res.Answers, check.HasLen, 3)
+}
+
+func (s *S) TestAnswerZone(c *check.C) {
+	z := newTestZone()
+	res := z.Answer(query("megambox.com.", dnsmsg.TypeSOA), false)
+	c.Assert(res.Answers, check.HasLen, 1)
+	c.Assert(res.Answers[0].Name, check.Equals, "megambox.com.")
+	ns, n, err := dnsmsg.Name(res.Answers[0].Data)
+	c.Assert(err, check.IsNil)
+	c.Assert(ns, check.Equals, "ns1.megambox.com.")
+	mbox, _, err := dnsmsg.Name(res.Answers[0].Data[n:])
+	c.Assert(err, check.IsNil)
+	c.Assert(mbox, check.Equals, "hostmaster.megambox.com.")
+	res = z.Answer(query("apps.megambox.com.", dnsmsg.TypeNS), false)
+	c.Assert(res.Answers, check.HasLen, 1)
+	c.Assert(res.Answers[0].Type, check.Equals, dnsmsg.TypeNS)
+
+	res = z.Answer(query("nothere.megambox.com.", dnsmsg.TypeA), false)
+	c.Assert(res.Rcode, check.Equals, dnsmsg.RcodeNXDomain)
+	c.Assert(res.Authority[0].Name, check.Equals, "megambox.com.")
+	res = z.Answer(query("nothere.apps.megambox.com.", dnsmsg.TypeA), false)
+	c.Assert(res.Authority[0].Name, check.Equals, "apps.megambox.com.")
+
+	res = z.Answer(query("www.google.com.", dnsmsg.TypeA), false)
+	c.Assert(res.Rcode, check.Equals, dnsmsg.RcodeRefused)
+	c.Assert(res.Authoritative, check.Equals, false)
+	update := query("megambox.com.", dnsmsg.TypeSOA)
+	update.Opcode = dnsmsg.OpcodeUpdate
+	c.Assert(z.Answer(update, true).Rcode, check.Equals, dnsmsg.RcodeNotImp)
+}
+
+func (s *S) TestSetRemoveAndSerial(c *check.C) {
+	z := newTestZone()
+	serial := z.serial
+	z.Set(Host{Id: "ASM001", Name: "renamed.megambox.com", Public: []net.IP{net.ParseIP("103.56.92.9")}})
+	c.Assert(z.serial > serial, check.Equals, true)
+	c.Assert(z.Answer(query("myapp.megambox.com.", dnsmsg.TypeA), false).Rcode, check.Equals, dnsmsg.RcodeNXDomain)
+	c.Assert(z.Answer(query("renamed.megambox.com.", dnsmsg.TypeA), false).Answers, check.HasLen, 1)
+	z.Remove("ASM001")
+	c.Assert(z.Answer(query("renamed.megambox.com.", dnsmsg.TypeA), false).Rcode, check.Equals, dnsmsg.RcodeNXDomain)
+	c.Assert(z.Len(), check.Equals, 2)
+}
+
+func (s *S) TestReplaceKeepsLaterChanges(c *check.C) {
+	z := newTestZone()
+	gen := z.Gen()
+	//changed while the sync read the assemblies: ASM002 is removed, ASM004 is added.
+	z.Remove("ASM002")
+	z.Set(Host{Id: "ASM004", Name: "new.megambox.com", Public: []net.IP{net.ParseIP("103.56.92.4")}})
+	z.Replace([]Host{
+		{Id: "ASM001", Name: "myapp.megambox.com", Public: []net.IP{net.ParseIP("103.56.92.5")}},
+		{Id: "ASM002", Name: "db.megambox.com", Private: []net.IP{net.ParseIP("10.0.0.6")}},
+	}, gen)
+	c.Assert(z.Len(), check.Equals, 2)
+	c.Assert(z.Answer(query("db.megambox.com.", dnsmsg.TypeA), true).Rcode, check.Equals, dnsmsg.RcodeNXDomain)
+	c.Assert(z.Answer(query("new.megambox.com.", dnsmsg.TypeA), false).Answers, check.HasLen, 1)
+	c.Assert(z.Answer(query("web.apps.megambox.com.", dnsmsg.TypeA), false).Rcode, check.Equals, dnsmsg.RcodeNXDomain)
+}
@@ -4,6 +4,7 @@ import (
 	log "github.com/Sirupsen/logrus"
 	nsq "github.com/crackcomm/nsqueue/consumer"
 	"github.com/megamsys/libgo/events"
+	"github.com/megamsys/vertice/instrument"
 	"github.com/megamsys/vertice/meta"
 	"github.com/megamsys/vertice/subd/deployd"
 	"sync"
@@ -60,6 +61,7 @@ func (s *Service) Open() error {
 
 func (s *Service) processNSQ(msg *nsq.Message) {
 	log.Debugf(TOPIC + " queue received message  :" + string(msg.Body))
+	instrument.NSQConsumed.Inc(TOPIC)
 	pe, err := events.NewParseEvent(msg.Body)
 	if err != nil {
 		return
@@ -6,8 +6,19 @@ import (
 	"strconv"
 	"strings"
 	"text/tabwriter"
+	"time"
 
 	"github.com/megamsys/libgo/cmd"
+	"github.com/megamsys/vertice/hc"
+	"github.com/megamsys/vertice/toml"
+)
+
+const (
+	// DefaultHealthInterval is how often the backends are checked for /healthz.
+	DefaultHealthInterval = time.Minute
+
+	// DefaultActionsFile is where the actions asked over http are kept.
+	DefaultActionsFile = "/var/lib/megam/vertice/actions.json"
 )
 
 type Config struct {
@@ -16,6 +27,29 @@ type Config struct {
 	UseTls      bool   `toml:"use_tls"`
 	CertFile    string `toml:"cert_file"`
 	KeyFile     string `toml:"key_file"`
+
+	//the shell sessions are recorded (asciicast) in shell_recordings when it is set,
+	//and removed after shell_retention.
+	ShellRecordings string        `toml:"shell_recordings"`
+	ShellRetention  toml.Duration `toml:"shell_retention"`
+
+	//a console token opens one vm console before console_token_ttl, the console closes
+	//when idle for console_idle, a vm has at most console_max_viewers.
+	ConsoleTokenTTL   toml.Duration `toml:"console_token_ttl"`
+	ConsoleIdle       toml.Duration `toml:"console_idle"`
+	ConsoleMaxViewers int           `toml:"console_max_viewers"`
+
+	//an action asked at /assemblies/{id}/actions is polled until action_retention after it finished,
+	//the actions are kept in actions_file so they are polled after a restart.
+	ActionRetention toml.Duration `toml:"action_retention"`
+	ActionsFile     string        `toml:"actions_file"`
+
+	//the backends are checked every health_interval for /healthz, a check not done in
+	//health_timeout is down. vertice isn't ready while one of health_requires (names
+	//or kinds, eg: "nsq", "one:chennai") is down.
+	HealthInterval toml.Duration `toml:"health_interval"`
+	HealthTimeout  toml.Duration `toml:"health_timeout"`
+	HealthRequires []string      `toml:"health_requires"`
 }
 
 func (c Config) String() string {
@@ -27,6 +61,10 @@ func (c Config) String() string {
 	b.Write([]byte("enabled     " + "\t" + strconv.FormatBool(c.Enabled) + "\n"))
 	b.Write([]byte("bind_address" + "\t" + c.BindAddress + "\n"))
 	b.Write([]byte("usetls      " + "\t" + strconv.FormatBool(c.UseTls) + "\n"))
+	if c.ShellRecordings != "" {
+		b.Write([]byte("shell_recordings" + "\t" + c.ShellRecordings + " (" + c.ShellRetention.String() + ")\n"))
+	}
+	b.Write([]byte("health      " + "\t" + c.HealthInterval.String() + " (" + strings.Join(c.HealthRequires, ",") + ")\n"))
 	b.Write([]byte("---\n"))
 	fmt.Fprintln(w)
 	w.Flush()
@@ -35,8 +73,12 @@ func (c Config) String() string {
 
 func NewConfig() *Config {
 	return &Config{
-		Enabled:     true,
-		BindAddress: "localhost:7777",
-		UseTls:      false,
+		Enabled:        true,
+		BindAddress:    "localhost:7777",
+		UseTls:         false,
+		ActionsFile:    DefaultActionsFile,
+		HealthInterval: toml.Duration(DefaultHealthInterval),
+		HealthTimeout:  toml.Duration(hc.DefaultHealthTimeout),
+		HealthRequires: hc.DefaultRequires,
 	}
 }
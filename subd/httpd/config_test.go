@@ -2,6 +2,7 @@ package httpd
 
 import (
 	"testing"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"gopkg.in/check.v1"
@@ -25,10 +26,14 @@ func (s *S) TestHttpdConfig_Parse(c *check.C) {
 enabled = true
 bind_address = ":8080"
 use_tls =  false
+shell_recordings = "/var/lib/megam/vertice/shell"
+shell_retention = "720h"
 `, &cm); err != nil {
 		c.Fatal(err)
 	}
 
 	c.Assert(cm.BindAddress, check.Equals, ":8080")
 	c.Assert(cm.UseTls, check.Equals, false)
+	c.Assert(cm.ShellRecordings, check.Equals, "/var/lib/megam/vertice/shell")
+	c.Assert(time.Duration(cm.ShellRetention), check.Equals, 720*time.Hour)
 }
@@ -11,6 +11,7 @@ import (
 	log "github.com/Sirupsen/logrus"
 	"github.com/codegangsta/negroni"
 	"github.com/megamsys/vertice/api"
+	"github.com/megamsys/vertice/hc"
 	"github.com/megamsys/vertice/subd/httpd/shutdown"
 	"gopkg.in/tylerb/graceful.v1"
 )
@@ -25,17 +26,40 @@ type Service struct {
 	err          chan error
 	shutdownChan chan bool
 	hlr          *negroni.Negroni
+	recordings   *api.Recordings
+	health       time.Duration
+	closing      chan struct{}
+	actions      string
+	retention    time.Duration
 }
 
-// NewService returns a new instance of Service.
-func NewService(c *Config) *Service {
+// NewService returns a new instance of Service. The actions asked over http
+// are run by the dispatcher, nil when deployd isn't enabled.
+func NewService(c *Config, d api.Dispatcher) *Service {
 	s := &Service{
-		addr:     c.BindAddress,
-		tls:      c.UseTls,
-		certFile: c.CertFile,
-		keyFile:  c.KeyFile,
-		err:      make(chan error),
-		hlr:      api.NewNegHandler(),
+		addr:      c.BindAddress,
+		tls:       c.UseTls,
+		certFile:  c.CertFile,
+		keyFile:   c.KeyFile,
+		err:       make(chan error),
+		hlr:       api.NewNegHandler(),
+		health:    time.Duration(c.HealthInterval),
+		closing:   make(chan struct{}),
+		actions:   c.ActionsFile,
+		retention: time.Duration(c.ActionRetention),
+	}
+	api.Deployer = d
+	api.Actions = api.NewActions(time.Duration(c.ActionRetention))
+	api.Consoles = api.NewConsoles(time.Duration(c.ConsoleTokenTTL), time.Duration(c.ConsoleIdle), c.ConsoleMaxViewers)
+	if c.HealthTimeout > 0 {
+		hc.Health.Timeout = time.Duration(c.HealthTimeout)
+	}
+	if c.HealthRequires != nil {
+		hc.Health.Requires = c.HealthRequires
+	}
+	if c.ShellRecordings != "" {
+		s.recordings = &api.Recordings{Dir: c.ShellRecordings, Retention: time.Duration(c.ShellRetention)}
+		api.ShellRecordings = s.recordings
 	}
 	return s
 }
@@ -43,6 +67,13 @@ func NewService(c *Config) *Service {
 // Open starts the service
 func (s *Service) Open() error {
 	log.Infof("starting httpd service")
+	if s.actions != "" {
+		acts, err := api.OpenActions(s.retention, s.actions)
+		if err != nil {
+			return err
+		}
+		api.Actions = acts
+	}
 	shutdownChan := make(chan bool)
 	shutdownTimeout := 10 * 60
 	idleTracker := newIdleTracker()
@@ -82,11 +113,24 @@ func (s *Service) Open() error {
 	s.ln = srv
 	s.shutdownChan = shutdownChan
 	go s.serve()
+	if s.health > 0 {
+		go hc.Health.Run(s.health, s.closing)
+	}
+	if s.recordings != nil && s.recordings.Retention > 0 {
+		go s.reapRecordings()
+	}
 	return nil
 }
 
 // Close closes the underlying listener.
 func (s *Service) Close() error {
+	if s.closing != nil {
+		select {
+		case <-s.closing:
+		default:
+			close(s.closing)
+		}
+	}
 	gsrv := s.ln
 	if s.ln != nil {
 		//this is not  graceful stop. and swallows the exception.
@@ -95,6 +139,24 @@ func (s *Service) Close() error {
 	return nil
 }
 
+// reapRecordings removes the shell recordings past their retention every hour.
+func (s *Service) reapRecordings() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		if n, err := s.recordings.Reap(time.Now()); err != nil {
+			log.Errorf("  shell recordings in %s : %s", s.recordings.Dir, err)
+		} else if n > 0 {
+			log.Infof("  removed %d shell recordings older than %s", n, s.recordings.Retention)
+		}
+		select {
+		case <-ticker.C:
+		case <-s.closing:
+			return
+		}
+	}
+}
+
 // Err returns a channel for fatal errors that occur on the listener.
 func (s *Service) Err() <-chan error { return s.err }
 
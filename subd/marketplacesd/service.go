@@ -9,6 +9,7 @@ import (
 	"github.com/megamsys/libgo/cmd"
 	constants "github.com/megamsys/libgo/utils"
 	"github.com/megamsys/vertice/carton"
+	"github.com/megamsys/vertice/instrument"
 	"github.com/megamsys/vertice/marketplaces"
 	"github.com/megamsys/vertice/meta"
 	"github.com/megamsys/vertice/provision"
@@ -68,6 +69,7 @@ func (s *Service) Open() error {
 
 func (s *Service) processNSQ(msg *nsq.Message) {
 	log.Debugf(TOPIC + " queue received message  :" + string(msg.Body))
+	instrument.NSQConsumed.Inc(TOPIC)
 	p, err := carton.NewPayload(msg.Body)
 	if err != nil {
 		log.Errorf("%s", err)
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/megamsys/libgo/cmd"
+	"github.com/megamsys/vertice/metrix"
 	"github.com/megamsys/vertice/toml"
 )
 
@@ -16,6 +17,12 @@ const (
 	DefaultCollectInterval = 10 * time.Minute
 	DefaultUnits           = "1024"
 	DefaultCost            = "0.1"
+
+	// DefaultLedgerDir is where the periods billed are kept.
+	DefaultLedgerDir = "/var/lib/megam/vertice/ledger"
+
+	// DefaultWarnedFile is where the warnings sent to the accounts are kept.
+	DefaultWarnedFile = "/var/lib/megam/vertice/balance_warnings.json"
 )
 
 type Config struct {
@@ -26,6 +33,17 @@ type Config struct {
 	Snapshots       *Snapshots    `json:"snapshots" toml:"snapshots"`
 	Backups         *Backups      `json:"backups" toml:"backups"`
 	Skews           *Skews        `json:"skews" toml:"skews"`
+	Ledger          *Ledger       `json:"ledger" toml:"ledger"`
+	Forecast        *Forecast     `json:"forecast" toml:"forecast"`
+	Sinks           []*Sink       `json:"sinks" toml:"sinks"`
+}
+
+// Ledger keeps the periods billed, so every collection bills the vms and
+// containers since their last charge: nothing is billed twice or lost while
+// metricsd is down. The statements of the accounts are made from it.
+type Ledger struct {
+	Enabled bool   `json:"enabled" toml:"enabled"`
+	Dir     string `json:"dir" toml:"dir"`
 }
 
 type Snapshots struct {
@@ -43,10 +61,12 @@ type Backups struct {
 type Deployd struct {
 	Enabled bool `json:"enabled" toml:"enabled"`
 	Units
+	Metering
 }
 type Dockerd struct {
 	Enabled bool `json:"enabled" toml:"enabled"`
 	Units
+	Metering
 }
 
 type Units struct {
@@ -55,6 +75,105 @@ type Units struct {
 	DiskUnit   string `json:"disk_unit" toml:"disk_unit"`
 }
 
+// Metering chooses how the assemblies are billed: "allocation" bills the flavor
+// for every interval, "usage" bills the cpus, memory, disk and network used
+// while they ran. The disk and network bytes are billed per GB when they have a cost.
+type Metering struct {
+	Mode        string `json:"metering" toml:"metering"`
+	DiskIOCost  string `json:"disk_io_cost" toml:"disk_io_cost"`
+	NetworkCost string `json:"network_cost" toml:"network_cost"`
+}
+
+func (m Metering) metering() string {
+	if m.IsUsage() {
+		return metrix.USAGE
+	}
+	return metrix.ALLOCATION
+}
+
+// IsUsage is true when the usage is billed.
+func (m Metering) IsUsage() bool {
+	return m.Mode == metrix.USAGE
+}
+
+// Forecast warns the accounts before their balance runs out at the rate their
+// running assemblies are billed, once per warning they cross. An account
+// chooses its own warnings with balance_warnings = "7d,3d,24h" in its account
+// quota, "none" for none. The warnings sent are kept in warned_file, a
+// restart doesn't send them again.
+type Forecast struct {
+	Enabled    bool            `json:"enabled" toml:"enabled"`
+	Warnings   []toml.Duration `json:"warnings" toml:"warnings"`
+	WarnedFile string          `json:"warned_file" toml:"warned_file"`
+}
+
+func (f *Forecast) warnings() []time.Duration {
+	warnings := make([]time.Duration, len(f.Warnings))
+	for i, w := range f.Warnings {
+		warnings[i] = time.Duration(w)
+	}
+	return warnings
+}
+
+// Sink is where the sensors are written besides the gateway: influxdb (its
+// write url), kafka (the url of its rest proxy and a topic), file (a path
+// rotated at max_size_mb) or remote_write (a prometheus write url). Each one
+// retries and buffers as it is told, so a sink down only loses its own batches.
+type Sink struct {
+	Type      string        `json:"type" toml:"type"`
+	URL       string        `json:"url" toml:"url"`
+	Topic     string        `json:"topic" toml:"topic"`
+	Username  string        `json:"username" toml:"username"`
+	Password  string        `json:"password" toml:"password"`
+	Timeout   toml.Duration `json:"timeout" toml:"timeout"`
+	Path      string        `json:"path" toml:"path"`
+	MaxSizeMB int64         `json:"max_size_mb" toml:"max_size_mb"`
+	MaxFiles  int           `json:"max_files" toml:"max_files"`
+	Retries   int           `json:"retries" toml:"retries"`
+	Backoff   toml.Duration `json:"backoff" toml:"backoff"`
+	Buffer    int           `json:"buffer" toml:"buffer"`
+}
+
+func (k *Sink) policy() metrix.SinkPolicy {
+	p := metrix.SinkPolicy{Retries: k.Retries, Backoff: time.Duration(k.Backoff), Buffer: k.Buffer}
+	if p.Backoff <= 0 {
+		p.Backoff = metrix.DefaultSinkBackoff
+	}
+	if p.Buffer <= 0 {
+		p.Buffer = metrix.DefaultSinkBuffer
+	}
+	return p
+}
+
+//sink makes the sink configured.
+func (k *Sink) sink() (metrix.Sink, error) {
+	switch k.Type {
+	case metrix.INFLUXDB, metrix.KAFKA, metrix.FILE, metrix.REMOTE_WRITE:
+	default:
+		return nil, fmt.Errorf("sink %q isn't one of influxdb, kafka, file or remote_write", k.Type)
+	}
+	if k.Type == metrix.FILE {
+		if k.Path == "" {
+			return nil, fmt.Errorf("sink %s : path is required", k.Type)
+		}
+		return metrix.NewFileSink(k.Path, k.MaxSizeMB<<20, k.MaxFiles), nil
+	}
+	if k.URL == "" {
+		return nil, fmt.Errorf("sink %s : url is required", k.Type)
+	}
+	timeout := time.Duration(k.Timeout)
+	switch k.Type {
+	case metrix.INFLUXDB:
+		return metrix.NewInfluxSink(k.URL, k.Username, k.Password, timeout), nil
+	case metrix.KAFKA:
+		if k.Topic == "" {
+			return nil, fmt.Errorf("sink %s : topic is required", k.Type)
+		}
+		return metrix.NewKafkaSink(k.URL, k.Topic, k.Username, k.Password, timeout), nil
+	}
+	return metrix.NewRemoteWriteSink(k.URL, k.Username, k.Password, timeout), nil
+}
+
 type Skews struct {
 	Enabled         bool          `json:"enabled" toml:"enabled"`
 	SoftGracePeriod toml.Duration `json:"soft_grace_period" toml:"soft_grace_period"`
@@ -87,6 +206,14 @@ func NewConfig() *Config {
 			HardGracePeriod: toml.Duration(120 * time.Hour),
 			HardLimit:       "-10",
 		},
+		Ledger: &Ledger{
+			Enabled: true,
+			Dir:     DefaultLedgerDir,
+		},
+		Forecast: &Forecast{
+			Enabled:    true,
+			WarnedFile: DefaultWarnedFile,
+		},
 	}
 }
 
@@ -97,6 +224,21 @@ func (c Config) String() string {
 	b.Write([]byte(cmd.Colorfy("Config:", "white", "", "bold") + "\t" + cmd.Colorfy("Metricsd", "cyan", "", "") + "\n"))
 	b.Write([]byte("enabled" + "\t" + strconv.FormatBool(c.Enabled) + "\n"))
 	b.Write([]byte("collect_interval" + "\t" + c.CollectInterval.String() + "\n"))
+	if c.Deployd != nil {
+		b.Write([]byte("vm metering" + "\t" + c.Deployd.metering() + "\n"))
+	}
+	if c.Dockerd != nil {
+		b.Write([]byte("container metering" + "\t" + c.Dockerd.metering() + "\n"))
+	}
+	if c.Ledger != nil && c.Ledger.Enabled {
+		b.Write([]byte("ledger" + "\t" + c.Ledger.Dir + "\n"))
+	}
+	if c.Forecast != nil && c.Forecast.Enabled {
+		b.Write([]byte("balance warnings" + "\t" + fmt.Sprint(c.Forecast.warnings()) + "\n"))
+	}
+	for _, k := range c.Sinks {
+		b.Write([]byte("sink" + "\t" + k.Type + " " + k.URL + k.Path + "\n"))
+	}
 	b.Write([]byte("---\n"))
 	b.Write([]byte(cmd.Colorfy("\nResource Bill Config:", "white", "", "bold") + "\n" + cmd.Colorfy("Bakups", "cyan", "", "") + "\n"))
 	b.Write([]byte("enabled      " + "\t" + strconv.FormatBool(c.Backups.Enabled) + "\n"))
@@ -4,6 +4,9 @@ import (
 	"time"
 
 	"github.com/BurntSushi/toml"
+	"github.com/megamsys/vertice/metrix"
+	"github.com/megamsys/vertice/subd/deployd"
+	"github.com/megamsys/vertice/subd/docker"
 	"gopkg.in/check.v1"
 )
 
@@ -22,3 +25,88 @@ func (s *S) TestMetrics_Parse(c *check.C) {
 	c.Assert(cm.Enabled, check.Equals, false)
 
 }
+
+func (s *S) TestMetrics_ParseMetering(c *check.C) {
+	cm := NewConfig()
+	if _, err := toml.Decode(`
+		enabled = true
+		[deployd]
+		  enabled = true
+		  cpu_unit = "1"
+		  metering = "usage"
+		  network_cost = "0.05"
+		[dockerd]
+		  enabled = true
+`, cm); err != nil {
+		c.Fatal(err)
+	}
+	c.Assert(cm.Deployd.CpuUnit, check.Equals, "1")
+	c.Assert(cm.Deployd.IsUsage(), check.Equals, true)
+	c.Assert(cm.Deployd.NetworkCost, check.Equals, "0.05")
+	c.Assert(cm.Dockerd.IsUsage(), check.Equals, false)
+
+	vms, containers := usageSources(deployd.NewConfig(), docker.NewConfig(), cm)
+	c.Assert(vms, check.FitsTypeOf, &metrix.OneUsage{})
+	c.Assert(containers, check.IsNil)
+}
+
+func (s *S) TestMetrics_ParseLedger(c *check.C) {
+	cm := NewConfig()
+	c.Assert(cm.Ledger, check.DeepEquals, &Ledger{Enabled: true, Dir: DefaultLedgerDir})
+	if _, err := toml.Decode(`
+		[ledger]
+		  enabled = true
+		  dir = "/tmp/ledger"
+`, cm); err != nil {
+		c.Fatal(err)
+	}
+	c.Assert(cm.Ledger.Dir, check.Equals, "/tmp/ledger")
+}
+
+func (s *S) TestMetrics_ParseForecast(c *check.C) {
+	cm := NewConfig()
+	c.Assert(forecaster(cm).Warnings, check.DeepEquals, metrix.DefaultWarnings)
+	c.Assert(cm.Forecast.WarnedFile, check.Equals, DefaultWarnedFile)
+	if _, err := toml.Decode(`
+		[forecast]
+		  enabled = true
+		  warnings = ["72h", "12h"]
+`, cm); err != nil {
+		c.Fatal(err)
+	}
+	c.Assert(forecaster(cm).Warnings, check.DeepEquals, []time.Duration{72 * time.Hour, 12 * time.Hour})
+	cm.Forecast.Enabled = false
+	c.Assert(forecaster(cm), check.IsNil)
+}
+
+func (s *S) TestMetrics_ParseSinks(c *check.C) {
+	cm := NewConfig()
+	if _, err := toml.Decode(`
+		[[sinks]]
+		  type = "influxdb"
+		  url = "http://localhost:8086/write?db=vertice"
+		  retries = 3
+		  backoff = "1s"
+		[[sinks]]
+		  type = "file"
+		  path = "/tmp/sensors.jsonl"
+		  max_size_mb = 10
+		[[sinks]]
+		  type = "kafka"
+		  url = "http://localhost:8082"
+`, cm); err != nil {
+		c.Fatal(err)
+	}
+	c.Assert(cm.Sinks, check.HasLen, 3)
+	c.Assert(cm.Sinks[0].policy(), check.DeepEquals, metrix.SinkPolicy{Retries: 3, Backoff: time.Second, Buffer: metrix.DefaultSinkBuffer})
+	sk, err := cm.Sinks[0].sink()
+	c.Assert(err, check.IsNil)
+	c.Assert(sk, check.FitsTypeOf, &metrix.InfluxSink{})
+	sk, err = cm.Sinks[1].sink()
+	c.Assert(err, check.IsNil)
+	c.Assert(sk.(*metrix.FileSink).MaxSize, check.Equals, int64(10<<20))
+	_, err = cm.Sinks[2].sink()
+	c.Assert(err, check.ErrorMatches, "sink kafka : topic is required")
+	_, err = (&Sink{Type: "graphite"}).sink()
+	c.Assert(err, check.NotNil)
+}
@@ -2,7 +2,9 @@ package metricsd
 
 import (
 	log "github.com/Sirupsen/logrus"
+	"github.com/megamsys/vertice/instrument"
 	"github.com/megamsys/vertice/metrix"
+	"time"
 )
 
 type Handler struct {
@@ -13,7 +15,9 @@ func NewHandler() *Handler {
 	return &Handler{}
 }
 
-func (h *Handler) processCollector(mh *metrix.MetricHandler, output *metrix.OutputHandler, c metrix.MetricCollector) error {
+func (h *Handler) processCollector(name string, mh *metrix.MetricHandler, output *metrix.OutputHandler, c metrix.MetricCollector) (err error) {
+	start := time.Now()
+	defer func() { instrument.CollectorSeconds.Since(start, name, instrument.Result(err)) }()
 	all, err := mh.Collect(c)
 	if err != nil {
 		log.Debugf("%v", err)
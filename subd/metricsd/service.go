@@ -22,6 +22,13 @@ type Service struct {
 	Dockerd *docker.Config
 	Config  *Config
 	Storage *storage.Config
+
+	//the sources of the usage, kept between the collections.
+	vmUsage        metrix.UsageSource
+	containerUsage metrix.UsageSource
+	ledger         *metrix.Ledger
+	forecaster     *metrix.Forecaster
+	sinks          []*metrix.BufferedSink
 }
 
 // NewService returns a new instance of Service.
@@ -35,15 +42,74 @@ func NewService(c *meta.Config, one *deployd.Config, doc *docker.Config, f *Conf
 		Storage: strg,
 	}
 	s.Handler = NewHandler()
+	s.vmUsage, s.containerUsage = usageSources(one, doc, f)
+	s.forecaster = forecaster(f)
 	return s
 }
 
+//usageSources are the sources of the usage of the vms and containers that
+//are billed by usage, nil for the ones billed by allocation.
+func usageSources(one *deployd.Config, doc *docker.Config, f *Config) (vms, containers metrix.UsageSource) {
+	if f.Deployd != nil && f.Deployd.IsUsage() && one != nil {
+		src := &metrix.OneUsage{Regions: make(map[string]metrix.OneEndpoint)}
+		for _, r := range one.One.Regions {
+			src.Regions[r.OneZone] = metrix.OneEndpoint{Endpoint: r.OneEndPoint, User: r.OneUserid, Password: r.OnePassword}
+		}
+		vms = src
+	}
+	if f.Dockerd != nil && f.Dockerd.IsUsage() && doc != nil {
+		src := &metrix.DockerUsage{Swarms: make(map[string]string)}
+		for _, r := range doc.Docker.Regions {
+			src.Swarms[r.DockerZone] = r.SwarmEndPoint
+		}
+		containers = src
+	}
+	return
+}
+
+//forecaster warns of the balances with the warnings configured, the default
+//ones when there are none.
+func forecaster(f *Config) *metrix.Forecaster {
+	if f.Forecast == nil || !f.Forecast.Enabled {
+		return nil
+	}
+	warnings := f.Forecast.warnings()
+	if len(warnings) == 0 {
+		warnings = metrix.DefaultWarnings
+	}
+	return metrix.NewForecaster(warnings)
+}
+
 // Open starts the service
 func (s *Service) Open() error {
 	log.Info("starting metricsd service")
 	if s.stop != nil {
 		return nil
 	}
+	sinks := make([]metrix.Sink, len(s.Config.Sinks))
+	for i, k := range s.Config.Sinks {
+		sk, err := k.sink()
+		if err != nil {
+			return err
+		}
+		sinks[i] = sk
+	}
+	if s.Config.Ledger != nil && s.Config.Ledger.Enabled {
+		l, err := metrix.OpenLedger(s.Config.Ledger.Dir)
+		if err != nil {
+			return err
+		}
+		s.ledger = l
+	}
+	if s.forecaster != nil && s.Config.Forecast.WarnedFile != "" {
+		if err := s.forecaster.Load(s.Config.Forecast.WarnedFile); err != nil {
+			return err
+		}
+	}
+	s.sinks = make([]*metrix.BufferedSink, len(sinks))
+	for i, sk := range sinks {
+		s.sinks[i] = metrix.NewBufferedSink(sk, s.Config.Sinks[i].policy())
+	}
 
 	s.stop = make(chan struct{})
 	go s.backgroundLoop()
@@ -67,6 +133,9 @@ func (s *Service) runMetricsCollectors() error {
 	output := &metrix.OutputHandler{
 		ScyllaAddress: s.Meta.Api,
 	}
+	for _, sk := range s.sinks {
+		output.Sinks = append(output.Sinks, sk)
+	}
 	skews := make(map[string]string, 0)
 	skews[constants.ENABLED] = strconv.FormatBool(s.Config.Skews.Enabled)
 	skews[constants.SOFT_LIMIT] = s.Config.Skews.SoftLimit
@@ -99,9 +168,22 @@ func (s *Service) Close() error {
 	}
 	close(s.stop)
 	s.stop = nil
+	s.closeSinks()
+	if s.ledger != nil {
+		return s.ledger.Close()
+	}
 	return nil
 }
 
+//closeSinks writes what the sinks hold and closes them.
+func (s *Service) closeSinks() {
+	for _, sk := range s.sinks {
+		if err := sk.Close(); err != nil {
+			log.Errorf("closing the sink %s : %s", sk.Name(), err)
+		}
+	}
+}
+
 // Err returns a channel for fatal errors that occur on the listener.
 func (s *Service) Err() <-chan error { return s.err }
 
@@ -109,17 +191,23 @@ func (s *Service) asmCollectors(output *metrix.OutputHandler, skews map[string]s
 	// One VirtualMachine Metrics collectors
 	collectors := map[string]metrix.MetricCollector{
 		metrix.INSTANCE: &metrix.InstanceHandler{
-			VMUnits:        map[string]string{metrix.MEMORY_UNIT: s.Config.Deployd.MemoryUnit, metrix.CPU_UNIT: s.Config.Deployd.CpuUnit, metrix.DISK_UNIT: s.Config.Deployd.DiskUnit},
-			ContainerUnits: map[string]string{metrix.MEMORY_UNIT: s.Config.Dockerd.MemoryUnit, metrix.CPU_UNIT: s.Config.Dockerd.CpuUnit, metrix.DISK_UNIT: s.Config.Dockerd.DiskUnit},
+			VMUnits: map[string]string{metrix.MEMORY_UNIT: s.Config.Deployd.MemoryUnit, metrix.CPU_UNIT: s.Config.Deployd.CpuUnit, metrix.DISK_UNIT: s.Config.Deployd.DiskUnit,
+				metrix.DISK_IO_COST: s.Config.Deployd.DiskIOCost, metrix.NETWORK_COST: s.Config.Deployd.NetworkCost},
+			ContainerUnits: map[string]string{metrix.MEMORY_UNIT: s.Config.Dockerd.MemoryUnit, metrix.CPU_UNIT: s.Config.Dockerd.CpuUnit, metrix.DISK_UNIT: s.Config.Dockerd.DiskUnit,
+				metrix.DISK_IO_COST: s.Config.Dockerd.DiskIOCost, metrix.NETWORK_COST: s.Config.Dockerd.NetworkCost},
 			SkewsActions:   skews,
 			Dockerd:        s.Config.Dockerd.Enabled,
 			Deployd:        s.Config.Deployd.Enabled,
+			VMUsage:        s.vmUsage,
+			ContainerUsage: s.containerUsage,
+			Ledger:         s.ledger,
+			Forecaster:     s.forecaster,
 		},
 	}
 	mh := &metrix.MetricHandler{}
 
-	for _, collector := range collectors {
-		go s.Handler.processCollector(mh, output, collector)
+	for name, collector := range collectors {
+		go s.Handler.processCollector(name, mh, output, collector)
 	}
 }
 
@@ -134,13 +222,14 @@ func (s *Service) storageCollectors(output *metrix.OutputHandler, skews map[stri
 					MasterKey:    s.Meta.MasterKey,
 					AccessKey:    region.AdminAccess,
 					SecretKey:    region.AdminSecret,
+					Ledger:       s.ledger,
 				},
 			}
 
 			mh := &metrix.MetricHandler{}
 
-			for _, collector := range collectors {
-				go s.Handler.processCollector(mh, output, collector)
+			for name, collector := range collectors {
+				go s.Handler.processCollector(name, mh, output, collector)
 			}
 
 		}
@@ -152,12 +241,13 @@ func (s *Service) snapshotsCollectors(output *metrix.OutputHandler, skews map[st
 	collectors := map[string]metrix.MetricCollector{
 		metrix.SNAPSHOTS: &metrix.Snapshots{
 			DefaultUnits: map[string]string{metrix.STORAGE_UNIT: s.Config.Snapshots.StorageUnit, metrix.STORAGE_COST_PER_HOUR: s.Config.Snapshots.CostPerHour},
+			Ledger:       s.ledger,
 		},
 	}
 	mh := &metrix.MetricHandler{}
 
-	for _, collector := range collectors {
-		go s.Handler.processCollector(mh, output, collector)
+	for name, collector := range collectors {
+		go s.Handler.processCollector(name, mh, output, collector)
 	}
 }
 
@@ -166,11 +256,12 @@ func (s *Service) backupsCollectors(output *metrix.OutputHandler, skews map[stri
 	collectors := map[string]metrix.MetricCollector{
 		metrix.BACKUPS: &metrix.Backups{
 			DefaultUnits: map[string]string{metrix.STORAGE_UNIT: s.Config.Backups.StorageUnit, metrix.STORAGE_COST_PER_HOUR: s.Config.Backups.CostPerHour},
+			Ledger:       s.ledger,
 		},
 	}
 	mh := &metrix.MetricHandler{}
 
-	for _, collector := range collectors {
-		go s.Handler.processCollector(mh, output, collector)
+	for name, collector := range collectors {
+		go s.Handler.processCollector(name, mh, output, collector)
 	}
 }
@@ -0,0 +1,90 @@
+package proxyd
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/megamsys/libgo/cmd"
+	"github.com/megamsys/vertice/router/proxy"
+	"github.com/megamsys/vertice/toml"
+)
+
+const (
+	// DefaultRoutesFile keeps the routes set by the pipelines.
+	DefaultRoutesFile = "/var/lib/megam/vertice/routes.json"
+
+	// DefaultDiscoverInterval is how often the containers are read from the swarms.
+	DefaultDiscoverInterval = 30 * time.Second
+
+	// DefaultReloadInterval is how often the routes file is checked for changes.
+	DefaultReloadInterval = 5 * time.Second
+)
+
+// Config is the built-in http router of the container assemblies, the
+// proxy router. Its bind addresses are the public address of the containers.
+type Config struct {
+	Enabled     bool   `toml:"enabled"`
+	BindAddress string `toml:"bind_address"`
+
+	//tls is terminated on tls_bind_address with the certificates of certs_dir
+	//(<host>.crt/.key, _.<domain>.crt/.key for a wildcard) or else cert_file/key_file.
+	TLSBindAddress string `toml:"tls_bind_address"`
+	CertsDir       string `toml:"certs_dir"`
+	CertFile       string `toml:"cert_file"`
+	KeyFile        string `toml:"key_file"`
+
+	//the routes set by the pipelines are kept in routes_file, a change of the file is
+	//read within reload_interval. backend_port is the port of the containers.
+	RoutesFile     string        `toml:"routes_file"`
+	ReloadInterval toml.Duration `toml:"reload_interval"`
+	BackendPort    int           `toml:"backend_port"`
+
+	//the running containers of the docker swarms are routed too, read every discover_interval.
+	DiscoverInterval toml.Duration `toml:"discover_interval"`
+
+	//the hosts are pointed at public_address with dns_router (eg: "route53"), when both are set.
+	PublicAddress string `toml:"public_address"`
+	DNSRouter     string `toml:"dns_router"`
+}
+
+func NewConfig() *Config {
+	port, _ := strconv.Atoi(proxy.DefaultPort)
+	return &Config{
+		Enabled:          false,
+		BindAddress:      ":80",
+		TLSBindAddress:   ":443",
+		RoutesFile:       DefaultRoutesFile,
+		ReloadInterval:   toml.Duration(DefaultReloadInterval),
+		BackendPort:      port,
+		DiscoverInterval: toml.Duration(DefaultDiscoverInterval),
+	}
+}
+
+// UseTls is true when there is a certificate to terminate tls with.
+func (c *Config) UseTls() bool {
+	return c.TLSBindAddress != "" && (c.CertsDir != "" || c.CertFile != "")
+}
+
+func (c Config) String() string {
+	w := new(tabwriter.Writer)
+	var b bytes.Buffer
+	w.Init(&b, 0, 8, 0, '\t', 0)
+	b.Write([]byte(cmd.Colorfy("Config:", "white", "", "bold") + "\t" +
+		cmd.Colorfy("Proxyd", "cyan", "", "") + "\n"))
+	b.Write([]byte("enabled     " + "\t" + strconv.FormatBool(c.Enabled) + "\n"))
+	b.Write([]byte("bind_address" + "\t" + c.BindAddress + "\n"))
+	if c.UseTls() {
+		b.Write([]byte("tls_address " + "\t" + c.TLSBindAddress + "\n"))
+	}
+	b.Write([]byte("routes_file " + "\t" + c.RoutesFile + "\n"))
+	b.Write([]byte("backend_port" + "\t" + strconv.Itoa(c.BackendPort) + "\n"))
+	b.Write([]byte("discover    " + "\t" + c.DiscoverInterval.String() + "\n"))
+	b.Write([]byte("---\n"))
+	fmt.Fprintln(w)
+	w.Flush()
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,31 @@
+package proxyd
+
+import (
+	"github.com/BurntSushi/toml"
+	"gopkg.in/check.v1"
+)
+
+// Ensure the configuration can be parsed.
+func (s *S) TestConfig_Parse(c *check.C) {
+	cm := NewConfig()
+	if _, err := toml.Decode(`
+enabled = true
+bind_address = "127.0.0.1:8080"
+certs_dir = "/var/lib/megam/vertice/certs"
+backend_port = 8000
+discover_interval = "1m"
+dns_router = "rfc2136:chennai"
+public_address = "203.0.113.10"
+`, cm); err != nil {
+		c.Fatal(err)
+	}
+	c.Assert(cm.BindAddress, check.Equals, "127.0.0.1:8080")
+	c.Assert(cm.TLSBindAddress, check.Equals, ":443")
+	c.Assert(cm.UseTls(), check.Equals, true)
+	c.Assert(cm.BackendPort, check.Equals, 8000)
+	c.Assert(cm.RoutesFile, check.Equals, DefaultRoutesFile)
+	c.Assert(cm.DiscoverInterval.String(), check.Equals, "1m0s")
+	c.Assert(cm.ReloadInterval.String(), check.Equals, "5s")
+	c.Assert(cm.DNSRouter, check.Equals, "rfc2136:chennai")
+	c.Assert(NewConfig().UseTls(), check.Equals, false)
+}
@@ -0,0 +1,78 @@
+package proxyd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	constants "github.com/megamsys/libgo/utils"
+)
+
+var client = &http.Client{Timeout: 10 * time.Second}
+
+type apiContainer struct {
+	Id              string            `json:"Id"`
+	Labels          map[string]string `json:"Labels"`
+	NetworkSettings struct {
+		Networks map[string]struct {
+			IPAddress string `json:"IPAddress"`
+		} `json:"Networks"`
+	} `json:"NetworkSettings"`
+}
+
+//ip is the address of the container on the first of its networks, by name.
+func (c *apiContainer) ip() string {
+	names := make([]string, 0, len(c.NetworkSettings.Networks))
+	for name := range c.NetworkSettings.Networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if ip := c.NetworkSettings.Networks[name].IPAddress; ip != "" {
+			return ip
+		}
+	}
+	return ""
+}
+
+// Discover reads the running containers of the assemblies on the swarms,
+// given as tcp://host:port. They are the addresses of every assembly name.
+func Discover(swarms []string) (map[string][]string, error) {
+	found := make(map[string][]string)
+	for _, swarm := range swarms {
+		cs, err := containers(swarm)
+		if err != nil {
+			return nil, err
+		}
+		for i := range cs {
+			name := cs[i].Labels[constants.ASSEMBLY_NAME]
+			if ip := cs[i].ip(); name != "" && ip != "" {
+				found[name] = append(found[name], ip)
+			}
+		}
+	}
+	return found, nil
+}
+
+func containers(swarm string) ([]apiContainer, error) {
+	filters, _ := json.Marshal(map[string][]string{"label": {constants.ASSEMBLY_NAME}})
+	u := strings.TrimRight(strings.Replace(swarm, "tcp://", "http://", 1), "/") +
+		"/containers/json?filters=" + url.QueryEscape(string(filters))
+	res, err := client.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s answered %s", swarm, res.Status)
+	}
+	var cs []apiContainer
+	if err = json.NewDecoder(res.Body).Decode(&cs); err != nil {
+		return nil, err
+	}
+	return cs, nil
+}
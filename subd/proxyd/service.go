@@ -0,0 +1,147 @@
+package proxyd
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/megamsys/vertice/router/proxy"
+)
+
+//discover reads the containers of the swarms, a seam for the tests.
+var discover = Discover
+
+// Service is the built-in http proxy of the container assemblies. It serves
+// the routes of the proxy routers and of the containers running on the swarms.
+type Service struct {
+	err     chan error
+	stop    chan struct{}
+	Config  *Config
+	Swarms  []string
+	Table   *proxy.Table
+	servers []*http.Server
+	addrs   []net.Addr
+}
+
+// NewService returns a new instance of Service, the proxy routers route
+// with its table.
+func NewService(c *Config, swarms []string) *Service {
+	t := proxy.Routes
+	t.SetFile(c.RoutesFile)
+	if c.BackendPort > 0 {
+		t.Port = strconv.Itoa(c.BackendPort)
+	}
+	t.DNSRouter = c.DNSRouter
+	t.PublicAddress = c.PublicAddress
+	return &Service{
+		err:    make(chan error),
+		Config: c,
+		Swarms: swarms,
+		Table:  t,
+	}
+}
+
+// Open starts the service
+func (s *Service) Open() error {
+	log.Info("starting proxyd service")
+	if s.stop != nil {
+		return nil
+	}
+	if err := s.Table.Load(); err != nil {
+		return err
+	}
+	handler := proxy.NewProxy(s.Table)
+	l, err := net.Listen("tcp", s.Config.BindAddress)
+	if err != nil {
+		return err
+	}
+	s.serve(&http.Server{Handler: handler}, l)
+	if s.Config.UseTls() {
+		certs := proxy.NewCerts(s.Config.CertsDir, s.Config.CertFile, s.Config.KeyFile)
+		tl, err := net.Listen("tcp", s.Config.TLSBindAddress)
+		if err != nil {
+			s.closeServers()
+			return err
+		}
+		s.serve(&http.Server{Handler: handler}, tls.NewListener(tl, &tls.Config{GetCertificate: certs.GetCertificate}))
+	}
+	s.stop = make(chan struct{})
+	go s.backgroundLoop(s.stop)
+	return nil
+}
+
+func (s *Service) serve(srv *http.Server, l net.Listener) {
+	log.Infof("proxyd listening on %s", l.Addr())
+	s.servers = append(s.servers, srv)
+	s.addrs = append(s.addrs, l.Addr())
+	go func() {
+		if err := srv.Serve(l); err != nil && err != http.ErrServerClosed {
+			log.Errorf("proxyd on %s failed : %s", l.Addr(), err)
+		}
+	}()
+}
+
+// Addrs are the addresses the proxy listens on, the tls one last.
+func (s *Service) Addrs() []net.Addr {
+	return s.addrs
+}
+
+func (s *Service) backgroundLoop(stop chan struct{}) {
+	discovered := time.Time{}
+	for {
+		if time.Since(discovered) >= time.Duration(s.Config.DiscoverInterval) {
+			s.discover()
+			discovered = time.Now()
+		}
+		if changed, err := s.Table.Reload(); err != nil {
+			log.Errorf("proxyd reload of %s failed : %s", s.Config.RoutesFile, err)
+		} else if changed {
+			log.Infof("proxyd reloaded %s", s.Config.RoutesFile)
+		}
+		select {
+		case <-stop:
+			log.Info("proxyd terminating")
+			return
+		case <-time.After(time.Duration(s.Config.ReloadInterval)):
+		}
+	}
+}
+
+//discover routes the containers running on the swarms, the ones found before
+//are kept when a swarm can't be read.
+func (s *Service) discover() {
+	if len(s.Swarms) == 0 {
+		return
+	}
+	found, err := discover(s.Swarms)
+	if err != nil {
+		log.Errorf("proxyd discovery failed : %s", err)
+		return
+	}
+	s.Table.Found(found)
+	log.Debugf("proxyd routes %d hosts", len(s.Table.Hosts()))
+}
+
+func (s *Service) closeServers() {
+	for _, srv := range s.servers {
+		srv.Close()
+	}
+	s.servers = nil
+}
+
+// Close closes the underlying listeners.
+func (s *Service) Close() error {
+	if s.stop == nil {
+		return nil
+	}
+	close(s.stop)
+	s.stop = nil
+	s.closeServers()
+	return nil
+}
+
+// Err returns a channel for fatal errors that occur in the service.
+func (s *Service) Err() <-chan error { return s.err }
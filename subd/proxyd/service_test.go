@@ -0,0 +1,89 @@
+package proxyd
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	constants "github.com/megamsys/libgo/utils"
+	"github.com/megamsys/vertice/router/proxy"
+	"github.com/megamsys/vertice/toml"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type S struct{}
+
+var _ = check.Suite(&S{})
+
+func (s *S) SetUpTest(c *check.C) {
+	proxy.Routes = proxy.NewTable("")
+	discover = Discover
+}
+
+func (s *S) TestDiscover(c *check.C) {
+	swarm := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.Check(r.URL.Path, check.Equals, "/containers/json")
+		c.Check(r.URL.Query().Get("filters"), check.Equals, `{"label":["`+constants.ASSEMBLY_NAME+`"]}`)
+		w.Write([]byte(`[
+ {"Id": "c1", "Labels": {"` + constants.ASSEMBLY_NAME + `": "myapp.megambox.com"},
+  "NetworkSettings": {"Networks": {"bridge": {"IPAddress": "172.17.0.2"}, "overlay": {"IPAddress": "10.0.9.2"}}}},
+ {"Id": "c2", "Labels": {"` + constants.ASSEMBLY_NAME + `": "myapp.megambox.com"},
+  "NetworkSettings": {"Networks": {"bridge": {"IPAddress": ""}, "overlay": {"IPAddress": "10.0.9.3"}}}},
+ {"Id": "c3", "Labels": {"` + constants.ASSEMBLY_NAME + `": "web.megambox.com"},
+  "NetworkSettings": {"Networks": {}}}
+]`))
+	}))
+	defer swarm.Close()
+	found, err := Discover([]string{strings.Replace(swarm.URL, "http://", "tcp://", 1)})
+	c.Assert(err, check.IsNil)
+	c.Assert(found, check.DeepEquals, map[string][]string{"myapp.megambox.com": {"172.17.0.2", "10.0.9.3"}})
+
+	swarm.Close()
+	_, err = Discover([]string{swarm.URL})
+	c.Assert(err, check.NotNil)
+}
+
+func (s *S) TestService(c *check.C) {
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("myapp " + r.Host))
+	}))
+	defer app.Close()
+	discover = func(swarms []string) (map[string][]string, error) {
+		c.Check(swarms, check.DeepEquals, []string{"tcp://swarm:2375"})
+		return map[string][]string{"myapp.megambox.com": {strings.TrimPrefix(app.URL, "http://")}}, nil
+	}
+	cf := NewConfig()
+	cf.BindAddress = "127.0.0.1:0"
+	cf.RoutesFile = filepath.Join(c.MkDir(), "routes.json")
+	cf.ReloadInterval = toml.Duration(10 * time.Millisecond)
+	srv := NewService(cf, []string{"tcp://swarm:2375"})
+	c.Assert(srv.Open(), check.IsNil)
+	defer srv.Close()
+	for i := 0; i < 100 && len(proxy.Routes.Hosts()) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	req, err := http.NewRequest("GET", "http://"+srv.Addrs()[0].String()+"/", nil)
+	c.Assert(err, check.IsNil)
+	req.Host = "myapp.megambox.com"
+	res, err := http.DefaultClient.Do(req)
+	c.Assert(err, check.IsNil)
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	c.Assert(res.StatusCode, check.Equals, http.StatusOK)
+	c.Assert(string(body), check.Equals, "myapp myapp.megambox.com")
+
+	//a route set by a router of another vertice is read from the file.
+	c.Assert(ioutil.WriteFile(cf.RoutesFile, []byte(`{"web.megambox.com": ["172.17.0.9"]}`), 0644), check.IsNil)
+	for i := 0; i < 100 && len(proxy.Routes.Hosts()) < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Assert(proxy.Routes.Backends("web.megambox.com"), check.DeepEquals, []string{"172.17.0.9:80"})
+}
@@ -0,0 +1,79 @@
+package retentiond
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/megamsys/libgo/cmd"
+	"github.com/megamsys/vertice/toml"
+)
+
+const (
+	// DefaultInterval is how often the retention policies are applied.
+	DefaultInterval = time.Hour
+)
+
+// Config holds the default policies for snapshots and backups. The [[retention.policy]]
+// entries override them for an account (account_id) or an assembly (asm_id), an
+// assembly policy wins over an account policy.
+type Config struct {
+	Enabled   bool          `toml:"enabled"`
+	DryRun    bool          `toml:"dry_run"`
+	Interval  toml.Duration `toml:"interval"`
+	Snapshots Policy        `toml:"snapshots"`
+	Backups   Policy        `toml:"backups"`
+	Policies  []Policy      `toml:"policy"`
+}
+
+func NewConfig() *Config {
+	return &Config{
+		Enabled:  false,
+		DryRun:   true,
+		Interval: toml.Duration(DefaultInterval),
+	}
+}
+
+// PolicyFor returns the policy of kind (snapshots or backups) for the assembly.
+func (c *Config) PolicyFor(kind, asmId, accountId string) Policy {
+	var account *Policy
+	for i, p := range c.Policies {
+		if p.Kind != "" && p.Kind != kind {
+			continue
+		}
+		if p.AssemblyId != "" && p.AssemblyId == asmId {
+			return p
+		}
+		if p.AssemblyId == "" && p.AccountId != "" && p.AccountId == accountId && account == nil {
+			account = &c.Policies[i]
+		}
+	}
+	if account != nil {
+		return *account
+	}
+	if kind == BACKUPS {
+		return c.Backups
+	}
+	return c.Snapshots
+}
+
+func (c Config) String() string {
+	w := new(tabwriter.Writer)
+	var b bytes.Buffer
+	w.Init(&b, 0, 8, 0, '\t', 0)
+	b.Write([]byte(cmd.Colorfy("Config:", "white", "", "bold") + "\t" +
+		cmd.Colorfy("Retentiond", "cyan", "", "") + "\n"))
+	b.Write([]byte("enabled  " + "\t" + strconv.FormatBool(c.Enabled) + "\n"))
+	b.Write([]byte("dry_run  " + "\t" + strconv.FormatBool(c.DryRun) + "\n"))
+	b.Write([]byte("interval " + "\t" + c.Interval.String() + "\n"))
+	b.Write([]byte("snapshots" + "\t" + c.Snapshots.String() + "\n"))
+	b.Write([]byte("backups  " + "\t" + c.Backups.String() + "\n"))
+	b.Write([]byte("policies " + "\t" + strconv.Itoa(len(c.Policies)) + "\n"))
+	b.Write([]byte("---\n"))
+	fmt.Fprintln(w)
+	w.Flush()
+	return strings.TrimSpace(b.String())
+}
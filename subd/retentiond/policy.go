@@ -0,0 +1,126 @@
+package retentiond
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	SNAPSHOTS = "snapshots"
+	BACKUPS   = "backups"
+
+	day  = 24 * time.Hour
+	week = 7 * day
+)
+
+// Policy is a retention rule for the snapshots or backups of an assembly.
+// An item is kept when it is one of the last keep_last, or the newest of one
+// of the last keep_daily days or keep_weekly weeks. When max_total_gb is set
+// the oldest kept items are expired until the total fits.
+// A policy without any keep rule keeps everything.
+type Policy struct {
+	Kind       string  `json:"kind" toml:"kind"`
+	AccountId  string  `json:"account_id" toml:"account_id"`
+	AssemblyId string  `json:"asm_id" toml:"asm_id"`
+	KeepLast   int     `json:"keep_last" toml:"keep_last"`
+	KeepDaily  int     `json:"keep_daily" toml:"keep_daily"`
+	KeepWeekly int     `json:"keep_weekly" toml:"keep_weekly"`
+	MaxTotalGB float64 `json:"max_total_gb" toml:"max_total_gb"`
+}
+
+func (p Policy) String() string {
+	return fmt.Sprintf("keep_last=%d keep_daily=%d keep_weekly=%d max_total_gb=%g",
+		p.KeepLast, p.KeepDaily, p.KeepWeekly, p.MaxTotalGB)
+}
+
+func (p Policy) hasKeepRules() bool {
+	return p.KeepLast > 0 || p.KeepDaily > 0 || p.KeepWeekly > 0
+}
+
+func (p Policy) isEmpty() bool {
+	return !p.hasKeepRules() && p.MaxTotalGB <= 0
+}
+
+// Item is a snapshot or a backup of an assembly.
+type Item struct {
+	Id         string    `json:"id"`
+	Kind       string    `json:"kind"`
+	Name       string    `json:"name"`
+	AssemblyId string    `json:"asm_id"`
+	AccountId  string    `json:"account_id"`
+	CreatedAt  time.Time `json:"created_at"`
+	SizeMB     float64   `json:"size_mb"`
+}
+
+// Expired is an item that the policy says should be deleted.
+type Expired struct {
+	Item
+	Reason string `json:"reason"`
+}
+
+// Expire returns the items of a single assembly that fall outside the policy.
+func (p Policy) Expire(items []Item, now time.Time) []Expired {
+	if p.isEmpty() || len(items) == 0 {
+		return nil
+	}
+	sorted := make([]Item, len(items))
+	copy(sorted, items)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].CreatedAt.After(sorted[j].CreatedAt) })
+
+	kept := make([]bool, len(sorted))
+	if !p.hasKeepRules() {
+		for i := range kept {
+			kept[i] = true
+		}
+	}
+	days := make(map[string]bool)
+	weeks := make(map[string]bool)
+	for i, it := range sorted {
+		if i < p.KeepLast {
+			kept[i] = true
+		}
+		age := now.Sub(it.CreatedAt)
+		if d := it.CreatedAt.Format("2006-01-02"); age < time.Duration(p.KeepDaily)*day && !days[d] {
+			days[d] = true
+			kept[i] = true
+		}
+		y, wk := it.CreatedAt.ISOWeek()
+		if w := fmt.Sprintf("%d-%d", y, wk); age < time.Duration(p.KeepWeekly)*week && !weeks[w] {
+			weeks[w] = true
+			kept[i] = true
+		}
+	}
+
+	reasons := make([]string, len(sorted))
+	total := 0.0
+	count := 0
+	for i := range sorted {
+		if kept[i] {
+			total += sorted[i].SizeMB
+			count++
+		} else {
+			reasons[i] = "outside " + p.String()
+		}
+	}
+	if p.MaxTotalGB > 0 {
+		//the newest item is always kept, even when it alone is over the limit.
+		for i := len(sorted) - 1; i >= 0 && total/1024 > p.MaxTotalGB && count > 1; i-- {
+			if !kept[i] {
+				continue
+			}
+			kept[i] = false
+			total -= sorted[i].SizeMB
+			count--
+			reasons[i] = fmt.Sprintf("over max_total_gb=%g", p.MaxTotalGB)
+		}
+	}
+
+	expired := make([]Expired, 0)
+	for i, it := range sorted {
+		if !kept[i] {
+			expired = append(expired, Expired{Item: it, Reason: reasons[i]})
+		}
+	}
+	return expired
+}
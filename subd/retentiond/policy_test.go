@@ -0,0 +1,69 @@
+package retentiond
+
+import (
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+func snaps(now time.Time, ages ...time.Duration) []Item {
+	items := make([]Item, 0)
+	for i, a := range ages {
+		items = append(items, Item{Id: string(rune('a' + i)), Kind: SNAPSHOTS, CreatedAt: now.Add(-a), SizeMB: 1024})
+	}
+	return items
+}
+
+func ids(e []Expired) []string {
+	out := make([]string, 0)
+	for _, v := range e {
+		out = append(out, v.Id)
+	}
+	return out
+}
+
+func (s *S) TestPolicyKeepLast(c *check.C) {
+	now := time.Date(2017, 3, 10, 12, 0, 0, 0, time.UTC)
+	p := Policy{KeepLast: 2}
+	e := p.Expire(snaps(now, time.Hour, 3*time.Hour, 2*time.Hour, 4*time.Hour), now)
+	c.Assert(ids(e), check.DeepEquals, []string{"b", "d"})
+}
+
+func (s *S) TestPolicyDailyAndWeekly(c *check.C) {
+	now := time.Date(2017, 3, 10, 12, 0, 0, 0, time.UTC)
+	p := Policy{KeepDaily: 7, KeepWeekly: 4}
+	items := snaps(now,
+		time.Hour,   // a: today, newest of the day
+		2*time.Hour, // b: today, older
+		2*day,       // c: 2 days ago
+		10*day,      // d: 10 days ago, newest of its week
+		11*day,      // e: same week as d
+		60*day)      // f: out of 4 weeks
+	e := p.Expire(items, now)
+	c.Assert(ids(e), check.DeepEquals, []string{"b", "e", "f"})
+}
+
+func (s *S) TestPolicyMaxTotal(c *check.C) {
+	now := time.Date(2017, 3, 10, 12, 0, 0, 0, time.UTC)
+	p := Policy{MaxTotalGB: 2}
+	e := p.Expire(snaps(now, time.Hour, 2*time.Hour, 3*time.Hour, 4*time.Hour), now)
+	c.Assert(ids(e), check.DeepEquals, []string{"c", "d"})
+}
+
+func (s *S) TestPolicyEmptyKeepsAll(c *check.C) {
+	now := time.Now()
+	c.Assert(Policy{}.Expire(snaps(now, time.Hour, day), now), check.HasLen, 0)
+}
+
+func (s *S) TestPolicyFor(c *check.C) {
+	cfg := NewConfig()
+	cfg.Snapshots = Policy{KeepLast: 5}
+	cfg.Policies = []Policy{
+		{AccountId: "info@megam.io", KeepLast: 3},
+		{Kind: SNAPSHOTS, AssemblyId: "ASM00001", KeepLast: 1},
+	}
+	c.Assert(cfg.PolicyFor(SNAPSHOTS, "ASM00001", "info@megam.io").KeepLast, check.Equals, 1)
+	c.Assert(cfg.PolicyFor(SNAPSHOTS, "ASM00002", "info@megam.io").KeepLast, check.Equals, 3)
+	c.Assert(cfg.PolicyFor(SNAPSHOTS, "ASM00003", "other@megam.io").KeepLast, check.Equals, 5)
+	c.Assert(cfg.PolicyFor(BACKUPS, "ASM00001", "other@megam.io").KeepLast, check.Equals, 0)
+}
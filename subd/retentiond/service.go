@@ -0,0 +1,193 @@
+package retentiond
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	constants "github.com/megamsys/libgo/utils"
+	"github.com/megamsys/vertice/carton"
+)
+
+var createdAtLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05-0700",
+	"2006-01-02 15:04:05.000-0700",
+	"2006-01-02 15:04:05",
+}
+
+// Dispatcher runs a request through the same path as the requests received
+// from nsq, done is called with the result once it is processed.
+type Dispatcher interface {
+	Dispatch(r *carton.Requests, done func(error)) error
+}
+
+// Service is the reaper that deletes the snapshots and backups that fall
+// outside their retention policy. In dry run it only reports them.
+type Service struct {
+	err        chan error
+	stop       chan struct{}
+	Config     *Config
+	Dispatcher Dispatcher
+}
+
+// NewService returns a new instance of Service.
+func NewService(c *Config, d Dispatcher) *Service {
+	return &Service{
+		err:        make(chan error),
+		Config:     c,
+		Dispatcher: d,
+	}
+}
+
+// Open starts the service
+func (s *Service) Open() error {
+	log.Info("starting retentiond service")
+	if s.stop != nil {
+		return nil
+	}
+	s.stop = make(chan struct{})
+	go s.backgroundLoop()
+	return nil
+}
+
+func (s *Service) backgroundLoop() {
+	for {
+		select {
+		case <-s.stop:
+			log.Info("retentiond terminating")
+			return
+		case <-time.After(time.Duration(s.Config.Interval)):
+			s.reap(time.Now())
+		}
+	}
+}
+
+// Plan returns the snapshots and backups that are expired at now.
+func (s *Service) Plan(now time.Time) ([]Expired, error) {
+	items, err := s.items()
+	if err != nil {
+		return nil, err
+	}
+	return s.expire(items, now), nil
+}
+
+func (s *Service) expire(items []Item, now time.Time) []Expired {
+	groups := make(map[string][]Item)
+	for _, it := range items {
+		k := it.Kind + "/" + it.AssemblyId
+		groups[k] = append(groups[k], it)
+	}
+	expired := make([]Expired, 0)
+	for _, g := range groups {
+		p := s.Config.PolicyFor(g[0].Kind, g[0].AssemblyId, g[0].AccountId)
+		expired = append(expired, p.Expire(g, now)...)
+	}
+	return expired
+}
+
+func (s *Service) reap(now time.Time) {
+	expired, err := s.Plan(now)
+	if err != nil {
+		log.Errorf("retention plan failed : %s", err)
+		return
+	}
+	for _, e := range expired {
+		if s.Config.DryRun {
+			log.Infof("retention dry run, would delete %s %s (%s, %s MB) of %s : %s", e.Kind, e.Id, e.Name,
+				strconv.FormatFloat(e.SizeMB, 'f', 0, 64), e.AssemblyId, e.Reason)
+			continue
+		}
+		log.Infof("retention deleting %s %s of %s : %s", e.Kind, e.Id, e.AssemblyId, e.Reason)
+		id := e.Id
+		if err := s.Dispatcher.Dispatch(e.request(), func(err error) {
+			if err != nil {
+				log.Errorf("retention delete %s failed : %s", id, err)
+			}
+		}); err != nil {
+			log.Errorf("retention delete %s failed : %s", id, err)
+		}
+	}
+	log.Infof("retention found %d expired snapshots and backups (dry run %t)", len(expired), s.Config.DryRun)
+}
+
+//the alive snapshots and the ready backups of every account.
+func (s *Service) items() ([]Item, error) {
+	items := make([]Item, 0)
+	snaps, err := new(carton.Snaps).GetBox()
+	if err != nil {
+		log.Debugf("retention snapshots : %s", err)
+	}
+	for _, sn := range snaps {
+		if !sn.IsAlive() {
+			continue
+		}
+		if it, ok := newItem(SNAPSHOTS, sn.Id, sn.Name, sn.AssemblyId, sn.AccountId, sn.CreatedAt, sn.Sizeof()); ok {
+			items = append(items, it)
+		}
+	}
+	bks, err := new(carton.Backups).GetBox()
+	if err != nil {
+		log.Debugf("retention backups : %s", err)
+	}
+	for _, bk := range bks {
+		if bk.Status != constants.IMAGE_READY {
+			continue
+		}
+		if it, ok := newItem(BACKUPS, bk.Id, bk.Name, bk.AssemblyId, bk.AccountId, bk.CreatedAt, bk.Sizeof()); ok {
+			items = append(items, it)
+		}
+	}
+	return items, nil
+}
+
+//an item whose created_at can't be parsed is never expired.
+func newItem(kind, id, name, asmId, accountId, createdAt, size string) (Item, bool) {
+	at, err := parseCreatedAt(createdAt)
+	if err != nil {
+		log.Warnf("retention skips %s %s : %s", kind, id, err)
+		return Item{}, false
+	}
+	mb, _ := strconv.ParseFloat(size, 64)
+	return Item{Id: id, Kind: kind, Name: name, AssemblyId: asmId, AccountId: accountId, CreatedAt: at, SizeMB: mb}, true
+}
+
+func parseCreatedAt(s string) (time.Time, error) {
+	for _, l := range createdAtLayouts {
+		if t, err := time.Parse(l, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unknown created_at %q", s)
+}
+
+func (e Expired) request() *carton.Requests {
+	r := &carton.Requests{
+		Id:        "retention." + e.Id,
+		Name:      e.Name,
+		CatId:     e.Id,
+		AccountId: e.AccountId,
+		Category:  carton.SNAPSHOT,
+		Action:    carton.SNAPDELETE,
+		CreatedAt: time.Now(),
+	}
+	if e.Kind == BACKUPS {
+		r.Category = carton.BACKUPS
+		r.Action = carton.IMAGEDESTROY
+	}
+	return r
+}
+
+func (s *Service) Close() error {
+	if s.stop == nil {
+		return nil
+	}
+	close(s.stop)
+	s.stop = nil
+	return nil
+}
+
+// Err returns a channel for fatal errors that occur on the listener.
+func (s *Service) Err() <-chan error { return s.err }
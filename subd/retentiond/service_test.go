@@ -0,0 +1,60 @@
+package retentiond
+
+import (
+	"testing"
+	"time"
+
+	"github.com/megamsys/vertice/carton"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type S struct {
+	service *Service
+}
+
+var _ = check.Suite(&S{})
+
+func (s *S) SetUpTest(c *check.C) {
+	cfg := NewConfig()
+	cfg.Snapshots = Policy{KeepLast: 1}
+	cfg.Policies = []Policy{{Kind: BACKUPS, AssemblyId: "ASM00002", KeepLast: 2}}
+	s.service = NewService(cfg, nil)
+}
+
+func (s *S) TestExpireGroupsByAssembly(c *check.C) {
+	now := time.Date(2017, 3, 10, 12, 0, 0, 0, time.UTC)
+	items := []Item{
+		{Id: "SNP1", Kind: SNAPSHOTS, AssemblyId: "ASM00001", CreatedAt: now.Add(-2 * time.Hour)},
+		{Id: "SNP2", Kind: SNAPSHOTS, AssemblyId: "ASM00001", CreatedAt: now.Add(-1 * time.Hour)},
+		{Id: "SNP3", Kind: SNAPSHOTS, AssemblyId: "ASM00002", CreatedAt: now.Add(-3 * time.Hour)},
+		{Id: "BAK1", Kind: BACKUPS, AssemblyId: "ASM00002", CreatedAt: now.Add(-3 * time.Hour)},
+		{Id: "BAK2", Kind: BACKUPS, AssemblyId: "ASM00002", CreatedAt: now.Add(-2 * time.Hour)},
+	}
+	expired := s.service.expire(items, now)
+	c.Assert(expired, check.HasLen, 1)
+	c.Assert(expired[0].Id, check.Equals, "SNP1")
+}
+
+func (s *S) TestExpiredRequest(c *check.C) {
+	snap := Expired{Item: Item{Id: "SNP1", Kind: SNAPSHOTS, AccountId: "info@megam.io"}}
+	r := snap.request()
+	c.Assert(r.CatId, check.Equals, "SNP1")
+	c.Assert(r.Category, check.Equals, carton.SNAPSHOT)
+	c.Assert(r.Action, check.Equals, carton.SNAPDELETE)
+	bak := Expired{Item: Item{Id: "BAK1", Kind: BACKUPS}}
+	r = bak.request()
+	c.Assert(r.Category, check.Equals, carton.BACKUPS)
+	c.Assert(r.Action, check.Equals, carton.IMAGEDESTROY)
+}
+
+func (s *S) TestParseCreatedAt(c *check.C) {
+	t, err := parseCreatedAt("2017-03-10T12:00:00Z")
+	c.Assert(err, check.IsNil)
+	c.Assert(t.Equal(time.Date(2017, 3, 10, 12, 0, 0, 0, time.UTC)), check.Equals, true)
+	_, err = parseCreatedAt("yesterday")
+	c.Assert(err, check.NotNil)
+}
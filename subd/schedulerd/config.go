@@ -0,0 +1,51 @@
+package schedulerd
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/megamsys/libgo/cmd"
+	"github.com/megamsys/vertice/toml"
+)
+
+const (
+	// DefaultFile is where the schedules of the assemblies are stored.
+	DefaultFile = "/var/lib/megam/vertice/schedules.json"
+
+	// DefaultCheckInterval is how often the schedules are checked, a minute is the
+	// smallest unit of a cron spec.
+	DefaultCheckInterval = time.Minute
+)
+
+type Config struct {
+	Enabled       bool          `toml:"enabled"`
+	File          string        `toml:"file"`
+	CheckInterval toml.Duration `toml:"check_interval"`
+}
+
+func NewConfig() *Config {
+	return &Config{
+		Enabled:       false,
+		File:          DefaultFile,
+		CheckInterval: toml.Duration(DefaultCheckInterval),
+	}
+}
+
+func (c Config) String() string {
+	w := new(tabwriter.Writer)
+	var b bytes.Buffer
+	w.Init(&b, 0, 8, 0, '\t', 0)
+	b.Write([]byte(cmd.Colorfy("Config:", "white", "", "bold") + "\t" +
+		cmd.Colorfy("Schedulerd", "cyan", "", "") + "\n"))
+	b.Write([]byte("enabled       " + "\t" + strconv.FormatBool(c.Enabled) + "\n"))
+	b.Write([]byte("file          " + "\t" + c.File + "\n"))
+	b.Write([]byte("check_interval" + "\t" + c.CheckInterval.String() + "\n"))
+	b.Write([]byte("---\n"))
+	fmt.Fprintln(w)
+	w.Flush()
+	return strings.TrimSpace(b.String())
+}
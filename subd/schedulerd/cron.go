@@ -0,0 +1,137 @@
+package schedulerd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Spec is a parsed five field cron expression: minute hour day-of-month month day-of-week.
+// Every field accepts *, lists (1,15), ranges (1-5) and steps (*/10, 0-30/5).
+type Spec struct {
+	minute, hour, dom, month, dow uint64
+	anyDom, anyDow                bool
+	expr                          string
+}
+
+type bounds struct {
+	min, max int
+}
+
+var (
+	minutes = bounds{0, 59}
+	hours   = bounds{0, 23}
+	doms    = bounds{1, 31}
+	months  = bounds{1, 12}
+	dows    = bounds{0, 6}
+)
+
+// ParseSpec parses a cron expression like "0 2 * * *" (nightly at 02:00).
+func ParseSpec(expr string) (*Spec, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron %q: expected 5 fields, found %d", expr, len(fields))
+	}
+	s := &Spec{expr: expr}
+	var err error
+	if s.minute, err = parseField(fields[0], minutes); err != nil {
+		return nil, err
+	}
+	if s.hour, err = parseField(fields[1], hours); err != nil {
+		return nil, err
+	}
+	if s.dom, err = parseField(fields[2], doms); err != nil {
+		return nil, err
+	}
+	if s.month, err = parseField(fields[3], months); err != nil {
+		return nil, err
+	}
+	if s.dow, err = parseField(fields[4], dows); err != nil {
+		return nil, err
+	}
+	s.anyDom, s.anyDow = fields[2] == "*", fields[4] == "*"
+	return s, nil
+}
+
+func (s *Spec) String() string {
+	return s.expr
+}
+
+// Next returns the first minute after t that matches the spec.
+func (s *Spec) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// five years covers every valid spec, a 31st of february never matches.
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if !has(s.month, int(t.Month())) {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !s.matchDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !has(s.hour, t.Hour()) {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if !has(s.minute, t.Minute()) {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// matchDay follows cron: when both day fields are restricted either one may match.
+func (s *Spec) matchDay(t time.Time) bool {
+	dom, dow := has(s.dom, t.Day()), has(s.dow, int(t.Weekday()))
+	if s.anyDom || s.anyDow {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+func has(set uint64, v int) bool {
+	return set&(1<<uint(v)) != 0
+}
+
+func parseField(field string, b bounds) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		lo, hi, step := b.min, b.max, 1
+		rng := part
+		if i := strings.Index(part, "/"); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("cron: bad step in %q", part)
+			}
+			step = n
+			rng = part[:i]
+		}
+		if rng != "*" {
+			ends := strings.SplitN(rng, "-", 2)
+			n, err := strconv.Atoi(ends[0])
+			if err != nil {
+				return 0, fmt.Errorf("cron: bad value in %q", part)
+			}
+			lo, hi = n, n
+			if len(ends) == 2 {
+				if hi, err = strconv.Atoi(ends[1]); err != nil {
+					return 0, fmt.Errorf("cron: bad range in %q", part)
+				}
+			} else if step > 1 {
+				hi = b.max
+			}
+		}
+		if lo < b.min || hi > b.max || lo > hi {
+			return 0, fmt.Errorf("cron: %q is out of range %d-%d", part, b.min, b.max)
+		}
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
@@ -0,0 +1,39 @@
+package schedulerd
+
+import (
+	"time"
+
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestParseSpecNightly(c *check.C) {
+	sp, err := ParseSpec("0 2 * * *")
+	c.Assert(err, check.IsNil)
+	from := time.Date(2017, 3, 10, 13, 45, 0, 0, time.UTC)
+	c.Assert(sp.Next(from), check.DeepEquals, time.Date(2017, 3, 11, 2, 0, 0, 0, time.UTC))
+}
+
+func (s *S) TestParseSpecFridayEvening(c *check.C) {
+	sp, err := ParseSpec("0 19 * * 5")
+	c.Assert(err, check.IsNil)
+	//2017-03-10 is a friday
+	from := time.Date(2017, 3, 10, 19, 0, 0, 0, time.UTC)
+	c.Assert(sp.Next(from), check.DeepEquals, time.Date(2017, 3, 17, 19, 0, 0, 0, time.UTC))
+}
+
+func (s *S) TestParseSpecStepsAndLists(c *check.C) {
+	sp, err := ParseSpec("*/15 8-10 1,15 * *")
+	c.Assert(err, check.IsNil)
+	from := time.Date(2017, 3, 1, 10, 50, 0, 0, time.UTC)
+	c.Assert(sp.Next(from), check.DeepEquals, time.Date(2017, 3, 15, 8, 0, 0, 0, time.UTC))
+	c.Assert(sp.Next(time.Date(2017, 3, 15, 8, 0, 0, 0, time.UTC)), check.DeepEquals, time.Date(2017, 3, 15, 8, 15, 0, 0, time.UTC))
+}
+
+func (s *S) TestParseSpecInvalid(c *check.C) {
+	_, err := ParseSpec("0 2 * *")
+	c.Assert(err, check.NotNil)
+	_, err = ParseSpec("61 2 * * *")
+	c.Assert(err, check.NotNil)
+	_, err = ParseSpec("0 2 * * mon")
+	c.Assert(err, check.NotNil)
+}
@@ -0,0 +1,198 @@
+package schedulerd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/megamsys/vertice/carton"
+)
+
+var (
+	ErrScheduleNotFound = errors.New("schedule not found")
+	ErrScheduleTaken    = errors.New("schedule is taken by another account")
+)
+
+const (
+	ResultDispatched = "dispatched"
+	ResultSuccess    = "success"
+	ResultFailure    = "failure"
+)
+
+// Schedule runs a carton operation (category, action) at the times matched by
+// its cron spec, eg: ("snapshot", "snapcreate") at "0 2 * * *". The CatId is
+// the assembly for a snapcreate, a snapshot record of it is added at every
+// run, and what the request operates for the others (the assemblies of a
+// control or operations).
+type Schedule struct {
+	Id         string    `json:"id"`
+	CatId      string    `json:"cat_id"`
+	AccountId  string    `json:"account_id"`
+	Category   string    `json:"category"`
+	Action     string    `json:"action"`
+	Cron       string    `json:"cron"`
+	Enabled    bool      `json:"enabled"`
+	NextRun    time.Time `json:"next_run"`
+	LastRun    time.Time `json:"last_run"`
+	LastResult string    `json:"last_result"`
+	LastError  string    `json:"last_error"`
+}
+
+// Validate checks that the id is one for a file name, that the cron spec
+// parses and that the operation is one that carton.ReqParser knows about. The disk, backup and snapshot operations
+// act on a record made before them, only a snapcreate makes its own.
+func (sc *Schedule) Validate() error {
+	if sc.Id == "" || sc.CatId == "" {
+		return fmt.Errorf("schedule needs an id and an assembly")
+	}
+	if !carton.ValidId(sc.Id) {
+		return fmt.Errorf("schedule %q : the id is made of letters, digits, '_' and '-' only", sc.Id)
+	}
+	if _, err := ParseSpec(sc.Cron); err != nil {
+		return err
+	}
+	switch {
+	case sc.Category == carton.SNAPSHOT && sc.Action != carton.SNAPCREATE,
+		sc.Category == carton.DISKS, sc.Category == carton.BACKUPS:
+		return fmt.Errorf("schedule %s : %s.%s can't be scheduled, only %s.%s of the snapshots", sc.Id, sc.Category, sc.Action, carton.SNAPSHOT, carton.SNAPCREATE)
+	}
+	_, err := carton.NewReqParser(sc.CatId).ParseRequest(sc.Category, sc.Action)
+	return err
+}
+
+// request is the synthetic request emitted for the run at t. Its id is
+// derived from the run, so the same run is never processed twice.
+func (sc *Schedule) request(t time.Time) *carton.Requests {
+	return &carton.Requests{
+		Id:        fmt.Sprintf("%s.%d", sc.Id, t.Unix()),
+		Name:      sc.Id,
+		CatId:     sc.CatId,
+		AccountId: sc.AccountId,
+		Category:  sc.Category,
+		Action:    sc.Action,
+		CreatedAt: t,
+	}
+}
+
+// Store keeps the schedules of every assembly in a json file. The file is
+// read on every access, so schedules added to it are picked up without a restart.
+type Store struct {
+	sync.Mutex
+	file string
+}
+
+func NewStore(file string) *Store {
+	return &Store{file: file}
+}
+
+// List returns all the schedules ordered by id.
+func (s *Store) List() ([]*Schedule, error) {
+	s.Lock()
+	defer s.Unlock()
+	return s.load()
+}
+
+// ForAssembly returns the schedules of the assembly catId.
+func (s *Store) ForAssembly(catId string) ([]*Schedule, error) {
+	all, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+	scs := make([]*Schedule, 0)
+	for _, sc := range all {
+		if sc.CatId == catId {
+			scs = append(scs, sc)
+		}
+	}
+	return scs, nil
+}
+
+// Put adds or replaces the schedule. A schedule of another account isn't
+// replaced, ErrScheduleTaken is returned.
+func (s *Store) Put(sc *Schedule) error {
+	if err := sc.Validate(); err != nil {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+	scs, err := s.load()
+	if err != nil {
+		return err
+	}
+	for i, old := range scs {
+		if old.Id == sc.Id {
+			if old.AccountId != sc.AccountId {
+				return ErrScheduleTaken
+			}
+			scs[i] = sc
+			return s.save(scs)
+		}
+	}
+	return s.save(append(scs, sc))
+}
+
+// Delete removes the schedule id.
+func (s *Store) Delete(id string) error {
+	s.Lock()
+	defer s.Unlock()
+	scs, err := s.load()
+	if err != nil {
+		return err
+	}
+	for i, sc := range scs {
+		if sc.Id == id {
+			return s.save(append(scs[:i], scs[i+1:]...))
+		}
+	}
+	return nil
+}
+
+// Update applies fn to the schedule id.
+func (s *Store) Update(id string, fn func(sc *Schedule)) error {
+	s.Lock()
+	defer s.Unlock()
+	scs, err := s.load()
+	if err != nil {
+		return err
+	}
+	for _, sc := range scs {
+		if sc.Id == id {
+			fn(sc)
+			return s.save(scs)
+		}
+	}
+	return ErrScheduleNotFound
+}
+
+func (s *Store) load() ([]*Schedule, error) {
+	scs := make([]*Schedule, 0)
+	b, err := ioutil.ReadFile(s.file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return scs, nil
+		}
+		return nil, err
+	}
+	if err = json.Unmarshal(b, &scs); err != nil {
+		return nil, err
+	}
+	sort.Slice(scs, func(i, j int) bool { return scs[i].Id < scs[j].Id })
+	return scs, nil
+}
+
+func (s *Store) save(scs []*Schedule) error {
+	b, err := json.MarshalIndent(scs, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.file + ".tmp"
+	if err = ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.file)
+}
@@ -0,0 +1,154 @@
+package schedulerd
+
+import (
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/megamsys/vertice/carton"
+)
+
+// Dispatcher runs a request through the same path as the requests received
+// from nsq, done is called with the result once it is processed.
+type Dispatcher interface {
+	Dispatch(r *carton.Requests, done func(error)) error
+}
+
+//snapOf adds the snapshot record a scheduled snapcreate fills in, replaced in tests.
+var snapOf = func(sc *Schedule) (string, error) {
+	a, err := carton.NewAssembly(sc.CatId, sc.AccountId, "")
+	if err != nil {
+		return "", err
+	}
+	snp, err := carton.NewSnapOf(a, sc.Id)
+	if err != nil {
+		return "", err
+	}
+	return snp.Id, nil
+}
+
+// Service emits the requests of the schedules that are due.
+type Service struct {
+	err        chan error
+	stop       chan struct{}
+	Config     *Config
+	Store      *Store
+	Dispatcher Dispatcher
+}
+
+// NewService returns a new instance of Service.
+func NewService(c *Config, d Dispatcher) *Service {
+	return &Service{
+		err:        make(chan error),
+		Config:     c,
+		Store:      NewStore(c.File),
+		Dispatcher: d,
+	}
+}
+
+// Open starts the service
+func (s *Service) Open() error {
+	log.Info("starting schedulerd service")
+	if s.stop != nil {
+		return nil
+	}
+	s.stop = make(chan struct{})
+	go s.backgroundLoop()
+	return nil
+}
+
+func (s *Service) backgroundLoop() {
+	for {
+		select {
+		case <-s.stop:
+			log.Info("schedulerd terminating")
+			return
+		case <-time.After(time.Duration(s.Config.CheckInterval)):
+			s.runDue(time.Now())
+		}
+	}
+}
+
+// runDue dispatches every enabled schedule whose next run is not after now.
+// A run missed while vertice was down is dispatched once, on the first check.
+func (s *Service) runDue(now time.Time) {
+	scs, err := s.Store.List()
+	if err != nil {
+		log.Errorf("unable to read schedules : %s", err)
+		return
+	}
+	for _, sc := range scs {
+		if !sc.Enabled {
+			continue
+		}
+		spec, err := ParseSpec(sc.Cron)
+		if err != nil {
+			s.record(sc.Id, err)
+			continue
+		}
+		if sc.NextRun.IsZero() {
+			next := spec.Next(now)
+			s.update(sc.Id, func(x *Schedule) { x.NextRun = next })
+			continue
+		}
+		if now.Before(sc.NextRun) {
+			continue
+		}
+		s.run(sc, spec.Next(now))
+	}
+}
+
+func (s *Service) run(sc *Schedule, next time.Time) {
+	r := sc.request(sc.NextRun)
+	log.Infof("schedule %s due, %s.%s on %s", sc.Id, sc.Category, sc.Action, sc.CatId)
+	at := sc.NextRun
+	s.update(sc.Id, func(x *Schedule) {
+		x.LastRun = at
+		x.NextRun = next
+		x.LastResult = ResultDispatched
+		x.LastError = ""
+	})
+	id := sc.Id
+	if sc.Category == carton.SNAPSHOT {
+		snp, err := snapOf(sc)
+		if err != nil {
+			s.record(id, err)
+			return
+		}
+		r.CatId = snp
+	}
+	if err := s.Dispatcher.Dispatch(r, func(err error) { s.record(id, err) }); err != nil {
+		s.record(id, err)
+	}
+}
+
+// record stores the result of the last run of the schedule id.
+func (s *Service) record(id string, err error) {
+	s.update(id, func(x *Schedule) {
+		if err != nil {
+			log.Errorf("schedule %s failed : %s", id, err)
+			x.LastResult = ResultFailure
+			x.LastError = err.Error()
+			return
+		}
+		x.LastResult = ResultSuccess
+		x.LastError = ""
+	})
+}
+
+func (s *Service) update(id string, fn func(x *Schedule)) {
+	if err := s.Store.Update(id, fn); err != nil {
+		log.Errorf("unable to update schedule %s : %s", id, err)
+	}
+}
+
+func (s *Service) Close() error {
+	if s.stop == nil {
+		return nil
+	}
+	close(s.stop)
+	s.stop = nil
+	return nil
+}
+
+// Err returns a channel for fatal errors that occur on the listener.
+func (s *Service) Err() <-chan error { return s.err }
@@ -0,0 +1,130 @@
+package schedulerd
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/megamsys/vertice/carton"
+	"gopkg.in/check.v1"
+)
+
+func Test(t *testing.T) {
+	check.TestingT(t)
+}
+
+type S struct {
+	service    *Service
+	dispatcher *fakeDispatcher
+}
+
+var _ = check.Suite(&S{})
+
+type fakeDispatcher struct {
+	sync.Mutex
+	requests []*carton.Requests
+	result   error
+}
+
+func (f *fakeDispatcher) Dispatch(r *carton.Requests, done func(error)) error {
+	f.Lock()
+	f.requests = append(f.requests, r)
+	f.Unlock()
+	done(f.result)
+	return nil
+}
+
+func (s *S) SetUpTest(c *check.C) {
+	s.dispatcher = &fakeDispatcher{}
+	cfg := NewConfig()
+	cfg.File = filepath.Join(c.MkDir(), "schedules.json")
+	s.service = NewService(cfg, s.dispatcher)
+	snapOf = func(sc *Schedule) (string, error) {
+		if sc.CatId == "ASM00404" {
+			return "", errors.New("assembly ASM00404 not found")
+		}
+		return "SNP" + sc.CatId, nil
+	}
+}
+
+func (s *S) TestRunDueDispatchesAndRecords(c *check.C) {
+	sc := &Schedule{Id: "nightly", CatId: "ASM00001", AccountId: "info@megam.io",
+		Category: carton.SNAPSHOT, Action: carton.SNAPCREATE, Cron: "0 2 * * *", Enabled: true}
+	c.Assert(s.service.Store.Put(sc), check.IsNil)
+	now := time.Date(2017, 3, 10, 13, 45, 0, 0, time.UTC)
+	s.service.runDue(now)
+	c.Assert(s.dispatcher.requests, check.HasLen, 0)
+	scs, err := s.service.Store.List()
+	c.Assert(err, check.IsNil)
+	c.Assert(scs[0].NextRun, check.DeepEquals, time.Date(2017, 3, 11, 2, 0, 0, 0, time.UTC))
+
+	s.service.runDue(time.Date(2017, 3, 11, 2, 0, 30, 0, time.UTC))
+	c.Assert(s.dispatcher.requests, check.HasLen, 1)
+	r := s.dispatcher.requests[0]
+	c.Assert(r.CatId, check.Equals, "SNPASM00001")
+	c.Assert(r.Category, check.Equals, carton.SNAPSHOT)
+	c.Assert(r.Action, check.Equals, carton.SNAPCREATE)
+	scs, err = s.service.Store.ForAssembly("ASM00001")
+	c.Assert(err, check.IsNil)
+	c.Assert(scs[0].LastResult, check.Equals, ResultSuccess)
+	c.Assert(scs[0].LastRun, check.DeepEquals, time.Date(2017, 3, 11, 2, 0, 0, 0, time.UTC))
+	c.Assert(scs[0].NextRun, check.DeepEquals, time.Date(2017, 3, 12, 2, 0, 0, 0, time.UTC))
+}
+
+func (s *S) TestRunDueRecordsFailure(c *check.C) {
+	s.dispatcher.result = errors.New("box is busy")
+	sc := &Schedule{Id: "friday-stop", CatId: "ASM00002", Category: carton.CONTROL, Action: carton.STOP,
+		Cron: "0 19 * * 5", Enabled: true, NextRun: time.Date(2017, 3, 10, 19, 0, 0, 0, time.UTC)}
+	c.Assert(s.service.Store.Put(sc), check.IsNil)
+	s.service.runDue(time.Date(2017, 3, 10, 19, 0, 10, 0, time.UTC))
+	scs, err := s.service.Store.List()
+	c.Assert(err, check.IsNil)
+	c.Assert(scs[0].LastResult, check.Equals, ResultFailure)
+	c.Assert(scs[0].LastError, check.Equals, "box is busy")
+}
+
+func (s *S) TestPutRejectsUnknownAction(c *check.C) {
+	sc := &Schedule{Id: "bad", CatId: "ASM00003", Category: carton.CONTROL, Action: "explode", Cron: "0 2 * * *"}
+	c.Assert(s.service.Store.Put(sc), check.NotNil)
+}
+
+func (s *S) TestRunDueRecordsSnapshotFailure(c *check.C) {
+	sc := &Schedule{Id: "gone", CatId: "ASM00404", Category: carton.SNAPSHOT, Action: carton.SNAPCREATE,
+		Cron: "0 2 * * *", Enabled: true, NextRun: time.Date(2017, 3, 11, 2, 0, 0, 0, time.UTC)}
+	c.Assert(s.service.Store.Put(sc), check.IsNil)
+	s.service.runDue(time.Date(2017, 3, 11, 2, 0, 30, 0, time.UTC))
+	c.Assert(s.dispatcher.requests, check.HasLen, 0)
+	scs, err := s.service.Store.List()
+	c.Assert(err, check.IsNil)
+	c.Assert(scs[0].LastResult, check.Equals, ResultFailure)
+	c.Assert(scs[0].LastError, check.Equals, "assembly ASM00404 not found")
+	c.Assert(scs[0].NextRun, check.DeepEquals, time.Date(2017, 3, 12, 2, 0, 0, 0, time.UTC))
+}
+
+func (s *S) TestPutRejectsOperationsOnRecords(c *check.C) {
+	for _, ca := range [][]string{{carton.SNAPSHOT, carton.SNAPDELETE}, {carton.BACKUPS, carton.IMAGECREATE}} {
+		sc := &Schedule{Id: "bad", CatId: "ASM00003", Category: ca[0], Action: ca[1], Cron: "0 2 * * *"}
+		c.Assert(s.service.Store.Put(sc), check.ErrorMatches, "schedule bad : .* can't be scheduled, .*")
+	}
+}
+
+func (s *S) TestPutRejectsIdsOutOfFileNames(c *check.C) {
+	for _, id := range []string{"../journal/x", "a/b", "a b", "."} {
+		sc := &Schedule{Id: id, CatId: "ASM00003", Category: carton.CONTROL, Action: carton.STOP, Cron: "0 2 * * *"}
+		c.Assert(s.service.Store.Put(sc), check.ErrorMatches, "schedule .* : the id is made of .*")
+	}
+}
+
+func (s *S) TestPutKeepsScheduleOfAnotherAccount(c *check.C) {
+	sc := &Schedule{Id: "nightly", CatId: "ASM00003", AccountId: "info@megam.io", Category: carton.CONTROL, Action: carton.STOP, Cron: "0 2 * * *"}
+	c.Assert(s.service.Store.Put(sc), check.IsNil)
+	other := *sc
+	other.AccountId, other.CatId = "other@megam.io", "ASM00004"
+	c.Assert(s.service.Store.Put(&other), check.Equals, ErrScheduleTaken)
+	scs, err := s.service.Store.List()
+	c.Assert(err, check.IsNil)
+	c.Assert(scs, check.HasLen, 1)
+	c.Assert(scs[0].AccountId, check.Equals, "info@megam.io")
+}